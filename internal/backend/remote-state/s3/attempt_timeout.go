@@ -0,0 +1,46 @@
+package s3
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// attemptTimerKey is the context key of the timer abandoning an attempt of a
+// request, for attempt_timeout.
+type attemptTimerKey struct{}
+
+// attemptTimeoutHandlers returns the handlers which abandon each attempt of a
+// request that gets no response within timeout, so that the retryer retries
+// it rather than one slow attempt using up the whole operation.
+//
+// The timeout ends once the response is received and unmarshaled, so unlike
+// http_request_timeout, it doesn't cover streaming the body of the state
+// which is read after the request completes.
+func attemptTimeoutHandlers(timeout time.Duration) (send, completeAttempt request.NamedHandler) {
+	send = request.NamedHandler{
+		Name: "tofu.s3.AttemptTimeout",
+		Fn: func(r *request.Request) {
+			ctx, cancel := context.WithCancel(r.Context())
+			timer := time.AfterFunc(timeout, cancel)
+			ctx = context.WithValue(ctx, attemptTimerKey{}, timer)
+			r.HTTPRequest = r.HTTPRequest.WithContext(ctx)
+		},
+	}
+	completeAttempt = request.NamedHandler{
+		Name: "tofu.s3.AttemptTimeoutStop",
+		Fn: func(r *request.Request) {
+			timer, ok := r.HTTPRequest.Context().Value(attemptTimerKey{}).(*time.Timer)
+			if !ok {
+				return
+			}
+			timer.Stop()
+			// The next attempt is signed with the context of the request,
+			// which must not be that of an abandoned attempt. A response
+			// being read keeps the context of its attempt.
+			r.HTTPRequest = r.HTTPRequest.WithContext(r.Context())
+		},
+	}
+	return send, completeAttempt
+}
@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+)
+
+func TestBackendConfig_AttemptTimeout(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	var requests atomic.Int64
+	storage := newMockS3Storage()
+	storage.objects["bucket/key"] = &mockS3Object{body: []byte(`{"version": 4}`), header: http.Header{}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt is too slow, and is abandoned.
+		if requests.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+			return
+		}
+		storage.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	b, diags := configureBackend(t, map[string]any{
+		"access_key":                  awsbase.MockStaticAccessKey,
+		"secret_key":                  awsbase.MockStaticSecretKey,
+		"bucket":                      "bucket",
+		"key":                         "key",
+		"region":                      "us-west-2",
+		"endpoint":                    ts.URL,
+		"force_path_style":            true,
+		"attempt_timeout":             1,
+		"skip_credentials_validation": true,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+	}
+
+	for name, c := range map[string]*client.Client{"S3": b.s3Client.Client, "DynamoDB": b.dynClient.Client} {
+		handlers := c.Handlers.Copy()
+		handlers.Send.RemoveByName("tofu.s3.AttemptTimeout")
+		if handlers.Send.Len() != c.Handlers.Send.Len()-1 {
+			t.Errorf("expected the %s client to time out attempts", name)
+		}
+	}
+
+	client, err := b.remoteClient("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	start := time.Now()
+	payload, err := client.Get()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(payload.Data) != `{"version": 4}` {
+		t.Fatalf("unexpected state: %s", payload.Data)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("expected the slow attempt to be retried, got %d requests", got)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the slow attempt to be abandoned after 1 second, took %s", elapsed)
+	}
+}
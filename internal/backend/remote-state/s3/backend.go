@@ -6,13 +6,23 @@ package s3
 import (
 	"encoding/base64"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	awsbase "github.com/hashicorp/aws-sdk-go-base"
+	"github.com/mitchellh/go-homedir"
 	"github.com/opentofu/opentofu/internal/backend"
 	"github.com/opentofu/opentofu/internal/configs/configschema"
 	"github.com/opentofu/opentofu/internal/httpclient"
@@ -21,24 +31,126 @@ import (
 	"github.com/opentofu/opentofu/version"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/gocty"
+	"golang.org/x/exp/slices"
 )
 
-func New() backend.Backend {
-	return &Backend{}
+func New(opts ...Option) backend.Backend {
+	b := &Backend{}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Option customizes a Backend created with New, for programs embedding the
+// backend.
+type Option func(*Backend)
+
+// WithHTTPClient makes the backend send its S3, DynamoDB and KMS requests with
+// the given HTTP client, such as one served by an httptest server or with a
+// custom transport, instead of the client it creates itself. The client's
+// transport is used as it is, so min_tls_version doesn't apply to it. The
+// requests made while resolving credentials aren't affected.
+func WithHTTPClient(client *http.Client) Option {
+	return func(b *Backend) {
+		b.httpClient = client
+	}
 }
 
 type Backend struct {
 	s3Client  *s3.S3
 	dynClient *dynamodb.DynamoDB
+	kmsClient *kms.KMS
+
+	// s3ReadClient reads the state from read_endpoint, if it differs from
+	// the endpoint of s3Client.
+	s3ReadClient *s3.S3
+
+	// s3Session is the session s3Client was created from, to create clients
+	// for the buckets in workspace_buckets which are in another region.
+	// bucketClients caches the client for each of those buckets.
+	s3Session       *session.Session
+	bucketClientsMu sync.Mutex
+	bucketClients   map[string]*s3.S3
+
+	// httpClient is the HTTP client set with WithHTTPClient, if any.
+	httpClient *http.Client
+
+	// locker is the StateLocker set with WithStateLocker, if any.
+	locker StateLocker
+
+	// postWriteHook is the hook set with WithPostWriteHook, if any.
+	postWriteHook PostWriteHook
 
 	bucketName            string
+	workspaceBuckets      map[string]string
 	keyName               string
 	serverSideEncryption  bool
 	customerEncryptionKey []byte
 	acl                   string
+	workspaceACLs         map[string]string
+	grants                *objectGrants
 	kmsKeyID              string
 	ddbTable              string
 	workspaceKeyPrefix    string
+	keyCase               string
+	unifyWorkspacePaths   bool
+	compress              bool
+	shardedState          bool
+	writeInitMarker       bool
+	logReplicationStatus  bool
+	keepBackup            bool
+	sendContentMD5        bool
+	allowEmptyState       bool
+	tagSerialAndLineage   bool
+	autoTagWorkspace      bool
+	idempotencyToken      bool
+	verifyWriteChecksum   bool
+
+	clientSideEncryptionKMSKeyID string
+
+	lockRetryMaxAttempts int
+	lockRetryWait        time.Duration
+	lockInitialJitter    time.Duration
+	lockMaxAge           time.Duration
+	malformedLockAction  string
+	lockMetadataEnv      []string
+	checkSerial          bool
+
+	// eventualLockReads is set when lock_consistent_read is false.
+	eventualLockReads bool
+
+	readCacheTTL time.Duration
+
+	skipWorkspaceListing bool
+	workspaceIndexKey    string
+
+	newStateReadRetries int
+	downloadPartSize    int64
+	maxResponseBytes    int64
+	downloadConcurrency int
+	verifyDelete        bool
+	cleanupUploads      bool
+
+	stateGrowthWarnRatio float64
+
+	objectExpires *objectExpires
+
+	contentDisposition string
+
+	keyIsPointer     bool
+	pointerTargetKey string
+
+	// localMirrorPath is the directory the state is read from instead of
+	// S3, if set.
+	localMirrorPath  string
+	localMirrorWrite bool
+
+	// config is the configuration as it was prepared, before any credentials
+	// were resolved, and awsConfig is the AWS configuration the clients were
+	// created with. They're kept to report the resolved configuration.
+	config    cty.Value
+	awsConfig *awsbase.Config
 }
 
 // ConfigSchema returns a description of the expected configuration
@@ -51,6 +163,32 @@ func (b *Backend) ConfigSchema() *configschema.Block {
 				Required:    true,
 				Description: "The name of the S3 bucket",
 			},
+			"allowed_buckets": {
+				Type:        cty.Set(cty.String),
+				Optional:    true,
+				Description: "List of allowed S3 bucket names, to prevent a misconfigured bucket from being used",
+			},
+			"skip_bucket_name_validation": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Skip the validation of bucket names against the S3 bucket naming rules, for S3-compatible stores with laxer rules.",
+			},
+
+			"skip_workspace_listing": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Find workspaces without listing the bucket, for roles which can't list it. Only the default workspace and the workspaces in workspace_buckets are found.",
+			},
+			"workspace_buckets": {
+				Type:        cty.Map(cty.String),
+				Optional:    true,
+				Description: "Map of workspace names to the S3 buckets holding their state. Workspaces not listed use the bucket set by bucket.",
+			},
+			"workspace_index_key": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: "The path of an object in the bucket holding the list of workspaces, which is kept up to date when workspaces are created or deleted and read instead of listing the bucket.",
+			},
 			"key": {
 				Type:        cty.String,
 				Required:    true,
@@ -66,11 +204,36 @@ func (b *Backend) ConfigSchema() *configschema.Block {
 				Optional:    true,
 				Description: "A custom endpoint for the DynamoDB API",
 			},
+			"dynamodb_region": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: "AWS region of the DynamoDB Table, if it differs from the region of the S3 Bucket.",
+			},
 			"endpoint": {
 				Type:        cty.String,
 				Optional:    true,
 				Description: "A custom endpoint for the S3 API",
 			},
+			"read_endpoint": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: "A custom endpoint for the S3 API used to read the state, instead of endpoint",
+			},
+			"write_endpoint": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: "A custom endpoint for the S3 API used for all requests other than reading the state, instead of endpoint",
+			},
+			"signing_name": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: "The service name used to sign S3 requests to a custom endpoint",
+			},
+			"signing_region": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: "The region used to sign S3 requests to a custom endpoint",
+			},
 			"iam_endpoint": {
 				Type:        cty.String,
 				Optional:    true,
@@ -81,6 +244,11 @@ func (b *Backend) ConfigSchema() *configschema.Block {
 				Optional:    true,
 				Description: "A custom endpoint for the STS API",
 			},
+			"sso_endpoint": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: "A custom endpoint for the SSO portal, used to resolve the credentials of an SSO profile",
+			},
 			"encrypt": {
 				Type:        cty.Bool,
 				Optional:    true,
@@ -91,6 +259,66 @@ func (b *Backend) ConfigSchema() *configschema.Block {
 				Optional:    true,
 				Description: "Canned ACL to be applied to the state file",
 			},
+			"workspace_acls": {
+				Type:        cty.Map(cty.String),
+				Optional:    true,
+				Description: "Map of workspace names to the canned ACLs applied to their state files. Workspaces not listed use the ACL set by acl.",
+			},
+			"write_init_marker": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Whether to write an object recording when and by whom a new state was first initialized.",
+			},
+			"keep_backup": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Whether to keep a backup of the previous state next to the state file, to recover from a corrupt state.",
+			},
+			"send_content_md5": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Whether to send the Content-MD5 header when writing the state file, for bucket policies which require it.",
+			},
+			"allow_empty_state": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Whether to allow writing an empty state file, which is refused by default to protect against replacing the state by mistake.",
+			},
+			"tag_serial_and_lineage": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Whether to tag the state file with its serial and lineage, which can be read without the key of state encrypted with a customer-provided key.",
+			},
+			"auto_tag_workspace": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Whether to tag the state file with the name of its workspace, such as for cost allocation by workspace.",
+			},
+			"idempotency_token": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Whether to attach an idempotency token derived from the checksum of the state to each write, so that duplicate writes from retried requests can be recognized.",
+			},
+			"verify_write_checksum": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Whether to verify the SHA-256 checksum of the state object after each write, to detect state corrupted in transit.",
+			},
+			"log_replication_status": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Whether to log the replication status of the state file after each write.",
+			},
+			"sharded_state": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Experimental: split the state across several objects, referenced by a manifest in place of the state, so that only the changed parts of large states are uploaded.",
+			},
+			"compress": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Whether to gzip-compress the state file. Compressed and uncompressed state can always be read.",
+			},
 			"access_key": {
 				Type:        cty.String,
 				Optional:    true,
@@ -100,17 +328,28 @@ func (b *Backend) ConfigSchema() *configschema.Block {
 				Type:        cty.String,
 				Optional:    true,
 				Description: "AWS secret key",
+				Sensitive:   true,
 			},
 			"kms_key_id": {
 				Type:        cty.String,
 				Optional:    true,
 				Description: "The ARN of a KMS Key to use for encrypting the state",
 			},
+			"client_side_encryption_kms_key_id": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: "The ARN of a KMS Key to use for encrypting the state locally before it is uploaded",
+			},
 			"dynamodb_table": {
 				Type:        cty.String,
 				Optional:    true,
 				Description: "DynamoDB table for state locking and consistency",
 			},
+			"dynamodb_table_missing_action": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: `What to do when the DynamoDB table does not exist: "error", "warn" or "create". Defaults to "error".`,
+			},
 			"profile": {
 				Type:        cty.String,
 				Optional:    true,
@@ -121,10 +360,26 @@ func (b *Backend) ConfigSchema() *configschema.Block {
 				Optional:    true,
 				Description: "Path to a shared credentials file",
 			},
+			"credentials_source_priority": {
+				Type:        cty.List(cty.String),
+				Optional:    true,
+				Description: `The sources to resolve credentials from, in the order they are tried: "static", "assume_role", "profile", "env", "ecs" and "ec2".`,
+			},
+			"warn_on_multiple_credential_sources": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Whether to warn when credentials are available from more than one source, stating which one is used. Defaults to true.",
+			},
 			"token": {
 				Type:        cty.String,
 				Optional:    true,
 				Description: "MFA token",
+				Sensitive:   true,
+			},
+			"log_caller_identity": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Report the identity the backend's requests are made as when it's configured.",
 			},
 			"skip_credentials_validation": {
 				Type:        cty.Bool,
@@ -136,6 +391,11 @@ func (b *Backend) ConfigSchema() *configschema.Block {
 				Optional:    true,
 				Description: "Skip the AWS Metadata API check.",
 			},
+			"forbid_imds": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Never use the EC2 instance metadata service, and fail any request to it. Implies skip_metadata_api_check.",
+			},
 			"skip_region_validation": {
 				Type:        cty.Bool,
 				Optional:    true,
@@ -147,6 +407,11 @@ func (b *Backend) ConfigSchema() *configschema.Block {
 				Description: "The base64-encoded encryption key to use for server-side encryption with customer-provided keys (SSE-C).",
 				Sensitive:   true,
 			},
+			"sse_customer_key_file": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: "Path to a file holding the base64-encoded encryption key to use for server-side encryption with customer-provided keys (SSE-C).",
+			},
 			"role_arn": {
 				Type:        cty.String,
 				Optional:    true,
@@ -161,6 +426,7 @@ func (b *Backend) ConfigSchema() *configschema.Block {
 				Type:        cty.String,
 				Optional:    true,
 				Description: "The external ID to use when assuming the role",
+				Sensitive:   true,
 			},
 
 			"assume_role_duration_seconds": {
@@ -199,93 +465,1170 @@ func (b *Backend) ConfigSchema() *configschema.Block {
 				Description: "The prefix applied to the non-default state path inside the bucket.",
 			},
 
+			"unify_workspace_paths": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Store the state of the default workspace under the workspace_key_prefix, like every other workspace.",
+			},
+
+			"key_case": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: `Normalize the case of state object keys for case-insensitive stores. Valid values are "lower" and "upper".`,
+			},
+
+			"key_env_allowlist": {
+				Type:        cty.Set(cty.String),
+				Optional:    true,
+				Description: "The names of environment variables which can be referenced in the key as ${env.NAME}.",
+			},
+
+			"require_key_suffix": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: `The suffix the key must end with, such as ".tfstate".`,
+			},
+
 			"force_path_style": {
 				Type:        cty.Bool,
 				Optional:    true,
 				Description: "Force s3 to use path style api.",
 			},
 
+			"s3_compatible": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Apply the settings known to work with S3-compatible stores such as MinIO, unless they are set explicitly.",
+			},
+
+			"require_https": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Reject any custom endpoint that does not use HTTPS.",
+			},
+
+			"custom_headers": {
+				Type:        cty.Map(cty.String),
+				Optional:    true,
+				Description: "Additional HTTP headers to send with every S3 and DynamoDB request.",
+			},
+
+			"require_versioning": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Fail if versioning is not enabled on the S3 bucket.",
+			},
+
+			"require_bucket_encryption": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Fail if default encryption is not configured on the S3 bucket.",
+			},
+
+			"use_dualstack_endpoint": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Resolve the S3 endpoint to a dual-stack endpoint, which supports both IPv4 and IPv6.",
+			},
+
 			"max_retries": {
 				Type:        cty.Number,
 				Optional:    true,
 				Description: "The maximum number of times an AWS API request is retried on retryable failure.",
 			},
-		},
+
+			"fail_fast_on_expired_credentials": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Fail requests rejected because the credentials expired immediately, instead of retrying them.",
+			},
+
+			"credential_cache_ttl": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The number of seconds for which the resolved credentials are reused when the backend is configured again with the same settings.",
+			},
+
+			"read_cache_ttl": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The number of seconds for which a state read is cached, and only downloaded again if its ETag changed.",
+			},
+
+			"http_request_timeout": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The timeout in seconds of each HTTP request to AWS, after which the request is retried.",
+			},
+			"connect_timeout": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The timeout in seconds of establishing a connection to AWS, separate from http_request_timeout.",
+			},
+
+			"min_tls_version": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: `The minimum TLS version of the connections to AWS: "1.2" or "1.3". Defaults to "1.2".`,
+			},
+
+			"follow_redirects": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Follow HTTP redirects from gateways in front of S3-compatible stores, signing the redirected requests again.",
+			},
+
+			"max_redirects": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The maximum number of redirects followed for each request when follow_redirects is set. Defaults to 5.",
+			},
+
+			"max_retry_delay": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The maximum number of seconds to wait between two retries of an AWS API request.",
+			},
+
+			"attempt_timeout": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The timeout in seconds of each attempt of an AWS API request to get a response, after which the attempt is abandoned and retried.",
+			},
+
+			"retry_budget": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The number of retries of AWS API requests shared by all operations of the process.",
+			},
+
+			"retry_on": {
+				Type:        cty.Set(cty.String),
+				Optional:    true,
+				Description: `The classes of errors to retry AWS API requests on: "5xx", "throttling" and "timeout". Defaults to all errors the AWS SDK considers retryable.`,
+			},
+
+			"lock_retry_max_attempts": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The maximum number of times a DynamoDB locking request is retried when it is throttled or fails with a transient error.",
+			},
+
+			"lock_retry_wait_seconds": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The number of seconds to wait before the first lock retry. The wait doubles with each subsequent retry.",
+			},
+
+			"lock_initial_jitter": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The maximum number of seconds to wait, for a random time, before the first attempt to acquire the lock, to spread out processes starting at once.",
+			},
+
+			"lock_max_age": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The age in seconds after which a lock held by another process is considered stale and overridden.",
+			},
+
+			"lock_consistent_read": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Read the lock item from the DynamoDB table with strongly consistent reads, so that a lock just acquired or released is never read stale. Defaults to true.",
+			},
+
+			"malformed_lock_action": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: `What to do when the lock item in the DynamoDB table can't be parsed: "error" or "takeover". Defaults to "error".`,
+			},
+
+			"require_locking": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Refuse to operate without a locking mechanism, rather than silently disabling state locking when dynamodb_table is not set.",
+			},
+
+			"check_serial": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Record the serial of the state in the DynamoDB table, and refuse to write the state if another process wrote it since it was read.",
+			},
+
+			"lock_metadata_env": {
+				Type:        cty.Set(cty.String),
+				Optional:    true,
+				Description: "The names of environment variables, such as the URL of a CI build, whose values are stored with the DynamoDB lock and shown when the lock is held.",
+			},
+
+			"new_state_read_retries": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The number of times reading a new workspace's state is retried when it's not found, to wait for a concurrent initialization.",
+			},
+
+			"download_part_size": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "Read state files larger than this many MiB in parts of this size, which are downloaded concurrently.",
+			},
+
+			"download_concurrency": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The number of parts of a state file downloaded concurrently when download_part_size is set.",
+			},
+
+			"max_response_bytes": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "The maximum size in bytes of a state file read from S3, to protect against endpoints returning unexpectedly large responses.",
+			},
+
+			"cleanup_incomplete_uploads": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Abort incomplete multipart uploads of the state which are older than a day after each write.",
+			},
+
+			"verify_delete": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Check that the state is gone after deleting a workspace, waiting for it to disappear on eventually consistent S3-compatible stores.",
+			},
+
+			"state_growth_warn_ratio": {
+				Type:        cty.Number,
+				Optional:    true,
+				Description: "Log a warning when a write grows the state file by more than this ratio of its previous size.",
+			},
+
+			"content_disposition": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: "The Content-Disposition header to set on the state object, such as to suggest a filename for downloads.",
+			},
+
+			"object_expires": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: `The expiration to set on the state file with the Expires header, either a duration after each write such as "72h" or a time in RFC 3339 format. S3 doesn't delete expired objects.`,
+			},
+
+			"local_mirror_path": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: "Read the state from this local directory, laid out like the S3 bucket, instead of S3, for offline plans. The state is not locked.",
+			},
+
+			"local_mirror_write": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Allow writing the state to local_mirror_path.",
+			},
+
+			"key_is_pointer": {
+				Type:        cty.Bool,
+				Optional:    true,
+				Description: "Treat the state file as a pointer whose content is the key of the object holding the state.",
+			},
+
+			"pointer_target_key": {
+				Type:        cty.String,
+				Optional:    true,
+				Description: `The key of the object to write the state to when key_is_pointer is set, after which the pointer is updated to refer to it. May contain the "${workspace}" placeholder.`,
+			},
+		},
+
+		BlockTypes: map[string]*configschema.NestedBlock{
+			"grant": {
+				Nesting: configschema.NestingSet,
+				Block: configschema.Block{
+					Attributes: map[string]*configschema.Attribute{
+						"type": {
+							Type:        cty.String,
+							Required:    true,
+							Description: `The type of grantee: "CanonicalUser" or "Group"`,
+						},
+						"id": {
+							Type:        cty.String,
+							Optional:    true,
+							Description: "The canonical user ID of a CanonicalUser grantee",
+						},
+						"uri": {
+							Type:        cty.String,
+							Optional:    true,
+							Description: "The URI of a Group grantee",
+						},
+						"permissions": {
+							Type:        cty.Set(cty.String),
+							Required:    true,
+							Description: `The permissions granted on the state file: "READ", "READ_ACP", "WRITE_ACP" or "FULL_CONTROL"`,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// PrepareConfig checks the validity of the values in the given
+// configuration, and inserts any missing defaults, assuming that its
+// structure has already been validated per the schema returned by
+// ConfigSchema.
+func (b *Backend) PrepareConfig(obj cty.Value) (cty.Value, tfdiags.Diagnostics) {
+	obj, diags := b.prepareConfig(obj)
+	return obj, redactDiagnostics(diags, b.sensitiveValues(obj))
+}
+
+func (b *Backend) prepareConfig(obj cty.Value) (cty.Value, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+	if obj.IsNull() {
+		return obj, diags
+	}
+
+	if val := obj.GetAttr("bucket"); val.IsNull() || val.AsString() == "" {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid bucket value",
+			`The "bucket" attribute value must not be empty.`,
+			cty.Path{cty.GetAttrStep{Name: "bucket"}},
+		))
+	}
+
+	allowedBuckets := obj.GetAttr("allowed_buckets")
+	validateBucketNames := !s3CompatibleAttr(obj, "skip_bucket_name_validation")
+	if bucket := obj.GetAttr("bucket"); !bucket.IsNull() && bucket.AsString() != "" {
+		path := cty.Path{cty.GetAttrStep{Name: "bucket"}}
+		if validateBucketNames {
+			diags = diags.Append(validateBucketName(path, "bucket", bucket.AsString()))
+		}
+		diags = diags.Append(validateAllowedBucket(path, bucket.AsString(), allowedBuckets))
+	}
+
+	if val := obj.GetAttr("workspace_buckets"); !val.IsNull() {
+		for it := val.ElementIterator(); it.Next(); {
+			workspace, bucket := it.Element()
+			path := cty.Path{cty.GetAttrStep{Name: "workspace_buckets"}, cty.IndexStep{Key: workspace}}
+			if bucket.IsNull() || bucket.AsString() == "" {
+				diags = diags.Append(tfdiags.AttributeValue(
+					tfdiags.Error,
+					"Invalid workspace_buckets value",
+					fmt.Sprintf(`The bucket for workspace %q must not be empty.`, workspace.AsString()),
+					path,
+				))
+				continue
+			}
+			if validateBucketNames {
+				diags = diags.Append(validateBucketName(path, "workspace_buckets", bucket.AsString()))
+			}
+			diags = diags.Append(validateAllowedBucket(path, bucket.AsString(), allowedBuckets))
+		}
+	}
+
+	if val := obj.GetAttr("key"); val.IsNull() || val.AsString() == "" {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid key value",
+			`The "key" attribute value must not be empty.`,
+			cty.Path{cty.GetAttrStep{Name: "key"}},
+		))
+	} else if key, keyDiags := resolveKeyAttr(obj, "key"); keyDiags.HasErrors() {
+		diags = diags.Append(keyDiags)
+	} else if key == "" {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid key value",
+			`The file referenced by the "key" attribute must not be empty.`,
+			cty.Path{cty.GetAttrStep{Name: "key"}},
+		))
+	} else if strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		// S3 will strip leading slashes from an object, so while this will
+		// technically be accepted by S3, it will break our workspace hierarchy.
+		// S3 will recognize objects with a trailing slash as a directory
+		// so they should not be valid keys
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid key value",
+			`The "key" attribute value must not start or end with with "/".`,
+			cty.Path{cty.GetAttrStep{Name: "key"}},
+		))
+	}
+
+	if key, keyDiags := resolveKeyAttr(obj, "key"); !keyDiags.HasErrors() {
+		if n := strings.Count(key, workspacePlaceholder); n > 1 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid key value",
+				fmt.Sprintf(`The "key" attribute value must not contain the %q placeholder more than once.`, workspacePlaceholder),
+				cty.Path{cty.GetAttrStep{Name: "key"}},
+			))
+		} else if n == 1 && !obj.GetAttr("workspace_key_prefix").IsNull() {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid workspace_key_prefix value",
+				fmt.Sprintf(`The "workspace_key_prefix" attribute cannot be combined with a "key" containing the %q placeholder, which determines the state path of every workspace, including the default workspace.`, workspacePlaceholder),
+				cty.Path{cty.GetAttrStep{Name: "workspace_key_prefix"}},
+			))
+		} else if n == 1 && boolAttr(obj, "unify_workspace_paths") {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid unify_workspace_paths value",
+				fmt.Sprintf(`The "unify_workspace_paths" attribute cannot be combined with a "key" containing the %q placeholder, which already determines the state path of the default workspace.`, workspacePlaceholder),
+				cty.Path{cty.GetAttrStep{Name: "unify_workspace_paths"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("key_env_allowlist"); !val.IsNull() {
+		for _, v := range val.AsValueSlice() {
+			if !envVarNamePattern.MatchString(v.AsString()) {
+				diags = diags.Append(tfdiags.AttributeValue(
+					tfdiags.Error,
+					"Invalid key_env_allowlist value",
+					fmt.Sprintf(`The "key_env_allowlist" attribute value %q is not a valid environment variable name.`, v.AsString()),
+					cty.Path{cty.GetAttrStep{Name: "key_env_allowlist"}},
+				))
+			}
+		}
+	}
+
+	if boolAttr(obj, "unify_workspace_paths") {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Warning,
+			"Default workspace state path changed",
+			unifyWorkspacePathsWarning,
+			cty.Path{cty.GetAttrStep{Name: "unify_workspace_paths"}},
+		))
+	}
+
+	if val := obj.GetAttr("key_case"); !val.IsNull() {
+		keyCase := val.AsString()
+		if keyCase != keyCaseLower && keyCase != keyCaseUpper {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid key_case value",
+				fmt.Sprintf(`The "key_case" attribute value must be %q or %q.`, keyCaseLower, keyCaseUpper),
+				cty.Path{cty.GetAttrStep{Name: "key_case"}},
+			))
+		} else {
+			for _, name := range []string{"key", "workspace_key_prefix"} {
+				if obj.GetAttr(name).IsNull() {
+					continue
+				}
+				v, vDiags := resolveKeyAttr(obj, name)
+				if vDiags.HasErrors() {
+					continue
+				}
+				if v != normalizeKeyCase(keyCase, v) {
+					diags = diags.Append(tfdiags.AttributeValue(
+						tfdiags.Warning,
+						"State key will be normalized",
+						fmt.Sprintf(`Because "key_case" is set to %q, the %q value %q will be stored as %q.`, keyCase, name, v, normalizeKeyCase(keyCase, v)),
+						cty.Path{cty.GetAttrStep{Name: name}},
+					))
+				}
+			}
+		}
+	}
+
+	if suffix, ok := stringAttrOk(obj, "require_key_suffix"); ok {
+		// The key is empty if it can't be resolved, which is reported with
+		// the key itself.
+		key, _ := resolveKeyAttr(obj, "key")
+		// The suffix applies to the key as it's stored.
+		keyCase := stringAttr(obj, "key_case")
+		switch {
+		case suffix == "":
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid require_key_suffix value",
+				`The "require_key_suffix" attribute value must not be empty.`,
+				cty.Path{cty.GetAttrStep{Name: "require_key_suffix"}},
+			))
+		case key != "" && !strings.HasSuffix(normalizeKeyCase(keyCase, key), normalizeKeyCase(keyCase, suffix)):
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid key value",
+				fmt.Sprintf(`The "key" attribute value %q must end with %q, as required by "require_key_suffix".`, key, suffix),
+				cty.Path{cty.GetAttrStep{Name: "key"}},
+			))
+		}
+	}
+
+	if v, ok := stringAttrOk(obj, "workspace_index_key"); ok && (v == "" || strings.HasPrefix(v, "/") || strings.HasSuffix(v, "/")) {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid workspace_index_key value",
+			`The "workspace_index_key" attribute value must not be empty, and must not start or end with "/".`,
+			cty.Path{cty.GetAttrStep{Name: "workspace_index_key"}},
+		))
+	}
+
+	for _, name := range []string{"key", "workspace_key_prefix"} {
+		if obj.GetAttr(name).IsNull() {
+			continue
+		}
+		v, vDiags := resolveKeyAttr(obj, name)
+		if vDiags.HasErrors() {
+			continue
+		}
+		diags = diags.Append(validateKeyCharacters(cty.Path{cty.GetAttrStep{Name: name}}, name, v))
+	}
+
+	// The instance metadata service is only queried by Configure, so the
+	// region can only be known to be missing here if it is skipped.
+	if region, _ := staticRegion(obj); region == "" && skipMetadataAPI(obj) {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Missing region value",
+			errMissingRegion,
+			cty.Path{cty.GetAttrStep{Name: "region"}},
+		))
+	}
+
+	if boolAttr(obj, "forbid_imds") {
+		if v, ok := boolAttrOk(obj, "skip_metadata_api_check"); ok && !v {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid skip_metadata_api_check value",
+				`The "skip_metadata_api_check" attribute cannot be set to false when "forbid_imds" is set, which never uses the EC2 instance metadata service.`,
+				cty.Path{cty.GetAttrStep{Name: "skip_metadata_api_check"}},
+			))
+		}
+		if val := obj.GetAttr("credentials_source_priority"); !val.IsNull() {
+			for _, v := range val.AsValueSlice() {
+				if !v.IsNull() && v.AsString() == credentialsSourceEC2 {
+					diags = diags.Append(tfdiags.AttributeValue(
+						tfdiags.Error,
+						"Invalid credentials_source_priority value",
+						fmt.Sprintf(`The credentials source %q reads credentials from the EC2 instance metadata service, which "forbid_imds" forbids.`, credentialsSourceEC2),
+						cty.Path{cty.GetAttrStep{Name: "credentials_source_priority"}},
+					))
+				}
+			}
+		}
+	}
+
+	diags = diags.Append(validateS3Compatible(obj))
+
+	if val := obj.GetAttr("require_https"); !val.IsNull() && val.True() {
+		for _, endpoint := range endpointAttributes {
+			if val := obj.GetAttr(endpoint.name); !val.IsNull() {
+				diags = diags.Append(validateHTTPSEndpoint(cty.Path{cty.GetAttrStep{Name: endpoint.name}}, val.AsString()))
+			} else if v := os.Getenv(endpoint.envvar); v != "" && isPlaintextEndpoint(v) {
+				diags = diags.Append(tfdiags.Sourceless(
+					tfdiags.Error,
+					"Invalid endpoint value",
+					fmt.Sprintf(`The environment variable %q value %q uses plaintext HTTP, which is not allowed when "require_https" is set.`, endpoint.envvar, v),
+				))
+			}
+		}
+	}
+
+	if region, _ := staticRegion(obj); region != "" {
+		for _, endpoint := range endpointAttributes {
+			// The SSO portal is in the sso_region of the profile, which is
+			// unrelated to the region of the backend.
+			if endpoint.name == "sso_endpoint" {
+				continue
+			}
+			// The DynamoDB endpoint is in dynamodb_region, if that is set.
+			expected := region
+			if v, ok := stringAttrOk(obj, "dynamodb_region"); ok && endpoint.name == "dynamodb_endpoint" {
+				expected = v
+			}
+			if val := obj.GetAttr(endpoint.name); !val.IsNull() && val.AsString() != "" {
+				diags = diags.Append(validateEndpointRegion(cty.Path{cty.GetAttrStep{Name: endpoint.name}}, val.AsString(), expected))
+			} else if v := os.Getenv(endpoint.envvar); v != "" {
+				if endpointRegion, ok := regionFromEndpoint(v); ok && endpointRegion != expected {
+					diags = diags.Append(tfdiags.Sourceless(
+						tfdiags.Warning,
+						"Endpoint region mismatch",
+						fmt.Sprintf(`The endpoint %q from the environment variable %q is in the region %q, but the configured region is %q.`, v, endpoint.envvar, endpointRegion, expected),
+					))
+				}
+			}
+		}
+	}
+
+	for _, name := range []string{"read_endpoint", "write_endpoint"} {
+		if val := obj.GetAttr(name); !val.IsNull() {
+			diags = diags.Append(validateEndpointURL(cty.Path{cty.GetAttrStep{Name: name}}, val.AsString()))
+		}
+	}
+
+	if val := obj.GetAttr("sso_endpoint"); !val.IsNull() {
+		diags = diags.Append(validateEndpointURL(cty.Path{cty.GetAttrStep{Name: "sso_endpoint"}}, val.AsString()))
+	} else if v := os.Getenv("AWS_SSO_ENDPOINT"); v != "" {
+		if validateEndpointURL(nil, v).HasErrors() {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Invalid endpoint value",
+				fmt.Sprintf(`The endpoint %q from the environment variable "AWS_SSO_ENDPOINT" must be an HTTPS or HTTP URL with a host.`, v),
+			))
+		}
+	}
+
+	for _, name := range []string{"signing_name", "signing_region"} {
+		val := obj.GetAttr(name)
+		if val.IsNull() {
+			continue
+		}
+		path := cty.Path{cty.GetAttrStep{Name: name}}
+		diags = diags.Append(validateSigningOption(path, val.AsString()))
+		if v := stringAttrDefaultEnvVar(obj, "endpoint", "AWS_S3_ENDPOINT"); v == "" {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Warning,
+				"Signing option ignored",
+				fmt.Sprintf(`The %q attribute only applies to a custom S3 endpoint, and is ignored since "endpoint" is not set.`, name),
+				path,
+			))
+		}
+	}
+
+	if val := obj.GetAttr("custom_headers"); !val.IsNull() {
+		for it := val.ElementIterator(); it.Next(); {
+			name, _ := it.Element()
+			diags = diags.Append(validateCustomHeaderName(cty.Path{cty.GetAttrStep{Name: "custom_headers"}, cty.IndexStep{Key: name}}, name.AsString()))
+		}
+	}
+
+	if val := obj.GetAttr("use_dualstack_endpoint"); !val.IsNull() && val.True() {
+		path := cty.Path{cty.GetAttrStep{Name: "use_dualstack_endpoint"}}
+		if val := obj.GetAttr("endpoint"); !val.IsNull() && val.AsString() != "" {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid endpoint configuration",
+				fmt.Sprintf(`The custom endpoint %q cannot be combined with "use_dualstack_endpoint", since the dual-stack endpoint is resolved from the region.`, val.AsString()),
+				path,
+			))
+		} else if v := os.Getenv("AWS_S3_ENDPOINT"); v != "" {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Invalid endpoint configuration",
+				fmt.Sprintf(`The custom endpoint %q from the environment variable "AWS_S3_ENDPOINT" cannot be combined with "use_dualstack_endpoint", since the dual-stack endpoint is resolved from the region.`, v),
+			))
+		}
+
+		if region, _ := staticRegion(obj); region != "" {
+			diags = diags.Append(validateDualStackRegion(path, region))
+		}
+	}
+
+	if v, ok := stringAttrOk(obj, "acl"); ok && v != "" {
+		diags = diags.Append(validateCannedACL(cty.Path{cty.GetAttrStep{Name: "acl"}}, v))
+	}
+	if val := obj.GetAttr("workspace_acls"); !val.IsNull() {
+		for it := val.ElementIterator(); it.Next(); {
+			workspace, acl := it.Element()
+			path := cty.Path{cty.GetAttrStep{Name: "workspace_acls"}, cty.IndexStep{Key: workspace}}
+			if acl.IsNull() {
+				acl = cty.StringVal("")
+			}
+			diags = diags.Append(validateCannedACL(path, acl.AsString()))
+		}
+	}
+
+	if val := obj.GetAttr("grant"); !val.IsNull() && val.LengthInt() > 0 {
+		if acl := obj.GetAttr("acl"); !acl.IsNull() && acl.AsString() != "" {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid ACL configuration",
+				`Only one of "acl" and "grant" can be set, since S3 doesn't accept a canned ACL together with explicit grants.`,
+				cty.Path{cty.GetAttrStep{Name: "acl"}},
+			))
+		}
+		if acls := obj.GetAttr("workspace_acls"); !acls.IsNull() && acls.LengthInt() > 0 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid ACL configuration",
+				`Only one of "workspace_acls" and "grant" can be set, since S3 doesn't accept a canned ACL together with explicit grants.`,
+				cty.Path{cty.GetAttrStep{Name: "workspace_acls"}},
+			))
+		}
+		for it := val.ElementIterator(); it.Next(); {
+			_, grant := it.Element()
+			diags = diags.Append(validateGrant(cty.Path{cty.GetAttrStep{Name: "grant"}, cty.IndexStep{Key: grant}}, grant))
+		}
+	}
+
+	if stringAttr(obj, "sse_customer_key") != "" && stringAttr(obj, "sse_customer_key_file") != "" {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid encryption configuration",
+			`Only one of "sse_customer_key" and "sse_customer_key_file" can be set.`,
+			cty.Path{cty.GetAttrStep{Name: "sse_customer_key_file"}},
+		))
+	}
+
+	if val := obj.GetAttr("kms_key_id"); !val.IsNull() && val.AsString() != "" {
+		if val := obj.GetAttr("sse_customer_key"); !val.IsNull() && val.AsString() != "" {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid encryption configuration",
+				encryptionKeyConflictError,
+				cty.Path{},
+			))
+		} else if stringAttr(obj, "sse_customer_key_file") != "" {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid encryption configuration",
+				encryptionKeyFileConflictError,
+				cty.Path{},
+			))
+		} else if customerKey := os.Getenv("AWS_SSE_CUSTOMER_KEY"); customerKey != "" {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid encryption configuration",
+				encryptionKeyConflictEnvVarError,
+				cty.Path{},
+			))
+		}
+
+		diags = diags.Append(validateKMSKey(cty.Path{cty.GetAttrStep{Name: "kms_key_id"}}, val.AsString()))
+	}
+
+	if boolAttr(obj, "encrypt") && (stringAttrDefaultEnvVar(obj, "sse_customer_key", "AWS_SSE_CUSTOMER_KEY") != "" || stringAttr(obj, "sse_customer_key_file") != "") {
+		if endpoint := stringAttrDefaultEnvVar(obj, "endpoint", "AWS_S3_ENDPOINT"); endpoint != "" {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Warning,
+				"Customer-provided encryption key with custom endpoint",
+				fmt.Sprintf(sseCustomerKeyCustomEndpointWarning, endpoint),
+			))
+		}
+	}
+
+	if val := obj.GetAttr("client_side_encryption_kms_key_id"); !val.IsNull() && val.AsString() != "" {
+		diags = diags.Append(validateKMSKey(cty.Path{cty.GetAttrStep{Name: "client_side_encryption_kms_key_id"}}, val.AsString()))
+	}
+
+	if val := obj.GetAttr("dynamodb_table_missing_action"); !val.IsNull() {
+		switch val.AsString() {
+		case dynamoDBTableMissingError, dynamoDBTableMissingWarn, dynamoDBTableMissingCreate:
+		default:
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid dynamodb_table_missing_action value",
+				fmt.Sprintf(`The "dynamodb_table_missing_action" attribute value must be one of %q, %q or %q.`, dynamoDBTableMissingError, dynamoDBTableMissingWarn, dynamoDBTableMissingCreate),
+				cty.Path{cty.GetAttrStep{Name: "dynamodb_table_missing_action"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("lock_max_age"); !val.IsNull() {
+		if v, _ := val.AsBigFloat().Int64(); v < 0 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid lock_max_age value",
+				`The "lock_max_age" attribute value must not be negative.`,
+				cty.Path{cty.GetAttrStep{Name: "lock_max_age"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("malformed_lock_action"); !val.IsNull() {
+		switch val.AsString() {
+		case malformedLockError, malformedLockTakeover:
+		default:
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid malformed_lock_action value",
+				fmt.Sprintf(`The "malformed_lock_action" attribute value must be %q or %q.`, malformedLockError, malformedLockTakeover),
+				cty.Path{cty.GetAttrStep{Name: "malformed_lock_action"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("max_retries"); !val.IsNull() {
+		if v, _ := val.AsBigFloat().Int64(); v < 0 || v > maxRetriesLimit {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid max_retries value",
+				fmt.Sprintf(`The "max_retries" attribute value must be between 0 and %d.`, maxRetriesLimit),
+				cty.Path{cty.GetAttrStep{Name: "max_retries"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("credential_cache_ttl"); !val.IsNull() {
+		if v, _ := val.AsBigFloat().Int64(); v < 0 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid credential_cache_ttl value",
+				`The "credential_cache_ttl" attribute value must not be negative.`,
+				cty.Path{cty.GetAttrStep{Name: "credential_cache_ttl"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("read_cache_ttl"); !val.IsNull() {
+		if v, _ := val.AsBigFloat().Int64(); v < 0 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid read_cache_ttl value",
+				`The "read_cache_ttl" attribute value must not be negative.`,
+				cty.Path{cty.GetAttrStep{Name: "read_cache_ttl"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("http_request_timeout"); !val.IsNull() {
+		if v, _ := val.AsBigFloat().Int64(); v < 1 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid http_request_timeout value",
+				`The "http_request_timeout" attribute value must be at least 1 second.`,
+				cty.Path{cty.GetAttrStep{Name: "http_request_timeout"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("connect_timeout"); !val.IsNull() {
+		v, _ := val.AsBigFloat().Int64()
+		requestTimeout, hasRequestTimeout := intAttrOk(obj, "http_request_timeout")
+		switch {
+		case v < 1:
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid connect_timeout value",
+				`The "connect_timeout" attribute value must be at least 1 second.`,
+				cty.Path{cty.GetAttrStep{Name: "connect_timeout"}},
+			))
+		case hasRequestTimeout && int(v) > requestTimeout:
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Warning,
+				"Ineffective connect_timeout value",
+				fmt.Sprintf(`The "connect_timeout" attribute value %d is longer than the "http_request_timeout" of %d seconds, which also covers connecting and so ends requests first.`, v, requestTimeout),
+				cty.Path{cty.GetAttrStep{Name: "connect_timeout"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("attempt_timeout"); !val.IsNull() {
+		v, _ := val.AsBigFloat().Int64()
+		requestTimeout, hasRequestTimeout := intAttrOk(obj, "http_request_timeout")
+		switch {
+		case v < 1:
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid attempt_timeout value",
+				`The "attempt_timeout" attribute value must be at least 1 second.`,
+				cty.Path{cty.GetAttrStep{Name: "attempt_timeout"}},
+			))
+		case hasRequestTimeout && int(v) > requestTimeout:
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Warning,
+				"Ineffective attempt_timeout value",
+				fmt.Sprintf(`The "attempt_timeout" attribute value %d is longer than the "http_request_timeout" of %d seconds, which also covers each attempt and so ends them first.`, v, requestTimeout),
+				cty.Path{cty.GetAttrStep{Name: "attempt_timeout"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("min_tls_version"); !val.IsNull() {
+		if _, ok := tlsVersions[val.AsString()]; !ok {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid min_tls_version value",
+				fmt.Sprintf(`The TLS version %q is not valid. Valid versions are "1.2" and "1.3".`, val.AsString()),
+				cty.Path{cty.GetAttrStep{Name: "min_tls_version"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("max_redirects"); !val.IsNull() {
+		path := cty.Path{cty.GetAttrStep{Name: "max_redirects"}}
+		if !boolAttr(obj, "follow_redirects") {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid max_redirects value",
+				`The "max_redirects" attribute requires "follow_redirects" to be set.`,
+				path,
+			))
+		} else if v, _ := val.AsBigFloat().Int64(); v < 1 || v > maxMaxRedirects {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid max_redirects value",
+				fmt.Sprintf(`The "max_redirects" attribute value must be between 1 and %d.`, maxMaxRedirects),
+				path,
+			))
+		}
+	}
+
+	if val := obj.GetAttr("retry_budget"); !val.IsNull() {
+		if v, _ := val.AsBigFloat().Int64(); v < 0 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid retry_budget value",
+				`The "retry_budget" attribute value must not be negative.`,
+				cty.Path{cty.GetAttrStep{Name: "retry_budget"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("max_retry_delay"); !val.IsNull() {
+		if v, _ := val.AsBigFloat().Int64(); v < 1 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid max_retry_delay value",
+				`The "max_retry_delay" attribute value must be at least 1 second.`,
+				cty.Path{cty.GetAttrStep{Name: "max_retry_delay"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("retry_on"); !val.IsNull() {
+		path := cty.Path{cty.GetAttrStep{Name: "retry_on"}}
+		if val.LengthInt() == 0 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid retry_on value",
+				`The "retry_on" attribute value must not be empty. Set "max_retries" to 0 to disable retries.`,
+				path,
+			))
+		}
+		for _, v := range val.AsValueSlice() {
+			switch v.AsString() {
+			case retryOnServerError, retryOnThrottling, retryOnTimeout:
+			default:
+				diags = diags.Append(tfdiags.AttributeValue(
+					tfdiags.Error,
+					"Invalid retry_on value",
+					fmt.Sprintf(`The error class %q is not valid. Valid classes are %q, %q and %q.`, v.AsString(), retryOnServerError, retryOnThrottling, retryOnTimeout),
+					path,
+				))
+			}
+		}
+	}
+
+	if val := obj.GetAttr("credentials_source_priority"); !val.IsNull() {
+		path := cty.Path{cty.GetAttrStep{Name: "credentials_source_priority"}}
+		if val.LengthInt() == 0 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid credentials_source_priority value",
+				`The "credentials_source_priority" attribute value must not be empty.`,
+				path,
+			))
+		}
+		seen := make(map[string]bool)
+		for _, v := range val.AsValueSlice() {
+			if v.IsNull() {
+				continue
+			}
+			source := v.AsString()
+			switch {
+			case !slices.Contains(credentialsSources, source):
+				diags = diags.Append(tfdiags.AttributeValue(
+					tfdiags.Error,
+					"Invalid credentials_source_priority value",
+					fmt.Sprintf(`The credentials source %q is not valid. Valid sources are %q.`, source, credentialsSources),
+					path,
+				))
+			case seen[source]:
+				diags = diags.Append(tfdiags.AttributeValue(
+					tfdiags.Error,
+					"Invalid credentials_source_priority value",
+					fmt.Sprintf(`The credentials source %q is listed more than once.`, source),
+					path,
+				))
+			}
+			seen[source] = true
+		}
+	}
+
+	if val := obj.GetAttr("lock_retry_max_attempts"); !val.IsNull() {
+		if v, _ := val.AsBigFloat().Int64(); v < 0 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid lock_retry_max_attempts value",
+				`The "lock_retry_max_attempts" attribute value must not be negative.`,
+				cty.Path{cty.GetAttrStep{Name: "lock_retry_max_attempts"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("lock_retry_wait_seconds"); !val.IsNull() {
+		if v, _ := val.AsBigFloat().Int64(); v < 0 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid lock_retry_wait_seconds value",
+				`The "lock_retry_wait_seconds" attribute value must not be negative.`,
+				cty.Path{cty.GetAttrStep{Name: "lock_retry_wait_seconds"}},
+			))
+		}
 	}
-}
 
-// PrepareConfig checks the validity of the values in the given
-// configuration, and inserts any missing defaults, assuming that its
-// structure has already been validated per the schema returned by
-// ConfigSchema.
-func (b *Backend) PrepareConfig(obj cty.Value) (cty.Value, tfdiags.Diagnostics) {
-	var diags tfdiags.Diagnostics
-	if obj.IsNull() {
-		return obj, diags
+	if val := obj.GetAttr("lock_initial_jitter"); !val.IsNull() {
+		if v, _ := val.AsBigFloat().Float64(); v < 0 || v > maxLockInitialJitter.Seconds() {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid lock_initial_jitter value",
+				fmt.Sprintf(`The "lock_initial_jitter" attribute value must be between 0 and %g seconds.`, maxLockInitialJitter.Seconds()),
+				cty.Path{cty.GetAttrStep{Name: "lock_initial_jitter"}},
+			))
+		}
 	}
 
-	if val := obj.GetAttr("bucket"); val.IsNull() || val.AsString() == "" {
+	if boolAttr(obj, "check_serial") && stringAttr(obj, "dynamodb_table") == "" {
 		diags = diags.Append(tfdiags.AttributeValue(
 			tfdiags.Error,
-			"Invalid bucket value",
-			`The "bucket" attribute value must not be empty.`,
-			cty.Path{cty.GetAttrStep{Name: "bucket"}},
+			"Invalid check_serial value",
+			`The "check_serial" attribute requires "dynamodb_table" to be set, since the serial is recorded in the DynamoDB table.`,
+			cty.Path{cty.GetAttrStep{Name: "check_serial"}},
 		))
 	}
 
-	if val := obj.GetAttr("key"); val.IsNull() || val.AsString() == "" {
-		diags = diags.Append(tfdiags.AttributeValue(
-			tfdiags.Error,
-			"Invalid key value",
-			`The "key" attribute value must not be empty.`,
-			cty.Path{cty.GetAttrStep{Name: "key"}},
-		))
-	} else if strings.HasPrefix(val.AsString(), "/") || strings.HasSuffix(val.AsString(), "/") {
-		// S3 will strip leading slashes from an object, so while this will
-		// technically be accepted by S3, it will break our workspace hierarchy.
-		// S3 will recognize objects with a trailing slash as a directory
-		// so they should not be valid keys
+	if boolAttr(obj, "require_locking") {
+		switch {
+		case stringAttr(obj, "dynamodb_table") == "" && b.locker == nil:
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"State locking not configured",
+				`The "require_locking" attribute requires a locking mechanism, but "dynamodb_table" is not set. Set "dynamodb_table" to a DynamoDB table to lock the state with.`,
+				cty.Path{cty.GetAttrStep{Name: "require_locking"}},
+			))
+		case stringAttr(obj, "dynamodb_table_missing_action") == dynamoDBTableMissingWarn:
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid dynamodb_table_missing_action value",
+				`The "dynamodb_table_missing_action" attribute can't be "warn" when "require_locking" is set, since state locking would be disabled if the table does not exist.`,
+				cty.Path{cty.GetAttrStep{Name: "dynamodb_table_missing_action"}},
+			))
+		}
+	}
+
+	if boolAttr(obj, "sharded_state") {
+		conflicts := map[string]bool{
+			"compress":                          boolAttr(obj, "compress"),
+			"client_side_encryption_kms_key_id": stringAttr(obj, "client_side_encryption_kms_key_id") != "",
+			"keep_backup":                       boolAttr(obj, "keep_backup"),
+		}
+		for _, name := range []string{"compress", "client_side_encryption_kms_key_id", "keep_backup"} {
+			if !conflicts[name] {
+				continue
+			}
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid sharded_state value",
+				fmt.Sprintf(`The "sharded_state" attribute can't be used with %q, which only applies to the manifest and not to the shards of the state.`, name),
+				cty.Path{cty.GetAttrStep{Name: "sharded_state"}},
+			))
+		}
+	}
+
+	if val := obj.GetAttr("lock_metadata_env"); !val.IsNull() {
+		for _, v := range val.AsValueSlice() {
+			if name := v.AsString(); name == "" || strings.Contains(name, "=") {
+				diags = diags.Append(tfdiags.AttributeValue(
+					tfdiags.Error,
+					"Invalid lock_metadata_env value",
+					fmt.Sprintf(`The environment variable name %q is not valid.`, name),
+					cty.Path{cty.GetAttrStep{Name: "lock_metadata_env"}},
+				))
+			}
+		}
+	}
+
+	if val := obj.GetAttr("new_state_read_retries"); !val.IsNull() {
+		if v, _ := val.AsBigFloat().Int64(); v < 0 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid new_state_read_retries value",
+				`The "new_state_read_retries" attribute value must not be negative.`,
+				cty.Path{cty.GetAttrStep{Name: "new_state_read_retries"}},
+			))
+		}
+	}
+
+	for _, name := range []string{"download_part_size", "download_concurrency", "max_response_bytes"} {
+		if val := obj.GetAttr(name); !val.IsNull() {
+			if v, _ := val.AsBigFloat().Int64(); v < 1 {
+				diags = diags.Append(tfdiags.AttributeValue(
+					tfdiags.Error,
+					fmt.Sprintf("Invalid %s value", name),
+					fmt.Sprintf(`The %q attribute value must be at least 1.`, name),
+					cty.Path{cty.GetAttrStep{Name: name}},
+				))
+			}
+		}
+	}
+	if !obj.GetAttr("download_concurrency").IsNull() && obj.GetAttr("download_part_size").IsNull() {
 		diags = diags.Append(tfdiags.AttributeValue(
 			tfdiags.Error,
-			"Invalid key value",
-			`The "key" attribute value must not start or end with with "/".`,
-			cty.Path{cty.GetAttrStep{Name: "key"}},
+			"Invalid download_concurrency value",
+			`The "download_concurrency" attribute requires "download_part_size" to be set.`,
+			cty.Path{cty.GetAttrStep{Name: "download_concurrency"}},
 		))
 	}
 
-	if val := obj.GetAttr("region"); val.IsNull() || val.AsString() == "" {
-		if os.Getenv("AWS_REGION") == "" && os.Getenv("AWS_DEFAULT_REGION") == "" {
+	if val := obj.GetAttr("state_growth_warn_ratio"); !val.IsNull() {
+		if v, _ := val.AsBigFloat().Float64(); v <= 1 {
 			diags = diags.Append(tfdiags.AttributeValue(
 				tfdiags.Error,
-				"Missing region value",
-				`The "region" attribute or the "AWS_REGION" or "AWS_DEFAULT_REGION" environment variables must be set.`,
-				cty.Path{cty.GetAttrStep{Name: "region"}},
+				"Invalid state_growth_warn_ratio value",
+				`The "state_growth_warn_ratio" attribute value must be greater than 1.`,
+				cty.Path{cty.GetAttrStep{Name: "state_growth_warn_ratio"}},
 			))
 		}
 	}
 
-	if val := obj.GetAttr("kms_key_id"); !val.IsNull() && val.AsString() != "" {
-		if val := obj.GetAttr("sse_customer_key"); !val.IsNull() && val.AsString() != "" {
+	if v, ok := stringAttrOk(obj, "content_disposition"); ok {
+		diags = diags.Append(validateContentDisposition(cty.Path{cty.GetAttrStep{Name: "content_disposition"}}, v))
+	}
+
+	if val := obj.GetAttr("object_expires"); !val.IsNull() {
+		if _, err := parseObjectExpires(val.AsString()); err != nil {
 			diags = diags.Append(tfdiags.AttributeValue(
 				tfdiags.Error,
-				"Invalid encryption configuration",
-				encryptionKeyConflictError,
-				cty.Path{},
+				"Invalid object_expires value",
+				fmt.Sprintf(`The "object_expires" attribute value is not valid: %s.`, err),
+				cty.Path{cty.GetAttrStep{Name: "object_expires"}},
 			))
-		} else if customerKey := os.Getenv("AWS_SSE_CUSTOMER_KEY"); customerKey != "" {
+		}
+	}
+
+	if v, ok := stringAttrOk(obj, "local_mirror_path"); ok && v == "" {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid local_mirror_path value",
+			`The "local_mirror_path" attribute value must not be empty.`,
+			cty.Path{cty.GetAttrStep{Name: "local_mirror_path"}},
+		))
+	}
+	if boolAttr(obj, "local_mirror_write") && obj.GetAttr("local_mirror_path").IsNull() {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid local_mirror_write value",
+			`The "local_mirror_write" attribute requires "local_mirror_path" to be set.`,
+			cty.Path{cty.GetAttrStep{Name: "local_mirror_write"}},
+		))
+	}
+
+	if v, ok := stringAttrOk(obj, "pointer_target_key"); ok {
+		if !boolAttr(obj, "key_is_pointer") {
 			diags = diags.Append(tfdiags.AttributeValue(
 				tfdiags.Error,
-				"Invalid encryption configuration",
-				encryptionKeyConflictEnvVarError,
-				cty.Path{},
+				"Invalid pointer_target_key value",
+				`The "pointer_target_key" attribute requires "key_is_pointer" to be set.`,
+				cty.Path{cty.GetAttrStep{Name: "pointer_target_key"}},
+			))
+		} else if v == "" || strings.HasPrefix(v, "/") || strings.HasSuffix(v, "/") {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid pointer_target_key value",
+				`The "pointer_target_key" attribute value must not be empty, nor start or end with "/".`,
+				cty.Path{cty.GetAttrStep{Name: "pointer_target_key"}},
 			))
 		}
-
-		diags = diags.Append(validateKMSKey(cty.Path{cty.GetAttrStep{Name: "kms_key_id"}}, val.AsString()))
 	}
 
-	if val := obj.GetAttr("workspace_key_prefix"); !val.IsNull() {
-		if v := val.AsString(); strings.HasPrefix(v, "/") || strings.HasSuffix(v, "/") {
+	if !obj.GetAttr("workspace_key_prefix").IsNull() {
+		if v, prefixDiags := resolveKeyAttr(obj, "workspace_key_prefix"); prefixDiags.HasErrors() {
+			diags = diags.Append(prefixDiags)
+		} else if strings.HasPrefix(v, "/") || strings.HasSuffix(v, "/") {
 			diags = diags.Append(tfdiags.AttributeValue(
 				tfdiags.Error,
 				"Invalid workspace_key_prefix value",
@@ -305,17 +1648,30 @@ func (b *Backend) PrepareConfig(obj cty.Value) (cty.Value, tfdiags.Diagnostics)
 // against the schema returned by ConfigSchema and passed validation
 // via PrepareConfig.
 func (b *Backend) Configure(obj cty.Value) tfdiags.Diagnostics {
+	diags := b.configure(obj)
+	return redactDiagnostics(diags, b.sensitiveValues(obj))
+}
+
+func (b *Backend) configure(obj cty.Value) tfdiags.Diagnostics {
 	var diags tfdiags.Diagnostics
 	if obj.IsNull() {
 		return diags
 	}
+	b.config = obj
 
-	var region string
-	if v, ok := stringAttrOk(obj, "region"); ok {
-		region = v
+	region, source := resolveRegion(obj)
+	if region == "" {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Missing region value",
+			errMissingRegion,
+			cty.Path{cty.GetAttrStep{Name: "region"}},
+		))
+		return diags
 	}
+	log.Printf("[DEBUG] Using region %q from %s", region, source)
 
-	if region != "" && !boolAttr(obj, "skip_region_validation") {
+	if !s3CompatibleAttr(obj, "skip_region_validation") {
 		if err := awsbase.ValidateRegion(region); err != nil {
 			diags = diags.Append(tfdiags.AttributeValue(
 				tfdiags.Error,
@@ -327,13 +1683,108 @@ func (b *Backend) Configure(obj cty.Value) tfdiags.Diagnostics {
 		}
 	}
 
+	dynamoDBRegion, hasDynamoDBRegion := stringAttrOk(obj, "dynamodb_region")
+	if hasDynamoDBRegion && !s3CompatibleAttr(obj, "skip_region_validation") {
+		if err := awsbase.ValidateRegion(dynamoDBRegion); err != nil {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid dynamodb_region value",
+				err.Error(),
+				cty.Path{cty.GetAttrStep{Name: "dynamodb_region"}},
+			))
+			return diags
+		}
+	}
+
 	b.bucketName = stringAttr(obj, "bucket")
-	b.keyName = stringAttr(obj, "key")
+	if val := obj.GetAttr("workspace_buckets"); !val.IsNull() {
+		b.workspaceBuckets = make(map[string]string)
+		for workspace, bucket := range val.AsValueMap() {
+			b.workspaceBuckets[workspace] = bucket.AsString()
+		}
+	}
+	b.keyCase = stringAttr(obj, "key_case")
 	b.acl = stringAttr(obj, "acl")
-	b.workspaceKeyPrefix = stringAttrDefault(obj, "workspace_key_prefix", "env:")
+	if val := obj.GetAttr("workspace_acls"); !val.IsNull() {
+		b.workspaceACLs = make(map[string]string)
+		for workspace, acl := range val.AsValueMap() {
+			b.workspaceACLs[workspace] = acl.AsString()
+		}
+	}
+	b.grants = grantsFromConfig(obj.GetAttr("grant"))
+
+	keyName, keyDiags := resolveKeyAttr(obj, "key")
+	diags = diags.Append(keyDiags)
+	if keyDiags.HasErrors() {
+		return diags
+	}
+	b.keyName = normalizeKey(b.keyCase, keyName)
+
+	workspaceKeyPrefix, prefixDiags := resolveKeyAttr(obj, "workspace_key_prefix")
+	diags = diags.Append(prefixDiags)
+	if prefixDiags.HasErrors() {
+		return diags
+	}
+	b.workspaceKeyPrefix = normalizeKey(b.keyCase, workspaceKeyPrefix)
+	b.unifyWorkspacePaths = boolAttr(obj, "unify_workspace_paths")
+
+	if v, ok := stringAttrOk(obj, "local_mirror_path"); ok {
+		// The mirror is used without any S3 connectivity, so none of the
+		// clients are created.
+		diags = diags.Append(b.configureLocalMirror(v, boolAttr(obj, "local_mirror_write")))
+		return diags
+	}
+
 	b.serverSideEncryption = boolAttr(obj, "encrypt")
+	b.compress = boolAttr(obj, "compress")
+	b.shardedState = boolAttr(obj, "sharded_state")
+	b.writeInitMarker = boolAttr(obj, "write_init_marker")
+	b.logReplicationStatus = boolAttr(obj, "log_replication_status")
+	b.keepBackup = boolAttr(obj, "keep_backup")
+	b.sendContentMD5 = boolAttr(obj, "send_content_md5")
+	b.allowEmptyState = boolAttr(obj, "allow_empty_state")
+	b.tagSerialAndLineage = boolAttr(obj, "tag_serial_and_lineage")
+	b.autoTagWorkspace = boolAttr(obj, "auto_tag_workspace")
+	b.idempotencyToken = boolAttr(obj, "idempotency_token")
+	b.verifyWriteChecksum = boolAttr(obj, "verify_write_checksum")
 	b.kmsKeyID = stringAttr(obj, "kms_key_id")
 	b.ddbTable = stringAttr(obj, "dynamodb_table")
+	b.clientSideEncryptionKMSKeyID = stringAttr(obj, "client_side_encryption_kms_key_id")
+	b.lockRetryMaxAttempts = intAttrDefault(obj, "lock_retry_max_attempts", 3)
+	b.lockRetryWait = time.Duration(intAttrDefault(obj, "lock_retry_wait_seconds", 1)) * time.Second
+	b.malformedLockAction = stringAttrDefault(obj, "malformed_lock_action", malformedLockError)
+	if val := obj.GetAttr("lock_initial_jitter"); !val.IsNull() {
+		v, _ := val.AsBigFloat().Float64()
+		b.lockInitialJitter = time.Duration(v * float64(time.Second))
+	}
+	b.lockMaxAge = time.Duration(intAttr(obj, "lock_max_age")) * time.Second
+	b.checkSerial = boolAttr(obj, "check_serial")
+	if v, ok := boolAttrOk(obj, "lock_consistent_read"); ok {
+		b.eventualLockReads = !v
+	}
+	b.readCacheTTL = time.Duration(intAttr(obj, "read_cache_ttl")) * time.Second
+	b.skipWorkspaceListing = boolAttr(obj, "skip_workspace_listing")
+	b.workspaceIndexKey = stringAttr(obj, "workspace_index_key")
+	if val := obj.GetAttr("lock_metadata_env"); !val.IsNull() {
+		for _, v := range val.AsValueSlice() {
+			b.lockMetadataEnv = append(b.lockMetadataEnv, v.AsString())
+		}
+	}
+	b.newStateReadRetries = intAttr(obj, "new_state_read_retries")
+	b.downloadPartSize = int64(intAttr(obj, "download_part_size")) * 1024 * 1024
+	b.downloadConcurrency = intAttrDefault(obj, "download_concurrency", s3manager.DefaultDownloadConcurrency)
+	b.maxResponseBytes = int64(intAttr(obj, "max_response_bytes"))
+	b.verifyDelete = boolAttr(obj, "verify_delete")
+	b.cleanupUploads = boolAttr(obj, "cleanup_incomplete_uploads")
+	if val := obj.GetAttr("state_growth_warn_ratio"); !val.IsNull() {
+		b.stateGrowthWarnRatio, _ = val.AsBigFloat().Float64()
+	}
+	if v, ok := stringAttrOk(obj, "object_expires"); ok {
+		b.objectExpires, _ = parseObjectExpires(v)
+	}
+	b.contentDisposition = stringAttr(obj, "content_disposition")
+	b.keyIsPointer = boolAttr(obj, "key_is_pointer")
+	b.pointerTargetKey = stringAttr(obj, "pointer_target_key")
 
 	if customerKey, ok := stringAttrOk(obj, "sse_customer_key"); ok {
 		if len(customerKey) != 44 {
@@ -354,6 +1805,31 @@ func (b *Backend) Configure(obj cty.Value) tfdiags.Diagnostics {
 				))
 			}
 		}
+	} else if keyFile, ok := stringAttrOk(obj, "sse_customer_key_file"); ok {
+		path := cty.Path{cty.GetAttrStep{Name: "sse_customer_key_file"}}
+		customerKey, err := readCustomerKeyFile(keyFile)
+		if err != nil {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid sse_customer_key_file value",
+				fmt.Sprintf("Failed to read the customer-provided encryption key: %s", err),
+				path,
+			))
+		} else if len(customerKey) != 44 {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid sse_customer_key_file value",
+				fmt.Sprintf("The key in %q must be 44 characters in length", keyFile),
+				path,
+			))
+		} else if b.customerEncryptionKey, err = base64.StdEncoding.DecodeString(customerKey); err != nil {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid sse_customer_key_file value",
+				fmt.Sprintf("The key in %q must be base64 encoded: %s", keyFile, err),
+				path,
+			))
+		}
 	} else if customerKey := os.Getenv("AWS_SSE_CUSTOMER_KEY"); customerKey != "" {
 		if len(customerKey) != 44 {
 			diags = diags.Append(tfdiags.Sourceless(
@@ -377,7 +1853,7 @@ func (b *Backend) Configure(obj cty.Value) tfdiags.Diagnostics {
 		AccessKey:                 stringAttr(obj, "access_key"),
 		AssumeRoleARN:             stringAttr(obj, "role_arn"),
 		AssumeRoleDurationSeconds: intAttr(obj, "assume_role_duration_seconds"),
-		AssumeRoleExternalID:      stringAttr(obj, "external_id"),
+		AssumeRoleExternalID:      stringAttrDefaultEnvVar(obj, "external_id", "AWS_ASSUME_ROLE_EXTERNAL_ID"),
 		AssumeRolePolicy:          stringAttr(obj, "assume_role_policy"),
 		AssumeRoleSessionName:     stringAttr(obj, "session_name"),
 		CallerDocumentationURL:    "https://opentofu.org/docs/language/settings/backends/s3/",
@@ -387,10 +1863,10 @@ func (b *Backend) Configure(obj cty.Value) tfdiags.Diagnostics {
 		IamEndpoint:               stringAttrDefaultEnvVar(obj, "iam_endpoint", "AWS_IAM_ENDPOINT"),
 		MaxRetries:                intAttrDefault(obj, "max_retries", 5),
 		Profile:                   stringAttr(obj, "profile"),
-		Region:                    stringAttr(obj, "region"),
+		Region:                    region,
 		SecretKey:                 stringAttr(obj, "secret_key"),
-		SkipCredsValidation:       boolAttr(obj, "skip_credentials_validation"),
-		SkipMetadataApiCheck:      boolAttr(obj, "skip_metadata_api_check"),
+		SkipCredsValidation:       s3CompatibleAttr(obj, "skip_credentials_validation"),
+		SkipMetadataApiCheck:      skipMetadataAPI(obj),
 		StsEndpoint:               stringAttrDefaultEnvVar(obj, "sts_endpoint", "AWS_STS_ENDPOINT"),
 		Token:                     stringAttr(obj, "token"),
 		UserAgentProducts: []*awsbase.UserAgentProduct{
@@ -431,7 +1907,38 @@ func (b *Backend) Configure(obj cty.Value) tfdiags.Diagnostics {
 		})
 	}
 
-	sess, err := awsbase.GetSession(cfg)
+	if warn, ok := boolAttrOk(obj, "warn_on_multiple_credential_sources"); warn || !ok {
+		diags = diags.Append(multipleCredentialsSourcesWarning(cfg, obj))
+	}
+
+	creds, err := setPriorityCredentials(cfg, obj)
+	if err != nil {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Failed to resolve credentials",
+			err.Error(),
+			cty.Path{cty.GetAttrStep{Name: "credentials_source_priority"}},
+		))
+		return diags
+	}
+
+	ssoCreds, err := setSSOCredentials(cfg, obj)
+	if err != nil {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Failed to resolve SSO credentials",
+			err.Error(),
+			cty.Path{cty.GetAttrStep{Name: "sso_endpoint"}},
+		))
+		return diags
+	}
+	if ssoCreds != nil {
+		creds = ssoCreds
+	}
+
+	b.awsConfig = cfg
+
+	sess, err := getSession(cfg, creds, time.Duration(intAttr(obj, "credential_cache_ttl"))*time.Second)
 	if err != nil {
 		diags = diags.Append(tfdiags.Sourceless(
 			tfdiags.Error,
@@ -441,24 +1948,246 @@ func (b *Backend) Configure(obj cty.Value) tfdiags.Diagnostics {
 		return diags
 	}
 
+	sess = withHTTPClientOptions(sess, obj, b.httpClient)
+	if boolAttr(obj, "forbid_imds") {
+		sess.Handlers.Build.PushFrontNamed(forbidIMDSHandler())
+	}
+	sess.Handlers.Retry.PushBackNamed(clockSkewHandler())
+	if boolAttr(obj, "fail_fast_on_expired_credentials") {
+		sess.Handlers.Retry.PushBackNamed(expiredCredentialsHandler())
+	}
+
+	if val := obj.GetAttr("custom_headers"); !val.IsNull() {
+		headers := make(http.Header)
+		for name, v := range val.AsValueMap() {
+			headers.Set(name, v.AsString())
+		}
+		sess.Handlers.Build.PushBackNamed(customHeadersHandler(headers))
+	}
+
+	var retryOn []string
+	if val := obj.GetAttr("retry_on"); !val.IsNull() {
+		for _, v := range val.AsValueSlice() {
+			retryOn = append(retryOn, v.AsString())
+		}
+	}
+	if v, ok := intAttrOk(obj, "max_retry_delay"); ok || len(retryOn) != 0 {
+		sess = sess.Copy(request.WithRetryer(&aws.Config{}, newRetryer(sess, time.Duration(v)*time.Second, retryOn)))
+	}
+	if v, ok := intAttrOk(obj, "attempt_timeout"); ok {
+		send, completeAttempt := attemptTimeoutHandlers(time.Duration(v) * time.Second)
+		sess.Handlers.Send.PushFrontNamed(send)
+		sess.Handlers.CompleteAttempt.PushBackNamed(completeAttempt)
+	}
+	if v, ok := intAttrOk(obj, "retry_budget"); ok {
+		retry, complete := retryBudgetHandlers(sharedRetryBudget(v))
+		sess.Handlers.Retry.PushBackNamed(retry)
+		sess.Handlers.Complete.PushBackNamed(complete)
+	}
+
 	var dynamoConfig aws.Config
 	if v, ok := stringAttrDefaultEnvVarOk(obj, "dynamodb_endpoint", "AWS_DYNAMODB_ENDPOINT"); ok {
 		dynamoConfig.Endpoint = aws.String(v)
 	}
+	if hasDynamoDBRegion {
+		dynamoConfig.Region = aws.String(dynamoDBRegion)
+	}
 	b.dynClient = dynamodb.New(sess.Copy(&dynamoConfig))
 
+	if b.ddbTable != "" {
+		diags = diags.Append(b.checkDynamoDBTable(stringAttrDefault(obj, "dynamodb_table_missing_action", dynamoDBTableMissingError)))
+		if diags.HasErrors() {
+			return diags
+		}
+	}
+
 	var s3Config aws.Config
 	if v, ok := stringAttrDefaultEnvVarOk(obj, "endpoint", "AWS_S3_ENDPOINT"); ok {
 		s3Config.Endpoint = aws.String(v)
 	}
 	if v, ok := boolAttrOk(obj, "force_path_style"); ok {
 		s3Config.S3ForcePathStyle = aws.Bool(v)
+	} else if boolAttr(obj, "s3_compatible") {
+		s3Config.S3ForcePathStyle = aws.Bool(true)
+	}
+	if boolAttr(obj, "use_dualstack_endpoint") {
+		s3Config.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+	}
+	newS3Client := func(endpoint string) *s3.S3 {
+		config := s3Config
+		if endpoint != "" {
+			config.Endpoint = aws.String(endpoint)
+		}
+		client := s3.New(sess.Copy(&config))
+		if config.Endpoint != nil {
+			if v, ok := stringAttrOk(obj, "signing_name"); ok {
+				client.SigningName = v
+			}
+			if v, ok := stringAttrOk(obj, "signing_region"); ok {
+				client.SigningRegion = v
+			}
+		}
+		return client
+	}
+	b.s3Client = newS3Client(stringAttr(obj, "write_endpoint"))
+	if _, ok := stringAttrOk(obj, "signing_region"); !ok {
+		// With signing_region, every bucket is signed for the same region.
+		b.s3Session = sess
+	}
+	if v, ok := stringAttrOk(obj, "read_endpoint"); ok {
+		if client := newS3Client(v); client.Endpoint != b.s3Client.Endpoint {
+			b.s3ReadClient = client
+		}
+	} else if _, ok := stringAttrOk(obj, "write_endpoint"); ok {
+		// Without read_endpoint, the state is still read from endpoint.
+		if client := newS3Client(""); client.Endpoint != b.s3Client.Endpoint {
+			b.s3ReadClient = client
+		}
+	}
+
+	if boolAttr(obj, "require_https") {
+		endpoints := []string{b.s3Client.Endpoint, b.dynClient.Endpoint, cfg.IamEndpoint, cfg.StsEndpoint}
+		if b.s3ReadClient != nil {
+			endpoints = append(endpoints, b.s3ReadClient.Endpoint)
+		}
+		for _, endpoint := range endpoints {
+			if isPlaintextEndpoint(endpoint) {
+				diags = diags.Append(tfdiags.Sourceless(
+					tfdiags.Error,
+					"Plaintext endpoint not allowed",
+					fmt.Sprintf(`The resolved endpoint %q uses plaintext HTTP, which is not allowed when "require_https" is set.`, endpoint),
+				))
+				return diags
+			}
+		}
+	}
+
+	if boolAttr(obj, "require_versioning") {
+		diags = diags.Append(b.checkBucketVersioning())
+		if diags.HasErrors() {
+			return diags
+		}
+	}
+
+	if boolAttr(obj, "require_bucket_encryption") {
+		diags = diags.Append(b.checkBucketEncryption())
+		if diags.HasErrors() {
+			return diags
+		}
+	}
+
+	if b.clientSideEncryptionKMSKeyID != "" {
+		b.kmsClient = kms.New(sess)
+	}
+
+	if boolAttr(obj, "log_caller_identity") {
+		if s3CompatibleAttr(obj, "skip_credentials_validation") {
+			log.Printf("[DEBUG] Not requesting the caller identity, since skip_credentials_validation is set")
+		} else {
+			diags = diags.Append(callerIdentityDiagnostic(sess))
+		}
 	}
-	b.s3Client = s3.New(sess.Copy(&s3Config))
+
+	log.Printf("[INFO] State encryption: %s", b.encryptionMode())
 
 	return diags
 }
 
+// customHeadersHandler adds the given headers to each request once the SDK has
+// built it, so that they are included in the request signature.
+func customHeadersHandler(headers http.Header) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "tofu.s3.CustomHeaders",
+		Fn: func(r *request.Request) {
+			for name, values := range headers {
+				r.HTTPRequest.Header[name] = values
+			}
+		},
+	}
+}
+
+// maxLockInitialJitter is the largest accepted lock_initial_jitter value,
+// since the wait can't be interrupted.
+const maxLockInitialJitter = time.Minute
+
+// maxRetriesLimit is the largest accepted max_retries value. With the SDK's
+// exponential backoff, more retries would keep a failing operation going for
+// hours.
+const maxRetriesLimit = 100
+
+// fileReferencePrefix marks a key or workspace_key_prefix value which
+// refers to a file holding the actual value.
+const fileReferencePrefix = "file://"
+
+// resolveFileReference returns the contents of the referenced file, with
+// surrounding whitespace removed, if s is a file:// reference. Any other value
+// is returned unchanged.
+func resolveFileReference(s string) (string, error) {
+	filename, ok := strings.CutPrefix(s, fileReferencePrefix)
+	if !ok {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// resolveKeyAttr returns the value of the key or workspace_key_prefix
+// attribute as it's used in state paths: the contents of the file it refers
+// to, and for the key, with the references to environment variables
+// expanded. An unset workspace_key_prefix resolves to its default. It returns
+// an empty value and an error diagnostic if the value can't be resolved.
+func resolveKeyAttr(obj cty.Value, name string) (string, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+	path := cty.Path{cty.GetAttrStep{Name: name}}
+
+	v := stringAttr(obj, name)
+	if name == "workspace_key_prefix" {
+		v = stringAttrDefault(obj, name, "env:")
+	}
+	v, err := resolveFileReference(v)
+	if err != nil {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			fmt.Sprintf("Invalid %s value", name),
+			fmt.Sprintf(`The %q file reference could not be read: %s`, name, err),
+			path,
+		))
+		return "", diags
+	}
+
+	if name == "key" {
+		v, err = expandKeyEnv(v, keyEnvAllowlist(obj))
+		if err != nil {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid key value",
+				fmt.Sprintf(`The "key" attribute value could not be expanded: %s.`, err),
+				path,
+			))
+			return "", diags
+		}
+	}
+	return v, nil
+}
+
+// readCustomerKeyFile reads the base64-encoded customer-provided encryption
+// key from a file, ignoring surrounding whitespace such as a trailing newline.
+func readCustomerKeyFile(filename string) (string, error) {
+	filename, err := homedir.Expand(filename)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 func stringValue(val cty.Value) string {
 	v, _ := stringValueOk(val)
 	return v
@@ -547,12 +2276,43 @@ func intAttrDefault(obj cty.Value, name string, def int) int {
 	}
 }
 
+// endpointAttributes lists the custom endpoint attributes along with the
+// environment variable each can be sourced from, if any.
+var endpointAttributes = []struct {
+	name   string
+	envvar string
+}{
+	{name: "endpoint", envvar: "AWS_S3_ENDPOINT"},
+	{name: "read_endpoint"},
+	{name: "write_endpoint"},
+	{name: "dynamodb_endpoint", envvar: "AWS_DYNAMODB_ENDPOINT"},
+	{name: "iam_endpoint", envvar: "AWS_IAM_ENDPOINT"},
+	{name: "sts_endpoint", envvar: "AWS_STS_ENDPOINT"},
+	{name: "sso_endpoint", envvar: "AWS_SSO_ENDPOINT"},
+}
+
+const unifyWorkspacePathsWarning = `With "unify_workspace_paths" set, the state of the default workspace is stored under the "workspace_key_prefix" rather than at the "key".
+
+Existing state of the default workspace is not moved automatically. Copy it to
+the new path before using this configuration, or it will appear to be empty.`
+
+const sseCustomerKeyCustomEndpointWarning = `State is encrypted with a customer-provided key (SSE-C) and stored through the custom endpoint %q.
+
+Not all S3-compatible stores implement SSE-C. Verify that the store supports
+it, since a store which doesn't will reject writing the state.`
+
 const encryptionKeyConflictError = `Only one of "kms_key_id" and "sse_customer_key" can be set.
 
 The "kms_key_id" is used for encryption with KMS-Managed Keys (SSE-KMS)
 while "sse_customer_key" is used for encryption with customer-managed keys (SSE-C).
 Please choose one or the other.`
 
+const encryptionKeyFileConflictError = `Only one of "kms_key_id" and "sse_customer_key_file" can be set.
+
+The "kms_key_id" is used for encryption with KMS-Managed Keys (SSE-KMS)
+while "sse_customer_key_file" is used for encryption with customer-managed keys (SSE-C).
+Please choose one or the other.`
+
 const encryptionKeyConflictEnvVarError = `Only one of "kms_key_id" and the environment variable "AWS_SSE_CUSTOMER_KEY" can be set.
 
 The "kms_key_id" is used for encryption with KMS-Managed Keys (SSE-KMS)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -89,6 +90,21 @@ func (m regexpMatcher) String() string {
 	return m.re.String()
 }
 
+// expectMultipleCredentialSources returns a validator expecting only the
+// warning that credentials are available from the given sources, of which the
+// first is used.
+func expectMultipleCredentialSources(sources ...string) DiagsValidator {
+	quoted := make([]string, len(sources))
+	for i, source := range sources {
+		quoted[i] = fmt.Sprintf("%q", source)
+	}
+	return ExpectDiagMatching(
+		tfdiags.Warning,
+		equalsMatcher("Multiple credential sources"),
+		newRegexpMatcher(regexp.QuoteMeta(fmt.Sprintf("from the sources %s, and the credentials from %s are used.", strings.Join(quoted, ", "), quoted[0]))),
+	)
+}
+
 func TestBackendConfig_Authentication(t *testing.T) {
 	testCases := map[string]struct {
 		config                     map[string]any
@@ -168,6 +184,23 @@ func TestBackendConfig_Authentication(t *testing.T) {
 			},
 		},
 
+		"envvar AssumeRoleExternalID": {
+			config: map[string]any{
+				"access_key":   awsbase.MockStaticAccessKey,
+				"secret_key":   servicemocks.MockStaticSecretKey,
+				"role_arn":     servicemocks.MockStsAssumeRoleArn,
+				"session_name": servicemocks.MockStsAssumeRoleSessionName,
+			},
+			EnvironmentVariables: map[string]string{
+				"AWS_ASSUME_ROLE_EXTERNAL_ID": servicemocks.MockStsAssumeRoleExternalId,
+			},
+			ExpectedCredentialsValue: mockdata.MockStsAssumeRoleCredentials,
+			MockStsEndpoints: []*servicemocks.MockEndpoint{
+				servicemocks.MockStsAssumeRoleValidEndpointWithOptions(map[string]string{"ExternalId": servicemocks.MockStsAssumeRoleExternalId}),
+				servicemocks.MockStsGetCallerIdentityValidEndpoint,
+			},
+		},
+
 		"config AssumeRolePolicy": {
 			config: map[string]any{
 				"access_key":         awsbase.MockStaticAccessKey,
@@ -294,7 +327,7 @@ aws_secret_access_key = DefaultSharedCredentialsSecretKey
 aws_access_key_id = ProfileSharedCredentialsAccessKey
 aws_secret_access_key = ProfileSharedCredentialsSecretKey
 `,
-			ValidateDiags: ExpectNoDiags,
+			ValidateDiags: expectMultipleCredentialSources("env", "profile"),
 		},
 
 		"config Profile shared configuration credential_source Ec2InstanceMetadata": {
@@ -336,6 +369,54 @@ aws_secret_access_key = SharedConfigurationSourceSecretKey
 `, servicemocks.MockStsAssumeRoleArn, servicemocks.MockStsAssumeRoleSessionName),
 		},
 
+		"config Profile shared configuration source_profile chain": {
+			config: map[string]any{
+				"profile": "SharedConfigurationProfile",
+			},
+			ExpectedCredentialsValue: mockdata.MockStsAssumeRoleCredentials,
+			MockStsEndpoints: []*servicemocks.MockEndpoint{
+				servicemocks.MockStsAssumeRoleValidEndpoint,
+				servicemocks.MockStsGetCallerIdentityValidEndpoint,
+			},
+			SharedConfigurationFile: fmt.Sprintf(`
+[profile SharedConfigurationProfile]
+role_arn = %[1]s
+role_session_name = %[2]s
+source_profile = SharedConfigurationIntermediateProfile
+
+[profile SharedConfigurationIntermediateProfile]
+role_arn = %[1]s
+role_session_name = %[2]s
+source_profile = SharedConfigurationSourceProfile
+
+[profile SharedConfigurationSourceProfile]
+aws_access_key_id = SharedConfigurationSourceAccessKey
+aws_secret_access_key = SharedConfigurationSourceSecretKey
+`, servicemocks.MockStsAssumeRoleArn, servicemocks.MockStsAssumeRoleSessionName),
+		},
+
+		"config Profile shared configuration source_profile in shared credentials file": {
+			config: map[string]any{
+				"profile": "SharedConfigurationProfile",
+			},
+			ExpectedCredentialsValue: mockdata.MockStsAssumeRoleCredentials,
+			MockStsEndpoints: []*servicemocks.MockEndpoint{
+				servicemocks.MockStsAssumeRoleValidEndpoint,
+				servicemocks.MockStsGetCallerIdentityValidEndpoint,
+			},
+			SharedConfigurationFile: fmt.Sprintf(`
+[profile SharedConfigurationProfile]
+role_arn = %[1]s
+role_session_name = %[2]s
+source_profile = SharedCredentialsSourceProfile
+`, servicemocks.MockStsAssumeRoleArn, servicemocks.MockStsAssumeRoleSessionName),
+			SharedCredentialsFile: `
+[SharedCredentialsSourceProfile]
+aws_access_key_id = SharedCredentialsSourceAccessKey
+aws_secret_access_key = SharedCredentialsSourceSecretKey
+`,
+		},
+
 		"environment AWS_ACCESS_KEY_ID": {
 			config: map[string]any{},
 			EnvironmentVariables: map[string]string{
@@ -575,7 +656,7 @@ aws_secret_access_key = DefaultSharedCredentialsSecretKey
 			MockStsEndpoints: []*servicemocks.MockEndpoint{
 				servicemocks.MockStsGetCallerIdentityValidEndpoint,
 			},
-			ValidateDiags: ExpectNoDiags,
+			ValidateDiags: expectMultipleCredentialSources("static", "env"),
 		},
 
 		"config AccessKey over shared credentials default aws_access_key_id": {
@@ -592,7 +673,7 @@ aws_secret_access_key = DefaultSharedCredentialsSecretKey
 aws_access_key_id = DefaultSharedCredentialsAccessKey
 aws_secret_access_key = DefaultSharedCredentialsSecretKey
 `,
-			ValidateDiags: ExpectNoDiags,
+			ValidateDiags: expectMultipleCredentialSources("static", "profile"),
 		},
 
 		"config AccessKey over EC2 metadata access key": {
@@ -616,6 +697,7 @@ aws_secret_access_key = DefaultSharedCredentialsSecretKey
 			MockStsEndpoints: []*servicemocks.MockEndpoint{
 				servicemocks.MockStsGetCallerIdentityValidEndpoint,
 			},
+			ValidateDiags: expectMultipleCredentialSources("static", "ecs"),
 		},
 
 		"environment AWS_ACCESS_KEY_ID over shared credentials default aws_access_key_id": {
@@ -633,7 +715,7 @@ aws_secret_access_key = DefaultSharedCredentialsSecretKey
 aws_access_key_id = DefaultSharedCredentialsAccessKey
 aws_secret_access_key = DefaultSharedCredentialsSecretKey
 `,
-			ValidateDiags: ExpectNoDiags,
+			ValidateDiags: expectMultipleCredentialSources("env", "profile"),
 		},
 
 		"environment AWS_ACCESS_KEY_ID over EC2 metadata access key": {
@@ -659,6 +741,7 @@ aws_secret_access_key = DefaultSharedCredentialsSecretKey
 			MockStsEndpoints: []*servicemocks.MockEndpoint{
 				servicemocks.MockStsGetCallerIdentityValidEndpoint,
 			},
+			ValidateDiags: expectMultipleCredentialSources("env", "ecs"),
 		},
 
 		"shared credentials default aws_access_key_id over EC2 metadata access key": {
@@ -694,6 +777,7 @@ aws_secret_access_key = DefaultSharedCredentialsSecretKey
 aws_access_key_id = DefaultSharedCredentialsAccessKey
 aws_secret_access_key = DefaultSharedCredentialsSecretKey
 `,
+			ValidateDiags: expectMultipleCredentialSources("profile", "ecs"),
 		},
 
 		"ECS credentials access key over EC2 metadata access key": {
@@ -807,7 +891,7 @@ aws_secret_access_key = ProfileSharedCredentialsSecretKey
 				servicemocks.MockStsGetCallerIdentityValidEndpoint,
 			},
 			ExpectedCredentialsValue: mockdata.MockEnvCredentials,
-			ValidateDiags:            ExpectNoDiags,
+			ValidateDiags:            expectMultipleCredentialSources("env", "profile"),
 		},
 
 		"AWS_ACCESS_KEY_ID does not override invalid profile name from envvar": {
@@ -1010,25 +1094,38 @@ func TestBackendConfig_Region(t *testing.T) {
 			ExpectedRegion: "us-east-1",
 		},
 
-		// NOT SUPPORTED: region from shared configuration file
-		// 		"shared configuration file": {
-		// 			config: map[string]any{
-		// 				"access_key": awsbase.MockStaticAccessKey,
-		// 				"secret_key": servicemocks.MockStaticSecretKey,
-		// 			},
-		// 			SharedConfigurationFile: `
-		// [default]
-		// region = us-east-1
-		// `,
-		// 			ExpectedRegion: "us-east-1",
-		// 		},
-
-		// NOT SUPPORTED: region from IMDS
-		// "IMDS": {
-		// 	config:         map[string]any{},
-		// 	IMDSRegion:     "us-east-1",
-		// 	ExpectedRegion: "us-east-1",
-		// },
+		"shared configuration file": {
+			config: map[string]any{
+				"access_key": awsbase.MockStaticAccessKey,
+				"secret_key": servicemocks.MockStaticSecretKey,
+			},
+			SharedConfigurationFile: `
+[default]
+region = us-east-1
+`,
+			ExpectedRegion: "us-east-1",
+		},
+		"shared configuration file profile": {
+			config: map[string]any{
+				"access_key": awsbase.MockStaticAccessKey,
+				"secret_key": servicemocks.MockStaticSecretKey,
+				"profile":    "SharedConfigurationProfile",
+			},
+			SharedConfigurationFile: `
+[default]
+region = us-west-2
+
+[profile SharedConfigurationProfile]
+region = us-east-1
+`,
+			ExpectedRegion: "us-east-1",
+		},
+
+		"IMDS": {
+			config:         map[string]any{},
+			IMDSRegion:     "us-east-1",
+			ExpectedRegion: "us-east-1",
+		},
 
 		"config overrides AWS_REGION": {
 			config: map[string]any{
@@ -1092,6 +1189,19 @@ region = us-west-2
 			ExpectedRegion: "us-east-1",
 		},
 
+		"shared configuration overrides IMDS": {
+			config: map[string]any{
+				"access_key": awsbase.MockStaticAccessKey,
+				"secret_key": servicemocks.MockStaticSecretKey,
+			},
+			SharedConfigurationFile: `
+[default]
+region = us-east-1
+`,
+			IMDSRegion:     "us-west-2",
+			ExpectedRegion: "us-east-1",
+		},
+
 		"AWS_REGION overrides IMDS": {
 			config: map[string]any{
 				"access_key": awsbase.MockStaticAccessKey,
@@ -4,8 +4,10 @@
 package s3
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
 	"path"
 	"sort"
 	"strings"
@@ -13,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 
 	"github.com/opentofu/opentofu/internal/backend"
 	"github.com/opentofu/opentofu/internal/states"
@@ -21,14 +24,33 @@ import (
 )
 
 func (b *Backend) Workspaces() ([]string, error) {
+	if b.localMirrorPath != "" {
+		return b.mirrorWorkspaces()
+	}
+
+	if b.workspaceIndexKey != "" {
+		return b.indexedWorkspaces()
+	}
+
+	return b.listWorkspaces()
+}
+
+// listWorkspaces returns the workspaces found by listing the bucket.
+func (b *Backend) listWorkspaces() ([]string, error) {
 	const maxKeys = 1000
 
 	prefix := ""
 
-	if b.workspaceKeyPrefix != "" {
+	if templatePrefix, _, ok := b.keyTemplate(); ok {
+		prefix = templatePrefix
+	} else if b.workspaceKeyPrefix != "" {
 		prefix = b.workspaceKeyPrefix + "/"
 	}
 
+	if b.skipWorkspaceListing {
+		return b.knownWorkspaces()
+	}
+
 	params := &s3.ListObjectsInput{
 		Bucket:  &b.bucketName,
 		Prefix:  aws.String(prefix),
@@ -38,8 +60,12 @@ func (b *Backend) Workspaces() ([]string, error) {
 	wss := []string{backend.DefaultStateName}
 	err := b.s3Client.ListObjectsPages(params, func(page *s3.ListObjectsOutput, lastPage bool) bool {
 		for _, obj := range page.Contents {
+			if isDirectoryMarker(obj) {
+				continue
+			}
 			ws := b.keyEnv(*obj.Key)
-			if ws != "" {
+			// Workspaces mapped to another bucket don't keep their state here.
+			if ws != "" && b.workspaceBucket(ws) == b.bucketName {
 				wss = append(wss, ws)
 			}
 		}
@@ -47,19 +73,137 @@ func (b *Backend) Workspaces() ([]string, error) {
 	})
 
 	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == s3.ErrCodeNoSuchBucket {
-		return nil, fmt.Errorf(errS3NoSuchBucket, err)
+		return nil, fmt.Errorf(errS3NoSuchBucket, b.bucketName, err)
+	}
+
+	// Workspaces mapped to another bucket can't be found by listing ours.
+	for ws, bucket := range b.workspaceBuckets {
+		if ws == backend.DefaultStateName || bucket == b.bucketName {
+			continue
+		}
+		exists, err := b.stateExists(bucket, b.path(ws))
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			wss = append(wss, ws)
+		}
 	}
 
 	sort.Strings(wss[1:])
 	return wss, nil
 }
 
+// workspaceBucket returns the bucket holding the state of the given workspace.
+func (b *Backend) workspaceBucket(name string) string {
+	if bucket, ok := b.workspaceBuckets[name]; ok {
+		return bucket
+	}
+	return b.bucketName
+}
+
+// bucketClient returns the S3 client for requests to the given bucket. A
+// bucket in workspace_buckets which is in another region than bucket gets a
+// client for its region, since S3 rejects requests signed for another region
+// with a redirect. The region of each bucket is looked up once.
+func (b *Backend) bucketClient(bucket string) *s3.S3 {
+	if bucket == b.bucketName || b.s3Session == nil {
+		return b.s3Client
+	}
+
+	b.bucketClientsMu.Lock()
+	defer b.bucketClientsMu.Unlock()
+	if client, ok := b.bucketClients[bucket]; ok {
+		return client
+	}
+
+	client := b.s3Client
+	region, err := s3manager.GetBucketRegionWithClient(context.Background(), b.s3Client, bucket)
+	switch {
+	case err != nil:
+		// The requests to the bucket report the error, if it's not only
+		// the lookup which failed.
+		log.Printf("[DEBUG] Failed to look up the region of the S3 bucket %q: %s", bucket, err)
+	case region != aws.StringValue(b.s3Client.Config.Region):
+		client = s3.New(b.s3Session, b.s3Client.Config.Copy(&aws.Config{Region: aws.String(region)}))
+		client.SigningName = b.s3Client.SigningName
+	}
+
+	if b.bucketClients == nil {
+		b.bucketClients = make(map[string]*s3.S3)
+	}
+	b.bucketClients[bucket] = client
+	return client
+}
+
+// workspaceACL returns the canned ACL applied to the state of the given
+// workspace.
+func (b *Backend) workspaceACL(name string) string {
+	if acl, ok := b.workspaceACLs[name]; ok {
+		return acl
+	}
+	return b.acl
+}
+
+// stateExists reports whether the state object with the given key exists in
+// the bucket.
+func (b *Backend) stateExists(bucket, key string) (bool, error) {
+	if b.skipWorkspaceListing {
+		return b.headStateExists(bucket, key)
+	}
+
+	out, err := b.bucketClient(bucket).ListObjects(&s3.ListObjectsInput{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(key),
+		MaxKeys: aws.Int64(1),
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == s3.ErrCodeNoSuchBucket {
+			return false, fmt.Errorf(errS3NoSuchBucket, bucket, err)
+		}
+		return false, err
+	}
+
+	for _, obj := range out.Contents {
+		if aws.StringValue(obj.Key) == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isDirectoryMarker reports whether the object is an empty object with a key
+// ending in a slash, like the AWS console creates for folders. Such objects
+// are never the state of a workspace.
+func isDirectoryMarker(obj *s3.Object) bool {
+	return strings.HasSuffix(aws.StringValue(obj.Key), "/") && aws.Int64Value(obj.Size) == 0
+}
+
 func (b *Backend) keyEnv(key string) string {
+	if prefix, suffix, ok := b.keyTemplate(); ok {
+		ws, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			return ""
+		}
+		ws, ok = strings.CutSuffix(ws, suffix)
+		// The default workspace is always listed, and can't be told apart
+		// from a workspace named like it.
+		if !ok || ws == "" || ws == backend.DefaultStateName || strings.Contains(ws, "/") {
+			return ""
+		}
+		// Without a suffix, the objects kept alongside a state would
+		// otherwise be mistaken for workspaces.
+		if suffix == "" && (strings.HasSuffix(ws, initMarkerSuffix) || strings.HasSuffix(ws, backupSuffix)) {
+			return ""
+		}
+		return ws
+	}
+
 	prefix := b.workspaceKeyPrefix
 
 	if prefix == "" {
 		parts := strings.SplitN(key, "/", 2)
-		if len(parts) > 1 && parts[1] == b.keyName {
+		if len(parts) > 1 && parts[1] == b.keyName && parts[0] != backend.DefaultStateName {
 			return parts[0]
 		} else {
 			return ""
@@ -90,6 +234,12 @@ func (b *Backend) keyEnv(key string) string {
 		return ""
 	}
 
+	// The default workspace is always listed, even if its state is stored
+	// under the prefix.
+	if parts[0] == backend.DefaultStateName {
+		return ""
+	}
+
 	return parts[0]
 }
 
@@ -98,12 +248,23 @@ func (b *Backend) DeleteWorkspace(name string, _ bool) error {
 		return fmt.Errorf("can't delete default state")
 	}
 
+	if b.localMirrorPath != "" {
+		return b.mirrorClient(name).Delete()
+	}
+
 	client, err := b.remoteClient(name)
 	if err != nil {
 		return err
 	}
 
-	return client.Delete()
+	if err := client.Delete(); err != nil {
+		return err
+	}
+
+	if b.workspaceIndexKey != "" {
+		return b.removeIndexedWorkspace(name)
+	}
+	return nil
 }
 
 // get a remote client configured for this state
@@ -113,21 +274,67 @@ func (b *Backend) remoteClient(name string) (*RemoteClient, error) {
 	}
 
 	client := &RemoteClient{
-		s3Client:              b.s3Client,
-		dynClient:             b.dynClient,
-		bucketName:            b.bucketName,
-		path:                  b.path(name),
-		serverSideEncryption:  b.serverSideEncryption,
-		customerEncryptionKey: b.customerEncryptionKey,
-		acl:                   b.acl,
-		kmsKeyID:              b.kmsKeyID,
-		ddbTable:              b.ddbTable,
+		s3Client:                     b.bucketClient(b.workspaceBucket(name)),
+		s3ReadClient:                 b.s3ReadClient,
+		dynClient:                    b.dynClient,
+		kmsClient:                    b.kmsClient,
+		bucketName:                   b.workspaceBucket(name),
+		path:                         b.path(name),
+		serverSideEncryption:         b.serverSideEncryption,
+		customerEncryptionKey:        b.customerEncryptionKey,
+		acl:                          b.workspaceACL(name),
+		grants:                       b.grants,
+		compress:                     b.compress,
+		shardedState:                 b.shardedState,
+		logReplicationStatus:         b.logReplicationStatus,
+		keepBackup:                   b.keepBackup,
+		sendContentMD5:               b.sendContentMD5,
+		allowEmptyState:              b.allowEmptyState,
+		stateGrowthWarnRatio:         b.stateGrowthWarnRatio,
+		tagSerialAndLineage:          b.tagSerialAndLineage,
+		idempotencyToken:             b.idempotencyToken,
+		verifyWriteChecksum:          b.verifyWriteChecksum,
+		objectExpires:                b.objectExpires,
+		contentDisposition:           b.contentDisposition,
+		keyIsPointer:                 b.keyIsPointer,
+		pointerTargetKey:             strings.ReplaceAll(b.pointerTargetKey, workspacePlaceholder, name),
+		kmsKeyID:                     b.kmsKeyID,
+		ddbTable:                     b.ddbTable,
+		clientSideEncryptionKMSKeyID: b.clientSideEncryptionKMSKeyID,
+		lockRetryMaxAttempts:         b.lockRetryMaxAttempts,
+		lockRetryWait:                b.lockRetryWait,
+		lockInitialJitter:            b.lockInitialJitter,
+		lockMaxAge:                   b.lockMaxAge,
+		eventualLockReads:            b.eventualLockReads,
+		malformedLockAction:          b.malformedLockAction,
+		lockMetadataEnv:              b.lockMetadataEnv,
+		checkSerial:                  b.checkSerial,
+		readCacheTTL:                 b.readCacheTTL,
+		downloadPartSize:             b.downloadPartSize,
+		downloadConcurrency:          b.downloadConcurrency,
+		maxResponseBytes:             b.maxResponseBytes,
+		verifyDelete:                 b.verifyDelete,
+		cleanupUploads:               b.cleanupUploads,
+		locker:                       b.locker,
+		workspace:                    name,
+		postWriteHook:                b.postWriteHook,
+	}
+	if b.autoTagWorkspace {
+		client.workspaceTag = name
 	}
 
 	return client, nil
 }
 
 func (b *Backend) StateMgr(name string) (statemgr.Full, error) {
+	if b.localMirrorPath != "" {
+		if name == "" {
+			return nil, errors.New("missing state name")
+		}
+		// The mirror isn't initialized, since it's meant to be read.
+		return &remote.State{Client: b.mirrorClient(name)}, nil
+	}
+
 	client, err := b.remoteClient(name)
 	if err != nil {
 		return nil, err
@@ -142,19 +349,11 @@ func (b *Backend) StateMgr(name string) (statemgr.Full, error) {
 	// If we need to force-unlock, but for some reason the state no longer
 	// exists, the user will have to use aws tools to manually fix the
 	// situation.
-	existing, err := b.Workspaces()
+	exists, err := b.workspaceExists(name)
 	if err != nil {
 		return nil, err
 	}
 
-	exists := false
-	for _, s := range existing {
-		if s == name {
-			exists = true
-			break
-		}
-	}
-
 	// We need to create the object so it's listed by States.
 	if !exists {
 		// take a lock on this state while we write it
@@ -173,6 +372,15 @@ func (b *Backend) StateMgr(name string) (statemgr.Full, error) {
 			return parent
 		}
 
+		// Without locking, another initializer may be writing the state
+		// right now, so give its write the chance to land.
+		if b.newStateReadRetries > 0 {
+			if err := client.waitForNewState(b.newStateReadRetries); err != nil {
+				err = lockUnlock(err)
+				return nil, err
+			}
+		}
+
 		// Grab the value
 		// This is to ensure that no one beat us to writing a state between
 		// the `exists` check and taking the lock.
@@ -191,6 +399,20 @@ func (b *Backend) StateMgr(name string) (statemgr.Full, error) {
 				err = lockUnlock(err)
 				return nil, err
 			}
+			if b.writeInitMarker {
+				if err := client.putInitMarker(lockInfo); err != nil {
+					log.Printf("[WARN] Failed to write init marker for state %q: %s", client.path, err)
+				}
+			}
+		}
+
+		// The workspace is added to the index while its state is locked, so
+		// that it's not deleted in between.
+		if b.workspaceIndexKey != "" && name != backend.DefaultStateName {
+			if err := b.addIndexedWorkspace(name); err != nil {
+				err = lockUnlock(err)
+				return nil, err
+			}
 		}
 
 		// Unlock, the state should now be initialized
@@ -204,11 +426,52 @@ func (b *Backend) StateMgr(name string) (statemgr.Full, error) {
 }
 
 func (b *Backend) path(name string) string {
-	if name == backend.DefaultStateName {
+	if prefix, suffix, ok := b.keyTemplate(); ok {
+		return normalizeKey(b.keyCase, prefix+name+suffix)
+	}
+
+	if name == backend.DefaultStateName && !b.unifyWorkspacePaths {
 		return b.keyName
 	}
 
-	return path.Join(b.workspaceKeyPrefix, name, b.keyName)
+	return normalizeKey(b.keyCase, path.Join(b.workspaceKeyPrefix, name, b.keyName))
+}
+
+const (
+	keyCaseLower = "lower"
+	keyCaseUpper = "upper"
+)
+
+// normalizeKeyCase applies the configured key_case normalization to an object
+// key, so that keys are predictable on case-insensitive S3-compatible stores.
+// The "${workspace}" placeholder is kept as is.
+func normalizeKeyCase(keyCase, key string) string {
+	var normalize func(string) string
+	switch keyCase {
+	case keyCaseLower:
+		normalize = strings.ToLower
+	case keyCaseUpper:
+		normalize = strings.ToUpper
+	default:
+		return key
+	}
+
+	parts := strings.Split(key, workspacePlaceholder)
+	for i, part := range parts {
+		parts[i] = normalize(part)
+	}
+	return strings.Join(parts, workspacePlaceholder)
+}
+
+// workspacePlaceholder is replaced by the workspace name in a key, which then
+// determines the state path of every workspace instead of the
+// workspace_key_prefix.
+const workspacePlaceholder = "${workspace}"
+
+// keyTemplate returns the parts of the key before and after the workspace
+// placeholder, if the key contains one.
+func (b *Backend) keyTemplate() (prefix, suffix string, ok bool) {
+	return strings.Cut(b.keyName, workspacePlaceholder)
 }
 
 const errStateUnlock = `
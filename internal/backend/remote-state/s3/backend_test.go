@@ -6,9 +6,13 @@ package s3
 import (
 	"encoding/base64"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -53,11 +57,12 @@ func TestBackend_impl(t *testing.T) {
 func TestBackendConfig_original(t *testing.T) {
 	testACC(t)
 	config := map[string]interface{}{
-		"region":         "us-west-1",
-		"bucket":         "tf-test",
-		"key":            "state",
-		"encrypt":        true,
-		"dynamodb_table": "dynamoTable",
+		"region":                        "us-west-1",
+		"bucket":                        "tf-test",
+		"key":                           "state",
+		"encrypt":                       true,
+		"dynamodb_table":                "dynamoTable",
+		"dynamodb_table_missing_action": "warn",
 	}
 
 	b := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(config)).(*Backend)
@@ -689,17 +694,19 @@ func TestBackendConfig_PrepareConfigValidation(t *testing.T) {
 		},
 		"null region": {
 			config: cty.ObjectVal(map[string]cty.Value{
-				"bucket": cty.StringVal("test"),
-				"key":    cty.StringVal("test"),
-				"region": cty.NullVal(cty.String),
+				"bucket":                  cty.StringVal("test"),
+				"key":                     cty.StringVal("test"),
+				"region":                  cty.NullVal(cty.String),
+				"skip_metadata_api_check": cty.True,
 			}),
 			expectedErr: `The "region" attribute or the "AWS_REGION" or "AWS_DEFAULT_REGION" environment variables must be set.`,
 		},
 		"empty region": {
 			config: cty.ObjectVal(map[string]cty.Value{
-				"bucket": cty.StringVal("test"),
-				"key":    cty.StringVal("test"),
-				"region": cty.StringVal(""),
+				"bucket":                  cty.StringVal("test"),
+				"key":                     cty.StringVal("test"),
+				"region":                  cty.StringVal(""),
+				"skip_metadata_api_check": cty.True,
 			}),
 			expectedErr: `The "region" attribute or the "AWS_REGION" or "AWS_DEFAULT_REGION" environment variables must be set.`,
 		},
@@ -732,6 +739,770 @@ func TestBackendConfig_PrepareConfigValidation(t *testing.T) {
 			}),
 			expectedErr: `Only one of "kms_key_id" and "sse_customer_key" can be set`,
 		},
+		"customer key and customer key file": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                cty.StringVal("test"),
+				"key":                   cty.StringVal("test"),
+				"region":                cty.StringVal("us-west-2"),
+				"sse_customer_key":      cty.StringVal("1hwbcNPGWL+AwDiyGmRidTWAEVmCWMKbEHA+Es8w75o="),
+				"sse_customer_key_file": cty.StringVal("sse_customer_key"),
+			}),
+			expectedErr: `Only one of "sse_customer_key" and "sse_customer_key_file" can be set.`,
+		},
+		"kms key and customer key file": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                cty.StringVal("test"),
+				"key":                   cty.StringVal("test"),
+				"region":                cty.StringVal("us-west-2"),
+				"sse_customer_key_file": cty.StringVal("sse_customer_key"),
+				"kms_key_id":            cty.StringVal("alias/state"),
+			}),
+			expectedErr: `Only one of "kms_key_id" and "sse_customer_key_file" can be set`,
+		},
+		"negative lock_retry_max_attempts": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                  cty.StringVal("test"),
+				"key":                     cty.StringVal("test"),
+				"region":                  cty.StringVal("us-west-2"),
+				"lock_retry_max_attempts": cty.NumberIntVal(-1),
+			}),
+			expectedErr: `The "lock_retry_max_attempts" attribute value must not be negative.`,
+		},
+		"max_retries negative": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":      cty.StringVal("test"),
+				"key":         cty.StringVal("test"),
+				"region":      cty.StringVal("us-west-2"),
+				"max_retries": cty.NumberIntVal(-1),
+			}),
+			expectedErr: `The "max_retries" attribute value must be between 0 and 100.`,
+		},
+		"max_retries zero": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":      cty.StringVal("test"),
+				"key":         cty.StringVal("test"),
+				"region":      cty.StringVal("us-west-2"),
+				"max_retries": cty.NumberIntVal(0),
+			}),
+		},
+		"max_retries at limit": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":      cty.StringVal("test"),
+				"key":         cty.StringVal("test"),
+				"region":      cty.StringVal("us-west-2"),
+				"max_retries": cty.NumberIntVal(100),
+			}),
+		},
+		"max_retries above limit": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":      cty.StringVal("test"),
+				"key":         cty.StringVal("test"),
+				"region":      cty.StringVal("us-west-2"),
+				"max_retries": cty.NumberIntVal(101),
+			}),
+			expectedErr: `The "max_retries" attribute value must be between 0 and 100.`,
+		},
+		"max_retry_delay zero": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":          cty.StringVal("test"),
+				"key":             cty.StringVal("test"),
+				"region":          cty.StringVal("us-west-2"),
+				"max_retry_delay": cty.NumberIntVal(0),
+			}),
+			expectedErr: `The "max_retry_delay" attribute value must be at least 1 second.`,
+		},
+		"key with repeated workspace placeholder": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("${workspace}/${workspace}.tfstate"),
+				"region": cty.StringVal("us-west-2"),
+			}),
+			expectedErr: `The "key" attribute value must not contain the "${workspace}" placeholder more than once.`,
+		},
+		"key with workspace placeholder and workspace_key_prefix": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":               cty.StringVal("test"),
+				"key":                  cty.StringVal("stacks/${workspace}.tfstate"),
+				"region":               cty.StringVal("us-west-2"),
+				"workspace_key_prefix": cty.StringVal("env"),
+			}),
+			expectedErr: `The "workspace_key_prefix" attribute cannot be combined with a "key" containing the "${workspace}" placeholder`,
+		},
+		"key with workspace placeholder": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("stacks/${workspace}.tfstate"),
+				"region": cty.StringVal("us-west-2"),
+			}),
+		},
+		"bucket in allowed_buckets": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":          cty.StringVal("test"),
+				"key":             cty.StringVal("test"),
+				"region":          cty.StringVal("us-west-2"),
+				"allowed_buckets": cty.SetVal([]cty.Value{cty.StringVal("prod"), cty.StringVal("test")}),
+			}),
+		},
+		"bucket not in allowed_buckets": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":          cty.StringVal("tset"),
+				"key":             cty.StringVal("test"),
+				"region":          cty.StringVal("us-west-2"),
+				"allowed_buckets": cty.SetVal([]cty.Value{cty.StringVal("prod"), cty.StringVal("test")}),
+			}),
+			expectedErr: `The bucket "tset" is not in the list of allowed buckets: "prod", "test".`,
+		},
+		"workspace_buckets with empty bucket": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":            cty.StringVal("test"),
+				"key":               cty.StringVal("test"),
+				"region":            cty.StringVal("us-west-2"),
+				"workspace_buckets": cty.MapVal(map[string]cty.Value{"tenant": cty.StringVal("")}),
+			}),
+			expectedErr: `The bucket for workspace "tenant" must not be empty.`,
+		},
+		"workspace_buckets not in allowed_buckets": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":            cty.StringVal("test"),
+				"key":               cty.StringVal("test"),
+				"region":            cty.StringVal("us-west-2"),
+				"allowed_buckets":   cty.SetVal([]cty.Value{cty.StringVal("prod"), cty.StringVal("test")}),
+				"workspace_buckets": cty.MapVal(map[string]cty.Value{"tenant": cty.StringVal("tenant")}),
+			}),
+			expectedErr: `The bucket "tenant" is not in the list of allowed buckets: "prod", "test".`,
+		},
+		"custom_headers with invalid name": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":         cty.StringVal("test"),
+				"key":            cty.StringVal("test"),
+				"region":         cty.StringVal("us-west-2"),
+				"custom_headers": cty.MapVal(map[string]cty.Value{"X Gateway Token": cty.StringVal("secret")}),
+			}),
+			expectedErr: `The header name "X Gateway Token" is not a valid HTTP header name.`,
+		},
+		"custom_headers with SDK header": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":         cty.StringVal("test"),
+				"key":            cty.StringVal("test"),
+				"region":         cty.StringVal("us-west-2"),
+				"custom_headers": cty.MapVal(map[string]cty.Value{"x-amz-date": cty.StringVal("now")}),
+			}),
+			expectedErr: `The header "x-amz-date" is set by the AWS SDK and cannot be overridden.`,
+		},
+		"invalid signing_name": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":       cty.StringVal("test"),
+				"key":          cty.StringVal("test"),
+				"region":       cty.StringVal("us-west-2"),
+				"endpoint":     cty.StringVal("https://s3.example.com"),
+				"signing_name": cty.StringVal("S3 Gateway"),
+			}),
+			expectedErr: `The value "S3 Gateway" must only contain lowercase letters, digits, and dashes.`,
+		},
+		"empty signing_region": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":         cty.StringVal("test"),
+				"key":            cty.StringVal("test"),
+				"region":         cty.StringVal("us-west-2"),
+				"endpoint":       cty.StringVal("https://s3.example.com"),
+				"signing_region": cty.StringVal(""),
+			}),
+			expectedErr: `The value "" must only contain lowercase letters, digits, and dashes.`,
+		},
+		"unify_workspace_paths with key placeholder": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                cty.StringVal("test"),
+				"key":                   cty.StringVal("states/${workspace}.tfstate"),
+				"region":                cty.StringVal("us-west-2"),
+				"unify_workspace_paths": cty.True,
+			}),
+			expectedErr: `The "unify_workspace_paths" attribute cannot be combined with a "key" containing the "${workspace}" placeholder`,
+		},
+		"invalid malformed_lock_action": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                cty.StringVal("test"),
+				"key":                   cty.StringVal("test"),
+				"region":                cty.StringVal("us-west-2"),
+				"malformed_lock_action": cty.StringVal("ignore"),
+			}),
+			expectedErr: `The "malformed_lock_action" attribute value must be "error" or "takeover".`,
+		},
+		"invalid retry_on": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":   cty.StringVal("test"),
+				"key":      cty.StringVal("test"),
+				"region":   cty.StringVal("us-west-2"),
+				"retry_on": cty.SetVal([]cty.Value{cty.StringVal("5xx"), cty.StringVal("4xx")}),
+			}),
+			expectedErr: `The error class "4xx" is not valid. Valid classes are "5xx", "throttling" and "timeout".`,
+		},
+		"empty retry_on": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":   cty.StringVal("test"),
+				"key":      cty.StringVal("test"),
+				"region":   cty.StringVal("us-west-2"),
+				"retry_on": cty.SetValEmpty(cty.String),
+			}),
+			expectedErr: `The "retry_on" attribute value must not be empty.`,
+		},
+		"grant with acl": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("test"),
+				"region": cty.StringVal("us-west-2"),
+				"acl":    cty.StringVal("private"),
+				"grant": cty.SetVal([]cty.Value{
+					cty.ObjectVal(map[string]cty.Value{
+						"type":        cty.StringVal("CanonicalUser"),
+						"id":          cty.StringVal("79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be"),
+						"uri":         cty.NullVal(cty.String),
+						"permissions": cty.SetVal([]cty.Value{cty.StringVal("READ")}),
+					}),
+				}),
+			}),
+			expectedErr: `Only one of "acl" and "grant" can be set`,
+		},
+		"grant with workspace_acls": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("test"),
+				"region": cty.StringVal("us-west-2"),
+				"workspace_acls": cty.MapVal(map[string]cty.Value{
+					"tenant": cty.StringVal("private"),
+				}),
+				"grant": cty.SetVal([]cty.Value{
+					cty.ObjectVal(map[string]cty.Value{
+						"type":        cty.StringVal("CanonicalUser"),
+						"id":          cty.StringVal("79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be"),
+						"uri":         cty.NullVal(cty.String),
+						"permissions": cty.SetVal([]cty.Value{cty.StringVal("READ")}),
+					}),
+				}),
+			}),
+			expectedErr: `Only one of "workspace_acls" and "grant" can be set`,
+		},
+		"invalid acl": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("test"),
+				"region": cty.StringVal("us-west-2"),
+				"acl":    cty.StringVal("owner-full-control"),
+			}),
+			expectedErr: `The value "owner-full-control" is not a canned ACL.`,
+		},
+		"invalid workspace_acls value": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("test"),
+				"region": cty.StringVal("us-west-2"),
+				"workspace_acls": cty.MapVal(map[string]cty.Value{
+					"tenant": cty.StringVal("Private"),
+				}),
+			}),
+			expectedErr: `The value "Private" is not a canned ACL.`,
+		},
+		"workspace_index_key with trailing slash": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":              cty.StringVal("test"),
+				"key":                 cty.StringVal("test"),
+				"region":              cty.StringVal("us-west-2"),
+				"workspace_index_key": cty.StringVal("index/"),
+			}),
+			expectedErr: `The "workspace_index_key" attribute value must not be empty, and must not start or end with "/".`,
+		},
+		"forbid_imds with skip_metadata_api_check false": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                  cty.StringVal("test"),
+				"key":                     cty.StringVal("test"),
+				"region":                  cty.StringVal("us-west-2"),
+				"forbid_imds":             cty.True,
+				"skip_metadata_api_check": cty.False,
+			}),
+			expectedErr: `The "skip_metadata_api_check" attribute cannot be set to false when "forbid_imds" is set`,
+		},
+		"forbid_imds with ec2 credentials source": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                      cty.StringVal("test"),
+				"key":                         cty.StringVal("test"),
+				"region":                      cty.StringVal("us-west-2"),
+				"forbid_imds":                 cty.True,
+				"credentials_source_priority": cty.ListVal([]cty.Value{cty.StringVal("static"), cty.StringVal("ec2")}),
+			}),
+			expectedErr: `The credentials source "ec2" reads credentials from the EC2 instance metadata service, which "forbid_imds" forbids.`,
+		},
+		"connect_timeout too short": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":          cty.StringVal("test"),
+				"key":             cty.StringVal("test"),
+				"region":          cty.StringVal("us-west-2"),
+				"connect_timeout": cty.NumberIntVal(0),
+			}),
+			expectedErr: `The "connect_timeout" attribute value must be at least 1 second.`,
+		},
+		"grant Group with id": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("test"),
+				"region": cty.StringVal("us-west-2"),
+				"grant": cty.SetVal([]cty.Value{
+					cty.ObjectVal(map[string]cty.Value{
+						"type":        cty.StringVal("Group"),
+						"id":          cty.StringVal("79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be"),
+						"uri":         cty.NullVal(cty.String),
+						"permissions": cty.SetVal([]cty.Value{cty.StringVal("READ")}),
+					}),
+				}),
+			}),
+			expectedErr: `A grant of type "Group" must set "uri".`,
+		},
+		"grant invalid type": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("test"),
+				"region": cty.StringVal("us-west-2"),
+				"grant": cty.SetVal([]cty.Value{
+					cty.ObjectVal(map[string]cty.Value{
+						"type":        cty.StringVal("AmazonCustomerByEmail"),
+						"id":          cty.StringVal("user@example.com"),
+						"uri":         cty.NullVal(cty.String),
+						"permissions": cty.SetVal([]cty.Value{cty.StringVal("READ")}),
+					}),
+				}),
+			}),
+			expectedErr: `The grant type must be "CanonicalUser" or "Group", got "AmazonCustomerByEmail".`,
+		},
+		"grant invalid permission": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("test"),
+				"region": cty.StringVal("us-west-2"),
+				"grant": cty.SetVal([]cty.Value{
+					cty.ObjectVal(map[string]cty.Value{
+						"type":        cty.StringVal("Group"),
+						"id":          cty.NullVal(cty.String),
+						"uri":         cty.StringVal("http://acs.amazonaws.com/groups/global/AllUsers"),
+						"permissions": cty.SetVal([]cty.Value{cty.StringVal("WRITE")}),
+					}),
+				}),
+			}),
+			expectedErr: `The permission "WRITE" cannot be granted on the state file.`,
+		},
+		"grant valid": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("test"),
+				"region": cty.StringVal("us-west-2"),
+				"grant": cty.SetVal([]cty.Value{
+					cty.ObjectVal(map[string]cty.Value{
+						"type":        cty.StringVal("Group"),
+						"id":          cty.NullVal(cty.String),
+						"uri":         cty.StringVal("http://acs.amazonaws.com/groups/global/AllUsers"),
+						"permissions": cty.SetVal([]cty.Value{cty.StringVal("READ"), cty.StringVal("READ_ACP")}),
+					}),
+				}),
+			}),
+		},
+		"sso_endpoint without host": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":       cty.StringVal("test"),
+				"key":          cty.StringVal("test"),
+				"region":       cty.StringVal("us-gov-west-1"),
+				"sso_endpoint": cty.StringVal("https://"),
+			}),
+			expectedErr: `The endpoint "https://" must be an HTTPS or HTTP URL with a host.`,
+		},
+		"sso_endpoint invalid scheme": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":       cty.StringVal("test"),
+				"key":          cty.StringVal("test"),
+				"region":       cty.StringVal("us-gov-west-1"),
+				"sso_endpoint": cty.StringVal("ftp://portal.sso.us-gov-west-1.amazonaws.com"),
+			}),
+			expectedErr: `The endpoint "ftp://portal.sso.us-gov-west-1.amazonaws.com" must be an HTTPS or HTTP URL with a host.`,
+		},
+		"sso_endpoint in another region": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":       cty.StringVal("test"),
+				"key":          cty.StringVal("test"),
+				"region":       cty.StringVal("us-gov-east-1"),
+				"sso_endpoint": cty.StringVal("https://portal.sso.us-gov-west-1.amazonaws.com"),
+			}),
+		},
+		"state_growth_warn_ratio not above 1": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                  cty.StringVal("test"),
+				"key":                     cty.StringVal("test"),
+				"region":                  cty.StringVal("us-west-2"),
+				"state_growth_warn_ratio": cty.NumberFloatVal(1),
+			}),
+			expectedErr: `The "state_growth_warn_ratio" attribute value must be greater than 1.`,
+		},
+		"http_request_timeout zero": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":               cty.StringVal("test"),
+				"key":                  cty.StringVal("test"),
+				"region":               cty.StringVal("us-west-2"),
+				"http_request_timeout": cty.NumberIntVal(0),
+			}),
+			expectedErr: `The "http_request_timeout" attribute value must be at least 1 second.`,
+		},
+		"credentials_source_priority empty": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                      cty.StringVal("test"),
+				"key":                         cty.StringVal("test"),
+				"region":                      cty.StringVal("us-west-2"),
+				"credentials_source_priority": cty.ListValEmpty(cty.String),
+			}),
+			expectedErr: `The "credentials_source_priority" attribute value must not be empty.`,
+		},
+		"credentials_source_priority invalid source": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                      cty.StringVal("test"),
+				"key":                         cty.StringVal("test"),
+				"region":                      cty.StringVal("us-west-2"),
+				"credentials_source_priority": cty.ListVal([]cty.Value{cty.StringVal("env"), cty.StringVal("sso")}),
+			}),
+			expectedErr: `The credentials source "sso" is not valid.`,
+		},
+		"credentials_source_priority duplicate source": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                      cty.StringVal("test"),
+				"key":                         cty.StringVal("test"),
+				"region":                      cty.StringVal("us-west-2"),
+				"credentials_source_priority": cty.ListVal([]cty.Value{cty.StringVal("env"), cty.StringVal("static"), cty.StringVal("env")}),
+			}),
+			expectedErr: `The credentials source "env" is listed more than once.`,
+		},
+		"object_expires duration": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":         cty.StringVal("test"),
+				"key":            cty.StringVal("test"),
+				"region":         cty.StringVal("us-west-2"),
+				"object_expires": cty.StringVal("168h"),
+			}),
+		},
+		"object_expires time": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":         cty.StringVal("test"),
+				"key":            cty.StringVal("test"),
+				"region":         cty.StringVal("us-west-2"),
+				"object_expires": cty.StringVal("2030-01-02T15:04:05Z"),
+			}),
+		},
+		"object_expires negative duration": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":         cty.StringVal("test"),
+				"key":            cty.StringVal("test"),
+				"region":         cty.StringVal("us-west-2"),
+				"object_expires": cty.StringVal("-1h"),
+			}),
+			expectedErr: `The "object_expires" attribute value is not valid: the duration must be positive.`,
+		},
+		"object_expires invalid": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":         cty.StringVal("test"),
+				"key":            cty.StringVal("test"),
+				"region":         cty.StringVal("us-west-2"),
+				"object_expires": cty.StringVal("next week"),
+			}),
+			expectedErr: `"next week" is neither a duration`,
+		},
+		"lock_metadata_env invalid name": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":            cty.StringVal("test"),
+				"key":               cty.StringVal("test"),
+				"region":            cty.StringVal("us-west-2"),
+				"lock_metadata_env": cty.SetVal([]cty.Value{cty.StringVal("CI_BUILD_URL"), cty.StringVal("CI=1")}),
+			}),
+			expectedErr: `The environment variable name "CI=1" is not valid.`,
+		},
+		"min_tls_version invalid": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":          cty.StringVal("test"),
+				"key":             cty.StringVal("test"),
+				"region":          cty.StringVal("us-west-2"),
+				"min_tls_version": cty.StringVal("1.1"),
+			}),
+			expectedErr: `The TLS version "1.1" is not valid. Valid versions are "1.2" and "1.3".`,
+		},
+		"check_serial without dynamodb_table": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":       cty.StringVal("test"),
+				"key":          cty.StringVal("test"),
+				"region":       cty.StringVal("us-west-2"),
+				"check_serial": cty.True,
+			}),
+			expectedErr: `The "check_serial" attribute requires "dynamodb_table" to be set`,
+		},
+		"require_locking without dynamodb_table": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":          cty.StringVal("test"),
+				"key":             cty.StringVal("test"),
+				"region":          cty.StringVal("us-west-2"),
+				"require_locking": cty.True,
+			}),
+			expectedErr: `The "require_locking" attribute requires a locking mechanism, but "dynamodb_table" is not set.`,
+		},
+		"require_locking with dynamodb_table": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":          cty.StringVal("test"),
+				"key":             cty.StringVal("test"),
+				"region":          cty.StringVal("us-west-2"),
+				"dynamodb_table":  cty.StringVal("table"),
+				"require_locking": cty.True,
+			}),
+		},
+		"require_locking with dynamodb_table_missing_action warn": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                        cty.StringVal("test"),
+				"key":                           cty.StringVal("test"),
+				"region":                        cty.StringVal("us-west-2"),
+				"dynamodb_table":                cty.StringVal("table"),
+				"dynamodb_table_missing_action": cty.StringVal("warn"),
+				"require_locking":               cty.True,
+			}),
+			expectedErr: `The "dynamodb_table_missing_action" attribute can't be "warn" when "require_locking" is set`,
+		},
+		"attempt_timeout zero": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":          cty.StringVal("test"),
+				"key":             cty.StringVal("test"),
+				"region":          cty.StringVal("us-west-2"),
+				"attempt_timeout": cty.NumberIntVal(0),
+			}),
+			expectedErr: `The "attempt_timeout" attribute value must be at least 1 second.`,
+		},
+		"require_key_suffix matching": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":             cty.StringVal("test"),
+				"key":                cty.StringVal("network/terraform.tfstate"),
+				"region":             cty.StringVal("us-west-2"),
+				"require_key_suffix": cty.StringVal(".tfstate"),
+			}),
+		},
+		"require_key_suffix not matching": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":             cty.StringVal("test"),
+				"key":                cty.StringVal("network/terraform"),
+				"region":             cty.StringVal("us-west-2"),
+				"require_key_suffix": cty.StringVal(".tfstate"),
+			}),
+			expectedErr: `The "key" attribute value "network/terraform" must end with ".tfstate", as required by "require_key_suffix".`,
+		},
+		"require_key_suffix matching after key_case": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":             cty.StringVal("test"),
+				"key":                cty.StringVal("network/terraform.TFSTATE"),
+				"region":             cty.StringVal("us-west-2"),
+				"key_case":           cty.StringVal("lower"),
+				"require_key_suffix": cty.StringVal(".tfstate"),
+			}),
+		},
+		"require_key_suffix empty": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":             cty.StringVal("test"),
+				"key":                cty.StringVal("test"),
+				"region":             cty.StringVal("us-west-2"),
+				"require_key_suffix": cty.StringVal(""),
+			}),
+			expectedErr: `The "require_key_suffix" attribute value must not be empty.`,
+		},
+		"lock_initial_jitter too long": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":              cty.StringVal("test"),
+				"key":                 cty.StringVal("test"),
+				"region":              cty.StringVal("us-west-2"),
+				"lock_initial_jitter": cty.NumberIntVal(120),
+			}),
+			expectedErr: `The "lock_initial_jitter" attribute value must be between 0 and 60 seconds.`,
+		},
+		"sharded_state with compress": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":        cty.StringVal("test"),
+				"key":           cty.StringVal("test"),
+				"region":        cty.StringVal("us-west-2"),
+				"sharded_state": cty.True,
+				"compress":      cty.True,
+			}),
+			expectedErr: `The "sharded_state" attribute can't be used with "compress"`,
+		},
+		"invalid read_endpoint": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":        cty.StringVal("test"),
+				"key":           cty.StringVal("test"),
+				"region":        cty.StringVal("us-west-2"),
+				"read_endpoint": cty.StringVal("ftp://cache.example.com"),
+			}),
+			expectedErr: `The endpoint "ftp://cache.example.com" must be an HTTPS or HTTP URL with a host.`,
+		},
+		"s3_compatible without endpoint": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":        cty.StringVal("test"),
+				"key":           cty.StringVal("test"),
+				"region":        cty.StringVal("us-west-2"),
+				"s3_compatible": cty.True,
+			}),
+			expectedErr: `The "s3_compatible" attribute requires the "endpoint" of the S3-compatible store to be set`,
+		},
+		"s3_compatible with credentials validation": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":                      cty.StringVal("test"),
+				"key":                         cty.StringVal("test"),
+				"region":                      cty.StringVal("us-west-2"),
+				"endpoint":                    cty.StringVal("https://minio.example.com"),
+				"s3_compatible":               cty.True,
+				"skip_credentials_validation": cty.False,
+			}),
+			expectedErr: `Credentials are validated with the STS API, which S3-compatible stores don't provide.`,
+		},
+		"negative lock_max_age": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":       cty.StringVal("test"),
+				"key":          cty.StringVal("test"),
+				"region":       cty.StringVal("us-west-2"),
+				"lock_max_age": cty.NumberIntVal(-1),
+			}),
+			expectedErr: `The "lock_max_age" attribute value must not be negative.`,
+		},
+		"invalid content_disposition": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":              cty.StringVal("test"),
+				"key":                 cty.StringVal("test"),
+				"region":              cty.StringVal("us-west-2"),
+				"content_disposition": cty.StringVal("attachment; filename=\"prod.tfstate\"\r\nX-Injected: true"),
+			}),
+			expectedErr: `is not a valid Content-Disposition header value: it must not contain control characters.`,
+		},
+		"malformed content_disposition": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":              cty.StringVal("test"),
+				"key":                 cty.StringVal("test"),
+				"region":              cty.StringVal("us-west-2"),
+				"content_disposition": cty.StringVal("attachment; filename"),
+			}),
+			expectedErr: `is not a valid Content-Disposition header value`,
+		},
+		"negative retry_budget": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":       cty.StringVal("test"),
+				"key":          cty.StringVal("test"),
+				"region":       cty.StringVal("us-west-2"),
+				"retry_budget": cty.NumberIntVal(-1),
+			}),
+			expectedErr: `The "retry_budget" attribute value must not be negative.`,
+		},
+		"invalid bucket name": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("My_Bucket"),
+				"key":    cty.StringVal("test"),
+				"region": cty.StringVal("us-west-2"),
+			}),
+			expectedErr: `The bucket name "My_Bucket" is not valid`,
+		},
+		"invalid workspace bucket name": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("test"),
+				"region": cty.StringVal("us-west-2"),
+				"workspace_buckets": cty.MapVal(map[string]cty.Value{
+					"prod": cty.StringVal("prod..state"),
+				}),
+			}),
+			expectedErr: `The bucket name "prod..state" is not valid`,
+		},
+		"pointer_target_key without key_is_pointer": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":             cty.StringVal("test"),
+				"key":                cty.StringVal("test"),
+				"region":             cty.StringVal("us-west-2"),
+				"pointer_target_key": cty.StringVal("versions/2"),
+			}),
+			expectedErr: `The "pointer_target_key" attribute requires "key_is_pointer" to be set.`,
+		},
+		"download_concurrency without download_part_size": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":               cty.StringVal("test"),
+				"key":                  cty.StringVal("test"),
+				"region":               cty.StringVal("us-west-2"),
+				"download_concurrency": cty.NumberIntVal(8),
+			}),
+			expectedErr: `The "download_concurrency" attribute requires "download_part_size" to be set.`,
+		},
+		"zero download_part_size": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":             cty.StringVal("test"),
+				"key":                cty.StringVal("test"),
+				"region":             cty.StringVal("us-west-2"),
+				"download_part_size": cty.NumberIntVal(0),
+			}),
+			expectedErr: `The "download_part_size" attribute value must be at least 1.`,
+		},
+		"max_redirects without follow_redirects": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":        cty.StringVal("test"),
+				"key":           cty.StringVal("test"),
+				"region":        cty.StringVal("us-west-2"),
+				"max_redirects": cty.NumberIntVal(3),
+			}),
+			expectedErr: `The "max_redirects" attribute requires "follow_redirects" to be set.`,
+		},
+		"max_redirects too large": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":           cty.StringVal("test"),
+				"key":              cty.StringVal("test"),
+				"region":           cty.StringVal("us-west-2"),
+				"follow_redirects": cty.True,
+				"max_redirects":    cty.NumberIntVal(11),
+			}),
+			expectedErr: `The "max_redirects" attribute value must be between 1 and 10.`,
+		},
+		"local_mirror_write without local_mirror_path": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":             cty.StringVal("test"),
+				"key":                cty.StringVal("test"),
+				"region":             cty.StringVal("us-west-2"),
+				"local_mirror_write": cty.True,
+			}),
+			expectedErr: `The "local_mirror_write" attribute requires "local_mirror_path" to be set.`,
+		},
+		"require_https with http endpoint": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":        cty.StringVal("test"),
+				"key":           cty.StringVal("test"),
+				"region":        cty.StringVal("us-west-2"),
+				"endpoint":      cty.StringVal("http://s3.example.com"),
+				"require_https": cty.True,
+			}),
+			expectedErr: `The endpoint "http://s3.example.com" uses plaintext HTTP`,
+		},
+		"require_https with http dynamodb_endpoint": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":            cty.StringVal("test"),
+				"key":               cty.StringVal("test"),
+				"region":            cty.StringVal("us-west-2"),
+				"dynamodb_endpoint": cty.StringVal("HTTP://dynamo.example.com"),
+				"require_https":     cty.True,
+			}),
+			expectedErr: `The endpoint "HTTP://dynamo.example.com" uses plaintext HTTP`,
+		},
+		"require_https with https endpoints": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":        cty.StringVal("test"),
+				"key":           cty.StringVal("test"),
+				"region":        cty.StringVal("us-west-2"),
+				"endpoint":      cty.StringVal("https://s3.example.com"),
+				"sts_endpoint":  cty.StringVal("sts.example.com"),
+				"require_https": cty.True,
+			}),
+		},
+		"http endpoint without require_https": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":   cty.StringVal("test"),
+				"key":      cty.StringVal("test"),
+				"region":   cty.StringVal("us-west-2"),
+				"endpoint": cty.StringVal("http://localhost:4566"),
+			}),
+		},
 	}
 
 	for name, tc := range cases {
@@ -797,6 +1568,97 @@ func TestBackendConfig_PrepareConfigWithEnvVars(t *testing.T) {
 			},
 			expectedErr: `Only one of "kms_key_id" and the environment variable "AWS_SSE_CUSTOMER_KEY" can be set`,
 		},
+		"require_https with http endpoint env var": {
+			config: cty.ObjectVal(map[string]cty.Value{
+				"bucket":        cty.StringVal("test"),
+				"key":           cty.StringVal("test"),
+				"region":        cty.StringVal("us-west-2"),
+				"require_https": cty.True,
+			}),
+			vars: map[string]string{
+				"AWS_S3_ENDPOINT": "http://s3.example.com",
+			},
+			expectedErr: `The environment variable "AWS_S3_ENDPOINT" value "http://s3.example.com" uses plaintext HTTP`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			oldEnv := stashEnv()
+			defer popEnv(oldEnv)
+
+			b := New()
+
+			for k, v := range tc.vars {
+				os.Setenv(k, v)
+			}
+
+			_, valDiags := b.PrepareConfig(populateSchema(t, b.ConfigSchema(), tc.config))
+			if tc.expectedErr != "" {
+				if valDiags.Err() != nil {
+					actualErr := valDiags.Err().Error()
+					if !strings.Contains(actualErr, tc.expectedErr) {
+						t.Fatalf("unexpected validation result: %v", valDiags.Err())
+					}
+				} else {
+					t.Fatal("expected an error, got none")
+				}
+			} else if valDiags.Err() != nil {
+				t.Fatalf("expected no error, got %s", valDiags.Err())
+			}
+		})
+	}
+}
+
+func TestBackendConfig_DualStack(t *testing.T) {
+	cases := map[string]struct {
+		region      string
+		dualStack   bool
+		endpoint    string
+		vars        map[string]string
+		expectedErr string
+	}{
+		"commercial region": {
+			region:    "us-west-2",
+			dualStack: true,
+		},
+		"china region": {
+			region:    "cn-north-1",
+			dualStack: true,
+		},
+		"region without dualstack endpoint": {
+			region:      "us-iso-east-1",
+			dualStack:   true,
+			expectedErr: `The region "us-iso-east-1" has no dual-stack S3 endpoint.`,
+		},
+		"region without dualstack endpoint disabled": {
+			region: "us-iso-east-1",
+		},
+		"region from env var without dualstack endpoint": {
+			dualStack: true,
+			vars: map[string]string{
+				"AWS_REGION": "us-isob-east-1",
+			},
+			expectedErr: `The region "us-isob-east-1" has no dual-stack S3 endpoint.`,
+		},
+		"custom endpoint": {
+			region:      "us-west-2",
+			dualStack:   true,
+			endpoint:    "https://s3.example.com",
+			expectedErr: `The custom endpoint "https://s3.example.com" cannot be combined with "use_dualstack_endpoint"`,
+		},
+		"custom endpoint disabled": {
+			region:   "us-west-2",
+			endpoint: "https://s3.example.com",
+		},
+		"custom endpoint env var": {
+			region:    "us-west-2",
+			dualStack: true,
+			vars: map[string]string{
+				"AWS_S3_ENDPOINT": "https://s3.example.com",
+			},
+			expectedErr: `The custom endpoint "https://s3.example.com" from the environment variable "AWS_S3_ENDPOINT" cannot be combined`,
+		},
 	}
 
 	for name, tc := range cases {
@@ -804,25 +1666,304 @@ func TestBackendConfig_PrepareConfigWithEnvVars(t *testing.T) {
 			oldEnv := stashEnv()
 			defer popEnv(oldEnv)
 
+			for k, v := range tc.vars {
+				os.Setenv(k, v)
+			}
+
+			config := map[string]cty.Value{
+				"bucket":                 cty.StringVal("test"),
+				"key":                    cty.StringVal("test"),
+				"use_dualstack_endpoint": cty.BoolVal(tc.dualStack),
+			}
+			if tc.region != "" {
+				config["region"] = cty.StringVal(tc.region)
+			}
+			if tc.endpoint != "" {
+				config["endpoint"] = cty.StringVal(tc.endpoint)
+			}
+
 			b := New()
+			_, valDiags := b.PrepareConfig(populateSchema(t, b.ConfigSchema(), cty.ObjectVal(config)))
+			if tc.expectedErr != "" {
+				if valDiags.Err() == nil {
+					t.Fatal("expected an error, got none")
+				}
+				if !strings.Contains(valDiags.Err().Error(), tc.expectedErr) {
+					t.Fatalf("unexpected validation result: %v", valDiags.Err())
+				}
+			} else if valDiags.Err() != nil {
+				t.Fatalf("expected no error, got %s", valDiags.Err())
+			}
+		})
+	}
+}
+
+func TestBackendConfig_DynamoDBRegion(t *testing.T) {
+	testCases := map[string]struct {
+		dynamoDBRegion string
+		expectedRegion string
+		expectedErr    string
+	}{
+		"default": {
+			expectedRegion: "us-west-2",
+		},
+		"configured": {
+			dynamoDBRegion: "eu-central-1",
+			expectedRegion: "eu-central-1",
+		},
+		"invalid": {
+			dynamoDBRegion: "nowhere-1",
+			expectedErr:    "Invalid dynamodb_region value",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			config := map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         "key",
+				"region":                      "us-west-2",
+				"skip_credentials_validation": true,
+			}
+			if tc.dynamoDBRegion != "" {
+				config["dynamodb_region"] = tc.dynamoDBRegion
+			}
+
+			b, diags := configureBackend(t, config)
+			if tc.expectedErr != "" {
+				if !strings.Contains(diagnosticsString(diags), tc.expectedErr) {
+					t.Fatalf("expected error %q, got: %s", tc.expectedErr, diagnosticsString(diags))
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+			}
+
+			if got := aws.StringValue(b.dynClient.Config.Region); got != tc.expectedRegion {
+				t.Errorf("expected DynamoDB region %q, got %q", tc.expectedRegion, got)
+			}
+			if got := aws.StringValue(b.s3Client.Config.Region); got != "us-west-2" {
+				t.Errorf("expected S3 region %q, got %q", "us-west-2", got)
+			}
+		})
+	}
+}
+
+func TestBackendConfig_ReadWriteEndpoints(t *testing.T) {
+	testCases := map[string]struct {
+		config               map[string]any
+		expectedEndpoint     string
+		expectedReadEndpoint string
+	}{
+		"endpoint only": {
+			config: map[string]any{
+				"endpoint": "https://s3.example.com",
+			},
+			expectedEndpoint: "https://s3.example.com",
+		},
+		"read_endpoint": {
+			config: map[string]any{
+				"read_endpoint": "https://cache.example.com",
+			},
+			expectedEndpoint:     "https://s3.us-west-2.amazonaws.com",
+			expectedReadEndpoint: "https://cache.example.com",
+		},
+		"read_endpoint and write_endpoint": {
+			config: map[string]any{
+				"endpoint":       "https://s3.example.com",
+				"read_endpoint":  "https://cache.example.com",
+				"write_endpoint": "https://s3.us-west-2.amazonaws.com",
+			},
+			expectedEndpoint:     "https://s3.us-west-2.amazonaws.com",
+			expectedReadEndpoint: "https://cache.example.com",
+		},
+		"write_endpoint reads from endpoint": {
+			config: map[string]any{
+				"endpoint":       "https://cache.example.com",
+				"write_endpoint": "https://s3.us-west-2.amazonaws.com",
+			},
+			expectedEndpoint:     "https://s3.us-west-2.amazonaws.com",
+			expectedReadEndpoint: "https://cache.example.com",
+		},
+		"same endpoints": {
+			config: map[string]any{
+				"read_endpoint":  "https://s3.example.com",
+				"write_endpoint": "https://s3.example.com",
+			},
+			expectedEndpoint: "https://s3.example.com",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			config := map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         "key",
+				"region":                      "us-west-2",
+				"skip_credentials_validation": true,
+			}
+			for k, v := range tc.config {
+				config[k] = v
+			}
+
+			b, diags := configureBackend(t, config)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+			}
+
+			if b.s3Client.Endpoint != tc.expectedEndpoint {
+				t.Errorf("expected endpoint %q, got %q", tc.expectedEndpoint, b.s3Client.Endpoint)
+			}
+			var readEndpoint string
+			if b.s3ReadClient != nil {
+				readEndpoint = b.s3ReadClient.Endpoint
+			}
+			if readEndpoint != tc.expectedReadEndpoint {
+				t.Errorf("expected read endpoint %q, got %q", tc.expectedReadEndpoint, readEndpoint)
+			}
+		})
+	}
+}
+
+func TestBackendConfig_EndpointRegion(t *testing.T) {
+	cases := map[string]struct {
+		region          string
+		endpoints       map[string]string
+		vars            map[string]string
+		expectedWarning string
+	}{
+		"matching region": {
+			region: "us-west-2",
+			endpoints: map[string]string{
+				"endpoint":          "https://s3.us-west-2.amazonaws.com",
+				"dynamodb_endpoint": "https://dynamodb.us-west-2.amazonaws.com",
+			},
+		},
+		"mismatched endpoint": {
+			region: "us-west-2",
+			endpoints: map[string]string{
+				"endpoint": "https://s3.eu-west-1.amazonaws.com",
+			},
+			expectedWarning: `The endpoint "https://s3.eu-west-1.amazonaws.com" is in the region "eu-west-1", but the configured region is "us-west-2".`,
+		},
+		"mismatched legacy endpoint": {
+			region: "us-west-2",
+			endpoints: map[string]string{
+				"endpoint": "s3-us-east-2.amazonaws.com",
+			},
+			expectedWarning: `The endpoint "s3-us-east-2.amazonaws.com" is in the region "us-east-2"`,
+		},
+		"mismatched dynamodb_endpoint": {
+			region: "us-west-2",
+			endpoints: map[string]string{
+				"dynamodb_endpoint": "https://dynamodb.us-east-1.amazonaws.com",
+			},
+			expectedWarning: `The endpoint "https://dynamodb.us-east-1.amazonaws.com" is in the region "us-east-1"`,
+		},
+		"dynamodb_endpoint in dynamodb_region": {
+			region: "us-west-2",
+			endpoints: map[string]string{
+				"dynamodb_endpoint": "https://dynamodb.us-east-1.amazonaws.com",
+				"dynamodb_region":   "us-east-1",
+			},
+		},
+		"dynamodb_endpoint outside dynamodb_region": {
+			region: "us-west-2",
+			endpoints: map[string]string{
+				"dynamodb_endpoint": "https://dynamodb.us-west-2.amazonaws.com",
+				"dynamodb_region":   "us-east-1",
+			},
+			expectedWarning: `is in the region "us-west-2", but the configured region is "us-east-1".`,
+		},
+		"mismatched china endpoint": {
+			region: "cn-north-1",
+			endpoints: map[string]string{
+				"endpoint": "https://s3.cn-northwest-1.amazonaws.com.cn",
+			},
+			expectedWarning: `is in the region "cn-northwest-1", but the configured region is "cn-north-1".`,
+		},
+		"region from env var": {
+			endpoints: map[string]string{
+				"endpoint": "https://s3.eu-west-1.amazonaws.com",
+			},
+			vars: map[string]string{
+				"AWS_REGION": "us-west-2",
+			},
+			expectedWarning: `but the configured region is "us-west-2".`,
+		},
+		"endpoint from env var": {
+			region: "us-west-2",
+			vars: map[string]string{
+				"AWS_S3_ENDPOINT": "https://s3.eu-west-1.amazonaws.com",
+			},
+			expectedWarning: `from the environment variable "AWS_S3_ENDPOINT" is in the region "eu-west-1"`,
+		},
+		"global endpoint": {
+			region: "us-west-2",
+			endpoints: map[string]string{
+				"endpoint":     "https://s3.amazonaws.com",
+				"iam_endpoint": "https://iam.amazonaws.com",
+			},
+		},
+		"custom endpoint": {
+			region: "us-west-2",
+			endpoints: map[string]string{
+				"endpoint": "https://s3.eu-west-1.example.com",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			oldEnv := stashEnv()
+			defer popEnv(oldEnv)
 
 			for k, v := range tc.vars {
 				os.Setenv(k, v)
 			}
 
-			_, valDiags := b.PrepareConfig(populateSchema(t, b.ConfigSchema(), tc.config))
-			if tc.expectedErr != "" {
-				if valDiags.Err() != nil {
-					actualErr := valDiags.Err().Error()
-					if !strings.Contains(actualErr, tc.expectedErr) {
-						t.Fatalf("unexpected validation result: %v", valDiags.Err())
-					}
-				} else {
-					t.Fatal("expected an error, got none")
-				}
-			} else if valDiags.Err() != nil {
+			config := map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("test"),
+			}
+			if tc.region != "" {
+				config["region"] = cty.StringVal(tc.region)
+			}
+			for k, v := range tc.endpoints {
+				config[k] = cty.StringVal(v)
+			}
+
+			b := New()
+			_, valDiags := b.PrepareConfig(populateSchema(t, b.ConfigSchema(), cty.ObjectVal(config)))
+			if valDiags.HasErrors() {
 				t.Fatalf("expected no error, got %s", valDiags.Err())
 			}
+			if tc.expectedWarning == "" {
+				if len(valDiags) != 0 {
+					t.Fatalf("unexpected diagnostics: %s", diagnosticsString(valDiags))
+				}
+				return
+			}
+			if len(valDiags) != 1 {
+				t.Fatalf("expected 1 diagnostic, got %d: %s", len(valDiags), diagnosticsString(valDiags))
+			}
+			desc := valDiags[0].Description()
+			if valDiags[0].Severity() != tfdiags.Warning || desc.Summary != "Endpoint region mismatch" || !strings.Contains(desc.Detail, tc.expectedWarning) {
+				t.Fatalf("unexpected diagnostic: %s", diagnosticString(valDiags[0]))
+			}
 		})
 	}
 }
@@ -853,24 +1994,25 @@ func TestBackendLocked(t *testing.T) {
 	keyName := "test/state"
 
 	b1 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
-		"bucket":         bucketName,
-		"key":            keyName,
-		"encrypt":        true,
-		"dynamodb_table": bucketName,
-		"region":         "us-west-1",
+		"bucket":                        bucketName,
+		"key":                           keyName,
+		"encrypt":                       true,
+		"dynamodb_table":                bucketName,
+		"dynamodb_table_missing_action": "create",
+		"region":                        "us-west-1",
 	})).(*Backend)
 
 	b2 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
-		"bucket":         bucketName,
-		"key":            keyName,
-		"encrypt":        true,
-		"dynamodb_table": bucketName,
-		"region":         "us-west-1",
+		"bucket":                        bucketName,
+		"key":                           keyName,
+		"encrypt":                       true,
+		"dynamodb_table":                bucketName,
+		"dynamodb_table_missing_action": "create",
+		"region":                        "us-west-1",
 	})).(*Backend)
 
 	createS3Bucket(t, b1.s3Client, bucketName)
 	defer deleteS3Bucket(t, b1.s3Client, bucketName)
-	createDynamoDBTable(t, b1.dynClient, bucketName)
 	defer deleteDynamoDBTable(t, b1.dynClient, bucketName)
 
 	backend.TestBackendStateLocks(t, b1, b2)
@@ -1005,6 +2147,70 @@ func TestBackendSSECustomerKeyEnvVar(t *testing.T) {
 	}
 }
 
+func TestBackendSSECustomerKeyFile(t *testing.T) {
+	testCases := map[string]struct {
+		contents    string
+		missing     bool
+		expectedErr string
+	}{
+		"invalid length": {
+			contents:    "test",
+			expectedErr: `must be 44 characters in length`,
+		},
+		"invalid encoding": {
+			contents:    "====CT70aTYB2JGff7AjQtwbiLkwH4npICay1PWtmdka",
+			expectedErr: `must be base64 encoded`,
+		},
+		"missing file": {
+			missing:     true,
+			expectedErr: `Failed to read the customer-provided encryption key`,
+		},
+		"valid": {
+			contents: "4Dm1n4rphuFgawxuzY/bEfvLf6rYK0gIjfaDSLlfXNk=\n",
+		},
+	}
+
+	for name, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			keyFile := filepath.Join(t.TempDir(), "sse_customer_key")
+			if !testCase.missing {
+				if err := os.WriteFile(keyFile, []byte(testCase.contents), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			b, diags := configureBackend(t, map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"encrypt":                     true,
+				"key":                         "test-SSE-C",
+				"sse_customer_key_file":       keyFile,
+				"region":                      "us-west-1",
+				"skip_credentials_validation": true,
+			})
+
+			if testCase.expectedErr != "" {
+				if err := diags.Err(); err == nil || !strings.Contains(err.Error(), testCase.expectedErr) {
+					t.Fatalf("expected error %q, got %v", testCase.expectedErr, err)
+				}
+				return
+			}
+			if diags.Err() != nil {
+				t.Fatalf("expected no error, got %s", diags.Err())
+			}
+			if string(b.customerEncryptionKey) != string(must(base64.StdEncoding.DecodeString(strings.TrimSpace(testCase.contents)))) {
+				t.Fatal("unexpected value for customer encryption key")
+			}
+		})
+	}
+}
+
 // add some extra junk in S3 to try and confuse the env listing.
 func TestBackendExtraPaths(t *testing.T) {
 	testACC(t)
@@ -1106,131 +2312,807 @@ func TestBackendExtraPaths(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := s2Mgr.RefreshState(); err != nil {
-		t.Fatal(err)
+	if err := s2Mgr.RefreshState(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s2Mgr.(*remote.State).StateSnapshotMeta().Lineage == s2Lineage {
+		t.Fatal("state s2 was not deleted")
+	}
+	_ = s2Mgr.State() // We need the side-effect
+	s2Lineage = stateMgr.StateSnapshotMeta().Lineage
+
+	// add a state with a key that matches an existing environment dir name
+	client.path = b.workspaceKeyPrefix + "/s2/"
+	if err := stateMgr.WriteState(states.NewState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := stateMgr.PersistState(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// make sure s2 is OK
+	s2Mgr, err = b.StateMgr("s2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s2Mgr.RefreshState(); err != nil {
+		t.Fatal(err)
+	}
+
+	if stateMgr.StateSnapshotMeta().Lineage != s2Lineage {
+		t.Fatal("we got the wrong state for s2")
+	}
+
+	if err := checkStateList(b, []string{"default", "s1", "s2"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ensure we can separate the workspace prefix when it also matches the prefix
+// of the workspace name itself.
+func TestBackendPrefixInWorkspace(t *testing.T) {
+	testACC(t)
+	bucketName := fmt.Sprintf("terraform-remote-s3-test-%x", time.Now().Unix())
+
+	b := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
+		"bucket":               bucketName,
+		"key":                  "test-env.tfstate",
+		"workspace_key_prefix": "env",
+	})).(*Backend)
+
+	createS3Bucket(t, b.s3Client, bucketName)
+	defer deleteS3Bucket(t, b.s3Client, bucketName)
+
+	// get a state that contains the prefix as a substring
+	sMgr, err := b.StateMgr("env-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sMgr.RefreshState(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkStateList(b, []string{"default", "env-1"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyEnv(t *testing.T) {
+	testACC(t)
+	keyName := "some/paths/tfstate"
+
+	bucket0Name := fmt.Sprintf("terraform-remote-s3-test-%x-0", time.Now().Unix())
+	b0 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
+		"bucket":               bucket0Name,
+		"key":                  keyName,
+		"encrypt":              true,
+		"workspace_key_prefix": "",
+	})).(*Backend)
+
+	createS3Bucket(t, b0.s3Client, bucket0Name)
+	defer deleteS3Bucket(t, b0.s3Client, bucket0Name)
+
+	bucket1Name := fmt.Sprintf("terraform-remote-s3-test-%x-1", time.Now().Unix())
+	b1 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
+		"bucket":               bucket1Name,
+		"key":                  keyName,
+		"encrypt":              true,
+		"workspace_key_prefix": "project/env:",
+	})).(*Backend)
+
+	createS3Bucket(t, b1.s3Client, bucket1Name)
+	defer deleteS3Bucket(t, b1.s3Client, bucket1Name)
+
+	bucket2Name := fmt.Sprintf("terraform-remote-s3-test-%x-2", time.Now().Unix())
+	b2 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
+		"bucket":  bucket2Name,
+		"key":     keyName,
+		"encrypt": true,
+	})).(*Backend)
+
+	createS3Bucket(t, b2.s3Client, bucket2Name)
+	defer deleteS3Bucket(t, b2.s3Client, bucket2Name)
+
+	if err := testGetWorkspaceForKey(b0, "some/paths/tfstate", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := testGetWorkspaceForKey(b0, "ws1/some/paths/tfstate", "ws1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := testGetWorkspaceForKey(b1, "project/env:/ws1/some/paths/tfstate", "ws1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := testGetWorkspaceForKey(b1, "project/env:/ws2/some/paths/tfstate", "ws2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := testGetWorkspaceForKey(b2, "env:/ws3/some/paths/tfstate", "ws3"); err != nil {
+		t.Fatal(err)
+	}
+
+	backend.TestBackendStates(t, b0)
+	backend.TestBackendStates(t, b1)
+	backend.TestBackendStates(t, b2)
+}
+
+func TestBackendConfig_KeyFileReference(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return fileReferencePrefix + filename
+	}
+
+	cases := map[string]struct {
+		key                  string
+		workspaceKeyPrefix   string
+		expectedKey          string
+		expectedWorkspaceKey string
+		expectedErr          string
+	}{
+		"literal": {
+			key:                  "path/to/state",
+			expectedKey:          "path/to/state",
+			expectedWorkspaceKey: "env:",
+		},
+		"key file": {
+			key:                  writeFile("key", "path/to/state\n"),
+			expectedKey:          "path/to/state",
+			expectedWorkspaceKey: "env:",
+		},
+		"workspace_key_prefix file": {
+			key:                  "path/to/state",
+			workspaceKeyPrefix:   writeFile("prefix", "  tenants  "),
+			expectedKey:          "path/to/state",
+			expectedWorkspaceKey: "tenants",
+		},
+		"missing key file": {
+			key:         fileReferencePrefix + filepath.Join(dir, "missing"),
+			expectedErr: `The "key" file reference could not be read`,
+		},
+		"empty key file": {
+			key:         writeFile("empty", "\n"),
+			expectedErr: `The file referenced by the "key" attribute must not be empty.`,
+		},
+		"key file with leading slash": {
+			key:         writeFile("leading-slash", "/path/to/state"),
+			expectedErr: `The "key" attribute value must not start or end with with "/".`,
+		},
+		"workspace_key_prefix file with trailing slash": {
+			key:                "path/to/state",
+			workspaceKeyPrefix: writeFile("trailing-slash", "tenants/"),
+			expectedErr:        `The "workspace_key_prefix" attribute value must not start with "/".`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			config := map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         tc.key,
+				"region":                      "us-west-2",
+				"skip_credentials_validation": true,
+			}
+			if tc.workspaceKeyPrefix != "" {
+				config["workspace_key_prefix"] = tc.workspaceKeyPrefix
+			}
+
+			b, diags := configureBackend(t, config)
+			if tc.expectedErr != "" {
+				if !diags.HasErrors() {
+					t.Fatal("expected an error, got none")
+				}
+				if !strings.Contains(diags.Err().Error(), tc.expectedErr) {
+					t.Fatalf("unexpected error: %s", diags.Err())
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected error: %s", diags.Err())
+			}
+
+			if b.keyName != tc.expectedKey {
+				t.Errorf("expected key %q, got %q", tc.expectedKey, b.keyName)
+			}
+			if b.workspaceKeyPrefix != tc.expectedWorkspaceKey {
+				t.Errorf("expected workspace_key_prefix %q, got %q", tc.expectedWorkspaceKey, b.workspaceKeyPrefix)
+			}
+		})
+	}
+}
+
+func TestBackendKeyCase(t *testing.T) {
+	cases := map[string]struct {
+		keyCase       string
+		workspace     string
+		expectedPath  string
+		expectedWarns int
+	}{
+		"no normalization": {
+			workspace:    "Staging",
+			expectedPath: "Env/Staging/Some/State.tfstate",
+		},
+		"lower": {
+			keyCase:       keyCaseLower,
+			workspace:     "Staging",
+			expectedPath:  "env/staging/some/state.tfstate",
+			expectedWarns: 2,
+		},
+		"lower default workspace": {
+			keyCase:       keyCaseLower,
+			workspace:     backend.DefaultStateName,
+			expectedPath:  "some/state.tfstate",
+			expectedWarns: 2,
+		},
+		"upper": {
+			keyCase:       keyCaseUpper,
+			workspace:     "Staging",
+			expectedPath:  "ENV/STAGING/SOME/STATE.TFSTATE",
+			expectedWarns: 2,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := New().(*Backend)
+
+			config := map[string]cty.Value{
+				"bucket":               cty.StringVal("test"),
+				"key":                  cty.StringVal("Some/State.tfstate"),
+				"region":               cty.StringVal("us-west-2"),
+				"workspace_key_prefix": cty.StringVal("Env"),
+			}
+			if tc.keyCase != "" {
+				config["key_case"] = cty.StringVal(tc.keyCase)
+			}
+
+			_, diags := b.PrepareConfig(populateSchema(t, b.ConfigSchema(), cty.ObjectVal(config)))
+			if diags.HasErrors() {
+				t.Fatalf("unexpected error: %s", diags.Err())
+			}
+			if len(diags) != tc.expectedWarns {
+				t.Fatalf("expected %d warnings, got %d: %s", tc.expectedWarns, len(diags), diagnosticsString(diags))
+			}
+
+			b.keyCase = tc.keyCase
+			b.keyName = normalizeKeyCase(tc.keyCase, "Some/State.tfstate")
+			b.workspaceKeyPrefix = normalizeKeyCase(tc.keyCase, "Env")
+
+			if actual := b.path(tc.workspace); actual != tc.expectedPath {
+				t.Fatalf("expected path %q, got %q", tc.expectedPath, actual)
+			}
+		})
+	}
+}
+
+func TestBackendConfig_CustomHeaders(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if v := r.Header.Get("X-Gateway-Token"); v != "secret" {
+			t.Errorf("expected X-Gateway-Token header %q, got %q", "secret", v)
+		}
+		if !strings.Contains(r.Header.Get("Authorization"), "x-gateway-token") {
+			t.Errorf("expected custom header to be signed, got Authorization %q", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("X-Amz-Target") != "" {
+			writeDynamoDBResponse(w, map[string]any{"Table": map[string]any{"TableName": "table"}})
+		}
+	}))
+	defer ts.Close()
+
+	b, diags := configureBackend(t, map[string]any{
+		"access_key":                  awsbase.MockStaticAccessKey,
+		"secret_key":                  awsbase.MockStaticSecretKey,
+		"bucket":                      "bucket",
+		"key":                         "state",
+		"region":                      "us-west-2",
+		"endpoint":                    ts.URL,
+		"dynamodb_endpoint":           ts.URL,
+		"dynamodb_table":              "table",
+		"force_path_style":            true,
+		"skip_credentials_validation": true,
+		"custom_headers": map[string]any{
+			"x-gateway-token": "secret",
+		},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+	}
+
+	if _, err := b.s3Client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String("bucket")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The DynamoDB table was already described when configuring the backend.
+	if requests != 2 {
+		t.Fatalf("expected 2 requests, got %d", requests)
 	}
+}
 
-	if s2Mgr.(*remote.State).StateSnapshotMeta().Lineage == s2Lineage {
-		t.Fatal("state s2 was not deleted")
+func TestBackendConfig_SigningOptions(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get("Authorization"); !strings.Contains(v, "/us-east-1/gateway/aws4_request") {
+			t.Errorf("expected request to be signed for gateway in us-east-1, got Authorization %q", v)
+		}
+	}))
+	defer ts.Close()
+
+	b, diags := configureBackend(t, map[string]any{
+		"access_key":                  awsbase.MockStaticAccessKey,
+		"secret_key":                  awsbase.MockStaticSecretKey,
+		"bucket":                      "bucket",
+		"key":                         "state",
+		"region":                      "eu-west-1",
+		"endpoint":                    ts.URL,
+		"force_path_style":            true,
+		"signing_name":                "gateway",
+		"signing_region":              "us-east-1",
+		"skip_credentials_validation": true,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected error: %s", diagnosticsString(diags))
 	}
-	_ = s2Mgr.State() // We need the side-effect
-	s2Lineage = stateMgr.StateSnapshotMeta().Lineage
 
-	// add a state with a key that matches an existing environment dir name
-	client.path = b.workspaceKeyPrefix + "/s2/"
-	if err := stateMgr.WriteState(states.NewState()); err != nil {
-		t.Fatal(err)
+	if b.s3Client.SigningName != "gateway" {
+		t.Fatalf("expected signing name %q, got %q", "gateway", b.s3Client.SigningName)
 	}
-	if err := stateMgr.PersistState(nil); err != nil {
-		t.Fatal(err)
+	if b.s3Client.SigningRegion != "us-east-1" {
+		t.Fatalf("expected signing region %q, got %q", "us-east-1", b.s3Client.SigningRegion)
 	}
+	if _, err := b.s3Client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String("bucket")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
 
-	// make sure s2 is OK
-	s2Mgr, err = b.StateMgr("s2")
-	if err != nil {
-		t.Fatal(err)
+func TestBackendConfig_SigningOptionsWithoutEndpoint(t *testing.T) {
+	oldEnv := stashEnv()
+	defer popEnv(oldEnv)
+
+	b := New()
+	_, valDiags := b.PrepareConfig(populateSchema(t, b.ConfigSchema(), cty.ObjectVal(map[string]cty.Value{
+		"bucket":         cty.StringVal("test"),
+		"key":            cty.StringVal("test"),
+		"region":         cty.StringVal("us-west-2"),
+		"signing_region": cty.StringVal("us-east-1"),
+	})))
+	if len(valDiags) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d: %s", len(valDiags), diagnosticsString(valDiags))
 	}
-	if err := s2Mgr.RefreshState(); err != nil {
-		t.Fatal(err)
+	if valDiags[0].Severity() != tfdiags.Warning || valDiags[0].Description().Summary != "Signing option ignored" {
+		t.Fatalf("unexpected diagnostic: %s", diagnosticString(valDiags[0]))
 	}
+}
 
-	if stateMgr.StateSnapshotMeta().Lineage != s2Lineage {
-		t.Fatal("we got the wrong state for s2")
+func TestBackendConfig_SSECustomerKeyCustomEndpoint(t *testing.T) {
+	cases := map[string]struct {
+		config          map[string]cty.Value
+		vars            map[string]string
+		expectedWarning bool
+	}{
+		"custom endpoint": {
+			config: map[string]cty.Value{
+				"encrypt":          cty.True,
+				"sse_customer_key": cty.StringVal("4Dm1n4rphcFzA8yMoSgbNRahl6wuv9l0pEvYGHG17Dk="),
+				"endpoint":         cty.StringVal("https://minio.example.com"),
+			},
+			expectedWarning: true,
+		},
+		"custom endpoint env vars": {
+			config: map[string]cty.Value{
+				"encrypt": cty.True,
+			},
+			vars: map[string]string{
+				"AWS_SSE_CUSTOMER_KEY": "4Dm1n4rphcFzA8yMoSgbNRahl6wuv9l0pEvYGHG17Dk=",
+				"AWS_S3_ENDPOINT":      "https://minio.example.com",
+			},
+			expectedWarning: true,
+		},
+		"aws endpoint": {
+			config: map[string]cty.Value{
+				"encrypt":          cty.True,
+				"sse_customer_key": cty.StringVal("4Dm1n4rphcFzA8yMoSgbNRahl6wuv9l0pEvYGHG17Dk="),
+			},
+		},
+		"not encrypted": {
+			config: map[string]cty.Value{
+				"sse_customer_key": cty.StringVal("4Dm1n4rphcFzA8yMoSgbNRahl6wuv9l0pEvYGHG17Dk="),
+				"endpoint":         cty.StringVal("https://minio.example.com"),
+			},
+		},
 	}
 
-	if err := checkStateList(b, []string{"default", "s1", "s2"}); err != nil {
-		t.Fatal(err)
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			oldEnv := stashEnv()
+			defer popEnv(oldEnv)
+
+			for k, v := range tc.vars {
+				os.Setenv(k, v)
+			}
+
+			config := map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal("test"),
+				"region": cty.StringVal("us-west-2"),
+			}
+			for k, v := range tc.config {
+				config[k] = v
+			}
+
+			b := New()
+			_, valDiags := b.PrepareConfig(populateSchema(t, b.ConfigSchema(), cty.ObjectVal(config)))
+			if valDiags.HasErrors() {
+				t.Fatalf("expected no error, got %s", valDiags.Err())
+			}
+			if !tc.expectedWarning {
+				if len(valDiags) != 0 {
+					t.Fatalf("unexpected diagnostics: %s", diagnosticsString(valDiags))
+				}
+				return
+			}
+			if len(valDiags) != 1 {
+				t.Fatalf("expected 1 diagnostic, got %d: %s", len(valDiags), diagnosticsString(valDiags))
+			}
+			desc := valDiags[0].Description()
+			if valDiags[0].Severity() != tfdiags.Warning || !strings.Contains(desc.Detail, `"https://minio.example.com"`) {
+				t.Fatalf("unexpected diagnostic: %s", diagnosticString(valDiags[0]))
+			}
+		})
 	}
 }
 
-// ensure we can separate the workspace prefix when it also matches the prefix
-// of the workspace name itself.
-func TestBackendPrefixInWorkspace(t *testing.T) {
-	testACC(t)
-	bucketName := fmt.Sprintf("terraform-remote-s3-test-%x", time.Now().Unix())
+func TestBackendWorkspaceBuckets(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	b, diags := configureBackend(t, map[string]any{
+		"access_key":                  awsbase.MockStaticAccessKey,
+		"secret_key":                  awsbase.MockStaticSecretKey,
+		"bucket":                      "shared",
+		"key":                         "state",
+		"region":                      "us-west-2",
+		"skip_credentials_validation": true,
+		"workspace_buckets": map[string]any{
+			"tenant": "tenant-bucket",
+		},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+	}
+
+	b.s3Client = mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+		var keys []string
+		switch r.URL.Path {
+		case "/shared":
+			// A stale object of the tenant workspace in the shared bucket
+			// must not be mistaken for its state.
+			keys = []string{"env:/dev/state", "env:/tenant/state"}
+		case "/tenant-bucket":
+			keys = []string{"env:/tenant/state"}
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
 
-	b := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
-		"bucket":               bucketName,
-		"key":                  "test-env.tfstate",
-		"workspace_key_prefix": "env",
-	})).(*Backend)
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><IsTruncated>false</IsTruncated>`)
+		for _, key := range keys {
+			if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key></Contents>`, key)
+			}
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	})
 
-	createS3Bucket(t, b.s3Client, bucketName)
-	defer deleteS3Bucket(t, b.s3Client, bucketName)
+	for workspace, expected := range map[string]string{
+		backend.DefaultStateName: "shared",
+		"dev":                    "shared",
+		"tenant":                 "tenant-bucket",
+	} {
+		client, err := b.remoteClient(workspace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client.bucketName != expected {
+			t.Errorf("expected workspace %q to use bucket %q, got %q", workspace, expected, client.bucketName)
+		}
+	}
 
-	// get a state that contains the prefix as a substring
-	sMgr, err := b.StateMgr("env-1")
-	if err != nil {
+	if err := checkStateList(b, []string{backend.DefaultStateName, "dev", "tenant"}); err != nil {
 		t.Fatal(err)
 	}
-	if err := sMgr.RefreshState(); err != nil {
-		t.Fatal(err)
+}
+
+func TestBackendWorkspaceACLs(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	b, diags := configureBackend(t, map[string]any{
+		"access_key":                  awsbase.MockStaticAccessKey,
+		"secret_key":                  awsbase.MockStaticSecretKey,
+		"bucket":                      "shared",
+		"key":                         "state",
+		"region":                      "us-west-2",
+		"skip_credentials_validation": true,
+		"acl":                         "bucket-owner-full-control",
+		"workspace_acls": map[string]any{
+			"tenant-a": "authenticated-read",
+		},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected error: %s", diagnosticsString(diags))
 	}
 
-	if err := checkStateList(b, []string{"default", "env-1"}); err != nil {
-		t.Fatal(err)
+	for workspace, expected := range map[string]string{
+		backend.DefaultStateName: "bucket-owner-full-control",
+		"tenant-b":               "bucket-owner-full-control",
+		"tenant-a":               "authenticated-read",
+	} {
+		client, err := b.remoteClient(workspace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client.acl != expected {
+			t.Errorf("expected workspace %q to use ACL %q, got %q", workspace, expected, client.acl)
+		}
 	}
 }
 
-func TestKeyEnv(t *testing.T) {
-	testACC(t)
-	keyName := "some/paths/tfstate"
+func TestBackendWorkspacesDirectoryMarkers(t *testing.T) {
+	testCases := map[string]struct {
+		key     string
+		objects map[string]int
+	}{
+		"workspace_key_prefix": {
+			key: "network/terraform.tfstate",
+			objects: map[string]int{
+				"env:/":                                  0,
+				"env:/dev/":                              0,
+				"env:/dev/network/":                      0,
+				"env:/dev/network/terraform.tfstate":     120,
+				"env:/prod/network/terraform.tfstate/":   0,
+				"env://network/terraform.tfstate":        120,
+				"env:/staging/network/terraform.tfstate": 0,
+			},
+		},
+		"workspace placeholder": {
+			key: "states/${workspace}",
+			objects: map[string]int{
+				"states/":        0,
+				"states/dev":     120,
+				"states/prod/":   0,
+				"states/staging": 0,
+			},
+		},
+	}
 
-	bucket0Name := fmt.Sprintf("terraform-remote-s3-test-%x-0", time.Now().Unix())
-	b0 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
-		"bucket":               bucket0Name,
-		"key":                  keyName,
-		"encrypt":              true,
-		"workspace_key_prefix": "",
-	})).(*Backend)
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
 
-	createS3Bucket(t, b0.s3Client, bucket0Name)
-	defer deleteS3Bucket(t, b0.s3Client, bucket0Name)
+			b, diags := configureBackend(t, map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         tc.key,
+				"region":                      "us-west-2",
+				"skip_credentials_validation": true,
+			})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+			}
 
-	bucket1Name := fmt.Sprintf("terraform-remote-s3-test-%x-1", time.Now().Unix())
-	b1 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
-		"bucket":               bucket1Name,
-		"key":                  keyName,
-		"encrypt":              true,
-		"workspace_key_prefix": "project/env:",
-	})).(*Backend)
+			b.s3Client = mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+				keys := make([]string, 0, len(tc.objects))
+				for key := range tc.objects {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
 
-	createS3Bucket(t, b1.s3Client, bucket1Name)
-	defer deleteS3Bucket(t, b1.s3Client, bucket1Name)
+				w.Header().Set("Content-Type", "application/xml")
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><IsTruncated>false</IsTruncated>`)
+				for _, key := range keys {
+					if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+						fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size></Contents>`, key, tc.objects[key])
+					}
+				}
+				fmt.Fprint(w, `</ListBucketResult>`)
+			})
 
-	bucket2Name := fmt.Sprintf("terraform-remote-s3-test-%x-2", time.Now().Unix())
-	b2 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
-		"bucket":  bucket2Name,
-		"key":     keyName,
-		"encrypt": true,
-	})).(*Backend)
+			// A state written while empty states are allowed is still a
+			// workspace, unlike the folders created by console users.
+			if err := checkStateList(b, []string{backend.DefaultStateName, "dev", "staging"}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
 
-	createS3Bucket(t, b2.s3Client, bucket2Name)
-	defer deleteS3Bucket(t, b2.s3Client, bucket2Name)
+func TestBackendKeyWorkspacePlaceholder(t *testing.T) {
+	cases := map[string]struct {
+		keyCase      string
+		workspace    string
+		expectedPath string
+	}{
+		"default workspace": {
+			workspace:    backend.DefaultStateName,
+			expectedPath: "stacks/network/default.tfstate",
+		},
+		"workspace": {
+			workspace:    "Staging",
+			expectedPath: "stacks/network/Staging.tfstate",
+		},
+		"normalized": {
+			keyCase:      keyCaseUpper,
+			workspace:    "Staging",
+			expectedPath: "STACKS/NETWORK/STAGING.TFSTATE",
+		},
+	}
 
-	if err := testGetWorkspaceForKey(b0, "some/paths/tfstate", ""); err != nil {
-		t.Fatal(err)
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := &Backend{
+				keyCase: tc.keyCase,
+				keyName: normalizeKeyCase(tc.keyCase, "stacks/network/${workspace}.tfstate"),
+			}
+
+			path := b.path(tc.workspace)
+			if path != tc.expectedPath {
+				t.Fatalf("expected path %q, got %q", tc.expectedPath, path)
+			}
+
+			expectedWorkspace := normalizeKeyCase(tc.keyCase, tc.workspace)
+			if tc.workspace == backend.DefaultStateName {
+				expectedWorkspace = ""
+			}
+			if err := testGetWorkspaceForKey(b, path, expectedWorkspace); err != nil {
+				t.Fatal(err)
+			}
+		})
 	}
 
-	if err := testGetWorkspaceForKey(b0, "ws1/some/paths/tfstate", "ws1"); err != nil {
-		t.Fatal(err)
+	b := &Backend{keyName: "stacks/network/${workspace}.tfstate"}
+	for key, expected := range map[string]string{
+		"stacks/network/dev.tfstate":     "dev",
+		"stacks/network/sub/dev.tfstate": "",
+		"stacks/network/.tfstate":        "",
+		"stacks/network/dev.tflock":      "",
+		"stacks/other/dev.tfstate":       "",
+	} {
+		if err := testGetWorkspaceForKey(b, key, expected); err != nil {
+			t.Error(err)
+		}
 	}
 
-	if err := testGetWorkspaceForKey(b1, "project/env:/ws1/some/paths/tfstate", "ws1"); err != nil {
+	b.bucketName = "bucket"
+	b.s3Client = mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+		if prefix := r.URL.Query().Get("prefix"); prefix != "stacks/network/" {
+			t.Errorf("expected workspaces to be listed by the key prefix, got %q", prefix)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><IsTruncated>false</IsTruncated>`)
+		for _, key := range []string{"stacks/network/default.tfstate", "stacks/network/dev.tfstate", "stacks/network/prod.tfstate", "stacks/network/sub/x.tfstate"} {
+			fmt.Fprintf(w, `<Contents><Key>%s</Key></Contents>`, key)
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	})
+	if err := checkStateList(b, []string{backend.DefaultStateName, "dev", "prod"}); err != nil {
 		t.Fatal(err)
 	}
+}
 
-	if err := testGetWorkspaceForKey(b1, "project/env:/ws2/some/paths/tfstate", "ws2"); err != nil {
-		t.Fatal(err)
+func TestBackendUnifyWorkspacePaths(t *testing.T) {
+	cases := map[string]struct {
+		unify        bool
+		prefix       string
+		workspace    string
+		expectedPath string
+	}{
+		"legacy default workspace": {
+			prefix:       "env:",
+			workspace:    backend.DefaultStateName,
+			expectedPath: "network/terraform.tfstate",
+		},
+		"legacy workspace": {
+			prefix:       "env:",
+			workspace:    "dev",
+			expectedPath: "env:/dev/network/terraform.tfstate",
+		},
+		"unified default workspace": {
+			unify:        true,
+			prefix:       "env:",
+			workspace:    backend.DefaultStateName,
+			expectedPath: "env:/default/network/terraform.tfstate",
+		},
+		"unified workspace": {
+			unify:        true,
+			prefix:       "env:",
+			workspace:    "dev",
+			expectedPath: "env:/dev/network/terraform.tfstate",
+		},
+		"unified default workspace without prefix": {
+			unify:        true,
+			workspace:    backend.DefaultStateName,
+			expectedPath: "default/network/terraform.tfstate",
+		},
 	}
 
-	if err := testGetWorkspaceForKey(b2, "env:/ws3/some/paths/tfstate", "ws3"); err != nil {
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := &Backend{
+				keyName:             "network/terraform.tfstate",
+				workspaceKeyPrefix:  tc.prefix,
+				unifyWorkspacePaths: tc.unify,
+			}
+
+			path := b.path(tc.workspace)
+			if path != tc.expectedPath {
+				t.Fatalf("expected path %q, got %q", tc.expectedPath, path)
+			}
+
+			expectedWorkspace := tc.workspace
+			if tc.workspace == backend.DefaultStateName {
+				expectedWorkspace = ""
+			}
+			if err := testGetWorkspaceForKey(b, path, expectedWorkspace); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	b := &Backend{
+		bucketName:          "bucket",
+		keyName:             "network/terraform.tfstate",
+		workspaceKeyPrefix:  "env:",
+		unifyWorkspacePaths: true,
+	}
+	b.s3Client = mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><IsTruncated>false</IsTruncated>`)
+		for _, key := range []string{"env:/default/network/terraform.tfstate", "env:/dev/network/terraform.tfstate"} {
+			fmt.Fprintf(w, `<Contents><Key>%s</Key></Contents>`, key)
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	})
+	if err := checkStateList(b, []string{backend.DefaultStateName, "dev"}); err != nil {
 		t.Fatal(err)
 	}
 
-	backend.TestBackendStates(t, b0)
-	backend.TestBackendStates(t, b1)
-	backend.TestBackendStates(t, b2)
+	oldEnv := stashEnv()
+	defer popEnv(oldEnv)
+
+	nb := New()
+	_, valDiags := nb.PrepareConfig(populateSchema(t, nb.ConfigSchema(), cty.ObjectVal(map[string]cty.Value{
+		"bucket":                cty.StringVal("test"),
+		"key":                   cty.StringVal("test"),
+		"region":                cty.StringVal("us-west-2"),
+		"unify_workspace_paths": cty.True,
+	})))
+	if len(valDiags) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d: %s", len(valDiags), diagnosticsString(valDiags))
+	}
+	if valDiags[0].Severity() != tfdiags.Warning || valDiags[0].Description().Summary != "Default workspace state path changed" {
+		t.Fatalf("unexpected diagnostic: %s", diagnosticString(valDiags[0]))
+	}
 }
 
 func testGetWorkspaceForKey(b *Backend, key string, expected string) error {
@@ -1288,60 +3170,6 @@ func deleteS3Bucket(t *testing.T, s3Client *s3.S3, bucketName string) {
 	}
 }
 
-// create the dynamoDB table, and wait until we can query it.
-func createDynamoDBTable(t *testing.T, dynClient *dynamodb.DynamoDB, tableName string) {
-	createInput := &dynamodb.CreateTableInput{
-		AttributeDefinitions: []*dynamodb.AttributeDefinition{
-			{
-				AttributeName: aws.String("LockID"),
-				AttributeType: aws.String("S"),
-			},
-		},
-		KeySchema: []*dynamodb.KeySchemaElement{
-			{
-				AttributeName: aws.String("LockID"),
-				KeyType:       aws.String("HASH"),
-			},
-		},
-		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-			ReadCapacityUnits:  aws.Int64(5),
-			WriteCapacityUnits: aws.Int64(5),
-		},
-		TableName: aws.String(tableName),
-	}
-
-	_, err := dynClient.CreateTable(createInput)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// now wait until it's ACTIVE
-	start := time.Now()
-	time.Sleep(time.Second)
-
-	describeInput := &dynamodb.DescribeTableInput{
-		TableName: aws.String(tableName),
-	}
-
-	for {
-		resp, err := dynClient.DescribeTable(describeInput)
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		if *resp.Table.TableStatus == "ACTIVE" {
-			return
-		}
-
-		if time.Since(start) > time.Minute {
-			t.Fatalf("timed out creating DynamoDB table %s", tableName)
-		}
-
-		time.Sleep(3 * time.Second)
-	}
-
-}
-
 func deleteDynamoDBTable(t *testing.T, dynClient *dynamodb.DynamoDB, tableName string) {
 	params := &dynamodb.DeleteTableInput{
 		TableName: aws.String(tableName),
@@ -1366,8 +3194,8 @@ func unmarshal(value cty.Value, ty cty.Type, path cty.Path) (cty.Value, error) {
 	switch {
 	case ty.IsPrimitiveType():
 		return value, nil
-	// case ty.IsListType():
-	// 	return unmarshalList(value, ty.ElementType(), path)
+	case ty.IsListType():
+		return unmarshalList(value, ty.ElementType(), path)
 	case ty.IsSetType():
 		return unmarshalSet(value, ty.ElementType(), path)
 	case ty.IsMapType():
@@ -1381,6 +3209,26 @@ func unmarshal(value cty.Value, ty cty.Type, path cty.Path) (cty.Value, error) {
 	}
 }
 
+func unmarshalList(dec cty.Value, ety cty.Type, path cty.Path) (cty.Value, error) {
+	if dec.IsNull() {
+		return dec, nil
+	}
+
+	length := dec.LengthInt()
+
+	if length == 0 {
+		return cty.ListValEmpty(ety), nil
+	}
+
+	vals := make([]cty.Value, 0, length)
+	dec.ForEachElement(func(key, val cty.Value) (stop bool) {
+		vals = append(vals, val)
+		return
+	})
+
+	return cty.ListVal(vals), nil
+}
+
 func unmarshalSet(dec cty.Value, ety cty.Type, path cty.Path) (cty.Value, error) {
 	if dec.IsNull() {
 		return dec, nil
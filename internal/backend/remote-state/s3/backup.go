@@ -0,0 +1,135 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+// backupSuffix is appended to the state key to derive the key of the backup
+// of the previous state.
+const backupSuffix = ".backup"
+
+func (c *RemoteClient) backupPath() string {
+	return c.path + backupSuffix
+}
+
+// putBackup copies the current state object to the backup key on the server
+// side, before it is replaced by a new state. Nothing is copied if there is no
+// state yet.
+func (c *RemoteClient) putBackup() error {
+	i := &s3.CopyObjectInput{
+		Bucket:     &c.bucketName,
+		Key:        aws.String(c.backupPath()),
+		CopySource: aws.String(copySource(c.bucketName, c.path)),
+	}
+
+	if c.serverSideEncryption {
+		if c.kmsKeyID != "" {
+			i.SSEKMSKeyId = &c.kmsKeyID
+			i.ServerSideEncryption = aws.String("aws:kms")
+		} else if c.customerEncryptionKey != nil {
+			i.SetCopySourceSSECustomerKey(string(c.customerEncryptionKey))
+			i.SetCopySourceSSECustomerAlgorithm(s3EncryptionAlgorithm)
+			i.SetCopySourceSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+			i.SetSSECustomerKey(string(c.customerEncryptionKey))
+			i.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+			i.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+		} else {
+			i.ServerSideEncryption = aws.String(s3EncryptionAlgorithm)
+		}
+	}
+
+	if c.acl != "" {
+		i.ACL = aws.String(c.acl)
+	}
+	c.grants.setCopyObject(i)
+
+	_, err := c.s3Client.CopyObject(i)
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+		return nil
+	}
+	return err
+}
+
+// RecoverFromBackup replaces the state of the given workspace with the backup
+// of the previous state, which is kept when "keep_backup" is set. It is meant
+// to recover from a corrupt state object, such as one truncated by an
+// interrupted write. The state is locked while it is replaced.
+func (b *Backend) RecoverFromBackup(ctx context.Context, workspace string) error {
+	if err := b.requireBucket("Recovering from a state backup"); err != nil {
+		return err
+	}
+
+	client, err := b.remoteClient(workspace)
+	if err != nil {
+		return err
+	}
+
+	lockInfo := statemgr.NewLockInfo()
+	lockInfo.Operation = "recover"
+	lockID, err := client.Lock(lockInfo)
+	if err != nil {
+		return fmt.Errorf("failed to lock state: %w", err)
+	}
+	defer func() {
+		if err := client.Unlock(lockID); err != nil {
+			log.Printf("[ERROR] Failed to unlock state after recovering from backup: %s", err)
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	key, err := client.resolveStateKey()
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return fmt.Errorf(errStatePointerNotFound, client.path, client.bucketName)
+	}
+	stateClient := client.atKey(key)
+
+	backupClient := stateClient.atKey(stateClient.backupPath())
+	payload, err := backupClient.get()
+	if err != nil {
+		return fmt.Errorf("failed to read state backup: %w", err)
+	}
+	if payload == nil {
+		return fmt.Errorf("no state backup found at %q", backupClient.path)
+	}
+	if !json.Valid(payload.Data) {
+		return fmt.Errorf("state backup %q is corrupt as well", backupClient.path)
+	}
+
+	// Rewriting the state through the client keeps the configured encryption,
+	// compression and the state digest consistent. The current state is
+	// corrupt, so it must not replace the backup. It wasn't read either, so
+	// the serial it was written with is taken from the record for
+	// check_serial.
+	stateClient.keepBackup = false
+	if stateClient.checkSerial {
+		if err := stateClient.readRecordedSerial(); err != nil {
+			return err
+		}
+	}
+	return stateClient.Put(payload.Data)
+}
+
+const errCorruptStateFmt = `state object %[1]q is corrupt.
+
+The state could not be parsed, which can happen when a write was interrupted.
+A backup of the previous state is kept at %[2]q in the same bucket. After
+verifying its contents, restore it by copying it over the state object, for
+example with:
+
+    aws s3 cp "s3://%[3]s/%[2]s" "s3://%[3]s/%[1]s"`
@@ -0,0 +1,145 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+func TestBackend_RecoverFromBackup(t *testing.T) {
+	storage := newMockS3Storage()
+	b := &Backend{
+		s3Client:   mockS3Client(t, storage.ServeHTTP),
+		bucketName: "bucket",
+		keyName:    "state",
+		keepBackup: true,
+	}
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := []byte(`{"version": 4, "serial": 1}`)
+	second := []byte(`{"version": 4, "serial": 2}`)
+
+	if err := client.Put(first); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+	if _, ok := storage.objects["bucket/state.backup"]; ok {
+		t.Fatal("expected no backup before the state existed")
+	}
+
+	if err := client.Put(second); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+	if backup := storage.objects["bucket/state.backup"]; backup == nil || !bytes.Equal(backup.body, first) {
+		t.Fatalf("expected the previous state to be backed up, got %v", backup)
+	}
+
+	// Simulate a write which was interrupted halfway.
+	storage.objects["bucket/state"].body = second[:10]
+	_, err = client.Get()
+	if err == nil {
+		t.Fatal("expected an error reading corrupt state, got none")
+	}
+	if !strings.Contains(err.Error(), "is corrupt") || !strings.Contains(err.Error(), `aws s3 cp "s3://bucket/state.backup" "s3://bucket/state"`) {
+		t.Fatalf("expected error to describe restoring the backup, got: %s", err)
+	}
+
+	if err := b.RecoverFromBackup(context.Background(), backend.DefaultStateName); err != nil {
+		t.Fatalf("unexpected error recovering from backup: %s", err)
+	}
+
+	payload, err := client.Get()
+	if err != nil {
+		t.Fatalf("unexpected error reading recovered state: %s", err)
+	}
+	if !bytes.Equal(payload.Data, first) {
+		t.Fatalf("expected recovered state %q, got %q", first, payload.Data)
+	}
+	if backup := storage.objects["bucket/state.backup"]; !bytes.Equal(backup.body, first) {
+		t.Fatalf("recovering must not replace the backup with the corrupt state, got %q", backup.body)
+	}
+}
+
+func TestBackend_RecoverFromBackupKeyIsPointer(t *testing.T) {
+	storage := newMockS3Storage()
+	storage.objects["bucket/state"] = &mockS3Object{body: []byte("versions/1\n"), header: http.Header{}}
+	b := &Backend{
+		s3Client:     mockS3Client(t, storage.ServeHTTP),
+		bucketName:   "bucket",
+		keyName:      "state",
+		keepBackup:   true,
+		keyIsPointer: true,
+	}
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := []byte(`{"version": 4, "serial": 1}`)
+	second := []byte(`{"version": 4, "serial": 2}`)
+	for _, state := range [][]byte{first, second} {
+		if err := client.Put(state); err != nil {
+			t.Fatalf("unexpected error writing state: %s", err)
+		}
+	}
+	if backup := storage.objects["bucket/versions/1.backup"]; backup == nil || !bytes.Equal(backup.body, first) {
+		t.Fatalf("expected the previous state to be backed up next to the target, got %v", backup)
+	}
+
+	storage.objects["bucket/versions/1"].body = second[:10]
+	if err := b.RecoverFromBackup(context.Background(), backend.DefaultStateName); err != nil {
+		t.Fatalf("unexpected error recovering from backup: %s", err)
+	}
+
+	if state := storage.objects["bucket/versions/1"]; !bytes.Equal(state.body, first) {
+		t.Fatalf("expected the target state to be recovered, got %q", state.body)
+	}
+	if pointer := storage.objects["bucket/state"]; string(pointer.body) != "versions/1\n" {
+		t.Fatalf("expected the pointer to be unchanged, got %q", pointer.body)
+	}
+}
+
+func TestBackend_RecoverFromBackupCheckSerial(t *testing.T) {
+	storage := newMockS3Storage()
+	table := &mockSerialTable{items: make(map[string]map[string]map[string]string)}
+	b := &Backend{
+		s3Client:    mockS3Client(t, storage.ServeHTTP),
+		dynClient:   mockDynamoDBClient(t, table.ServeHTTP),
+		bucketName:  "bucket",
+		keyName:     "state",
+		ddbTable:    "table",
+		keepBackup:  true,
+		checkSerial: true,
+	}
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := []byte(`{"version": 4, "serial": 1}`)
+	second := []byte(`{"version": 4, "serial": 2}`)
+	for _, state := range [][]byte{first, second} {
+		if err := client.Put(state); err != nil {
+			t.Fatalf("unexpected error writing state: %s", err)
+		}
+	}
+
+	// The recorded serial is 2, and the corrupt state isn't read before it
+	// is replaced.
+	storage.objects["bucket/state"].body = second[:10]
+	if err := b.RecoverFromBackup(context.Background(), backend.DefaultStateName); err != nil {
+		t.Fatalf("unexpected error recovering from backup: %s", err)
+	}
+	if state := storage.objects["bucket/state"]; !bytes.Equal(state.body, first) {
+		t.Fatalf("expected the state to be recovered, got %q", state.body)
+	}
+	if serial := table.items["bucket/state-serial"][stateSerialAttribute]["N"]; serial != "1" {
+		t.Fatalf("expected the recorded serial to be that of the recovered state, got %q", serial)
+	}
+}
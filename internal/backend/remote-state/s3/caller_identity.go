@@ -0,0 +1,31 @@
+package s3
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+)
+
+// callerIdentityDiagnostic reports the identity the backend's requests are
+// made as, for log_caller_identity. There's no informational severity, so the
+// identity is reported as a warning, which is shown without failing the
+// operation.
+func callerIdentityDiagnostic(sess *session.Session) tfdiags.Diagnostic {
+	output, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return tfdiags.Sourceless(
+			tfdiags.Warning,
+			"Unable to determine caller identity",
+			fmt.Sprintf(`The "log_caller_identity" attribute is set, but the identity could not be requested with sts:GetCallerIdentity: %s`, err),
+		)
+	}
+
+	return tfdiags.Sourceless(
+		tfdiags.Warning,
+		"Caller identity",
+		fmt.Sprintf("The S3 backend makes its requests as %s in the AWS account %s.", aws.StringValue(output.Arn), aws.StringValue(output.Account)),
+	)
+}
@@ -0,0 +1,73 @@
+package s3
+
+import (
+	"strings"
+	"testing"
+
+	servicemocks "github.com/hashicorp/aws-sdk-go-base"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+)
+
+func TestBackendConfig_LogCallerIdentity(t *testing.T) {
+	testCases := map[string]struct {
+		config          map[string]any
+		expectedSummary string
+		expectedDetail  string
+	}{
+		"disabled": {},
+		"enabled": {
+			config: map[string]any{
+				"log_caller_identity": true,
+			},
+			expectedSummary: "Caller identity",
+			expectedDetail:  "arn:aws:iam::222222222222:user/Alice in the AWS account 222222222222",
+		},
+		"skip_credentials_validation": {
+			config: map[string]any{
+				"log_caller_identity":         true,
+				"skip_credentials_validation": true,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			ts := servicemocks.MockAwsApiServer("STS", []*servicemocks.MockEndpoint{
+				servicemocks.MockStsGetCallerIdentityValidEndpoint,
+			})
+			defer ts.Close()
+
+			config := map[string]any{
+				"access_key":   servicemocks.MockStaticAccessKey,
+				"secret_key":   servicemocks.MockStaticSecretKey,
+				"bucket":       "bucket",
+				"key":          "key",
+				"region":       "us-west-2",
+				"sts_endpoint": ts.URL,
+			}
+			for k, v := range tc.config {
+				config[k] = v
+			}
+
+			_, diags := configureBackend(t, config)
+
+			if tc.expectedSummary == "" {
+				if len(diags) != 0 {
+					t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+				}
+				return
+			}
+			if len(diags) != 1 {
+				t.Fatalf("expected 1 diagnostic, got %d: %s", len(diags), diagnosticsString(diags))
+			}
+			desc := diags[0].Description()
+			if diags[0].Severity() != tfdiags.Warning || desc.Summary != tc.expectedSummary || !strings.Contains(desc.Detail, tc.expectedDetail) {
+				t.Fatalf("unexpected diagnostic: %s", diagnosticString(diags[0]))
+			}
+		})
+	}
+}
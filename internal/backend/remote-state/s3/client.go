@@ -5,6 +5,7 @@ package s3
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/hex"
@@ -13,11 +14,16 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/aws/aws-sdk-go/service/s3"
 	multierror "github.com/hashicorp/go-multierror"
 	uuid "github.com/hashicorp/go-uuid"
@@ -25,6 +31,12 @@ import (
 	"github.com/opentofu/opentofu/internal/states/statemgr"
 )
 
+// Valid values of the malformed_lock_action attribute.
+const (
+	malformedLockError    = "error"
+	malformedLockTakeover = "takeover"
+)
+
 // Store the last saved serial in dynamo with this suffix for consistency checks.
 const (
 	s3EncryptionAlgorithm  = "AES256"
@@ -34,14 +46,73 @@ const (
 
 type RemoteClient struct {
 	s3Client              *s3.S3
+	s3ReadClient          *s3.S3
 	dynClient             *dynamodb.DynamoDB
+	kmsClient             *kms.KMS
 	bucketName            string
 	path                  string
 	serverSideEncryption  bool
 	customerEncryptionKey []byte
 	acl                   string
+	grants                *objectGrants
 	kmsKeyID              string
 	ddbTable              string
+	compress              bool
+	shardedState          bool
+	logReplicationStatus  bool
+	keepBackup            bool
+	sendContentMD5        bool
+	allowEmptyState       bool
+	stateGrowthWarnRatio  float64
+	tagSerialAndLineage   bool
+	workspaceTag          string
+	idempotencyToken      bool
+	verifyWriteChecksum   bool
+	objectExpires         *objectExpires
+	contentDisposition    string
+	keyIsPointer          bool
+	pointerTargetKey      string
+	lockMetadataEnv       []string
+	checkSerial           bool
+	readCacheTTL          time.Duration
+	downloadPartSize      int64
+	downloadConcurrency   int
+	maxResponseBytes      int64
+	verifyDelete          bool
+	cleanupUploads        bool
+
+	// locker locks the state instead of the DynamoDB table, if set.
+	locker StateLocker
+
+	// workspace is the name of the workspace of the state, and postWriteHook
+	// is called after each successful write of it, if set.
+	workspace     string
+	postWriteHook PostWriteHook
+
+	// readSerial is the serial of the state last read or written by this
+	// client, or nil if there was no state, for check_serial.
+	readSerial *uint64
+
+	// shardManifest is the manifest of the state last read or written by
+	// this client, or nil if the state isn't sharded, so that unchanged
+	// shards aren't uploaded again and unused ones can be deleted.
+	shardManifest *shardManifest
+
+	clientSideEncryptionKMSKeyID string
+
+	lockRetryMaxAttempts int
+	lockRetryWait        time.Duration
+	lockInitialJitter    time.Duration
+	lockMaxAge           time.Duration
+	malformedLockAction  string
+
+	// eventualLockReads reads the lock item with eventually consistent
+	// reads, which may return a lock as it was before a recent change.
+	eventualLockReads bool
+
+	// jittered is set once the client waited for lockInitialJitter before
+	// its first lock attempt.
+	jittered bool
 }
 
 var (
@@ -51,12 +122,31 @@ var (
 
 	// delay when polling the state
 	consistencyRetryPollInterval = 2 * time.Second
+
+	// The longest we will wait between two lock attempts when the DynamoDB
+	// table's provisioned throughput is exceeded.
+	lockRetryMaxWait = 30 * time.Second
+
+	// The delay before retrying to read a new state that was not found. The
+	// delay doubles with each retry.
+	newStateReadRetryInterval = 500 * time.Millisecond
+
+	// The delay before checking again whether a deleted state is gone, for
+	// verify_delete. The delay doubles with each check.
+	verifyDeleteInterval = 500 * time.Millisecond
 )
 
+// The number of times verify_delete checks whether a deleted state is gone.
+const verifyDeleteAttempts = 6
+
 // test hook called when checksums don't match
 var testChecksumHook func()
 
 func (c *RemoteClient) Get() (payload *remote.Payload, err error) {
+	if c.keyIsPointer {
+		return c.getThroughPointer()
+	}
+
 	deadline := time.Now().Add(consistencyRetryTimeout)
 
 	// If we have a checksum, and the returned payload doesn't match, we retry
@@ -97,6 +187,13 @@ func (c *RemoteClient) Get() (payload *remote.Payload, err error) {
 		break
 	}
 
+	if c.checkSerial {
+		c.readSerial = nil
+		if payload != nil {
+			c.readSerial = stateSerial(payload.Data)
+		}
+	}
+
 	return payload, err
 }
 
@@ -115,76 +212,400 @@ func (c *RemoteClient) get() (*remote.Payload, error) {
 		input.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
 	}
 
-	output, err = c.s3Client.GetObject(input)
+	cached, isCached := c.cachedState()
+	if isCached {
+		input.IfNoneMatch = aws.String(cached.etag)
+	}
+
+	if c.downloadPartSize > 0 {
+		output, err = c.downloadObject(input)
+	} else {
+		output, err = c.readClient().GetObject(input)
+	}
 
 	if err != nil {
+		if isCached && isNotModified(err) {
+			log.Printf("[DEBUG] State %q is unchanged since it was cached, not downloading it again", c.path)
+			c.shardManifest = cached.manifest
+			return statePayload(bytes.Clone(cached.data)), nil
+		}
 		if awserr, ok := err.(awserr.Error); ok {
 			switch awserr.Code() {
 			case s3.ErrCodeNoSuchBucket:
-				return nil, fmt.Errorf(errS3NoSuchBucket, err)
+				return nil, fmt.Errorf(errS3NoSuchBucket, c.bucketName, err)
 			case s3.ErrCodeNoSuchKey:
 				return nil, nil
+			case s3.ErrCodeInvalidObjectState:
+				return nil, c.archivedStateError(err)
 			}
 		}
-		return nil, err
+		if isKMSKeyAccessError(err) {
+			return nil, c.kmsKeyAccessError(err)
+		}
+		return nil, c.sseCustomerKeyError(err)
 	}
 
 	defer output.Body.Close()
 
 	buf := bytes.NewBuffer(nil)
-	if _, err := io.Copy(buf, output.Body); err != nil {
+	if _, err := io.Copy(buf, c.limitResponseBody(output)); err != nil {
 		return nil, fmt.Errorf("Failed to read remote state: %w", err)
 	}
 
-	sum := md5.Sum(buf.Bytes())
-	payload := &remote.Payload{
-		Data: buf.Bytes(),
-		MD5:  sum[:],
+	data, err := c.decryptPayload(buf.Bytes(), output.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = decompressPayload(data, aws.StringValue(output.ContentEncoding))
+	if err != nil {
+		return nil, err
+	}
+
+	// Sharded state is read whether or not sharded_state is set, so that
+	// the setting can be turned off again.
+	c.shardManifest = nil
+	if manifest, ok := parseShardManifest(data); ok {
+		if data, err = c.getShards(manifest); err != nil {
+			return nil, err
+		}
+		c.shardManifest = manifest
+	}
+
+	if c.keepBackup && len(data) > 0 && !json.Valid(data) {
+		return nil, fmt.Errorf(errCorruptStateFmt, c.path, c.backupPath(), c.bucketName)
 	}
 
+	c.cacheState(aws.StringValue(output.ETag), data, c.shardManifest)
+
+	return statePayload(data), nil
+}
+
+// readClient returns the client reading the state, which differs from the
+// client used for all other requests if read_endpoint is set.
+func (c *RemoteClient) readClient() *s3.S3 {
+	if c.s3ReadClient != nil {
+		return c.s3ReadClient
+	}
+	return c.s3Client
+}
+
+// statePayload returns the payload of the state in data.
+func statePayload(data []byte) *remote.Payload {
 	// If there was no data, then return nil
-	if len(payload.Data) == 0 {
-		return nil, nil
+	if len(data) == 0 {
+		return nil
+	}
+
+	sum := md5.Sum(data)
+	return &remote.Payload{
+		Data: data,
+		MD5:  sum[:],
 	}
+}
+
+// archivedStateError explains a read which failed because the state object
+// was moved to an archive storage class by a lifecycle rule or an
+// Intelligent-Tiering archive configuration, including how to restore it.
+func (c *RemoteClient) archivedStateError(err error) error {
+	input := &s3.HeadObjectInput{
+		Bucket: &c.bucketName,
+		Key:    &c.path,
+	}
+	if c.serverSideEncryption && c.customerEncryptionKey != nil {
+		input.SetSSECustomerKey(string(c.customerEncryptionKey))
+		input.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		input.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+	}
+
+	head, headErr := c.s3Client.HeadObject(input)
+	if headErr != nil {
+		log.Printf("[WARN] Failed to read storage class of archived state %q: %s", c.path, headErr)
+		head = &s3.HeadObjectOutput{}
+	}
+	if strings.Contains(aws.StringValue(head.Restore), `ongoing-request="true"`) {
+		return fmt.Errorf(errStateRestoreInProgress, c.path, c.bucketName, err)
+	}
+
+	storageClass := "an archive storage class"
+	if v := aws.StringValue(head.StorageClass); v != "" {
+		storageClass = "the " + v + " storage class"
+		if tier := aws.StringValue(head.ArchiveStatus); tier != "" {
+			storageClass += " (" + tier + ")"
+		}
+	}
+
+	// Objects in the archive tiers of Intelligent-Tiering are restored to
+	// the frequent access tier, without a number of days.
+	restoreRequest := "Days=7"
+	if aws.StringValue(head.StorageClass) == s3.StorageClassIntelligentTiering {
+		restoreRequest = "{}"
+	}
+
+	return fmt.Errorf(errStateArchived, c.path, c.bucketName, storageClass, c.bucketName, c.path, restoreRequest, err)
+}
+
+// waitForNewState retries reading a state which is not found up to the given
+// number of times, to let a concurrent initialization of the same workspace
+// finish writing it. It returns once the state exists or the retries are used
+// up; whether the state is found is up to the subsequent read.
+func (c *RemoteClient) waitForNewState(retries int) error {
+	wait := newStateReadRetryInterval
+	for i := 0; i < retries; i++ {
+		payload, err := c.get()
+		if err != nil {
+			return err
+		}
+		if payload != nil {
+			return nil
+		}
 
-	return payload, nil
+		log.Printf("[DEBUG] State %q not found, retrying in %s in case it's being initialized concurrently", c.path, wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+	return nil
+}
+
+// waitForDelete checks whether the deleted state is gone, waiting for it to
+// disappear on stores where deletes are eventually consistent, so that the
+// state isn't listed anymore once Delete returns.
+func (c *RemoteClient) waitForDelete() error {
+	input := &s3.HeadObjectInput{
+		Bucket: &c.bucketName,
+		Key:    &c.path,
+	}
+	if c.serverSideEncryption && c.customerEncryptionKey != nil {
+		input.SetSSECustomerKey(string(c.customerEncryptionKey))
+		input.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		input.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+	}
+
+	wait := verifyDeleteInterval
+	for i := 0; i < verifyDeleteAttempts; i++ {
+		_, err := c.s3Client.HeadObject(input)
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to verify that state %q was deleted: %w", c.path, err)
+		}
+		if i == verifyDeleteAttempts-1 {
+			break
+		}
+
+		log.Printf("[DEBUG] Deleted state %q still found, checking again in %s", c.path, wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+	return fmt.Errorf("state %q was deleted from the S3 bucket %q, but is still found after %d checks", c.path, c.bucketName, verifyDeleteAttempts)
+}
+
+// sseCustomerKeyError translates a failed read of an object encrypted with a
+// customer-provided key (SSE-C) into an explanation of the problem, since S3
+// reports these failures the same way it reports missing permissions.
+func (c *RemoteClient) sseCustomerKeyError(err error) error {
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) {
+		return err
+	}
+
+	usesCustomerKey := c.serverSideEncryption && c.customerEncryptionKey != nil
+	switch {
+	case usesCustomerKey && reqErr.StatusCode() == http.StatusForbidden:
+		// Requesting the metadata without the key tells a wrong key apart
+		// from missing permissions: S3 only rejects it as a bad request if
+		// the object is SSE-C encrypted and we're allowed to read it.
+		_, headErr := c.s3Client.HeadObject(&s3.HeadObjectInput{
+			Bucket: &c.bucketName,
+			Key:    &c.path,
+		})
+		var headReqErr awserr.RequestFailure
+		if errors.As(headErr, &headReqErr) && headReqErr.StatusCode() == http.StatusBadRequest {
+			return fmt.Errorf(errSSECustomerKeyMismatch, c.path, err)
+		}
+	case !usesCustomerKey && reqErr.StatusCode() == http.StatusBadRequest && reqErr.Code() == "InvalidRequest":
+		return fmt.Errorf(errSSECustomerKeyRequired, c.path, err)
+	}
+
+	return err
+}
+
+// sseCustomerKeyUnsupportedError explains a write rejected by an S3-compatible
+// store which doesn't implement customer-provided keys (SSE-C), which stores
+// often report as a bare "not implemented" error.
+func (c *RemoteClient) sseCustomerKeyUnsupportedError(err error) error {
+	if !c.serverSideEncryption || c.customerEncryptionKey == nil {
+		return err
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && (reqErr.StatusCode() == http.StatusNotImplemented || reqErr.Code() == "NotImplemented") {
+		return fmt.Errorf(errSSECustomerKeyUnsupported, c.bucketName, err)
+	}
+	return err
+}
+
+// checkStatePayload guards against replacing the state with an empty
+// payload, by checking that data is a JSON object with the "version" field
+// every state snapshot has, regardless of its format version.
+func checkStatePayload(data []byte) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return errors.New("the state is empty")
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("the state is not a JSON object: %w", err)
+	}
+	if _, ok := fields["version"]; !ok {
+		return errors.New(`the state has no "version" field`)
+	}
+	return nil
 }
 
 func (c *RemoteClient) Put(data []byte) error {
+	if c.keyIsPointer {
+		return c.putThroughPointer(data)
+	}
+	return c.put(data)
+}
+
+func (c *RemoteClient) put(data []byte) error {
+	if !c.allowEmptyState {
+		if err := checkStatePayload(data); err != nil {
+			return fmt.Errorf(errEmptyState, c.path, err)
+		}
+	}
+
 	contentType := "application/json"
-	contentLength := int64(len(data))
+	body := data
+
+	var manifest *shardManifest
+	if c.shardedState {
+		var err error
+		if manifest, err = c.putShards(data); err != nil {
+			return err
+		}
+		if body, err = json.Marshal(manifest); err != nil {
+			return err
+		}
+	}
+
+	var contentEncoding *string
+	if c.compress {
+		var err error
+		if body, err = compressPayload(body); err != nil {
+			return err
+		}
+		contentEncoding = aws.String(gzipContentEncoding)
+	}
+
+	var metadata map[string]*string
+	if c.clientSideEncryptionKMSKeyID != "" {
+		var err error
+		if body, metadata, err = c.encryptPayload(body); err != nil {
+			return err
+		}
+		contentType = "application/octet-stream"
+		// The ciphertext itself is not gzip-encoded; the compression is
+		// detected again after decryption.
+		contentEncoding = nil
+	}
+
+	contentLength := int64(len(body))
 
 	i := &s3.PutObjectInput{
-		ContentType:   &contentType,
-		ContentLength: &contentLength,
-		Body:          bytes.NewReader(data),
-		Bucket:        &c.bucketName,
-		Key:           &c.path,
+		ContentType:     &contentType,
+		ContentEncoding: contentEncoding,
+		ContentLength:   &contentLength,
+		Body:            bytes.NewReader(body),
+		Bucket:          &c.bucketName,
+		Key:             &c.path,
+		Metadata:        metadata,
 	}
 
-	if c.serverSideEncryption {
-		if c.kmsKeyID != "" {
-			i.SSEKMSKeyId = &c.kmsKeyID
-			i.ServerSideEncryption = aws.String("aws:kms")
-		} else if c.customerEncryptionKey != nil {
-			i.SetSSECustomerKey(string(c.customerEncryptionKey))
-			i.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
-			i.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
-		} else {
-			i.ServerSideEncryption = aws.String(s3EncryptionAlgorithm)
+	c.setPutObjectOptions(i)
+
+	if tagging := c.stateTagging(data); tagging != "" {
+		i.Tagging = aws.String(tagging)
+	}
+
+	i.Expires = c.objectExpires.expiresAt(time.Now())
+	if c.contentDisposition != "" {
+		i.ContentDisposition = aws.String(c.contentDisposition)
+	}
+
+	var checksum string
+	if c.verifyWriteChecksum {
+		// Stores which support checksums reject a corrupted upload right
+		// away, and return the checksum to verify the object against.
+		checksum = writeChecksum(body)
+		i.ChecksumSHA256 = aws.String(checksum)
+	}
+
+	if c.sendContentMD5 {
+		// The digest covers the body as uploaded, so that S3 can verify it.
+		sum := md5.Sum(body)
+		i.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+
+	if c.stateGrowthWarnRatio > 0 {
+		c.checkStateGrowth(contentLength)
+	}
+
+	if c.keepBackup {
+		if err := c.putBackup(); err != nil {
+			return fmt.Errorf("failed to back up state: %w", c.sseCustomerKeyUnsupportedError(err))
 		}
 	}
 
-	if c.acl != "" {
-		i.ACL = aws.String(c.acl)
+	var serial *uint64
+	if c.checkSerial {
+		if serial = stateSerial(data); serial == nil {
+			return fmt.Errorf("state %q has no serial to check", c.path)
+		}
+		if err := c.advanceSerial(*serial); err != nil {
+			return err
+		}
+	}
+
+	var opts []request.Option
+	if c.idempotencyToken {
+		opts = append(opts, setIdempotencyToken(i, data))
 	}
 
 	log.Printf("[DEBUG] Uploading remote state to S3: %#v", i)
 
-	_, err := c.s3Client.PutObject(i)
+	output, err := c.s3Client.PutObjectWithContext(context.Background(), i, opts...)
 	if err != nil {
-		return fmt.Errorf("failed to upload state: %w", err)
+		if serial != nil {
+			c.revertSerial(*serial)
+		}
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchBucket {
+			return fmt.Errorf(errS3NoSuchBucket, c.bucketName, err)
+		}
+		return fmt.Errorf("failed to upload state: %w", c.sseCustomerKeyUnsupportedError(err))
+	}
+	if checksum != "" {
+		if err := c.checkWrittenChecksum(checksum); err != nil {
+			if serial != nil {
+				c.revertSerial(*serial)
+			}
+			c.forgetCachedState()
+			return err
+		}
+	}
+	if serial != nil {
+		c.readSerial = serial
+	}
+	c.forgetCachedState()
+	if c.shardManifest != nil {
+		c.deleteShards(c.shardManifest, manifest)
 	}
+	c.shardManifest = manifest
 
 	sum := md5.Sum(data)
 	if err := c.putMD5(sum[:]); err != nil {
@@ -194,10 +615,112 @@ func (c *RemoteClient) Put(data []byte) error {
 
 	}
 
+	if c.logReplicationStatus {
+		// This is only evidence for audits, so it must never fail the write.
+		if status, err := c.replicationStatus(); err != nil {
+			log.Printf("[WARN] Failed to read replication status of state %q: %s", c.path, err)
+		} else {
+			log.Printf("[INFO] Replication status of state %q: %s", c.path, status)
+		}
+	}
+
+	if c.cleanupUploads {
+		c.cleanupIncompleteUploads()
+	}
+
+	if c.postWriteHook != nil {
+		write := StateWrite{
+			Workspace: c.workspace,
+			Bucket:    c.bucketName,
+			Key:       c.path,
+			ETag:      aws.StringValue(output.ETag),
+		}
+		if serial := stateSerial(data); serial != nil {
+			write.Serial = *serial
+		}
+		c.postWriteHook(write)
+	}
+
 	return nil
 }
 
+// checkStateGrowth logs a warning if the state object grows by more than the
+// configured ratio of its current size. This is only an early signal of
+// misconfigurations that bloat the state, so it never fails the write.
+func (c *RemoteClient) checkStateGrowth(size int64) {
+	input := &s3.HeadObjectInput{
+		Bucket: &c.bucketName,
+		Key:    &c.path,
+	}
+	if c.serverSideEncryption && c.customerEncryptionKey != nil {
+		input.SetSSECustomerKey(string(c.customerEncryptionKey))
+		input.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		input.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+	}
+
+	output, err := c.s3Client.HeadObject(input)
+	if err != nil {
+		var reqErr awserr.RequestFailure
+		if !errors.As(err, &reqErr) || reqErr.StatusCode() != http.StatusNotFound {
+			log.Printf("[WARN] Failed to read size of state %q: %s", c.path, err)
+		}
+		return
+	}
+
+	previous := aws.Int64Value(output.ContentLength)
+	if previous > 0 && float64(size) > c.stateGrowthWarnRatio*float64(previous) {
+		log.Printf("[WARN] State %q grows from %d to %d bytes, more than %g times its previous size. This often means that a resource has unexpectedly large attributes.", c.path, previous, size, c.stateGrowthWarnRatio)
+	}
+}
+
+// replicationStatus returns the S3 replication status of the state object. It
+// is empty if the object is not subject to a replication rule.
+func (c *RemoteClient) replicationStatus() (string, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: &c.bucketName,
+		Key:    &c.path,
+	}
+	if c.serverSideEncryption && c.customerEncryptionKey != nil {
+		input.SetSSECustomerKey(string(c.customerEncryptionKey))
+		input.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		input.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+	}
+
+	output, err := c.s3Client.HeadObject(input)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.ReplicationStatus), nil
+}
+
+// setPutObjectOptions applies the configured server side encryption, ACL and
+// grants to an upload.
+func (c *RemoteClient) setPutObjectOptions(i *s3.PutObjectInput) {
+	if c.serverSideEncryption {
+		if c.kmsKeyID != "" {
+			i.SSEKMSKeyId = &c.kmsKeyID
+			i.ServerSideEncryption = aws.String("aws:kms")
+		} else if c.customerEncryptionKey != nil {
+			i.SetSSECustomerKey(string(c.customerEncryptionKey))
+			i.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+			i.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+		} else {
+			i.ServerSideEncryption = aws.String(s3EncryptionAlgorithm)
+		}
+	}
+
+	if c.acl != "" {
+		i.ACL = aws.String(c.acl)
+	}
+	c.grants.setPutObject(i)
+}
+
 func (c *RemoteClient) Delete() error {
+	manifest := c.shardManifest
+	if manifest == nil && c.shardedState {
+		manifest = c.storedShardManifest()
+	}
+
 	_, err := c.s3Client.DeleteObject(&s3.DeleteObjectInput{
 		Bucket: &c.bucketName,
 		Key:    &c.path,
@@ -206,21 +729,50 @@ func (c *RemoteClient) Delete() error {
 	if err != nil {
 		return err
 	}
+	c.forgetCachedState()
 
 	if err := c.deleteMD5(); err != nil {
 		log.Printf("error deleting state md5: %s", err)
 	}
 
+	if c.checkSerial {
+		if err := c.deleteSerial(); err != nil {
+			log.Printf("[WARN] Failed to delete the recorded serial of state %q: %s", c.path, err)
+		}
+		c.readSerial = nil
+	}
+
+	if manifest != nil {
+		c.deleteShards(manifest, nil)
+		c.shardManifest = nil
+	}
+
+	if c.verifyDelete {
+		return c.waitForDelete()
+	}
+
 	return nil
 }
 
 func (c *RemoteClient) Lock(info *statemgr.LockInfo) (string, error) {
+	if c.locker != nil {
+		info.Path = c.lockPath()
+		return c.locker.Lock(c.lockPath(), info)
+	}
+
 	if c.ddbTable == "" {
 		return "", nil
 	}
 
 	info.Path = c.lockPath()
 
+	if c.lockInitialJitter > 0 && !c.jittered {
+		c.jittered = true
+		wait := lockJitter(c.lockInitialJitter)
+		log.Printf("[DEBUG] Waiting %s before the first attempt to lock %q", wait, c.lockPath())
+		time.Sleep(wait)
+	}
+
 	if info.ID == "" {
 		lockID, err := uuid.GenerateUUID()
 		if err != nil {
@@ -231,17 +783,29 @@ func (c *RemoteClient) Lock(info *statemgr.LockInfo) (string, error) {
 	}
 
 	putParams := &dynamodb.PutItemInput{
-		Item: map[string]*dynamodb.AttributeValue{
-			"LockID": {S: aws.String(c.lockPath())},
-			"Info":   {S: aws.String(string(info.Marshal()))},
-		},
+		Item:                c.lockItem(info),
 		TableName:           aws.String(c.ddbTable),
 		ConditionExpression: aws.String("attribute_not_exists(LockID)"),
 	}
-	_, err := c.dynClient.PutItem(putParams)
+	err := c.putLockItem(putParams)
 
 	if err != nil {
-		lockInfo, infoErr := c.getLockInfo()
+		lockInfo, raw, infoErr := c.getLockItem()
+		if infoErr == nil && c.isStaleLock(lockInfo) {
+			takeoverErr := c.takeOverStaleLock(info, lockInfo, raw)
+			if takeoverErr == nil {
+				return info.ID, nil
+			}
+			infoErr = takeoverErr
+		}
+		var malformedErr *malformedLockInfoError
+		if errors.As(infoErr, &malformedErr) && c.malformedLockAction == malformedLockTakeover {
+			takeoverErr := c.takeOverMalformedLock(info, malformedErr.raw)
+			if takeoverErr == nil {
+				return info.ID, nil
+			}
+			infoErr = multierror.Append(infoErr, takeoverErr)
+		}
 		if infoErr != nil {
 			err = multierror.Append(err, infoErr)
 		}
@@ -256,6 +820,74 @@ func (c *RemoteClient) Lock(info *statemgr.LockInfo) (string, error) {
 	return info.ID, nil
 }
 
+// putLockItem writes the lock item, retrying transient failures such as the
+// DynamoDB table's provisioned throughput being exceeded.
+func (c *RemoteClient) putLockItem(params *dynamodb.PutItemInput) error {
+	attempts, err := c.retryLockRequest(func() error {
+		_, err := c.dynClient.PutItem(params)
+		return err
+	})
+	if isThroughputExceeded(err) {
+		return fmt.Errorf(errDynamoDBThroughputExceeded, c.ddbTable, attempts, err)
+	}
+	return err
+}
+
+// retryLockRequest calls fn, retrying it with an exponential backoff while it
+// fails with a transient DynamoDB error. The number of retries is bounded so
+// that persistent problems, such as a table which is permanently
+// under-provisioned, still surface. It returns the number of attempts made.
+func (c *RemoteClient) retryLockRequest(fn func() error) (int, error) {
+	wait := c.lockRetryWait
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !isTransientDynamoDBError(err) || attempt > c.lockRetryMaxAttempts {
+			return attempt, err
+		}
+
+		if isThroughputExceeded(err) && attempt > 1 {
+			log.Printf("[WARN] DynamoDB table %q repeatedly exceeded its provisioned throughput; consider switching the table to PAY_PER_REQUEST billing mode", c.ddbTable)
+		}
+
+		log.Printf("[DEBUG] DynamoDB request to table %q failed, retrying in %s: %s", c.ddbTable, wait, err)
+		time.Sleep(wait)
+
+		wait *= 2
+		if wait > lockRetryMaxWait {
+			wait = lockRetryMaxWait
+		}
+	}
+}
+
+func isThroughputExceeded(err error) bool {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code() == dynamodb.ErrCodeProvisionedThroughputExceededException
+	}
+	return false
+}
+
+// isTransientDynamoDBError reports whether err is a throttling or server-side
+// DynamoDB error which is likely to succeed when retried.
+func isTransientDynamoDBError(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() >= 500 {
+		return true
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case dynamodb.ErrCodeProvisionedThroughputExceededException,
+			dynamodb.ErrCodeRequestLimitExceeded,
+			dynamodb.ErrCodeInternalServerError,
+			"ThrottlingException":
+			return true
+		}
+	}
+	return false
+}
+
 func (c *RemoteClient) getMD5() ([]byte, error) {
 	if c.ddbTable == "" {
 		return nil, nil
@@ -331,19 +963,31 @@ func (c *RemoteClient) deleteMD5() error {
 	return nil
 }
 
+// lockJitter returns a random wait of less than max.
+func lockJitter(max time.Duration) time.Duration {
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
 func (c *RemoteClient) getLockInfo() (*statemgr.LockInfo, error) {
+	lockInfo, _, err := c.getLockItem()
+	return lockInfo, err
+}
+
+// getLockItem is like getLockInfo, but also returns the Info attribute of the
+// lock item as it's stored, to replace the lock only if it didn't change.
+func (c *RemoteClient) getLockItem() (*statemgr.LockInfo, string, error) {
 	getParams := &dynamodb.GetItemInput{
 		Key: map[string]*dynamodb.AttributeValue{
 			"LockID": {S: aws.String(c.lockPath())},
 		},
-		ProjectionExpression: aws.String("LockID, Info"),
+		ProjectionExpression: aws.String("LockID, Info, " + lockMetadataAttribute),
 		TableName:            aws.String(c.ddbTable),
-		ConsistentRead:       aws.Bool(true),
+		ConsistentRead:       aws.Bool(!c.eventualLockReads),
 	}
 
 	resp, err := c.dynClient.GetItem(getParams)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	var infoData string
@@ -354,13 +998,70 @@ func (c *RemoteClient) getLockInfo() (*statemgr.LockInfo, error) {
 	lockInfo := &statemgr.LockInfo{}
 	err = json.Unmarshal([]byte(infoData), lockInfo)
 	if err != nil {
-		return nil, err
+		if len(resp.Item) != 0 {
+			return nil, "", &malformedLockInfoError{
+				table: c.ddbTable,
+				path:  c.lockPath(),
+				raw:   infoData,
+				err:   err,
+			}
+		}
+		return nil, "", err
 	}
+	lockInfo.Info = withLockMetadata(lockInfo.Info, resp.Item[lockMetadataAttribute])
+
+	return lockInfo, infoData, nil
+}
+
+// malformedLockInfoError is returned when the lock item exists, but its lock
+// info can't be parsed, for example after a botched manual edit of the item.
+type malformedLockInfoError struct {
+	table string
+	path  string
+	raw   string
+	err   error
+}
 
-	return lockInfo, nil
+func (e *malformedLockInfoError) Error() string {
+	return fmt.Sprintf(errMalformedLockInfo, e.path, e.table, e.err, e.raw, e.table, e.path)
+}
+
+func (e *malformedLockInfoError) Unwrap() error {
+	return e.err
+}
+
+// takeOverMalformedLock replaces a lock item whose lock info couldn't be
+// parsed with our own, treating it like a stale lock. The item is only
+// replaced if it still holds the malformed lock info that was read, so that a
+// lock taken in the meantime is not overwritten.
+func (c *RemoteClient) takeOverMalformedLock(info *statemgr.LockInfo, raw string) error {
+	log.Printf("[WARN] Taking over malformed lock %q in DynamoDB table %q, which held: %s", c.lockPath(), c.ddbTable, raw)
+	return c.replaceLockItem(info, raw)
+}
+
+// replaceLockItem replaces the lock item with our own, but only if its Info
+// attribute still holds raw.
+func (c *RemoteClient) replaceLockItem(info *statemgr.LockInfo, raw string) error {
+	params := &dynamodb.PutItemInput{
+		Item:      c.lockItem(info),
+		TableName: aws.String(c.ddbTable),
+	}
+	if raw == "" {
+		params.ConditionExpression = aws.String("attribute_exists(LockID) AND attribute_not_exists(Info)")
+	} else {
+		params.ConditionExpression = aws.String("Info = :info")
+		params.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":info": {S: aws.String(raw)},
+		}
+	}
+	return c.putLockItem(params)
 }
 
 func (c *RemoteClient) Unlock(id string) error {
+	if c.locker != nil {
+		return c.locker.Unlock(c.lockPath(), id)
+	}
+
 	if c.ddbTable == "" {
 		return nil
 	}
@@ -370,9 +1071,14 @@ func (c *RemoteClient) Unlock(id string) error {
 	// TODO: store the path and lock ID in separate fields, and have proper
 	// projection expression only delete the lock if both match, rather than
 	// checking the ID from the info field first.
-	lockInfo, err := c.getLockInfo()
+	var lockInfo *statemgr.LockInfo
+	_, err := c.retryLockRequest(func() error {
+		var err error
+		lockInfo, err = c.getLockInfo()
+		return err
+	})
 	if err != nil {
-		lockErr.Err = fmt.Errorf("failed to retrieve lock info: %w", err)
+		lockErr.Err = fmt.Errorf(errLockMayBeHeld, "failed to retrieve lock info", err, id)
 		return lockErr
 	}
 	lockErr.Info = lockInfo
@@ -388,10 +1094,13 @@ func (c *RemoteClient) Unlock(id string) error {
 		},
 		TableName: aws.String(c.ddbTable),
 	}
-	_, err = c.dynClient.DeleteItem(params)
+	_, err = c.retryLockRequest(func() error {
+		_, err := c.dynClient.DeleteItem(params)
+		return err
+	})
 
 	if err != nil {
-		lockErr.Err = err
+		lockErr.Err = fmt.Errorf(errLockMayBeHeld, "failed to delete lock", err, id)
 		return lockErr
 	}
 	return nil
@@ -415,7 +1124,41 @@ to manually verify the remote state and update the Digest value stored in the
 DynamoDB table to the following value: %x
 `
 
-const errS3NoSuchBucket = `S3 bucket does not exist.
+const errDynamoDBThroughputExceeded = `DynamoDB table %q exceeded its provisioned throughput.
+
+The state lock could not be acquired after %d attempts. If this happens
+regularly, consider increasing the table's provisioned capacity or switching
+it to the PAY_PER_REQUEST billing mode.
+
+Error: %w
+`
+
+const errLockMayBeHeld = `%s: %w
+
+The state lock may still be held. Once the underlying problem is resolved,
+release it manually by running:
+
+    tofu force-unlock %s`
+
+const errSSECustomerKeyMismatch = `the customer-provided encryption key does not match the key state object %q was encrypted with.
+
+The object is encrypted with a customer-provided key (SSE-C), and S3 rejected
+the configured "sse_customer_key" (or "AWS_SSE_CUSTOMER_KEY"). Ensure the same
+key that was used to write the state is configured.
+
+Error: %w
+`
+
+const errSSECustomerKeyRequired = `state object %q is encrypted with a customer-provided key.
+
+The object is encrypted with a customer-provided key (SSE-C), so the key must
+be configured to read it. Set "encrypt" to true and provide the key with
+"sse_customer_key" or the "AWS_SSE_CUSTOMER_KEY" environment variable.
+
+Error: %w
+`
+
+const errS3NoSuchBucket = `S3 bucket %q does not exist.
 
 The referenced S3 bucket must have been previously created. If the S3 bucket
 was created within the last minute, please wait for a minute or two and try
@@ -423,3 +1166,57 @@ again.
 
 Error: %w
 `
+
+const errSSECustomerKeyUnsupported = `the S3 store does not support customer-provided encryption keys.
+
+Writing to the bucket %q was rejected as not implemented while the state is
+encrypted with a customer-provided key (SSE-C). Some S3-compatible stores do
+not implement SSE-C. Unset "sse_customer_key" and "AWS_SSE_CUSTOMER_KEY", or
+use an encryption method the store supports, such as
+"client_side_encryption_kms_key_id".
+
+Error: %w
+`
+
+const errMalformedLockInfo = `the lock %q in the DynamoDB table %q is malformed: %s
+
+The lock item exists, but its lock info can't be parsed, which is usually the
+result of a manual edit of the item. Its raw contents are:
+
+%s
+
+Since the lock can't be attributed to an operation, verify that no other
+operation is in progress, then remove the lock item with:
+
+  aws dynamodb delete-item --table-name %q --key '{"LockID": {"S": %q}}'
+
+Alternatively, set "malformed_lock_action" to "takeover" to treat malformed
+locks as stale and take them over.`
+
+const errEmptyState = `refusing to write state %q: %s.
+
+This usually means that the tool writing the state has a bug, and writing it
+would replace the existing state. If an empty state is written intentionally,
+set "allow_empty_state" to true.`
+
+const errStateArchived = `state object %q in the S3 bucket %q is archived.
+
+The object was moved to %s, for example by a lifecycle rule or an
+Intelligent-Tiering archive configuration, and can't be read until it is
+restored. Restore it with:
+
+  aws s3api restore-object --bucket %q --key %q --restore-request '%s'
+
+Restoring can take from minutes to hours. To prevent this from happening
+again, exclude state objects from rules which archive objects.
+
+Error: %w
+`
+
+const errStateRestoreInProgress = `state object %q in the S3 bucket %q is archived and being restored.
+
+The object can be read once the restore has completed, which can take from
+minutes to hours.
+
+Error: %w
+`
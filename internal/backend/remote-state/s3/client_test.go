@@ -6,11 +6,19 @@ package s3
 import (
 	"bytes"
 	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"log"
+	"net/http"
+	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
 	"github.com/opentofu/opentofu/internal/backend"
 	"github.com/opentofu/opentofu/internal/states/remote"
 	"github.com/opentofu/opentofu/internal/states/statefile"
@@ -50,22 +58,23 @@ func TestRemoteClientLocks(t *testing.T) {
 	keyName := "testState"
 
 	b1 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
-		"bucket":         bucketName,
-		"key":            keyName,
-		"encrypt":        true,
-		"dynamodb_table": bucketName,
+		"bucket":                        bucketName,
+		"key":                           keyName,
+		"encrypt":                       true,
+		"dynamodb_table":                bucketName,
+		"dynamodb_table_missing_action": "create",
 	})).(*Backend)
 
 	b2 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
-		"bucket":         bucketName,
-		"key":            keyName,
-		"encrypt":        true,
-		"dynamodb_table": bucketName,
+		"bucket":                        bucketName,
+		"key":                           keyName,
+		"encrypt":                       true,
+		"dynamodb_table":                bucketName,
+		"dynamodb_table_missing_action": "create",
 	})).(*Backend)
 
 	createS3Bucket(t, b1.s3Client, bucketName)
 	defer deleteS3Bucket(t, b1.s3Client, bucketName)
-	createDynamoDBTable(t, b1.dynClient, bucketName)
 	defer deleteDynamoDBTable(t, b1.dynClient, bucketName)
 
 	s1, err := b1.StateMgr(backend.DefaultStateName)
@@ -88,22 +97,23 @@ func TestForceUnlock(t *testing.T) {
 	keyName := "testState"
 
 	b1 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
-		"bucket":         bucketName,
-		"key":            keyName,
-		"encrypt":        true,
-		"dynamodb_table": bucketName,
+		"bucket":                        bucketName,
+		"key":                           keyName,
+		"encrypt":                       true,
+		"dynamodb_table":                bucketName,
+		"dynamodb_table_missing_action": "create",
 	})).(*Backend)
 
 	b2 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
-		"bucket":         bucketName,
-		"key":            keyName,
-		"encrypt":        true,
-		"dynamodb_table": bucketName,
+		"bucket":                        bucketName,
+		"key":                           keyName,
+		"encrypt":                       true,
+		"dynamodb_table":                bucketName,
+		"dynamodb_table_missing_action": "create",
 	})).(*Backend)
 
 	createS3Bucket(t, b1.s3Client, bucketName)
 	defer deleteS3Bucket(t, b1.s3Client, bucketName)
-	createDynamoDBTable(t, b1.dynClient, bucketName)
 	defer deleteDynamoDBTable(t, b1.dynClient, bucketName)
 
 	// first test with default
@@ -165,14 +175,14 @@ func TestRemoteClient_clientMD5(t *testing.T) {
 	keyName := "testState"
 
 	b := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
-		"bucket":         bucketName,
-		"key":            keyName,
-		"dynamodb_table": bucketName,
+		"bucket":                        bucketName,
+		"key":                           keyName,
+		"dynamodb_table":                bucketName,
+		"dynamodb_table_missing_action": "create",
 	})).(*Backend)
 
 	createS3Bucket(t, b.s3Client, bucketName)
 	defer deleteS3Bucket(t, b.s3Client, bucketName)
-	createDynamoDBTable(t, b.dynClient, bucketName)
 	defer deleteDynamoDBTable(t, b.dynClient, bucketName)
 
 	s, err := b.StateMgr(backend.DefaultStateName)
@@ -213,14 +223,14 @@ func TestRemoteClient_stateChecksum(t *testing.T) {
 	keyName := "testState"
 
 	b1 := backend.TestBackendConfig(t, New(), backend.TestWrapConfig(map[string]interface{}{
-		"bucket":         bucketName,
-		"key":            keyName,
-		"dynamodb_table": bucketName,
+		"bucket":                        bucketName,
+		"key":                           keyName,
+		"dynamodb_table":                bucketName,
+		"dynamodb_table_missing_action": "create",
 	})).(*Backend)
 
 	createS3Bucket(t, b1.s3Client, bucketName)
 	defer deleteS3Bucket(t, b1.s3Client, bucketName)
-	createDynamoDBTable(t, b1.dynClient, bucketName)
 	defer deleteDynamoDBTable(t, b1.dynClient, bucketName)
 
 	s1, err := b1.StateMgr(backend.DefaultStateName)
@@ -270,6 +280,7 @@ func TestRemoteClient_stateChecksum(t *testing.T) {
 	}
 
 	// put an empty state in place to check for panics during get
+	client2.(*RemoteClient).allowEmptyState = true
 	if err := client2.Put([]byte{}); err != nil {
 		t.Fatal(err)
 	}
@@ -318,3 +329,1029 @@ func TestRemoteClient_stateChecksum(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRemoteClient_lockThroughputExceeded(t *testing.T) {
+	testCases := map[string]struct {
+		throttledAttempts int
+		maxAttempts       int
+		expectedErr       string
+	}{
+		"recovers": {
+			throttledAttempts: 2,
+			maxAttempts:       3,
+		},
+		"no retries": {
+			throttledAttempts: 1,
+			maxAttempts:       0,
+			expectedErr:       "PAY_PER_REQUEST",
+		},
+		"persistent": {
+			throttledAttempts: 10,
+			maxAttempts:       3,
+			expectedErr:       "could not be acquired after 4 attempts",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var putCalls int
+			client := &RemoteClient{
+				bucketName: "bucket",
+				path:       "state",
+				ddbTable:   "table",
+				dynClient: mockDynamoDBClient(t, func(w http.ResponseWriter, r *http.Request) {
+					switch dynamoDBOperation(r) {
+					case "PutItem":
+						putCalls++
+						if putCalls <= tc.throttledAttempts {
+							writeDynamoDBError(w, dynamodb.ErrCodeProvisionedThroughputExceededException, "throughput exceeded")
+							return
+						}
+						writeDynamoDBResponse(w, map[string]any{})
+					default:
+						writeDynamoDBResponse(w, map[string]any{})
+					}
+				}),
+				lockRetryMaxAttempts: tc.maxAttempts,
+				lockRetryWait:        time.Millisecond,
+			}
+
+			_, err := client.Lock(statemgr.NewLockInfo())
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if putCalls != tc.throttledAttempts+1 {
+					t.Fatalf("expected %d PutItem calls, got %d", tc.throttledAttempts+1, putCalls)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected an error, got none")
+			}
+			if !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Fatalf("expected error containing %q, got: %s", tc.expectedErr, err)
+			}
+			if putCalls != tc.maxAttempts+1 {
+				t.Fatalf("expected %d PutItem calls, got %d", tc.maxAttempts+1, putCalls)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_unlockTransientError(t *testing.T) {
+	testCases := map[string]struct {
+		failedDeletes int
+		expectedErr   string
+	}{
+		"recovers": {
+			failedDeletes: 1,
+		},
+		"persistent": {
+			failedDeletes: 10,
+			expectedErr:   "tofu force-unlock lock-id",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			info := statemgr.NewLockInfo()
+			info.ID = "lock-id"
+
+			var deleteCalls int
+			client := &RemoteClient{
+				bucketName: "bucket",
+				path:       "state",
+				ddbTable:   "table",
+				dynClient: mockDynamoDBClient(t, func(w http.ResponseWriter, r *http.Request) {
+					switch dynamoDBOperation(r) {
+					case "GetItem":
+						writeDynamoDBResponse(w, map[string]any{
+							"Item": map[string]any{
+								"LockID": map[string]string{"S": "bucket/state"},
+								"Info":   map[string]string{"S": string(info.Marshal())},
+							},
+						})
+					case "DeleteItem":
+						deleteCalls++
+						if deleteCalls <= tc.failedDeletes {
+							w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+							w.WriteHeader(http.StatusInternalServerError)
+							fmt.Fprint(w, `{"__type":"com.amazonaws.dynamodb.v20120810#InternalServerError","message":"internal error"}`)
+							return
+						}
+						writeDynamoDBResponse(w, map[string]any{})
+					}
+				}),
+				lockRetryMaxAttempts: 2,
+				lockRetryWait:        time.Millisecond,
+			}
+
+			err := client.Unlock(info.ID)
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if deleteCalls != tc.failedDeletes+1 {
+					t.Fatalf("expected %d DeleteItem calls, got %d", tc.failedDeletes+1, deleteCalls)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected an error, got none")
+			}
+			if !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Fatalf("expected error containing %q, got: %s", tc.expectedErr, err)
+			}
+			if deleteCalls != 3 {
+				t.Fatalf("expected 3 DeleteItem calls, got %d", deleteCalls)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_sseCustomerKeyErrors(t *testing.T) {
+	testCases := map[string]struct {
+		customerKey bool
+		headStatus  int
+		getStatus   int
+		getCode     string
+		expectedErr string
+	}{
+		"key mismatch": {
+			customerKey: true,
+			getStatus:   http.StatusForbidden,
+			getCode:     "AccessDenied",
+			headStatus:  http.StatusBadRequest,
+			expectedErr: "does not match the key",
+		},
+		"access denied": {
+			customerKey: true,
+			getStatus:   http.StatusForbidden,
+			getCode:     "AccessDenied",
+			headStatus:  http.StatusForbidden,
+			expectedErr: "AccessDenied",
+		},
+		"key required": {
+			getStatus:   http.StatusBadRequest,
+			getCode:     "InvalidRequest",
+			expectedErr: "is encrypted with a customer-provided key",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					switch r.Method {
+					case http.MethodGet:
+						writeS3Error(w, tc.getStatus, tc.getCode, "request failed")
+					case http.MethodHead:
+						if r.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key") != "" {
+							t.Error("HeadObject must be sent without the customer key")
+						}
+						w.WriteHeader(tc.headStatus)
+					}
+				}),
+				bucketName: "bucket",
+				path:       "state",
+			}
+			if tc.customerKey {
+				client.serverSideEncryption = true
+				client.customerEncryptionKey = bytes.Repeat([]byte{'k'}, 32)
+			}
+
+			_, err := client.Get()
+			if err == nil {
+				t.Fatal("expected an error, got none")
+			}
+			if !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Fatalf("expected error containing %q, got: %s", tc.expectedErr, err)
+			}
+			if tc.expectedErr == "AccessDenied" && strings.Contains(err.Error(), "customer-provided") {
+				t.Fatalf("permission errors must not be reported as a key mismatch: %s", err)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_sseCustomerKeyUnsupported(t *testing.T) {
+	testCases := map[string]struct {
+		customerKey bool
+		status      int
+		code        string
+		expectedErr string
+	}{
+		"not implemented": {
+			customerKey: true,
+			status:      http.StatusNotImplemented,
+			code:        "NotImplemented",
+			expectedErr: "does not support customer-provided encryption keys",
+		},
+		"bad request": {
+			customerKey: true,
+			status:      http.StatusBadRequest,
+			code:        "NotImplemented",
+			expectedErr: "does not support customer-provided encryption keys",
+		},
+		"without customer key": {
+			status:      http.StatusNotImplemented,
+			code:        "NotImplemented",
+			expectedErr: "NotImplemented",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					writeS3Error(w, tc.status, tc.code, "A header you provided implies functionality that is not implemented")
+				}),
+				bucketName: "bucket",
+				path:       "state",
+			}
+			if tc.customerKey {
+				client.serverSideEncryption = true
+				client.customerEncryptionKey = bytes.Repeat([]byte{'k'}, 32)
+			}
+
+			err := client.Put([]byte(`{"version": 4}`))
+			if err == nil {
+				t.Fatal("expected an error, got none")
+			}
+			if !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Fatalf("expected error containing %q, got: %s", tc.expectedErr, err)
+			}
+			if !tc.customerKey && strings.Contains(err.Error(), "customer-provided") {
+				t.Fatalf("errors without a customer key must not mention it: %s", err)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_malformedLock(t *testing.T) {
+	const malformed = `{"ID": "abc", "Operation":`
+
+	testCases := map[string]struct {
+		action string
+		// changed replaces the malformed lock after it was read, as if
+		// another operation had taken it over in the meantime.
+		changed      bool
+		expectLocked bool
+		expectedErr  string
+	}{
+		"default": {
+			expectedErr: `the lock "bucket/state" in the DynamoDB table "table" is malformed`,
+		},
+		"error": {
+			action:      malformedLockError,
+			expectedErr: `aws dynamodb delete-item --table-name "table" --key '{"LockID": {"S": "bucket/state"}}'`,
+		},
+		"takeover": {
+			action:       malformedLockTakeover,
+			expectLocked: true,
+		},
+		"takeover after change": {
+			action:      malformedLockTakeover,
+			changed:     true,
+			expectedErr: "ConditionalCheckFailedException",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			info := malformed
+			client := &RemoteClient{
+				dynClient: mockDynamoDBClient(t, func(w http.ResponseWriter, r *http.Request) {
+					var input struct {
+						Item                      map[string]map[string]string
+						ConditionExpression       string
+						ExpressionAttributeValues map[string]map[string]string
+					}
+					if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+						t.Errorf("invalid DynamoDB request: %s", err)
+					}
+
+					switch dynamoDBOperation(r) {
+					case "PutItem":
+						if input.ConditionExpression == "attribute_not_exists(LockID)" {
+							writeDynamoDBError(w, dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed")
+							return
+						}
+						if input.ConditionExpression != "Info = :info" || input.ExpressionAttributeValues[":info"]["S"] != info {
+							writeDynamoDBError(w, dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed")
+							return
+						}
+						info = input.Item["Info"]["S"]
+						writeDynamoDBResponse(w, map[string]any{})
+					case "GetItem":
+						writeDynamoDBResponse(w, map[string]any{
+							"Item": map[string]any{
+								"LockID": map[string]string{"S": "bucket/state"},
+								"Info":   map[string]string{"S": info},
+							},
+						})
+						if tc.changed {
+							info = `{"ID": "other", "Operation":`
+						}
+					default:
+						t.Errorf("unexpected DynamoDB operation %q", dynamoDBOperation(r))
+					}
+				}),
+				bucketName:          "bucket",
+				path:                "state",
+				ddbTable:            "table",
+				malformedLockAction: tc.action,
+			}
+
+			lockInfo := statemgr.NewLockInfo()
+			lockInfo.Operation = "test"
+			id, err := client.Lock(lockInfo)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				if !tc.changed && !strings.Contains(err.Error(), malformed) {
+					t.Fatalf("expected error to show the raw lock info, got: %s", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if id != lockInfo.ID {
+				t.Fatalf("expected lock ID %q, got %q", lockInfo.ID, id)
+			}
+			if tc.expectLocked != strings.Contains(info, lockInfo.ID) {
+				t.Fatalf("expected lock to be taken over, lock info is %s", info)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_lockConsistentRead(t *testing.T) {
+	testCases := map[string]struct {
+		config               map[string]any
+		expectConsistentRead bool
+	}{
+		"default": {
+			config:               map[string]any{},
+			expectConsistentRead: true,
+		},
+		"consistent": {
+			config:               map[string]any{"lock_consistent_read": true},
+			expectConsistentRead: true,
+		},
+		"eventual": {
+			config:               map[string]any{"lock_consistent_read": false},
+			expectConsistentRead: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			config := map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         "state",
+				"region":                      "us-west-2",
+				"skip_credentials_validation": true,
+			}
+			for k, v := range tc.config {
+				config[k] = v
+			}
+			b, diags := configureBackend(t, config)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+			}
+
+			var consistentRead *bool
+			b.dynClient = mockDynamoDBClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if op := dynamoDBOperation(r); op != "GetItem" {
+					t.Errorf("unexpected DynamoDB operation %q", op)
+				}
+				var input struct {
+					ConsistentRead *bool
+				}
+				if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+					t.Errorf("invalid DynamoDB request: %s", err)
+				}
+				consistentRead = input.ConsistentRead
+				writeDynamoDBResponse(w, map[string]any{
+					"Item": map[string]any{
+						"LockID": map[string]string{"S": "bucket/state"},
+						"Info":   map[string]string{"S": `{"ID": "abc"}`},
+					},
+				})
+			})
+			b.ddbTable = "table"
+
+			client, err := b.remoteClient(backend.DefaultStateName)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if _, err := client.getLockInfo(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if consistentRead == nil || *consistentRead != tc.expectConsistentRead {
+				t.Fatalf("expected ConsistentRead %t, got %v", tc.expectConsistentRead, consistentRead)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_archivedState(t *testing.T) {
+	testCases := map[string]struct {
+		header      map[string]string
+		headStatus  int
+		expectedErr []string
+	}{
+		"glacier": {
+			header: map[string]string{
+				"X-Amz-Storage-Class": "GLACIER",
+			},
+			expectedErr: []string{
+				`state object "state" in the S3 bucket "bucket" is archived`,
+				"the GLACIER storage class",
+				`aws s3api restore-object --bucket "bucket" --key "state" --restore-request 'Days=7'`,
+			},
+		},
+		"intelligent-tiering": {
+			header: map[string]string{
+				"X-Amz-Storage-Class":  "INTELLIGENT_TIERING",
+				"X-Amz-Archive-Status": "DEEP_ARCHIVE_ACCESS",
+			},
+			expectedErr: []string{
+				"the INTELLIGENT_TIERING storage class (DEEP_ARCHIVE_ACCESS)",
+				`--restore-request '{}'`,
+			},
+		},
+		"restore in progress": {
+			header: map[string]string{
+				"X-Amz-Storage-Class": "GLACIER",
+				"X-Amz-Restore":       `ongoing-request="true"`,
+			},
+			expectedErr: []string{
+				"is archived and being restored",
+			},
+		},
+		"storage class unknown": {
+			headStatus: http.StatusForbidden,
+			expectedErr: []string{
+				"an archive storage class",
+				"InvalidObjectState",
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					switch r.Method {
+					case http.MethodGet:
+						writeS3Error(w, http.StatusForbidden, "InvalidObjectState", "The operation is not valid for the object's storage class")
+					case http.MethodHead:
+						for k, v := range tc.header {
+							w.Header().Set(k, v)
+						}
+						if tc.headStatus != 0 {
+							w.WriteHeader(tc.headStatus)
+						}
+					}
+				}),
+				bucketName: "bucket",
+				path:       "state",
+			}
+
+			_, err := client.Get()
+			if err == nil {
+				t.Fatal("expected an error, got none")
+			}
+			for _, expected := range tc.expectedErr {
+				if !strings.Contains(err.Error(), expected) {
+					t.Fatalf("expected error containing %q, got: %s", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoteClient_emptyState(t *testing.T) {
+	testCases := map[string]struct {
+		data        string
+		allow       bool
+		expectedErr string
+	}{
+		"zero bytes": {
+			expectedErr: "the state is empty",
+		},
+		"whitespace": {
+			data:        " \n",
+			expectedErr: "the state is empty",
+		},
+		"empty object": {
+			data:        `{}`,
+			expectedErr: `the state has no "version" field`,
+		},
+		"null": {
+			data:        `null`,
+			expectedErr: `the state has no "version" field`,
+		},
+		"not an object": {
+			data:        `[]`,
+			expectedErr: "the state is not a JSON object",
+		},
+		"allowed": {
+			allow: true,
+		},
+		"state": {
+			data: `{"version": 4, "serial": 1, "lineage": "abc"}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			storage.objects["bucket/state"] = &mockS3Object{body: []byte(`{"version": 4, "serial": 1, "lineage": "abc"}`), header: http.Header{}}
+			client := &RemoteClient{
+				s3Client:        mockS3Client(t, storage.ServeHTTP),
+				bucketName:      "bucket",
+				path:            "state",
+				allowEmptyState: tc.allow,
+			}
+
+			err := client.Put([]byte(tc.data))
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if body := string(storage.objects["bucket/state"].body); body != tc.data {
+					t.Fatalf("expected state %q, got %q", tc.data, body)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected an error, got none")
+			}
+			if !strings.Contains(err.Error(), tc.expectedErr) || !strings.Contains(err.Error(), `"allow_empty_state"`) {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if body := string(storage.objects["bucket/state"].body); body != `{"version": 4, "serial": 1, "lineage": "abc"}` {
+				t.Fatalf("expected the existing state to be kept, got %q", body)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_stateGrowth(t *testing.T) {
+	previous := `{"version": 4, "serial": 1, "lineage": "abc"}`
+
+	testCases := map[string]struct {
+		previous    string
+		next        string
+		ratio       float64
+		expectHeads int
+		expectWarn  bool
+	}{
+		"disabled": {
+			previous: previous,
+			next:     previous + strings.Repeat(" ", 10*len(previous)),
+		},
+		"no previous state": {
+			next:        previous,
+			ratio:       2,
+			expectHeads: 1,
+		},
+		"below ratio": {
+			previous:    previous,
+			next:        previous + strings.Repeat(" ", len(previous)-1),
+			ratio:       2,
+			expectHeads: 1,
+		},
+		"at ratio": {
+			previous:    previous,
+			next:        previous + strings.Repeat(" ", len(previous)),
+			ratio:       2,
+			expectHeads: 1,
+		},
+		"above ratio": {
+			previous:    previous,
+			next:        previous + strings.Repeat(" ", len(previous)+1),
+			ratio:       2,
+			expectHeads: 1,
+			expectWarn:  true,
+		},
+		"fractional ratio": {
+			previous:    previous,
+			next:        previous + strings.Repeat(" ", len(previous)/2+1),
+			ratio:       1.5,
+			expectHeads: 1,
+			expectWarn:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			storage := newMockS3Storage()
+			if tc.previous != "" {
+				storage.objects["bucket/state"] = &mockS3Object{body: []byte(tc.previous), header: http.Header{}}
+			}
+			var heads int
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == http.MethodHead {
+						heads++
+					}
+					storage.ServeHTTP(w, r)
+				}),
+				bucketName:           "bucket",
+				path:                 "state",
+				stateGrowthWarnRatio: tc.ratio,
+			}
+
+			if err := client.Put([]byte(tc.next)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if heads != tc.expectHeads {
+				t.Fatalf("expected %d HEAD requests, got %d", tc.expectHeads, heads)
+			}
+			if warned := strings.Contains(logs.String(), "[WARN] State \"state\" grows"); warned != tc.expectWarn {
+				t.Fatalf("expected warning to be %t, got logs:\n%s", tc.expectWarn, logs.String())
+			}
+		})
+	}
+}
+
+func TestRemoteClient_sendContentMD5(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress %t", compress), func(t *testing.T) {
+			storage := newMockS3Storage()
+			var header string
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == http.MethodPut {
+						header = r.Header.Get("Content-MD5")
+					}
+					storage.ServeHTTP(w, r)
+				}),
+				bucketName:     "bucket",
+				path:           "state",
+				compress:       compress,
+				sendContentMD5: true,
+			}
+
+			if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			sum := md5.Sum(storage.objects["bucket/state"].body)
+			if expected := base64.StdEncoding.EncodeToString(sum[:]); header != expected {
+				t.Fatalf("expected Content-MD5 header %q, got %q", expected, header)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_contentDisposition(t *testing.T) {
+	for name, disposition := range map[string]string{
+		"unset":      "",
+		"configured": `attachment; filename="prod.tfstate"`,
+	} {
+		disposition := disposition
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			var header string
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == http.MethodPut {
+						header = r.Header.Get("Content-Disposition")
+					}
+					storage.ServeHTTP(w, r)
+				}),
+				bucketName:         "bucket",
+				path:               "state",
+				contentDisposition: disposition,
+			}
+
+			if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if header != disposition {
+				t.Fatalf("expected Content-Disposition header %q, got %q", disposition, header)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_waitForNewState(t *testing.T) {
+	defer func(d time.Duration) { newStateReadRetryInterval = d }(newStateReadRetryInterval)
+	newStateReadRetryInterval = time.Millisecond
+
+	testCases := map[string]struct {
+		// writtenAfter is the number of reads after which a concurrent
+		// initializer's write lands, or 0 if it never does.
+		writtenAfter  int
+		retries       int
+		expectedReads int
+	}{
+		"concurrent write lands": {
+			writtenAfter:  2,
+			retries:       3,
+			expectedReads: 3,
+		},
+		"concurrent write too late": {
+			writtenAfter:  5,
+			retries:       2,
+			expectedReads: 2,
+		},
+		"genuinely missing": {
+			retries:       2,
+			expectedReads: 2,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			var reads int
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == http.MethodGet {
+						if reads == tc.writtenAfter && tc.writtenAfter > 0 {
+							storage.mu.Lock()
+							storage.objects["bucket/state"] = &mockS3Object{body: []byte(`{"version": 4}`), header: http.Header{}}
+							storage.mu.Unlock()
+						}
+						reads++
+					}
+					storage.ServeHTTP(w, r)
+				}),
+				bucketName: "bucket",
+				path:       "state",
+			}
+
+			if err := client.waitForNewState(tc.retries); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if reads != tc.expectedReads {
+				t.Fatalf("expected %d reads, got %d", tc.expectedReads, reads)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_verifyDelete(t *testing.T) {
+	defer func(d time.Duration) { verifyDeleteInterval = d }(verifyDeleteInterval)
+	verifyDeleteInterval = time.Millisecond
+
+	testCases := map[string]struct {
+		// goneAfter is the number of checks after which the deleted state
+		// disappears, or 0 if it never does.
+		goneAfter     int
+		verifyDelete  bool
+		expectedHeads int
+		expectedErr   string
+	}{
+		"disabled": {
+			goneAfter: 3,
+		},
+		"delayed delete": {
+			goneAfter:     3,
+			verifyDelete:  true,
+			expectedHeads: 4,
+		},
+		"never gone": {
+			verifyDelete:  true,
+			expectedHeads: verifyDeleteAttempts,
+			expectedErr:   `state "state" was deleted from the S3 bucket "bucket", but is still found after 6 checks`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			storage.objects["bucket/state"] = &mockS3Object{body: []byte(`{"version": 4}`), header: http.Header{}}
+			var heads int
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					switch r.Method {
+					case http.MethodDelete:
+						// The deleted state is still found for a while, as on
+						// eventually consistent stores.
+						w.WriteHeader(http.StatusNoContent)
+						return
+					case http.MethodHead:
+						heads++
+						if heads > tc.goneAfter && tc.goneAfter > 0 {
+							storage.mu.Lock()
+							delete(storage.objects, "bucket/state")
+							storage.mu.Unlock()
+						}
+					}
+					storage.ServeHTTP(w, r)
+				}),
+				bucketName:   "bucket",
+				path:         "state",
+				verifyDelete: tc.verifyDelete,
+			}
+
+			err := client.Delete()
+			if tc.expectedErr != "" {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if heads != tc.expectedHeads {
+				t.Fatalf("expected %d checks, got %d", tc.expectedHeads, heads)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_replicationStatus(t *testing.T) {
+	testCases := map[string]struct {
+		headStatus     int
+		expectedStatus string
+	}{
+		"pending": {
+			expectedStatus: s3.ReplicationStatusPending,
+		},
+		"head fails": {
+			headStatus: http.StatusForbidden,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			var heads int
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == http.MethodHead {
+						heads++
+						if tc.headStatus != 0 {
+							w.WriteHeader(tc.headStatus)
+							return
+						}
+						w.Header().Set("X-Amz-Replication-Status", s3.ReplicationStatusPending)
+					}
+					storage.ServeHTTP(w, r)
+				}),
+				bucketName:           "bucket",
+				path:                 "state",
+				logReplicationStatus: true,
+			}
+
+			// Reading the replication status is best-effort, so the write
+			// succeeds even if it can't be read.
+			if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if heads != 1 {
+				t.Fatalf("expected replication status to be requested once, got %d", heads)
+			}
+
+			status, err := client.replicationStatus()
+			if tc.headStatus != 0 {
+				if err == nil {
+					t.Fatal("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if status != tc.expectedStatus {
+				t.Fatalf("expected replication status %q, got %q", tc.expectedStatus, status)
+			}
+		})
+	}
+}
+
+func TestLockJitter(t *testing.T) {
+	const max = 10 * time.Millisecond
+	for i := 0; i < 1000; i++ {
+		if wait := lockJitter(max); wait < 0 || wait >= max {
+			t.Fatalf("expected a wait of less than %s, got %s", max, wait)
+		}
+	}
+}
+
+func TestRemoteClient_readEndpoint(t *testing.T) {
+	writeStorage := newMockS3Storage()
+	readStorage := newMockS3Storage()
+
+	client := &RemoteClient{
+		s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				t.Errorf("unexpected read of %s from the write endpoint", r.URL.Path)
+			}
+			writeStorage.ServeHTTP(w, r)
+		}),
+		s3ReadClient: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				t.Errorf("unexpected %s request to the read endpoint", r.Method)
+			}
+			readStorage.ServeHTTP(w, r)
+		}),
+		bucketName: "bucket",
+		path:       "state",
+	}
+
+	state := []byte(`{"version": 4, "serial": 1, "lineage": "abc"}`)
+	if err := client.Put(state); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+	if writeStorage.objects["bucket/state"] == nil {
+		t.Fatal("state was not written to the write endpoint")
+	}
+
+	// The read endpoint serves its own copy, as a caching gateway would.
+	readStorage.objects["bucket/state"] = writeStorage.objects["bucket/state"]
+	payload, err := client.Get()
+	if err != nil {
+		t.Fatalf("unexpected error reading state: %s", err)
+	}
+	if !bytes.Equal(payload.Data, state) {
+		t.Fatalf("expected state %q, got %q", state, payload.Data)
+	}
+
+	if err := client.Delete(); err != nil {
+		t.Fatalf("unexpected error deleting state: %s", err)
+	}
+	if writeStorage.objects["bucket/state"] != nil {
+		t.Fatal("state was not deleted from the write endpoint")
+	}
+}
+
+func TestRemoteClient_noSuchBucket(t *testing.T) {
+	const expectedErr = `S3 bucket "bucket" does not exist`
+
+	var puts int
+	s3Client := mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			puts++
+		}
+		writeS3Error(w, http.StatusNotFound, s3.ErrCodeNoSuchBucket, "The specified bucket does not exist")
+	})
+
+	client := &RemoteClient{
+		s3Client:   s3Client,
+		bucketName: "bucket",
+		path:       "state",
+	}
+	if payload, err := client.Get(); err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Fatalf("expected error containing %q, got payload %v and error %v", expectedErr, payload, err)
+	}
+	if err := client.Put([]byte(`{"version": 4}`)); err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Fatalf("expected error containing %q, got: %v", expectedErr, err)
+	}
+
+	// Without listing the bucket, the state is found with HEAD requests,
+	// whose responses don't tell a missing bucket apart from a missing object.
+	puts = 0
+	b := &Backend{
+		s3Client:             s3Client,
+		bucketName:           "bucket",
+		keyName:              "state",
+		workspaceKeyPrefix:   "env:",
+		skipWorkspaceListing: true,
+	}
+	if _, err := b.workspaceExists("dev"); err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Fatalf("expected error containing %q, got: %v", expectedErr, err)
+	}
+	if _, err := b.StateMgr("dev"); err == nil || !strings.Contains(err.Error(), expectedErr) {
+		t.Fatalf("expected error containing %q, got: %v", expectedErr, err)
+	}
+	if puts != 0 {
+		t.Fatalf("expected no state to be written, got %d writes", puts)
+	}
+}
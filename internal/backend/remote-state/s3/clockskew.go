@@ -0,0 +1,60 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// errCodeRequestTimeTooSkewed is the error code AWS rejects a request with
+// when its signing time is too far off the time of the service.
+const errCodeRequestTimeTooSkewed = "RequestTimeTooSkewed"
+
+// clockSkewHandler explains requests rejected because the local clock is out
+// of sync with AWS, which AWS reports as a bare signing error. The skew is
+// estimated from the Date header of the response, and the error keeps its code
+// and status so that it's still handled like the original one.
+//
+// The handler belongs in the Retry list, which runs after the error response
+// has been unmarshalled and before the error is returned.
+func clockSkewHandler() request.NamedHandler {
+	return request.NamedHandler{
+		Name: "tofu.s3.ClockSkew",
+		Fn: func(r *request.Request) {
+			reqErr, ok := r.Error.(awserr.RequestFailure)
+			if !ok || reqErr.Code() != errCodeRequestTimeTooSkewed || r.HTTPResponse == nil {
+				return
+			}
+
+			msg := fmt.Sprintf(errClockSkew, clockSkewDescription(r.HTTPResponse.Header.Get("Date"), time.Now()))
+			r.Error = awserr.NewRequestFailure(
+				awserr.New(reqErr.Code(), msg, reqErr),
+				reqErr.StatusCode(),
+				reqErr.RequestID(),
+			)
+		},
+	}
+}
+
+// clockSkewDescription describes how far the local time now is off the time
+// in the Date header of an AWS response.
+func clockSkewDescription(date string, now time.Time) string {
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return "out of sync with the time of AWS"
+	}
+
+	skew := now.Sub(serverTime).Round(time.Second)
+	if skew < 0 {
+		return fmt.Sprintf("about %s behind the time of AWS", -skew)
+	}
+	return fmt.Sprintf("about %s ahead of the time of AWS", skew)
+}
+
+const errClockSkew = `The request was rejected because the system clock is %s.
+
+AWS rejects signed requests whose time differs too much from its own. Synchronize
+the system clock, for example by enabling NTP, and try again.`
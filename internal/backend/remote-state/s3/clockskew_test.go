@@ -0,0 +1,80 @@
+package s3
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+)
+
+func TestBackend_clockSkew(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-10*time.Minute).UTC().Format(http.TimeFormat))
+		writeS3Error(w, http.StatusForbidden, errCodeRequestTimeTooSkewed, "The difference between the request time and the current time is too large.")
+	}))
+	defer ts.Close()
+
+	b, diags := configureBackend(t, map[string]any{
+		"access_key":                  awsbase.MockStaticAccessKey,
+		"secret_key":                  awsbase.MockStaticSecretKey,
+		"bucket":                      "bucket",
+		"key":                         "key",
+		"region":                      "us-west-2",
+		"endpoint":                    ts.URL,
+		"force_path_style":            true,
+		"max_retries":                 0,
+		"skip_credentials_validation": true,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+	}
+
+	client, err := b.remoteClient("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err = client.Get()
+	if err == nil {
+		t.Fatal("expected an error, got none")
+	}
+	// The Date header has a resolution of one second.
+	if msg := err.Error(); !strings.Contains(msg, "the system clock is about 10m") || !strings.Contains(msg, "ahead of the time of AWS") {
+		t.Fatalf("expected error explaining the clock skew, got: %s", err)
+	}
+}
+
+func TestClockSkewDescription(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		date     string
+		expected string
+	}{
+		"ahead": {
+			date:     "Fri, 01 Mar 2024 11:54:30 GMT",
+			expected: "about 5m30s ahead of the time of AWS",
+		},
+		"behind": {
+			date:     "Fri, 01 Mar 2024 13:00:00 GMT",
+			expected: "about 1h0m0s behind the time of AWS",
+		},
+		"missing date": {
+			expected: "out of sync with the time of AWS",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			if actual := clockSkewDescription(tc.date, now); actual != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/opentofu/opentofu/internal/states/remote"
+)
+
+// WorkspaceState describes the state of a workspace by its serial and
+// lineage.
+type WorkspaceState struct {
+	Workspace string
+	Serial    uint64
+	Lineage   string
+}
+
+// WorkspaceComparison is the result of comparing the states of two
+// workspaces.
+type WorkspaceComparison struct {
+	A, B WorkspaceState
+
+	// SameLineage is true if both states descend from the same initial
+	// state, so that their serials can be meaningfully compared.
+	SameLineage bool
+}
+
+// CompareWorkspaces reads the serial and lineage of the states of the
+// workspaces wsA and wsB, for example to check that a state is promoted from
+// the intended version. The states are read without locking, and only their
+// serial and lineage are decoded.
+func (b *Backend) CompareWorkspaces(ctx context.Context, wsA, wsB string) (*WorkspaceComparison, error) {
+	stateA, err := b.workspaceState(ctx, wsA)
+	if err != nil {
+		return nil, err
+	}
+	stateB, err := b.workspaceState(ctx, wsB)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WorkspaceComparison{
+		A:           *stateA,
+		B:           *stateB,
+		SameLineage: stateA.Lineage == stateB.Lineage,
+	}, nil
+}
+
+func (b *Backend) workspaceState(ctx context.Context, workspace string) (*WorkspaceState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	payload, err := b.readWorkspaceState(workspace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state of workspace %q: %w", workspace, err)
+	}
+	if payload == nil {
+		return nil, fmt.Errorf("workspace %q has no state", workspace)
+	}
+
+	var state struct {
+		Serial  uint64 `json:"serial"`
+		Lineage string `json:"lineage"`
+	}
+	if err := json.Unmarshal(payload.Data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode state of workspace %q: %w", workspace, err)
+	}
+
+	return &WorkspaceState{
+		Workspace: workspace,
+		Serial:    state.Serial,
+		Lineage:   state.Lineage,
+	}, nil
+}
+
+// readWorkspaceState reads the state of a workspace without locking it, from
+// the local mirror if local_mirror_path is set. It returns nil if the
+// workspace has no state.
+func (b *Backend) readWorkspaceState(workspace string) (*remote.Payload, error) {
+	if b.localMirrorPath != "" {
+		return b.mirrorClient(workspace).Get()
+	}
+
+	client, err := b.remoteClient(workspace)
+	if err != nil {
+		return nil, err
+	}
+	key, err := client.resolveStateKey()
+	if err != nil || key == "" {
+		return nil, err
+	}
+	return client.atKey(key).get()
+}
@@ -0,0 +1,118 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBackend_CompareWorkspaces(t *testing.T) {
+	storage := newMockS3Storage()
+	for key, body := range map[string]string{
+		"bucket/state":              `{"version": 4, "serial": 3, "lineage": "abc"}`,
+		"bucket/env:/staging/state": `{"version": 4, "serial": 7, "lineage": "abc"}`,
+		"bucket/env:/other/state":   `{"version": 4, "serial": 7, "lineage": "def"}`,
+		"bucket/env:/broken/state":  `{"version": 4,`,
+	} {
+		storage.objects[key] = &mockS3Object{body: []byte(body), header: http.Header{}}
+	}
+
+	b := &Backend{
+		s3Client:           mockS3Client(t, storage.ServeHTTP),
+		bucketName:         "bucket",
+		keyName:            "state",
+		workspaceKeyPrefix: "env:",
+	}
+
+	cases := map[string]struct {
+		a, b          string
+		expectSerials [2]uint64
+		expectSame    bool
+		expectedErr   string
+	}{
+		"same lineage": {
+			a:             "staging",
+			b:             "default",
+			expectSerials: [2]uint64{7, 3},
+			expectSame:    true,
+		},
+		"different lineage": {
+			a:             "staging",
+			b:             "other",
+			expectSerials: [2]uint64{7, 7},
+		},
+		"missing state": {
+			a:           "staging",
+			b:           "missing",
+			expectedErr: `workspace "missing" has no state`,
+		},
+		"corrupt state": {
+			a:           "broken",
+			b:           "staging",
+			expectedErr: `failed to decode state of workspace "broken"`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cmp, err := b.CompareWorkspaces(context.Background(), tc.a, tc.b)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if cmp.A.Workspace != tc.a || cmp.B.Workspace != tc.b {
+				t.Fatalf("unexpected workspaces %q and %q", cmp.A.Workspace, cmp.B.Workspace)
+			}
+			if serials := [2]uint64{cmp.A.Serial, cmp.B.Serial}; serials != tc.expectSerials {
+				t.Fatalf("expected serials %v, got %v", tc.expectSerials, serials)
+			}
+			if cmp.SameLineage != tc.expectSame {
+				t.Fatalf("expected same lineage to be %t, got %t", tc.expectSame, cmp.SameLineage)
+			}
+		})
+	}
+
+}
+
+func TestBackend_CompareWorkspacesKeyIsPointer(t *testing.T) {
+	storage := newMockS3Storage()
+	for key, body := range map[string]string{
+		"bucket/state":              "versions/default/1",
+		"bucket/env:/staging/state": "versions/staging/2\n",
+		"bucket/versions/default/1": `{"version": 4, "serial": 3, "lineage": "abc"}`,
+		"bucket/versions/staging/2": `{"version": 4, "serial": 7, "lineage": "abc"}`,
+	} {
+		storage.objects[key] = &mockS3Object{body: []byte(body), header: http.Header{}}
+	}
+
+	b := &Backend{
+		s3Client:           mockS3Client(t, storage.ServeHTTP),
+		bucketName:         "bucket",
+		keyName:            "state",
+		workspaceKeyPrefix: "env:",
+		keyIsPointer:       true,
+	}
+
+	cmp, err := b.CompareWorkspaces(context.Background(), "staging", "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if serials := [2]uint64{cmp.A.Serial, cmp.B.Serial}; serials != [2]uint64{7, 3} {
+		t.Fatalf("expected the serials of the states the pointers refer to, got %v", serials)
+	}
+	if !cmp.SameLineage {
+		t.Fatal("expected the same lineage")
+	}
+
+	_, err = b.CompareWorkspaces(context.Background(), "staging", "missing")
+	if err == nil || !strings.Contains(err.Error(), `workspace "missing" has no state`) {
+		t.Fatalf("expected an error for a missing pointer, got: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+const gzipContentEncoding = "gzip"
+
+// gzipMagic is the header every gzip stream starts with. State is JSON, so it
+// can never start with these bytes.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func compressPayload(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress state: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress state: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressPayload gunzips data if the object was stored compressed. This
+// does not depend on the "compress" setting, so that state written before and
+// after changing it can both be read.
+func decompressPayload(data []byte, contentEncoding string) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		if strings.EqualFold(contentEncoding, gzipContentEncoding) {
+			// The HTTP client transparently decodes bodies with a gzip
+			// content encoding when it negotiated the compression itself.
+			log.Printf("[DEBUG] State object with gzip content encoding was already decoded")
+		}
+		return data, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress state: %w", err)
+	}
+	defer zr.Close()
+
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress state: %w", err)
+	}
+	return plain, nil
+}
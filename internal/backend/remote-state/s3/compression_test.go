@@ -0,0 +1,96 @@
+package s3
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRemoteClient_compression(t *testing.T) {
+	testCases := map[string]struct {
+		writeCompressed bool
+		readCompressed  bool
+	}{
+		"compressed read with compression disabled": {
+			writeCompressed: true,
+			readCompressed:  false,
+		},
+		"uncompressed read with compression enabled": {
+			writeCompressed: false,
+			readCompressed:  true,
+		},
+		"compressed read with compression enabled": {
+			writeCompressed: true,
+			readCompressed:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			s3Client := mockS3Client(t, storage.ServeHTTP)
+
+			writer := &RemoteClient{
+				s3Client:   s3Client,
+				bucketName: "bucket",
+				path:       "state",
+				compress:   tc.writeCompressed,
+			}
+			reader := &RemoteClient{
+				s3Client:   s3Client,
+				bucketName: "bucket",
+				path:       "state",
+				compress:   tc.readCompressed,
+			}
+
+			state := []byte(`{"version": 4, "serial": 1, "lineage": "abc"}`)
+			if err := writer.Put(state); err != nil {
+				t.Fatalf("unexpected error writing state: %s", err)
+			}
+
+			stored := storage.objects["bucket/state"]
+			if stored == nil {
+				t.Fatal("state object was not written")
+			}
+			if got := bytes.HasPrefix(stored.body, gzipMagic); got != tc.writeCompressed {
+				t.Fatalf("expected stored state compressed to be %t, got %t", tc.writeCompressed, got)
+			}
+
+			payload, err := reader.Get()
+			if err != nil {
+				t.Fatalf("unexpected error reading state: %s", err)
+			}
+			if !bytes.Equal(payload.Data, state) {
+				t.Fatalf("expected state %q, got %q", state, payload.Data)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_compressionWithClientSideEncryption(t *testing.T) {
+	storage := newMockS3Storage()
+	client := &RemoteClient{
+		s3Client:                     mockS3Client(t, storage.ServeHTTP),
+		kmsClient:                    mockKMSClient(t),
+		bucketName:                   "bucket",
+		path:                         "state",
+		compress:                     true,
+		clientSideEncryptionKMSKeyID: "alias/state",
+	}
+
+	state := []byte(`{"version": 4, "serial": 1, "lineage": "abc"}`)
+	if err := client.Put(state); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+	if enc := storage.objects["bucket/state"].header.Get("Content-Encoding"); enc != "" {
+		t.Fatalf("expected no content encoding on ciphertext, got %q", enc)
+	}
+
+	payload, err := client.Get()
+	if err != nil {
+		t.Fatalf("unexpected error reading state: %s", err)
+	}
+	if !bytes.Equal(payload.Data, state) {
+		t.Fatalf("expected state %q, got %q", state, payload.Data)
+	}
+}
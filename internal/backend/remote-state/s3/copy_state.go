@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+// CopyStateTo streams the state object of the default workspace to w, such as
+// to back it up to another store, and returns the number of bytes written.
+//
+// The object is copied as it's stored, without holding it in memory: the
+// encryption configured with "sse_customer_key" or "kms_key_id" is removed by
+// S3 as the object is read, but state which was compressed, encrypted on the
+// client side or sharded is copied in that form. The state isn't locked or
+// otherwise changed, so a state written concurrently may be copied either
+// before or after the write, but never partially. With "key_is_pointer", the
+// state object the pointer refers to is copied, and with "local_mirror_path",
+// the state file in the local mirror is.
+func (b *Backend) CopyStateTo(ctx context.Context, w io.Writer) (int64, error) {
+	if b.localMirrorPath != "" {
+		return b.mirrorClient(backend.DefaultStateName).copyTo(w)
+	}
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := client.resolveStateKey()
+	if err != nil {
+		return 0, err
+	}
+	if key == "" {
+		return 0, fmt.Errorf(errStatePointerNotFound, client.path, client.bucketName)
+	}
+	client = client.atKey(key)
+
+	input := &s3.GetObjectInput{
+		Bucket: &client.bucketName,
+		Key:    &client.path,
+	}
+	if client.serverSideEncryption && client.customerEncryptionKey != nil {
+		input.SetSSECustomerKey(string(client.customerEncryptionKey))
+		input.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		input.SetSSECustomerKeyMD5(client.getSSECustomerKeyMD5())
+	}
+
+	output, err := client.readClient().GetObjectWithContext(ctx, input)
+	if err != nil {
+		var awsErr awserr.Error
+		switch {
+		case errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchBucket:
+			return 0, fmt.Errorf(errS3NoSuchBucket, client.bucketName, err)
+		case errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey:
+			return 0, fmt.Errorf("state %q does not exist in the S3 bucket %q", client.path, client.bucketName)
+		case isKMSKeyAccessError(err):
+			return 0, client.kmsKeyAccessError(err)
+		}
+		return 0, client.sseCustomerKeyError(err)
+	}
+	defer output.Body.Close()
+
+	n, err := io.Copy(w, client.limitResponseBody(output))
+	if err != nil {
+		return n, fmt.Errorf("failed to copy state %q: %w", client.path, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,77 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBackend_CopyStateTo(t *testing.T) {
+	storage := newMockS3Storage()
+	b := &Backend{
+		s3Client:              mockS3Client(t, storage.ServeHTTP),
+		bucketName:            "bucket",
+		keyName:               "state",
+		serverSideEncryption:  true,
+		customerEncryptionKey: bytes.Repeat([]byte{'k'}, 32),
+	}
+
+	var buf bytes.Buffer
+	if _, err := b.CopyStateTo(context.Background(), &buf); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected an error for a missing state, got: %v", err)
+	}
+
+	client, err := b.remoteClient("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	state := []byte(`{"version": 4, "serial": 1, "lineage": "copy"}`)
+	if err := client.Put(state); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	n, err := b.CopyStateTo(context.Background(), &buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != int64(len(state)) {
+		t.Fatalf("expected %d bytes to be copied, got %d", len(state), n)
+	}
+	if !bytes.Equal(buf.Bytes(), state) {
+		t.Fatalf("expected the state %s, got %s", state, buf.Bytes())
+	}
+
+	// The object can only be read with the key it was written with.
+	b.customerEncryptionKey = bytes.Repeat([]byte{'x'}, 32)
+	if _, err := b.CopyStateTo(context.Background(), &bytes.Buffer{}); err == nil {
+		t.Fatal("expected an error reading the state with another key")
+	}
+}
+
+func TestBackend_CopyStateToKeyIsPointer(t *testing.T) {
+	storage := newMockS3Storage()
+	b := &Backend{
+		s3Client:     mockS3Client(t, storage.ServeHTTP),
+		bucketName:   "bucket",
+		keyName:      "state",
+		keyIsPointer: true,
+	}
+
+	if _, err := b.CopyStateTo(context.Background(), &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), `state pointer "state" does not exist`) {
+		t.Fatalf("expected an error for a missing pointer, got: %v", err)
+	}
+
+	state := []byte(`{"version": 4, "serial": 1, "lineage": "copy"}`)
+	storage.objects["bucket/state"] = &mockS3Object{body: []byte("versions/1\n"), header: http.Header{}}
+	storage.objects["bucket/versions/1"] = &mockS3Object{body: state, header: http.Header{}}
+
+	var buf bytes.Buffer
+	if _, err := b.CopyStateTo(context.Background(), &buf); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), state) {
+		t.Fatalf("expected the state the pointer refers to, got %s", buf.Bytes())
+	}
+}
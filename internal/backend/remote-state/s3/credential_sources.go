@@ -0,0 +1,71 @@
+package s3
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// availableCredentialsSources returns the sources of credentials_source_priority
+// which provide credentials for the configuration, in the order the AWS SDK
+// tries them, so that the first is the one it uses. Only sources which can be
+// found without any request are returned, which excludes the role of the EC2
+// instance.
+func availableCredentialsSources(cfg *awsbase.Config, obj cty.Value) []string {
+	var sources []string
+	if cfg.AccessKey != "" && cfg.SecretKey != "" {
+		sources = append(sources, credentialsSourceStatic)
+	}
+	if (os.Getenv("AWS_ACCESS_KEY_ID") != "" || os.Getenv("AWS_ACCESS_KEY") != "") &&
+		(os.Getenv("AWS_SECRET_ACCESS_KEY") != "" || os.Getenv("AWS_SECRET_KEY") != "") {
+		sources = append(sources, credentialsSourceEnv)
+	}
+
+	profile := configuredProfile(obj)
+	credsFilename := stringAttrDefaultEnvVar(obj, "shared_credentials_file", "AWS_SHARED_CREDENTIALS_FILE")
+	if credsFilename == "" {
+		credsFilename = "~/.aws/credentials"
+	}
+	if profileValue(credsFilename, []string{profile}, "aws_access_key_id") != "" {
+		sources = append(sources, credentialsSourceProfile)
+	}
+	if profileValue(sharedConfigFilename(), configFileSections(profile), "role_arn") != "" {
+		sources = append(sources, credentialsSourceAssumeRole)
+	}
+
+	if os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" {
+		sources = append(sources, credentialsSourceECS)
+	}
+	return sources
+}
+
+// multipleCredentialsSourcesWarning warns if credentials are available from
+// more than one source, since the precedence of the AWS SDK may pick other
+// credentials than intended. Choosing the sources explicitly with
+// credentials_source_priority removes the ambiguity.
+func multipleCredentialsSourcesWarning(cfg *awsbase.Config, obj cty.Value) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+	if !obj.GetAttr("credentials_source_priority").IsNull() {
+		return diags
+	}
+
+	sources := availableCredentialsSources(cfg, obj)
+	if len(sources) < 2 {
+		return diags
+	}
+
+	quoted := make([]string, len(sources))
+	for i, source := range sources {
+		quoted[i] = fmt.Sprintf("%q", source)
+	}
+	diags = diags.Append(tfdiags.Sourceless(
+		tfdiags.Warning,
+		"Multiple credential sources",
+		fmt.Sprintf(`Credentials are available from the sources %s, and the credentials from %q are used. Set "credentials_source_priority" to choose the source explicitly, or set "warn_on_multiple_credential_sources" to false to hide this warning.`, strings.Join(quoted, ", "), sources[0]),
+	))
+	return diags
+}
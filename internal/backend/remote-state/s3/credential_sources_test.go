@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+)
+
+func TestBackendConfig_multipleCredentialSources(t *testing.T) {
+	testCases := map[string]struct {
+		config          map[string]any
+		expectedWarning bool
+	}{
+		"single source": {
+			config: map[string]any{},
+		},
+		"multiple sources": {
+			config: map[string]any{
+				"access_key": awsbase.MockStaticAccessKey,
+				"secret_key": awsbase.MockStaticSecretKey,
+			},
+			expectedWarning: true,
+		},
+		"warning disabled": {
+			config: map[string]any{
+				"access_key":                          awsbase.MockStaticAccessKey,
+				"secret_key":                          awsbase.MockStaticSecretKey,
+				"warn_on_multiple_credential_sources": false,
+			},
+		},
+		"explicit priority": {
+			config: map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"credentials_source_priority": []any{"env", "static"},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+			os.Setenv("AWS_ACCESS_KEY_ID", awsbase.MockEnvAccessKey)
+			os.Setenv("AWS_SECRET_ACCESS_KEY", awsbase.MockEnvSecretKey)
+
+			tc.config["bucket"] = "bucket"
+			tc.config["key"] = "key"
+			tc.config["region"] = "us-west-2"
+			tc.config["skip_credentials_validation"] = true
+
+			_, diags := configureBackend(t, tc.config)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors: %s", diagnosticsString(diags))
+			}
+
+			if !tc.expectedWarning {
+				if len(diags) != 0 {
+					t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+				}
+				return
+			}
+			if len(diags) != 1 || diags[0].Severity() != tfdiags.Warning || diags[0].Description().Summary != "Multiple credential sources" {
+				t.Fatalf("expected a multiple credential sources warning, got: %s", diagnosticsString(diags))
+			}
+			if expected := `Credentials are available from the sources "static", "env", and the credentials from "static" are used.`; !strings.HasPrefix(diags[0].Description().Detail, expected) {
+				t.Fatalf("unexpected warning detail: %s", diags[0].Description().Detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+	"github.com/mitchellh/go-homedir"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Valid values of the credentials_source_priority attribute.
+const (
+	credentialsSourceStatic     = "static"
+	credentialsSourceAssumeRole = "assume_role"
+	credentialsSourceProfile    = "profile"
+	credentialsSourceEnv        = "env"
+	credentialsSourceECS        = "ecs"
+	credentialsSourceEC2        = "ec2"
+)
+
+var credentialsSources = []string{
+	credentialsSourceStatic,
+	credentialsSourceAssumeRole,
+	credentialsSourceProfile,
+	credentialsSourceEnv,
+	credentialsSourceECS,
+	credentialsSourceEC2,
+}
+
+// setPriorityCredentials resolves the credentials from the sources listed in
+// credentials_source_priority, using the first which provides any, sets their
+// current value as the static credentials of cfg, and returns them so that
+// the session can be created with them by getSession. The role in
+// role_arn is still assumed with these credentials.
+//
+// The returned credentials are only ever refreshed from the listed sources,
+// in their order, rather than from a later source in the default order of the
+// SDK. It returns nil if credentials_source_priority isn't set.
+func setPriorityCredentials(cfg *awsbase.Config, obj cty.Value) (*credentials.Credentials, error) {
+	val := obj.GetAttr("credentials_source_priority")
+	if val.IsNull() {
+		return nil, nil
+	}
+
+	var sources []string
+	var providers []credentials.Provider
+	for _, v := range val.AsValueSlice() {
+		source := v.AsString()
+		sources = append(sources, source)
+		providers = append(providers, credentialsSourceProvider(cfg, obj, source))
+	}
+
+	chain := credentials.NewCredentials(&credentials.ChainProvider{
+		Providers:     providers,
+		VerboseErrors: true,
+	})
+	value, err := chain.Get()
+	if err != nil {
+		return nil, fmt.Errorf("no credentials found in the sources %q: %w", sources, err)
+	}
+	log.Printf("[INFO] Using credentials from %q", value.ProviderName)
+
+	*cfg = *resolvedConfig(cfg, value)
+	return chain, nil
+}
+
+// credentialsSourceProvider returns the provider of the credentials of one of
+// the sources of credentials_source_priority.
+func credentialsSourceProvider(cfg *awsbase.Config, obj cty.Value, source string) credentials.Provider {
+	switch source {
+	case credentialsSourceStatic:
+		return &credentials.StaticProvider{Value: credentials.Value{
+			AccessKeyID:     cfg.AccessKey,
+			SecretAccessKey: cfg.SecretKey,
+			SessionToken:    cfg.Token,
+		}}
+
+	case credentialsSourceEnv:
+		return &credentials.EnvProvider{}
+
+	case credentialsSourceProfile:
+		filename, err := homedir.Expand(stringAttrDefaultEnvVar(obj, "shared_credentials_file", "AWS_SHARED_CREDENTIALS_FILE"))
+		if err != nil {
+			return unavailableProvider{err}
+		}
+		return &credentials.SharedCredentialsProvider{
+			Filename: filename,
+			Profile:  configuredProfile(obj),
+		}
+
+	case credentialsSourceAssumeRole:
+		// Only the profile's own role is considered, rather than whatever
+		// the SDK would resolve for the profile.
+		profile := configuredProfile(obj)
+		if profileValue(sharedConfigFilename(), configFileSections(profile), "role_arn") == "" {
+			return unavailableProvider{fmt.Errorf("profile %q does not assume a role", profile)}
+		}
+		sess, err := session.NewSessionWithOptions(session.Options{
+			Config: aws.Config{
+				EndpointResolver: cfg.EndpointResolver(),
+				Region:           aws.String(cfg.Region),
+			},
+			Profile:           profile,
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			return unavailableProvider{err}
+		}
+		return sessionProvider{sess.Config.Credentials, credentialsSourceAssumeRole}
+
+	case credentialsSourceECS:
+		if os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") == "" && os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") == "" {
+			return unavailableProvider{errors.New("not running in a container with a credentials endpoint")}
+		}
+		return defaults.RemoteCredProvider(*defaults.Config(), defaults.Handlers())
+
+	case credentialsSourceEC2:
+		if cfg.SkipMetadataApiCheck {
+			return unavailableProvider{errors.New(`the EC2 instance metadata service is disabled by "skip_metadata_api_check"`)}
+		}
+		metadataConfig := &aws.Config{}
+		if endpoint := os.Getenv("AWS_METADATA_URL"); endpoint != "" {
+			metadataConfig.Endpoint = aws.String(endpoint)
+		}
+		sess, err := session.NewSession(metadataConfig)
+		if err != nil {
+			return unavailableProvider{err}
+		}
+		return &ec2rolecreds.EC2RoleProvider{Client: ec2metadata.New(sess)}
+	}
+
+	return unavailableProvider{fmt.Errorf("unknown credentials source %q", source)}
+}
+
+// sessionProvider provides the credentials resolved by a session.
+type sessionProvider struct {
+	creds *credentials.Credentials
+	name  string
+}
+
+func (p sessionProvider) Retrieve() (credentials.Value, error) {
+	v, err := p.creds.Get()
+	v.ProviderName = p.name
+	return v, err
+}
+
+func (p sessionProvider) IsExpired() bool {
+	return p.creds.IsExpired()
+}
+
+// unavailableProvider is the provider of a source which can't provide
+// credentials in the current environment.
+type unavailableProvider struct {
+	err error
+}
+
+func (p unavailableProvider) Retrieve() (credentials.Value, error) {
+	return credentials.Value{}, p.err
+}
+
+func (p unavailableProvider) IsExpired() bool {
+	return true
+}
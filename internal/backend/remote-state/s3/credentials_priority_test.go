@@ -0,0 +1,182 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+)
+
+func TestBackendConfig_CredentialsSourcePriority(t *testing.T) {
+	const (
+		envAccessKey     = "EnvAccessKey"
+		profileAccessKey = "ProfileAccessKey"
+	)
+
+	testCases := map[string]struct {
+		priority          []any
+		config            map[string]any
+		environment       map[string]string
+		sharedCredentials string
+		expectedAccessKey string
+		expectedErr       string
+	}{
+		"static before env": {
+			priority: []any{"static", "env"},
+			config: map[string]any{
+				"access_key": awsbase.MockStaticAccessKey,
+				"secret_key": awsbase.MockStaticSecretKey,
+			},
+			environment: map[string]string{
+				"AWS_ACCESS_KEY_ID":     envAccessKey,
+				"AWS_SECRET_ACCESS_KEY": awsbase.MockEnvSecretKey,
+			},
+			expectedAccessKey: awsbase.MockStaticAccessKey,
+		},
+		"env before static": {
+			priority: []any{"env", "static"},
+			config: map[string]any{
+				"access_key": awsbase.MockStaticAccessKey,
+				"secret_key": awsbase.MockStaticSecretKey,
+			},
+			environment: map[string]string{
+				"AWS_ACCESS_KEY_ID":     envAccessKey,
+				"AWS_SECRET_ACCESS_KEY": awsbase.MockEnvSecretKey,
+			},
+			expectedAccessKey: envAccessKey,
+		},
+		"profile before env": {
+			priority: []any{"profile", "env"},
+			environment: map[string]string{
+				"AWS_ACCESS_KEY_ID":     envAccessKey,
+				"AWS_SECRET_ACCESS_KEY": awsbase.MockEnvSecretKey,
+			},
+			sharedCredentials: `
+[default]
+aws_access_key_id = ProfileAccessKey
+aws_secret_access_key = ProfileSecretKey
+`,
+			expectedAccessKey: profileAccessKey,
+		},
+		"unavailable sources skipped": {
+			priority: []any{"ecs", "ec2", "static", "env"},
+			config: map[string]any{
+				"skip_metadata_api_check": true,
+			},
+			environment: map[string]string{
+				"AWS_ACCESS_KEY_ID":     envAccessKey,
+				"AWS_SECRET_ACCESS_KEY": awsbase.MockEnvSecretKey,
+			},
+			expectedAccessKey: envAccessKey,
+		},
+		"no source available": {
+			priority: []any{"ecs", "static"},
+			config: map[string]any{
+				"access_key": awsbase.MockStaticAccessKey,
+			},
+			environment: map[string]string{
+				"AWS_ACCESS_KEY_ID":     envAccessKey,
+				"AWS_SECRET_ACCESS_KEY": awsbase.MockEnvSecretKey,
+			},
+			expectedErr: "Failed to resolve credentials",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			for k, v := range tc.environment {
+				os.Setenv(k, v)
+			}
+			if tc.sharedCredentials != "" {
+				filename := filepath.Join(t.TempDir(), "credentials")
+				if err := os.WriteFile(filename, []byte(tc.sharedCredentials), 0600); err != nil {
+					t.Fatalf("writing shared credentials file: %s", err)
+				}
+				os.Setenv("AWS_SHARED_CREDENTIALS_FILE", filename)
+			}
+
+			config := map[string]any{
+				"bucket":                      "bucket",
+				"key":                         "key",
+				"region":                      "us-west-2",
+				"skip_credentials_validation": true,
+				"credentials_source_priority": tc.priority,
+			}
+			for k, v := range tc.config {
+				config[k] = v
+			}
+
+			b, diags := configureBackend(t, config)
+			if tc.expectedErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("expected error %q, got none", tc.expectedErr)
+				}
+				if got := diagnosticsString(diags); !strings.Contains(got, tc.expectedErr) {
+					t.Fatalf("expected error %q, got: %s", tc.expectedErr, got)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+			}
+
+			creds, err := b.s3Client.Config.Credentials.Get()
+			if err != nil {
+				t.Fatalf("retrieving credentials: %s", err)
+			}
+			if creds.AccessKeyID != tc.expectedAccessKey {
+				t.Errorf("expected access key %q, got %q", tc.expectedAccessKey, creds.AccessKeyID)
+			}
+		})
+	}
+}
+
+func TestBackendConfig_CredentialsSourcePriorityRefresh(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	// The container credentials expire within the SDK's expiry window, so
+	// they're retrieved again each time they're used.
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"AccessKeyId": "ContainerAccessKey%d", "SecretAccessKey": "ContainerSecretKey", "Token": "ContainerToken", "Expiration": %q}`, n, time.Now().Add(time.Minute).UTC().Format(time.RFC3339))
+	}))
+	defer ts.Close()
+	os.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", ts.URL)
+
+	b, diags := configureBackend(t, map[string]any{
+		"bucket":                      "bucket",
+		"key":                         "key",
+		"region":                      "us-west-2",
+		"skip_credentials_validation": true,
+		"credentials_source_priority": []any{"ecs", "env"},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+	}
+	resolved := requests.Load()
+
+	creds, err := b.s3Client.Config.Credentials.Get()
+	if err != nil {
+		t.Fatalf("retrieving credentials: %s", err)
+	}
+	if requests.Load() == resolved {
+		t.Fatal("expected the expired credentials to be retrieved again")
+	}
+	if expected := fmt.Sprintf("ContainerAccessKey%d", requests.Load()); creds.AccessKeyID != expected {
+		t.Fatalf("expected access key %q, got %q", expected, creds.AccessKeyID)
+	}
+}
@@ -0,0 +1,64 @@
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// downloadObject reads the state object in parts of download_part_size, which
+// are downloaded concurrently, if it is larger than one part. Smaller objects
+// are read with a single request, like without download_part_size.
+//
+// Every part is requested with the ETag of the object, so that the download
+// fails rather than mixing the parts of two versions of the state if it's
+// written in the meantime.
+func (c *RemoteClient) downloadObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	head, err := c.readClient().HeadObject(&s3.HeadObjectInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		IfNoneMatch:          input.IfNoneMatch,
+		SSECustomerAlgorithm: input.SSECustomerAlgorithm,
+		SSECustomerKey:       input.SSECustomerKey,
+		SSECustomerKeyMD5:    input.SSECustomerKeyMD5,
+	})
+	if err != nil || aws.Int64Value(head.ContentLength) <= c.downloadPartSize {
+		// A missing or unchanged state is reported by the single request the
+		// way the caller expects it.
+		return c.readClient().GetObject(input)
+	}
+	size := aws.Int64Value(head.ContentLength)
+	if c.maxResponseBytes > 0 && size > c.maxResponseBytes {
+		return nil, c.responseTooLargeError()
+	}
+
+	partInput := *input
+	partInput.IfNoneMatch = nil
+	partInput.IfMatch = head.ETag
+
+	downloader := s3manager.NewDownloaderWithClient(c.readClient(), func(d *s3manager.Downloader) {
+		d.PartSize = c.downloadPartSize
+		d.Concurrency = c.downloadConcurrency
+	})
+	buf := aws.NewWriteAtBuffer(make([]byte, 0, size))
+	n, err := downloader.Download(buf, &partInput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download state %q in parts: %w", c.path, err)
+	}
+	if n != size {
+		return nil, fmt.Errorf("downloaded %d bytes of state %q in parts, but it has %d bytes", n, c.path, size)
+	}
+
+	return &s3.GetObjectOutput{
+		Body:            io.NopCloser(bytes.NewReader(buf.Bytes())),
+		ContentEncoding: head.ContentEncoding,
+		ContentLength:   head.ContentLength,
+		ContentType:     head.ContentType,
+		ETag:            head.ETag,
+		Metadata:        head.Metadata,
+	}, nil
+}
@@ -0,0 +1,161 @@
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockObjectHandler serves an object with ranged and conditional requests,
+// like S3 does. The object can be replaced with set.
+type mockObjectHandler struct {
+	mu       sync.Mutex
+	body     []byte
+	etag     string
+	requests []string
+}
+
+func (h *mockObjectHandler) set(body []byte, etag string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.body, h.etag = body, etag
+}
+
+func (h *mockObjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	body, etag := h.body, h.etag
+	h.requests = append(h.requests, strings.TrimSpace(r.Method+" "+r.Header.Get("Range")))
+	h.mu.Unlock()
+
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+func TestRemoteClient_downloadPartSize(t *testing.T) {
+	body := make([]byte, 2500)
+	rand.New(rand.NewSource(0)).Read(body)
+
+	testCases := map[string]struct {
+		partSize         int64
+		changeAfterFirst bool
+		expectedRequests []string
+		expectedErr      string
+	}{
+		"parts": {
+			partSize: 1000,
+			expectedRequests: []string{
+				"HEAD",
+				"GET bytes=0-999",
+				"GET bytes=1000-1999",
+				"GET bytes=2000-2999",
+			},
+		},
+		"single part": {
+			partSize:         2500,
+			expectedRequests: []string{"HEAD", "GET"},
+		},
+		"changed during download": {
+			partSize:         1000,
+			changeAfterFirst: true,
+			expectedErr:      "PreconditionFailed",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			handler := &mockObjectHandler{body: body, etag: `"1"`}
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					handler.ServeHTTP(w, r)
+					if tc.changeAfterFirst && r.Method == http.MethodGet {
+						handler.set(bytes.Repeat([]byte("x"), len(body)), `"2"`)
+					}
+				}),
+				bucketName:          "bucket",
+				path:                "state",
+				downloadPartSize:    tc.partSize,
+				downloadConcurrency: 1,
+			}
+
+			payload, err := client.get()
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !bytes.Equal(payload.Data, body) {
+				t.Fatalf("the downloaded state differs from the stored state")
+			}
+			if got := strings.Join(handler.requests, ", "); got != strings.Join(tc.expectedRequests, ", ") {
+				t.Fatalf("expected requests %v, got %v", tc.expectedRequests, handler.requests)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_downloadPartSizeMissingState(t *testing.T) {
+	storage := newMockS3Storage()
+	client := &RemoteClient{
+		s3Client:            mockS3Client(t, storage.ServeHTTP),
+		bucketName:          "bucket",
+		path:                "state",
+		downloadPartSize:    1000,
+		downloadConcurrency: 1,
+	}
+
+	payload, err := client.get()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if payload != nil {
+		t.Fatalf("expected no state, got %q", payload.Data)
+	}
+}
+
+// BenchmarkRemoteClient_download compares reading a large state with a single
+// request to reading it in parts which are downloaded concurrently.
+func BenchmarkRemoteClient_download(b *testing.B) {
+	body := make([]byte, 64*1024*1024)
+	rand.New(rand.NewSource(0)).Read(body)
+	handler := &mockObjectHandler{body: body, etag: `"1"`}
+	s3Client := mockS3Client(b, handler.ServeHTTP)
+
+	for _, bc := range []struct {
+		partSize    int64
+		concurrency int
+	}{
+		{0, 0},
+		{8 * 1024 * 1024, 1},
+		{8 * 1024 * 1024, 8},
+	} {
+		name := "single request"
+		if bc.partSize > 0 {
+			name = fmt.Sprintf("%d MiB parts, concurrency %d", bc.partSize/1024/1024, bc.concurrency)
+		}
+		b.Run(name, func(b *testing.B) {
+			client := &RemoteClient{
+				s3Client:            s3Client,
+				bucketName:          "bucket",
+				path:                "state",
+				downloadPartSize:    bc.partSize,
+				downloadConcurrency: bc.concurrency,
+			}
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				if _, err := client.get(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package s3
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// Object metadata keys used to store the envelope of client-side encrypted
+// state. S3 returns metadata keys canonicalized, so lookups must be
+// case-insensitive.
+const (
+	cseMetadataKey       = "Tofu-Cse-Key"
+	cseMetadataNonce     = "Tofu-Cse-Nonce"
+	cseMetadataAlgorithm = "Tofu-Cse-Algorithm"
+
+	cseAlgorithm = "AES256-GCM"
+)
+
+// encryptionMode describes in plain language how state written by the backend
+// is encrypted, which follows from the combination of encrypt, kms_key_id,
+// sse_customer_key and client_side_encryption_kms_key_id. The keys given to
+// kms_key_id and sse_customer_key only apply when encrypt is set.
+func (b *Backend) encryptionMode() string {
+	var mode string
+	switch {
+	case !b.serverSideEncryption:
+		mode = "no server-side encryption requested, so the default encryption of the bucket applies"
+	case b.kmsKeyID != "":
+		mode = fmt.Sprintf("SSE-KMS with the KMS key %q", b.kmsKeyID)
+	case b.customerEncryptionKey != nil:
+		mode = "SSE-C with the customer-provided key"
+	default:
+		mode = "SSE-S3 with keys managed by S3"
+	}
+
+	if b.clientSideEncryptionKMSKeyID != "" {
+		mode = fmt.Sprintf("client-side encryption with a data key from the KMS key %q, then %s", b.clientSideEncryptionKMSKeyID, mode)
+	}
+	return mode
+}
+
+// encryptPayload encrypts data locally with a fresh data key generated by KMS
+// and returns the ciphertext along with the object metadata needed to decrypt
+// it again. The plaintext data key never leaves this process.
+func (c *RemoteClient) encryptPayload(data []byte) ([]byte, map[string]*string, error) {
+	out, err := c.kmsClient.GenerateDataKey(&kms.GenerateDataKeyInput{
+		KeyId:   aws.String(c.clientSideEncryptionKMSKeyID),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate data key for client-side encryption: %w", err)
+	}
+
+	gcm, err := newGCM(out.Plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate nonce for client-side encryption: %w", err)
+	}
+
+	metadata := map[string]*string{
+		cseMetadataKey:       aws.String(base64.StdEncoding.EncodeToString(out.CiphertextBlob)),
+		cseMetadataNonce:     aws.String(base64.StdEncoding.EncodeToString(nonce)),
+		cseMetadataAlgorithm: aws.String(cseAlgorithm),
+	}
+
+	return gcm.Seal(nil, nonce, data, nil), metadata, nil
+}
+
+// decryptPayload reverses encryptPayload. Objects which were not encrypted
+// client-side are returned unchanged, so that existing state remains readable
+// after enabling client-side encryption.
+func (c *RemoteClient) decryptPayload(data []byte, metadata map[string]*string) ([]byte, error) {
+	wrappedKey, ok := metadataValue(metadata, cseMetadataKey)
+	if !ok {
+		return data, nil
+	}
+
+	if c.kmsClient == nil {
+		return nil, fmt.Errorf(errClientSideEncryptionNotConfigured, c.path)
+	}
+
+	if alg, _ := metadataValue(metadata, cseMetadataAlgorithm); alg != cseAlgorithm {
+		return nil, fmt.Errorf("unsupported client-side encryption algorithm %q", alg)
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client-side encryption data key: %w", err)
+	}
+	encodedNonce, _ := metadataValue(metadata, cseMetadataNonce)
+	nonce, err := base64.StdEncoding.DecodeString(encodedNonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client-side encryption nonce: %w", err)
+	}
+
+	out, err := c.kmsClient.Decrypt(&kms.DecryptInput{
+		CiphertextBlob: blob,
+	})
+	if isKMSKeyAccessError(err) {
+		return nil, fmt.Errorf(errKMSKeyInaccessible, c.path, "", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt client-side encryption data key: %w", err)
+	}
+
+	gcm, err := newGCM(out.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid client-side encryption nonce length %d", len(nonce))
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt client-side encrypted state: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client-side encryption data key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func metadataValue(metadata map[string]*string, name string) (string, bool) {
+	for k, v := range metadata {
+		if strings.EqualFold(k, name) && v != nil {
+			return *v, true
+		}
+	}
+	return "", false
+}
+
+const errClientSideEncryptionNotConfigured = `state object %q is encrypted client-side.
+
+The state was written with client-side encryption enabled, but
+"client_side_encryption_kms_key_id" is not set. Configure the KMS key that
+was used to encrypt the state in order to read it.`
@@ -0,0 +1,138 @@
+package s3
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+)
+
+func TestRemoteClient_clientSideEncryption(t *testing.T) {
+	storage := newMockS3Storage()
+	s3Client := mockS3Client(t, storage.ServeHTTP)
+
+	client := &RemoteClient{
+		s3Client:                     s3Client,
+		kmsClient:                    mockKMSClient(t),
+		bucketName:                   "bucket",
+		path:                         "state",
+		clientSideEncryptionKMSKeyID: "alias/state",
+	}
+
+	state := []byte(`{"version": 4, "serial": 1, "lineage": "abc"}`)
+	if err := client.Put(state); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+
+	stored := storage.objects["bucket/state"]
+	if stored == nil {
+		t.Fatal("state object was not written")
+	}
+	if bytes.Contains(stored.body, []byte("lineage")) {
+		t.Fatalf("state was stored in plaintext: %s", stored.body)
+	}
+
+	payload, err := client.Get()
+	if err != nil {
+		t.Fatalf("unexpected error reading state: %s", err)
+	}
+	if !bytes.Equal(payload.Data, state) {
+		t.Fatalf("expected state %q, got %q", state, payload.Data)
+	}
+
+	// A client without client-side encryption must refuse to return the
+	// ciphertext as if it were state.
+	plainClient := &RemoteClient{
+		s3Client:   s3Client,
+		bucketName: "bucket",
+		path:       "state",
+	}
+	if _, err := plainClient.Get(); err == nil || !strings.Contains(err.Error(), "client_side_encryption_kms_key_id") {
+		t.Fatalf("expected client-side encryption error, got: %v", err)
+	}
+
+	// State written before client-side encryption was enabled remains readable.
+	if err := plainClient.Put(state); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+	payload, err = client.Get()
+	if err != nil {
+		t.Fatalf("unexpected error reading unencrypted state: %s", err)
+	}
+	if !bytes.Equal(payload.Data, state) {
+		t.Fatalf("expected state %q, got %q", state, payload.Data)
+	}
+}
+
+func TestBackendConfig_encryptionMode(t *testing.T) {
+	testCases := map[string]struct {
+		config   map[string]any
+		expected string
+	}{
+		"unencrypted": {
+			expected: "no server-side encryption requested, so the default encryption of the bucket applies",
+		},
+		"keys without encrypt": {
+			config: map[string]any{
+				"kms_key_id": "alias/server-side",
+			},
+			expected: "no server-side encryption requested, so the default encryption of the bucket applies",
+		},
+		"SSE-S3": {
+			config: map[string]any{
+				"encrypt": true,
+			},
+			expected: "SSE-S3 with keys managed by S3",
+		},
+		"SSE-KMS": {
+			config: map[string]any{
+				"encrypt":    true,
+				"kms_key_id": "alias/server-side",
+			},
+			expected: `SSE-KMS with the KMS key "alias/server-side"`,
+		},
+		"SSE-C": {
+			config: map[string]any{
+				"encrypt":          true,
+				"sse_customer_key": "4Dm1n4rphcFzA8yMoSgbNRahl6wuv9l0pEvYGHG17Dk=",
+			},
+			expected: "SSE-C with the customer-provided key",
+		},
+		"client-side and SSE-S3": {
+			config: map[string]any{
+				"encrypt":                           true,
+				"client_side_encryption_kms_key_id": "alias/state",
+			},
+			expected: `client-side encryption with a data key from the KMS key "alias/state", then SSE-S3 with keys managed by S3`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			config := map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         "key",
+				"region":                      "us-west-2",
+				"skip_credentials_validation": true,
+			}
+			for k, v := range tc.config {
+				config[k] = v
+			}
+
+			b, diags := configureBackend(t, config)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+			}
+			if got := b.encryptionMode(); got != tc.expected {
+				t.Fatalf("expected encryption mode %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
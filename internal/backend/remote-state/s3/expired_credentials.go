@@ -0,0 +1,46 @@
+package s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// expiredCredentialsCodes are the error codes AWS rejects requests signed with
+// expired credentials with.
+var expiredCredentialsCodes = map[string]bool{
+	"ExpiredToken":          true,
+	"ExpiredTokenException": true,
+}
+
+// expiredCredentialsHandler stops requests rejected because the credentials
+// expired from being retried, for fail_fast_on_expired_credentials. The SDK
+// retries them after expiring the credentials locally, which only helps if
+// they can be refreshed, and otherwise delays the failure by all retries.
+//
+// Like clockSkewHandler, the handler belongs in the Retry list, which runs
+// before the SDK decides whether to retry.
+func expiredCredentialsHandler() request.NamedHandler {
+	return request.NamedHandler{
+		Name: "tofu.s3.ExpiredCredentials",
+		Fn: func(r *request.Request) {
+			reqErr, ok := r.Error.(awserr.RequestFailure)
+			if !ok || !expiredCredentialsCodes[reqErr.Code()] {
+				return
+			}
+
+			r.Retryable = aws.Bool(false)
+			r.Error = awserr.NewRequestFailure(
+				awserr.New(reqErr.Code(), errExpiredCredentials, reqErr),
+				reqErr.StatusCode(),
+				reqErr.RequestID(),
+			)
+		},
+	}
+}
+
+const errExpiredCredentials = `The request was rejected because the AWS credentials have expired.
+
+The request was not retried, since "fail_fast_on_expired_credentials" is set.
+Re-authenticate, for example by logging in to AWS SSO again or by assuming the
+role again, and run the operation again.`
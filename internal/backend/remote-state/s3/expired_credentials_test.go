@@ -0,0 +1,72 @@
+package s3
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+)
+
+func TestBackend_failFastOnExpiredCredentials(t *testing.T) {
+	testCases := map[string]struct {
+		failFast         bool
+		expectedRequests int64
+	}{
+		"disabled": {
+			expectedRequests: 3,
+		},
+		"enabled": {
+			failFast:         true,
+			expectedRequests: 1,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			var requests atomic.Int64
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				writeS3Error(w, http.StatusBadRequest, "ExpiredToken", "The provided token has expired.")
+			}))
+			defer ts.Close()
+
+			b, diags := configureBackend(t, map[string]any{
+				"access_key":                       awsbase.MockStaticAccessKey,
+				"secret_key":                       awsbase.MockStaticSecretKey,
+				"bucket":                           "bucket",
+				"key":                              "key",
+				"region":                           "us-west-2",
+				"endpoint":                         ts.URL,
+				"force_path_style":                 true,
+				"max_retries":                      2,
+				"skip_credentials_validation":      true,
+				"fail_fast_on_expired_credentials": tc.failFast,
+			})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+			}
+
+			client, err := b.remoteClient("default")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			_, err = client.Get()
+			if err == nil {
+				t.Fatal("expected an error, got none")
+			}
+			if got := requests.Load(); got != tc.expectedRequests {
+				t.Fatalf("expected %d requests, got %d", tc.expectedRequests, got)
+			}
+			if explained := strings.Contains(err.Error(), "the AWS credentials have expired"); explained != tc.failFast {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
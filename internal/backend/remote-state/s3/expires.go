@@ -0,0 +1,46 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// objectExpires is the expiration set on the state object with the Expires
+// header when object_expires is set, either as a duration after each write or
+// as an absolute time.
+//
+// S3 doesn't delete objects when they expire: the header is only a hint for
+// lifecycle tooling and other consumers of the object.
+type objectExpires struct {
+	after time.Duration
+	at    time.Time
+}
+
+// parseObjectExpires parses an object_expires value, which is either a
+// positive duration such as "72h" or a time in RFC 3339 format.
+func parseObjectExpires(s string) (*objectExpires, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return nil, errors.New("the duration must be positive")
+		}
+		return &objectExpires{after: d}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &objectExpires{at: t}, nil
+	}
+	return nil, fmt.Errorf("%q is neither a duration such as \"72h\" nor a time in RFC 3339 format such as \"2024-03-01T12:00:00Z\"", s)
+}
+
+// expiresAt returns the expiration of an object written at now, or nil if no
+// expiration is configured.
+func (e *objectExpires) expiresAt(now time.Time) *time.Time {
+	if e == nil {
+		return nil
+	}
+	if e.after > 0 {
+		t := now.Add(e.after)
+		return &t
+	}
+	return &e.at
+}
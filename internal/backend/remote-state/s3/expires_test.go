@@ -0,0 +1,90 @@
+package s3
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRemoteClient_objectExpires(t *testing.T) {
+	testCases := map[string]struct {
+		expires  string
+		expected func(before, after time.Time) (time.Time, time.Time)
+	}{
+		"duration": {
+			expires: "72h",
+			expected: func(before, after time.Time) (time.Time, time.Time) {
+				return before.Add(72 * time.Hour), after.Add(72 * time.Hour)
+			},
+		},
+		"time": {
+			expires: "2030-01-02T15:04:05Z",
+			expected: func(before, after time.Time) (time.Time, time.Time) {
+				t := time.Date(2030, time.January, 2, 15, 4, 5, 0, time.UTC)
+				return t, t
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			expires, err := parseObjectExpires(tc.expires)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			storage := newMockS3Storage()
+			var header string
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					if r.Method == http.MethodPut {
+						header = r.Header.Get("Expires")
+					}
+					storage.ServeHTTP(w, r)
+				}),
+				bucketName:    "bucket",
+				path:          "state",
+				objectExpires: expires,
+			}
+
+			// The header has a resolution of one second.
+			before := time.Now().Truncate(time.Second)
+			if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			after := time.Now()
+
+			actual, err := http.ParseTime(header)
+			if err != nil {
+				t.Fatalf("parsing Expires header %q: %s", header, err)
+			}
+			earliest, latest := tc.expected(before, after)
+			if actual.Before(earliest) || actual.After(latest) {
+				t.Errorf("expected Expires header between %s and %s, got %s", earliest, latest, actual)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_noObjectExpires(t *testing.T) {
+	storage := newMockS3Storage()
+	header := "unset"
+	client := &RemoteClient{
+		s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				header = r.Header.Get("Expires")
+			}
+			storage.ServeHTTP(w, r)
+		}),
+		bucketName: "bucket",
+		path:       "state",
+	}
+
+	if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if header != "" {
+		t.Errorf("expected no Expires header, got %q", header)
+	}
+}
@@ -0,0 +1,94 @@
+package s3
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// objectGrants holds the grantees of each permission granted on the state
+// objects by the grant blocks, in the format of the x-amz-grant-* headers.
+type objectGrants struct {
+	read        string
+	readACP     string
+	writeACP    string
+	fullControl string
+}
+
+// grantPermissions are the permissions which can be granted on an object,
+// unlike WRITE which only applies to buckets.
+var grantPermissions = []string{
+	s3.PermissionRead,
+	s3.PermissionReadAcp,
+	s3.PermissionWriteAcp,
+	s3.PermissionFullControl,
+}
+
+// grantsFromConfig collects the grantees of the given grant blocks, which are
+// assumed to have passed validateGrant.
+func grantsFromConfig(val cty.Value) *objectGrants {
+	if val.IsNull() || val.LengthInt() == 0 {
+		return nil
+	}
+
+	grantees := make(map[string][]string)
+	val.ForEachElement(func(_, grant cty.Value) (stop bool) {
+		var grantee string
+		switch grant.GetAttr("type").AsString() {
+		case s3.TypeCanonicalUser:
+			grantee = fmt.Sprintf("id=%q", grant.GetAttr("id").AsString())
+		case s3.TypeGroup:
+			grantee = fmt.Sprintf("uri=%q", grant.GetAttr("uri").AsString())
+		}
+		grant.GetAttr("permissions").ForEachElement(func(_, permission cty.Value) (stop bool) {
+			p := permission.AsString()
+			grantees[p] = append(grantees[p], grantee)
+			return
+		})
+		return
+	})
+
+	join := func(permission string) string {
+		sort.Strings(grantees[permission])
+		return strings.Join(grantees[permission], ", ")
+	}
+	return &objectGrants{
+		read:        join(s3.PermissionRead),
+		readACP:     join(s3.PermissionReadAcp),
+		writeACP:    join(s3.PermissionWriteAcp),
+		fullControl: join(s3.PermissionFullControl),
+	}
+}
+
+// setPutObject applies the grants to an upload.
+func (g *objectGrants) setPutObject(i *s3.PutObjectInput) {
+	if g == nil {
+		return
+	}
+	i.GrantRead = optionalString(g.read)
+	i.GrantReadACP = optionalString(g.readACP)
+	i.GrantWriteACP = optionalString(g.writeACP)
+	i.GrantFullControl = optionalString(g.fullControl)
+}
+
+// setCopyObject applies the grants to a server side copy.
+func (g *objectGrants) setCopyObject(i *s3.CopyObjectInput) {
+	if g == nil {
+		return
+	}
+	i.GrantRead = optionalString(g.read)
+	i.GrantReadACP = optionalString(g.readACP)
+	i.GrantWriteACP = optionalString(g.writeACP)
+	i.GrantFullControl = optionalString(g.fullControl)
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
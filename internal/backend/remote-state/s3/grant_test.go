@@ -0,0 +1,56 @@
+package s3
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRemoteClient_grants(t *testing.T) {
+	grants := grantsFromConfig(cty.SetVal([]cty.Value{
+		cty.ObjectVal(map[string]cty.Value{
+			"type":        cty.StringVal(s3.TypeCanonicalUser),
+			"id":          cty.StringVal("79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be"),
+			"uri":         cty.NullVal(cty.String),
+			"permissions": cty.SetVal([]cty.Value{cty.StringVal(s3.PermissionRead), cty.StringVal(s3.PermissionReadAcp)}),
+		}),
+		cty.ObjectVal(map[string]cty.Value{
+			"type":        cty.StringVal(s3.TypeGroup),
+			"id":          cty.NullVal(cty.String),
+			"uri":         cty.StringVal("http://acs.amazonaws.com/groups/global/AuthenticatedUsers"),
+			"permissions": cty.SetVal([]cty.Value{cty.StringVal(s3.PermissionRead)}),
+		}),
+	}))
+
+	storage := newMockS3Storage()
+	var header http.Header
+	client := &RemoteClient{
+		s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				header = r.Header.Clone()
+			}
+			storage.ServeHTTP(w, r)
+		}),
+		bucketName: "bucket",
+		path:       "state",
+		grants:     grants,
+	}
+
+	if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string]string{
+		"X-Amz-Grant-Read":         `id="79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be", uri="http://acs.amazonaws.com/groups/global/AuthenticatedUsers"`,
+		"X-Amz-Grant-Read-Acp":     `id="79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be"`,
+		"X-Amz-Grant-Write-Acp":    "",
+		"X-Amz-Grant-Full-Control": "",
+	}
+	for name, value := range expected {
+		if actual := header.Get(name); actual != value {
+			t.Errorf("expected %s header %q, got %q", name, value, actual)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// idempotencyTokenMetadataKey is the key of the object metadata holding
+	// the idempotency token of a write, for idempotency_token, so that
+	// consumers of S3 event notifications can drop duplicate events.
+	idempotencyTokenMetadataKey = "Tofu-Idempotency-Token"
+
+	// idempotencyKeyHeader is the request header carrying the idempotency
+	// token, for S3-compatible stores which deduplicate requests.
+	idempotencyKeyHeader = "Idempotency-Key"
+)
+
+// idempotencyToken returns the idempotency token of writing the state in data
+// to the object with the given key. It's derived from the SHA-256 checksum of
+// both, so that retried writes of the same state share the same token even if
+// the uploaded body differs, such as when it's encrypted with a fresh nonce.
+func idempotencyToken(key string, data []byte) string {
+	h := sha256.New()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// setIdempotencyToken adds the idempotency token of the state in data to the
+// metadata of an upload, and returns the request option sending it as a
+// header as well.
+func setIdempotencyToken(i *s3.PutObjectInput, data []byte) request.Option {
+	token := idempotencyToken(*i.Key, data)
+	if i.Metadata == nil {
+		i.Metadata = make(map[string]*string)
+	}
+	i.Metadata[idempotencyTokenMetadataKey] = &token
+	return request.WithSetRequestHeaders(map[string]string{idempotencyKeyHeader: token})
+}
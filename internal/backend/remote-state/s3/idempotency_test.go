@@ -0,0 +1,56 @@
+package s3
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIdempotencyToken(t *testing.T) {
+	state := []byte(`{"version": 4, "serial": 1}`)
+
+	token := idempotencyToken("env:/dev/state", state)
+	if other := idempotencyToken("env:/dev/state", []byte(`{"version": 4, "serial": 1}`)); other != token {
+		t.Fatalf("expected identical writes to share the token %q, got %q", token, other)
+	}
+	if other := idempotencyToken("env:/dev/state", []byte(`{"version": 4, "serial": 2}`)); other == token {
+		t.Fatal("expected a different state to have a different token")
+	}
+	if other := idempotencyToken("env:/prod/state", state); other == token {
+		t.Fatal("expected a different key to have a different token")
+	}
+}
+
+func TestRemoteClient_idempotencyToken(t *testing.T) {
+	state := []byte(`{"version": 4, "serial": 1}`)
+
+	var headers []string
+	storage := newMockS3Storage()
+	client := &RemoteClient{
+		s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				headers = append(headers, r.Header.Get(idempotencyKeyHeader))
+			}
+			storage.ServeHTTP(w, r)
+		}),
+		bucketName:       "bucket",
+		path:             "state",
+		compress:         true,
+		idempotencyToken: true,
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := client.Put(state); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	expected := idempotencyToken("state", state)
+	for _, header := range headers {
+		if header != expected {
+			t.Errorf("expected the %s header %q, got %q", idempotencyKeyHeader, expected, header)
+		}
+	}
+	if got := storage.objects["bucket/state"].header.Get("X-Amz-Meta-" + idempotencyTokenMetadataKey); got != expected {
+		t.Errorf("expected the token %q in the object metadata, got %q", expected, got)
+	}
+}
@@ -0,0 +1,87 @@
+package s3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+// Keys of the object tags holding the serial and lineage of a state, written
+// when tag_serial_and_lineage is set.
+//
+// Tags are used rather than object metadata, since reading the metadata of an
+// object encrypted with a customer-provided key (SSE-C) requires the key,
+// while reading its tags doesn't.
+const (
+	serialTagKey  = "Tofu-Serial"
+	lineageTagKey = "Tofu-Lineage"
+)
+
+// workspaceTagKey is the key of the object tag holding the name of the
+// workspace of a state, written when auto_tag_workspace is set.
+const workspaceTagKey = "tofu:workspace"
+
+// tagValuePattern matches the values S3 accepts for object tags.
+var tagValuePattern = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]{0,256}$`)
+
+// lineagePattern matches the UUIDs OpenTofu generates as lineages. Any other
+// lineage isn't exposed as a tag, since it may not be safe to store in
+// cleartext or may not be a valid tag value.
+var lineagePattern = regexp.MustCompile(`^[0-9a-fA-F]{8}(-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}$`)
+
+// stateIdentityTags returns the tags holding the serial and lineage of the
+// state in data. Nothing else is read from the state, so that no sensitive
+// values can end up in the tags.
+func stateIdentityTags(data []byte) (url.Values, error) {
+	var state struct {
+		Serial  *uint64 `json:"serial"`
+		Lineage string  `json:"lineage"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode state: %w", err)
+	}
+	if state.Serial == nil {
+		return nil, errors.New("state has no serial")
+	}
+	if !lineagePattern.MatchString(state.Lineage) {
+		return nil, fmt.Errorf("lineage %q is not a UUID", state.Lineage)
+	}
+
+	return url.Values{
+		serialTagKey:  {strconv.FormatUint(*state.Serial, 10)},
+		lineageTagKey: {state.Lineage},
+	}, nil
+}
+
+// stateTagging returns the tags of a state object written by the client, in
+// the URL-encoded format of the x-amz-tagging header, or an empty string if
+// there are none.
+func (c *RemoteClient) stateTagging(data []byte) string {
+	tags := make(url.Values)
+
+	if c.workspaceTag != "" {
+		if tagValuePattern.MatchString(c.workspaceTag) {
+			tags.Set(workspaceTagKey, c.workspaceTag)
+		} else {
+			log.Printf("[WARN] Not tagging state %q with its workspace, since %q is not a valid tag value", c.path, c.workspaceTag)
+		}
+	}
+
+	if c.tagSerialAndLineage {
+		// The tags are only for inventory tools, so the state is still
+		// written without them if they can't be derived.
+		if identity, err := stateIdentityTags(data); err != nil {
+			log.Printf("[WARN] Not tagging state %q with its serial and lineage: %s", c.path, err)
+		} else {
+			for k, v := range identity {
+				tags[k] = v
+			}
+		}
+	}
+
+	return tags.Encode()
+}
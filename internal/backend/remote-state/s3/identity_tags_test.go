@@ -0,0 +1,157 @@
+package s3
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestRemoteClient_tagSerialAndLineage(t *testing.T) {
+	const lineage = "6b9c04a4-7d5e-4f5c-a3c1-0c5a1d2e3f40"
+
+	testCases := map[string]struct {
+		state        string
+		expectedTags map[string]string
+	}{
+		"state": {
+			state: `{"version": 4, "serial": 12, "lineage": "` + lineage + `", "outputs": {"password": {"value": "secret", "type": "string", "sensitive": true}}}`,
+			expectedTags: map[string]string{
+				serialTagKey:  "12",
+				lineageTagKey: lineage,
+			},
+		},
+		"lineage not a UUID": {
+			state:        `{"version": 4, "serial": 12, "lineage": "secret"}`,
+			expectedTags: map[string]string{},
+		},
+		"no serial": {
+			state:        `{"version": 4, "lineage": "` + lineage + `"}`,
+			expectedTags: map[string]string{},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			s3Client := mockS3Client(t, storage.ServeHTTP)
+			client := &RemoteClient{
+				s3Client:              s3Client,
+				bucketName:            "bucket",
+				path:                  "state",
+				serverSideEncryption:  true,
+				customerEncryptionKey: bytes.Repeat([]byte{'k'}, 32),
+				tagSerialAndLineage:   true,
+			}
+
+			if err := client.Put([]byte(tc.state)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			// Without the key, the metadata of the object can't be read, but
+			// its tags can.
+			_, err := s3Client.HeadObject(&s3.HeadObjectInput{
+				Bucket: aws.String("bucket"),
+				Key:    aws.String("state"),
+			})
+			if err == nil {
+				t.Fatal("expected reading the metadata without the key to fail")
+			}
+			out, err := s3Client.GetObjectTagging(&s3.GetObjectTaggingInput{
+				Bucket: aws.String("bucket"),
+				Key:    aws.String("state"),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error reading tags: %s", err)
+			}
+
+			tags := make(map[string]string)
+			for _, tag := range out.TagSet {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			if len(tags) != len(tc.expectedTags) {
+				t.Fatalf("expected tags %v, got %v", tc.expectedTags, tags)
+			}
+			for k, v := range tc.expectedTags {
+				if tags[k] != v {
+					t.Fatalf("expected tags %v, got %v", tc.expectedTags, tags)
+				}
+			}
+
+			// The state itself still round-trips with the key.
+			payload, err := client.Get()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if string(payload.Data) != tc.state {
+				t.Fatalf("expected state %q, got %q", tc.state, payload.Data)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_tagSerialAndLineageDisabled(t *testing.T) {
+	var tagging string
+	storage := newMockS3Storage()
+	client := &RemoteClient{
+		s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				tagging = r.Header.Get("X-Amz-Tagging")
+			}
+			storage.ServeHTTP(w, r)
+		}),
+		bucketName: "bucket",
+		path:       "state",
+	}
+
+	if err := client.Put([]byte(`{"version": 4, "serial": 1, "lineage": "6b9c04a4-7d5e-4f5c-a3c1-0c5a1d2e3f40"}`)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if tagging != "" {
+		t.Fatalf("expected no tags, got %q", tagging)
+	}
+}
+
+func TestBackend_autoTagWorkspace(t *testing.T) {
+	const lineage = "6b9c04a4-7d5e-4f5c-a3c1-0c5a1d2e3f40"
+
+	storage := newMockS3Storage()
+	b := &Backend{
+		s3Client:            mockS3Client(t, storage.ServeHTTP),
+		bucketName:          "bucket",
+		keyName:             "state",
+		workspaceKeyPrefix:  "env:",
+		tagSerialAndLineage: true,
+		autoTagWorkspace:    true,
+	}
+
+	for name, expected := range map[string]string{
+		"default":  "default",
+		"dev":      "dev",
+		"team/dev": "team/dev",
+		"dev%":     "",
+	} {
+		client, err := b.remoteClient(name)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := client.Put([]byte(`{"version": 4, "serial": 3, "lineage": "` + lineage + `"}`)); err != nil {
+			t.Fatalf("unexpected error writing workspace %q: %s", name, err)
+		}
+
+		tags, err := url.ParseQuery(storage.objects["bucket/"+client.path].tags)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := tags.Get(workspaceTagKey); got != expected {
+			t.Errorf("expected workspace %q to be tagged with %q, got %q", name, expected, got)
+		}
+		if got := tags.Get(serialTagKey); got != "3" {
+			t.Errorf("expected workspace %q to be tagged with its serial as well, got %q", name, got)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package s3
+
+import (
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// errCodeIMDSForbidden is the error code of requests to the EC2 instance
+// metadata service rejected because forbid_imds is set.
+const errCodeIMDSForbidden = "IMDSForbidden"
+
+// skipMetadataAPI reports whether the EC2 instance metadata service must not
+// be used, because skip_metadata_api_check or forbid_imds is set.
+func skipMetadataAPI(obj cty.Value) bool {
+	return boolAttr(obj, "forbid_imds") || s3CompatibleAttr(obj, "skip_metadata_api_check")
+}
+
+// forbidIMDSHandler returns a request handler rejecting every request to the
+// EC2 instance metadata service, for forbid_imds.
+//
+// skip_metadata_api_check already keeps the credentials and region from being
+// read from the service, and disables the metadata clients through the
+// AWS_EC2_METADATA_DISABLED environment variable. This handler makes sure
+// that no metadata client created from the session reaches the service either,
+// whatever the environment, and makes such attempts visible.
+func forbidIMDSHandler() request.NamedHandler {
+	return request.NamedHandler{
+		Name: "tofu.s3.ForbidIMDS",
+		Fn: func(r *request.Request) {
+			if r.ClientInfo.ServiceName != ec2metadata.ServiceName {
+				return
+			}
+			log.Printf("[ERROR] Refusing to request %s from the EC2 instance metadata service, since \"forbid_imds\" is set", r.Operation.HTTPPath)
+			r.Error = awserr.New(errCodeIMDSForbidden, `the EC2 instance metadata service is forbidden by "forbid_imds"`, nil)
+		},
+	}
+}
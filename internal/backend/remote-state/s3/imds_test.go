@@ -0,0 +1,102 @@
+package s3
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+)
+
+func TestBackend_forbidIMDS(t *testing.T) {
+	testCases := map[string]struct {
+		forbid          bool
+		expectRequests  bool
+		expectedErrPart string
+	}{
+		"allowed": {
+			expectRequests: true,
+		},
+		"forbidden": {
+			forbid:          true,
+			expectedErrPart: "no valid credential sources",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			var requests atomic.Int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				for _, e := range ec2metadata_securityCredentialsEndpoints {
+					if r.RequestURI == e.Uri {
+						_, _ = w.Write([]byte(e.Body))
+						return
+					}
+				}
+				w.WriteHeader(http.StatusNotFound)
+			}))
+			defer ts.Close()
+			os.Setenv("AWS_METADATA_URL", ts.URL+"/latest")
+
+			config := map[string]any{
+				"bucket":                      "bucket",
+				"key":                         "key",
+				"region":                      "us-west-2",
+				"skip_credentials_validation": true,
+			}
+			if tc.forbid {
+				config["forbid_imds"] = true
+			}
+			_, diags := configureBackend(t, config)
+
+			if tc.expectedErrPart != "" {
+				if !diags.HasErrors() || !strings.Contains(diagnosticsString(diags), tc.expectedErrPart) {
+					t.Fatalf("expected error containing %q, got: %s", tc.expectedErrPart, diagnosticsString(diags))
+				}
+			} else if diags.HasErrors() {
+				t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+			}
+
+			if n := requests.Load(); tc.expectRequests && n == 0 {
+				t.Fatal("expected the credentials to be read from the instance metadata service")
+			} else if !tc.expectRequests && n != 0 {
+				t.Fatalf("expected the instance metadata service never to be contacted, got %d requests", n)
+			}
+		})
+	}
+}
+
+func TestForbidIMDSHandler(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte("i-1234567890abcdef0"))
+	}))
+	defer ts.Close()
+
+	sess := mockSession(ts.URL)
+	sess.Handlers.Build.PushFrontNamed(forbidIMDSHandler())
+
+	_, err := ec2metadata.New(sess, &aws.Config{Endpoint: aws.String(ts.URL)}).GetMetadata("instance-id")
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) || awsErr.Code() != errCodeIMDSForbidden {
+		t.Fatalf("expected the request to be forbidden, got: %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Fatalf("expected the instance metadata service never to be contacted, got %d requests", n)
+	}
+}
@@ -0,0 +1,73 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+	"github.com/opentofu/opentofu/version"
+)
+
+// initMarkerSuffix is appended to the state key to derive the key of the init
+// marker. Workspace listing ignores it, since it doesn't end with the key.
+const initMarkerSuffix = ".init"
+
+// initMarker records when and by whom a state location was first initialized.
+type initMarker struct {
+	StateKey  string    `json:"state_key"`
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"created_by"`
+	Version   string    `json:"tofu_version"`
+}
+
+func (c *RemoteClient) initMarkerPath() string {
+	return c.path + initMarkerSuffix
+}
+
+// putInitMarker writes the init marker for the state, using the lock info of
+// the operation initializing it. An existing marker is never overwritten, so
+// that it keeps describing the first initialization.
+func (c *RemoteClient) putInitMarker(info *statemgr.LockInfo) error {
+	_, err := c.s3Client.HeadObject(&s3.HeadObjectInput{
+		Bucket: &c.bucketName,
+		Key:    aws.String(c.initMarkerPath()),
+	})
+	if err == nil {
+		return nil
+	}
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) || reqErr.StatusCode() != http.StatusNotFound {
+		return fmt.Errorf("failed to check for init marker: %w", err)
+	}
+
+	data, err := json.Marshal(initMarker{
+		StateKey:  c.path,
+		Created:   info.Created,
+		CreatedBy: info.Who,
+		Version:   version.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	i := &s3.PutObjectInput{
+		ContentType:   aws.String("application/json"),
+		ContentLength: aws.Int64(int64(len(data))),
+		Body:          bytes.NewReader(data),
+		Bucket:        &c.bucketName,
+		Key:           aws.String(c.initMarkerPath()),
+	}
+	c.setPutObjectOptions(i)
+
+	if _, err := c.s3Client.PutObject(i); err != nil {
+		return fmt.Errorf("failed to upload init marker: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package s3
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+func TestRemoteClient_putInitMarker(t *testing.T) {
+	storage := newMockS3Storage()
+	client := &RemoteClient{
+		s3Client:   mockS3Client(t, storage.ServeHTTP),
+		bucketName: "bucket",
+		path:       "env:/dev/state",
+	}
+
+	first := statemgr.NewLockInfo()
+	first.Who = "alice@host"
+	if err := client.putInitMarker(first); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// A later initialization must not replace the original marker.
+	second := statemgr.NewLockInfo()
+	second.Who = "bob@host"
+	if err := client.putInitMarker(second); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(storage.objects) != 1 {
+		t.Fatalf("expected only the init marker to be written, got %d objects", len(storage.objects))
+	}
+	obj := storage.objects["bucket/env:/dev/state.init"]
+	if obj == nil {
+		t.Fatal("init marker was not written next to the state")
+	}
+
+	var marker initMarker
+	if err := json.Unmarshal(obj.body, &marker); err != nil {
+		t.Fatalf("invalid init marker: %s", err)
+	}
+	if marker.StateKey != "env:/dev/state" || marker.CreatedBy != "alice@host" || !marker.Created.Equal(first.Created) {
+		t.Fatalf("unexpected init marker: %#v", marker)
+	}
+
+	b := &Backend{keyName: "state"}
+	if ws := b.keyEnv(client.initMarkerPath()); ws != "" {
+		t.Fatalf("init marker must not be listed as workspace, got %q", ws)
+	}
+}
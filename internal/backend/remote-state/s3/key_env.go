@@ -0,0 +1,66 @@
+package s3
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// keyEnvPattern matches the references to environment variables in the key,
+// of the form ${env.NAME}.
+var keyEnvPattern = regexp.MustCompile(`\$\{env\.([^}]*)\}`)
+
+// envVarNamePattern matches the names of environment variables which can be
+// referenced in the key.
+var envVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// keyEnvAllowlist returns the set of environment variables which may be
+// referenced in the key, from key_env_allowlist.
+func keyEnvAllowlist(obj cty.Value) map[string]bool {
+	allowed := make(map[string]bool)
+	if val := obj.GetAttr("key_env_allowlist"); !val.IsNull() {
+		for _, v := range val.AsValueSlice() {
+			allowed[v.AsString()] = true
+		}
+	}
+	return allowed
+}
+
+// expandKeyEnv replaces the references to environment variables in key with
+// their values. Only the variables in allowed can be referenced, and they
+// must be set, so that a typo or a missing variable in CI can't silently
+// change the state path.
+//
+// A value must not contain "${", so that it can't add another reference or
+// the workspace placeholder, nor "..", so that it stays within the path it's
+// referenced in.
+func expandKeyEnv(key string, allowed map[string]bool) (string, error) {
+	var err error
+	expanded := keyEnvPattern.ReplaceAllStringFunc(key, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+		name := keyEnvPattern.FindStringSubmatch(ref)[1]
+		if !allowed[name] {
+			err = fmt.Errorf("the environment variable %q is not listed in \"key_env_allowlist\"", name)
+			return ref
+		}
+		value, ok := os.LookupEnv(name)
+		switch {
+		case !ok || value == "":
+			err = fmt.Errorf("the environment variable %q is not set", name)
+		case strings.Contains(value, "${"):
+			err = fmt.Errorf("the value of the environment variable %q must not contain \"${\"", name)
+		case strings.Contains(value, ".."):
+			err = fmt.Errorf("the value of the environment variable %q must not contain \"..\"", name)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
@@ -0,0 +1,178 @@
+package s3
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+)
+
+func TestExpandKeyEnv(t *testing.T) {
+	oldEnv := stashEnv()
+	defer popEnv(oldEnv)
+	os.Setenv("STACK_NAME", "network")
+	os.Setenv("REGION_NAME", "eu-west-1")
+	os.Setenv("EMPTY", "")
+	os.Setenv("NESTED", "${workspace}")
+	os.Setenv("TRAVERSAL", "../other")
+
+	allowed := map[string]bool{
+		"STACK_NAME":  true,
+		"REGION_NAME": true,
+		"EMPTY":       true,
+		"UNSET":       true,
+		"NESTED":      true,
+		"TRAVERSAL":   true,
+	}
+
+	testCases := map[string]struct {
+		key         string
+		expected    string
+		expectedErr string
+	}{
+		"no references": {
+			key:      "stacks/terraform.tfstate",
+			expected: "stacks/terraform.tfstate",
+		},
+		"references": {
+			key:      "stacks/${env.STACK_NAME}/${env.REGION_NAME}.tfstate",
+			expected: "stacks/network/eu-west-1.tfstate",
+		},
+		"workspace placeholder": {
+			key:      "stacks/${env.STACK_NAME}/${workspace}.tfstate",
+			expected: "stacks/network/${workspace}.tfstate",
+		},
+		"not allowed": {
+			key:         "stacks/${env.HOME}.tfstate",
+			expectedErr: `the environment variable "HOME" is not listed in "key_env_allowlist"`,
+		},
+		"unset": {
+			key:         "stacks/${env.UNSET}.tfstate",
+			expectedErr: `the environment variable "UNSET" is not set`,
+		},
+		"empty": {
+			key:         "stacks/${env.EMPTY}.tfstate",
+			expectedErr: `the environment variable "EMPTY" is not set`,
+		},
+		"nested reference": {
+			key:         "stacks/${env.NESTED}.tfstate",
+			expectedErr: `the value of the environment variable "NESTED" must not contain "${"`,
+		},
+		"path traversal": {
+			key:         "stacks/${env.TRAVERSAL}.tfstate",
+			expectedErr: `the value of the environment variable "TRAVERSAL" must not contain ".."`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			key, err := expandKeyEnv(tc.key, allowed)
+			if tc.expectedErr != "" {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Fatalf("expected error %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if key != tc.expected {
+				t.Fatalf("expected key %q, got %q", tc.expected, key)
+			}
+		})
+	}
+}
+
+func TestBackendConfig_keyEnv(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("stacks/${env.STACK_NAME}/terraform.tfstate\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		config      map[string]any
+		expectedKey string
+		expectedErr string
+	}{
+		"expanded": {
+			config: map[string]any{
+				"key":               "stacks/${env.STACK_NAME}/terraform.tfstate",
+				"key_env_allowlist": []any{"STACK_NAME"},
+			},
+			expectedKey: "stacks/network/terraform.tfstate",
+		},
+		"file reference expanded": {
+			config: map[string]any{
+				"key":               "file://" + keyFile,
+				"key_env_allowlist": []any{"STACK_NAME"},
+				"key_case":          "lower",
+			},
+			expectedKey: "stacks/network/terraform.tfstate",
+		},
+		"no allowlist": {
+			config: map[string]any{
+				"key": "stacks/${env.STACK_NAME}/terraform.tfstate",
+			},
+			expectedErr: `The "key" attribute value could not be expanded: the environment variable "STACK_NAME" is not listed in "key_env_allowlist".`,
+		},
+		"not allowed": {
+			config: map[string]any{
+				"key":               "stacks/${env.STACK_NAME}/terraform.tfstate",
+				"key_env_allowlist": []any{"OTHER"},
+			},
+			expectedErr: `The "key" attribute value could not be expanded: the environment variable "STACK_NAME" is not listed in "key_env_allowlist".`,
+		},
+		"invalid allowlist": {
+			config: map[string]any{
+				"key":               "stacks/terraform.tfstate",
+				"key_env_allowlist": []any{"STACK-NAME"},
+			},
+			expectedErr: `The "key_env_allowlist" attribute value "STACK-NAME" is not a valid environment variable name.`,
+		},
+		"expanded key checked": {
+			config: map[string]any{
+				"key":                "stacks/${env.STACK_NAME}",
+				"key_env_allowlist":  []any{"STACK_NAME"},
+				"require_key_suffix": ".tfstate",
+			},
+			expectedErr: `The "key" attribute value "stacks/network" must end with ".tfstate"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+			os.Setenv("STACK_NAME", "network")
+
+			config := map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"region":                      "us-west-2",
+				"skip_credentials_validation": true,
+			}
+			for k, v := range tc.config {
+				config[k] = v
+			}
+
+			b, diags := configureBackend(t, config)
+			if tc.expectedErr != "" {
+				if !diags.HasErrors() || !strings.Contains(diagnosticsString(diags), tc.expectedErr) {
+					t.Fatalf("expected error containing %q, got: %s", tc.expectedErr, diagnosticsString(diags))
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+			}
+			if b.keyName != tc.expectedKey {
+				t.Fatalf("expected key %q, got %q", tc.expectedKey, b.keyName)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package s3
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/private/protocol/rest"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeKey normalizes an object key to Unicode Normalization Form C and
+// applies the configured key_case normalization, so that the same key typed
+// with composed or decomposed characters refers to the same object.
+func normalizeKey(keyCase, key string) string {
+	return normalizeKeyCase(keyCase, norm.NFC.String(key))
+}
+
+// copySource returns the value of the x-amz-copy-source header for an object,
+// which must be percent-encoded. It's encoded like the SDK encodes the object
+// key in request paths, so that both refer to the same object on stores which
+// decode "+" as a space.
+func copySource(bucket, key string) string {
+	return rest.EscapePath(bucket+"/"+key, false)
+}
+
+// troublesomeKeyCharacters describes the characters of an object key which
+// S3-compatible stores are known to encode or decode inconsistently.
+func troublesomeKeyCharacters(key string) []string {
+	var found []string
+	if strings.IndexFunc(key, unicode.IsSpace) >= 0 {
+		found = append(found, "whitespace")
+	}
+	if strings.Contains(key, "+") {
+		found = append(found, `"+"`)
+	}
+	if strings.IndexFunc(key, func(r rune) bool { return r > unicode.MaxASCII }) >= 0 {
+		found = append(found, "non-ASCII characters")
+	}
+	return found
+}
+
+// validateKeyCharacters warns about the characters of a key which are
+// normalized, or which are known to cause trouble.
+func validateKeyCharacters(path cty.Path, name, key string) (diags tfdiags.Diagnostics) {
+	if found := troublesomeKeyCharacters(key); len(found) != 0 {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Warning,
+			"State key with problematic characters",
+			fmt.Sprintf(`The %q value %q contains %s. Some S3-compatible stores encode or decode these inconsistently, so that objects can't be found although they exist. Consider using only ASCII letters, digits, "-", "_", "." and "/".`, name, key, strings.Join(found, ", ")),
+			path,
+		))
+	}
+	if !norm.NFC.IsNormalString(key) {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Warning,
+			"State key will be normalized",
+			fmt.Sprintf(`The %q value %q will be stored in Unicode Normalization Form C as %q.`, name, key, norm.NFC.String(key)),
+			path,
+		))
+	}
+	return diags
+}
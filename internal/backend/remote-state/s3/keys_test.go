@@ -0,0 +1,160 @@
+package s3
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRemoteClient_keyEncoding(t *testing.T) {
+	testCases := map[string]struct {
+		key      string
+		expected string
+	}{
+		"plain": {
+			key:      "path/to/terraform.tfstate",
+			expected: "path/to/terraform.tfstate",
+		},
+		"space": {
+			key:      "path/with space/terraform.tfstate",
+			expected: "path/with space/terraform.tfstate",
+		},
+		"plus": {
+			key:      "path/c++/terraform.tfstate",
+			expected: "path/c++/terraform.tfstate",
+		},
+		"percent": {
+			key:      "path/100%25/terraform.tfstate",
+			expected: "path/100%25/terraform.tfstate",
+		},
+		"reserved characters": {
+			key:      "path/a?b#c&d=e/terraform.tfstate",
+			expected: "path/a?b#c&d=e/terraform.tfstate",
+		},
+		"composed unicode": {
+			key:      "path/grüße/terraform.tfstate",
+			expected: "path/grüße/terraform.tfstate",
+		},
+		"decomposed unicode": {
+			key:      "path/gru\u0308ße/terraform.tfstate",
+			expected: "path/grüße/terraform.tfstate",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			client := &RemoteClient{
+				s3Client:   mockS3Client(t, storage.ServeHTTP),
+				bucketName: "bucket",
+				path:       normalizeKey("", tc.key),
+				keepBackup: true,
+			}
+
+			for _, serial := range []string{"1", "2"} {
+				state := []byte(`{"version": 4, "serial": ` + serial + `, "lineage": "abc"}`)
+				if err := client.Put(state); err != nil {
+					t.Fatalf("unexpected error writing state: %s", err)
+				}
+				payload, err := client.Get()
+				if err != nil {
+					t.Fatalf("unexpected error reading state: %s", err)
+				}
+				if !bytes.Equal(payload.Data, state) {
+					t.Fatalf("expected state %q, got %q", state, payload.Data)
+				}
+			}
+
+			// The backup is copied from the same object the state is
+			// written to.
+			if storage.objects["bucket/"+tc.expected] == nil {
+				t.Fatalf("state was not written to %q", tc.expected)
+			}
+			backup := storage.objects["bucket/"+tc.expected+backupSuffix]
+			if backup == nil || !bytes.Contains(backup.body, []byte(`"serial": 1`)) {
+				t.Fatalf("state was not backed up to %q", tc.expected+backupSuffix)
+			}
+		})
+	}
+}
+
+func TestCopySource(t *testing.T) {
+	testCases := map[string]string{
+		"path/terraform.tfstate":      "bucket/path/terraform.tfstate",
+		"path/with space/c++.tfstate": "bucket/path/with%20space/c%2B%2B.tfstate",
+		"path/grüße.tfstate":          "bucket/path/gr%C3%BC%C3%9Fe.tfstate",
+		"path/a?b#c%d.tfstate":        "bucket/path/a%3Fb%23c%25d.tfstate",
+	}
+
+	for key, expected := range testCases {
+		if got := copySource("bucket", key); got != expected {
+			t.Errorf("expected copy source of %q to be %q, got %q", key, expected, got)
+		}
+	}
+}
+
+func TestBackendConfig_keyCharacters(t *testing.T) {
+	testCases := map[string]struct {
+		key string
+		// keyFile is referenced by the key instead, since strings in the
+		// configuration are always normalized already.
+		keyFile          string
+		expectedWarnings []string
+	}{
+		"plain": {
+			key: "path/terraform.tfstate",
+		},
+		"space": {
+			key:              "path/with space.tfstate",
+			expectedWarnings: []string{`contains whitespace.`},
+		},
+		"plus and unicode": {
+			key:              "path/c++/grüße.tfstate",
+			expectedWarnings: []string{`contains "+", non-ASCII characters.`},
+		},
+		"decomposed unicode in key file": {
+			keyFile: "path/gru\u0308ße.tfstate",
+			expectedWarnings: []string{
+				`contains non-ASCII characters.`,
+				`will be stored in Unicode Normalization Form C as "path/grüße.tfstate".`,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			key := tc.key
+			if tc.keyFile != "" {
+				filename := filepath.Join(t.TempDir(), "key")
+				if err := os.WriteFile(filename, []byte(tc.keyFile), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				key = fileReferencePrefix + filename
+			}
+
+			b := New()
+			_, diags := b.PrepareConfig(populateSchema(t, b.ConfigSchema(), cty.ObjectVal(map[string]cty.Value{
+				"bucket": cty.StringVal("test"),
+				"key":    cty.StringVal(key),
+				"region": cty.StringVal("us-west-2"),
+			})))
+			if diags.HasErrors() {
+				t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+			}
+			if len(diags) != len(tc.expectedWarnings) {
+				t.Fatalf("expected %d warnings, got: %s", len(tc.expectedWarnings), diagnosticsString(diags))
+			}
+			for i, expected := range tc.expectedWarnings {
+				if detail := diags[i].Description().Detail; !strings.Contains(detail, expected) {
+					t.Errorf("expected warning containing %q, got %q", expected, detail)
+				}
+			}
+		})
+	}
+}
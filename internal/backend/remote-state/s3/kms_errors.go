@@ -0,0 +1,71 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// isKMSKeyAccessError reports whether err is a failure to decrypt with a KMS
+// key, either returned by KMS itself or by S3 reading an SSE-KMS object, which
+// prefixes the KMS error codes with "KMS.".
+func isKMSKeyAccessError(err error) bool {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+
+	switch strings.TrimPrefix(awsErr.Code(), "KMS.") {
+	case kms.ErrCodeDisabledException, kms.ErrCodeInvalidStateException, kms.ErrCodeNotFoundException, "AccessDeniedException":
+		return true
+	case "AccessDenied":
+		// S3 reports a denied kms:Decrypt like any other missing permission,
+		// which is only told apart by the message.
+		return strings.Contains(awsErr.Message(), "kms:Decrypt")
+	}
+	return false
+}
+
+// kmsKeyAccessError explains a failed read of the state object which is
+// encrypted with a KMS key that can't be used, naming the key the object was
+// encrypted with if S3 reports it.
+func (c *RemoteClient) kmsKeyAccessError(err error) error {
+	input := &s3.HeadObjectInput{
+		Bucket: &c.bucketName,
+		Key:    &c.path,
+	}
+	head, headErr := c.s3Client.HeadObject(input)
+	if headErr != nil {
+		log.Printf("[WARN] Failed to read KMS key of state %q: %s", c.path, headErr)
+		head = &s3.HeadObjectOutput{}
+	}
+	return fmt.Errorf(errKMSKeyInaccessible, c.path, kmsKeyDescription(aws.StringValue(head.SSEKMSKeyId)), err)
+}
+
+// kmsKeyDescription returns the part of errKMSKeyInaccessible naming the key,
+// if it's known.
+func kmsKeyDescription(keyID string) string {
+	if keyID == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", keyID)
+}
+
+const errKMSKeyInaccessible = `state object %q is encrypted with a KMS key%s which the current configuration can't use to decrypt it.
+
+The key may be disabled, pending deletion or deleted, or the credentials may
+not be allowed to use it. Objects stay encrypted with the key they were
+written with: if the alias used for "kms_key_id" or
+"client_side_encryption_kms_key_id" was repointed to a new key, state written
+before then still needs the previous key. Re-enable the key or allow
+"kms:Decrypt" on it, then write the state again to encrypt it with the key
+currently configured.
+
+Error: %w
+`
@@ -0,0 +1,99 @@
+package s3
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+func TestRemoteClient_kmsKeyAccessError(t *testing.T) {
+	const keyID = "arn:aws:kms:us-west-2:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+	testCases := map[string]struct {
+		status      int
+		code        string
+		message     string
+		expectedErr string
+	}{
+		"disabled key": {
+			status:      http.StatusBadRequest,
+			code:        "KMS.DisabledException",
+			message:     "The key is disabled.",
+			expectedErr: `is encrypted with a KMS key (` + keyID + `) which the current configuration can't use`,
+		},
+		"denied decrypt": {
+			status:      http.StatusForbidden,
+			code:        "AccessDenied",
+			message:     "User is not authorized to perform: kms:Decrypt on resource: " + keyID,
+			expectedErr: `is encrypted with a KMS key (` + keyID + `) which the current configuration can't use`,
+		},
+		"denied read": {
+			status:      http.StatusForbidden,
+			code:        "AccessDenied",
+			message:     "Access Denied",
+			expectedErr: "AccessDenied: Access Denied",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					switch r.Method {
+					case http.MethodGet:
+						writeS3Error(w, tc.status, tc.code, tc.message)
+					case http.MethodHead:
+						w.Header().Set("X-Amz-Server-Side-Encryption", "aws:kms")
+						w.Header().Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", keyID)
+					}
+				}),
+				bucketName: "bucket",
+				path:       "state",
+			}
+
+			_, err := client.Get()
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.expectedErr, err)
+			}
+			if tc.code == "AccessDenied" && !strings.Contains(tc.message, "kms:") && strings.Contains(err.Error(), "KMS key") {
+				t.Fatalf("permission errors must not be reported as a KMS key error: %s", err)
+			}
+		})
+	}
+}
+
+func TestRemoteClient_kmsKeyAccessErrorClientSide(t *testing.T) {
+	storage := newMockS3Storage()
+	client := &RemoteClient{
+		s3Client:                     mockS3Client(t, storage.ServeHTTP),
+		kmsClient:                    mockKMSClient(t),
+		bucketName:                   "bucket",
+		path:                         "state",
+		clientSideEncryptionKMSKeyID: "alias/state",
+	}
+	if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The alias now points to a disabled key.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"__type":  kms.ErrCodeDisabledException,
+			"message": "The key is disabled.",
+		})
+	}))
+	defer ts.Close()
+	client.kmsClient = kms.New(mockSession(ts.URL))
+
+	_, err := client.Get()
+	if err == nil || !strings.Contains(err.Error(), "is encrypted with a KMS key which the current configuration can't use") {
+		t.Fatalf("expected a KMS key error, got: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+// errCodeObjectLockConfigurationNotFound is returned by S3 for buckets
+// without object lock. The SDK doesn't define a constant for it.
+const errCodeObjectLockConfigurationNotFound = "ObjectLockConfigurationNotFoundError"
+
+// SetLegalHold places or removes an S3 legal hold on the current version of
+// the state object of the given workspace. While the hold is on, that version
+// can't be deleted or overwritten in place; new states are still written as
+// new versions. The bucket must have object lock enabled.
+//
+// The state is locked while the hold is changed, so that the hold applies to
+// the version which is current when the call is made.
+func (b *Backend) SetLegalHold(ctx context.Context, workspace string, on bool) error {
+	if err := b.requireBucket("Setting a legal hold"); err != nil {
+		return err
+	}
+
+	client, err := b.remoteClient(workspace)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.s3Client.GetObjectLockConfigurationWithContext(ctx, &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(client.bucketName),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == errCodeObjectLockConfigurationNotFound {
+			return fmt.Errorf(errObjectLockNotEnabled, client.bucketName)
+		}
+		return fmt.Errorf("failed to read object lock configuration: %w", err)
+	}
+
+	lockInfo := statemgr.NewLockInfo()
+	lockInfo.Operation = "legal-hold"
+	lockID, err := client.Lock(lockInfo)
+	if err != nil {
+		return fmt.Errorf("failed to lock state: %w", err)
+	}
+	defer func() {
+		if err := client.Unlock(lockID); err != nil {
+			log.Printf("[ERROR] Failed to unlock state after changing legal hold: %s", err)
+		}
+	}()
+
+	key, err := client.resolveStateKey()
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return fmt.Errorf(errStatePointerNotFound, client.path, client.bucketName)
+	}
+
+	head := &s3.HeadObjectInput{
+		Bucket: aws.String(client.bucketName),
+		Key:    aws.String(key),
+	}
+	if client.serverSideEncryption && client.customerEncryptionKey != nil {
+		head.SetSSECustomerKey(string(client.customerEncryptionKey))
+		head.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		head.SetSSECustomerKeyMD5(client.getSSECustomerKeyMD5())
+	}
+	out, err := client.s3Client.HeadObjectWithContext(ctx, head)
+	if err != nil {
+		return fmt.Errorf("failed to read state object %q: %w", key, err)
+	}
+
+	status := s3.ObjectLockLegalHoldStatusOff
+	if on {
+		status = s3.ObjectLockLegalHoldStatusOn
+	}
+	_, err = client.s3Client.PutObjectLegalHoldWithContext(ctx, &s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(client.bucketName),
+		Key:       aws.String(key),
+		VersionId: out.VersionId,
+		LegalHold: &s3.ObjectLockLegalHold{
+			Status: aws.String(status),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set legal hold on state object %q: %w", key, err)
+	}
+
+	log.Printf("[INFO] Set legal hold %s on version %q of state %q", status, aws.StringValue(out.VersionId), key)
+	return nil
+}
+
+const errObjectLockNotEnabled = `object lock is not enabled on the S3 bucket %q.
+
+Legal holds can only be placed on objects in buckets with object lock enabled.
+Object lock can be enabled on an existing bucket with versioning enabled, see
+https://docs.aws.amazon.com/AmazonS3/latest/userguide/object-lock-configure.html`
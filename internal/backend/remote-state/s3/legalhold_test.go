@@ -0,0 +1,103 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBackend_SetLegalHold(t *testing.T) {
+	testCases := map[string]struct {
+		on             bool
+		objectLock     bool
+		keyIsPointer   bool
+		expectedStatus string
+		expectedErr    string
+	}{
+		"on": {
+			on:             true,
+			objectLock:     true,
+			expectedStatus: "ON",
+		},
+		"off": {
+			objectLock:     true,
+			expectedStatus: "OFF",
+		},
+		"through pointer": {
+			on:             true,
+			objectLock:     true,
+			keyIsPointer:   true,
+			expectedStatus: "ON",
+		},
+		"object lock not enabled": {
+			on:          true,
+			expectedErr: `object lock is not enabled on the S3 bucket "bucket"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			// With key_is_pointer, the hold is placed on the state the
+			// pointer refers to.
+			statePath := "/bucket/env:/prod/state"
+			if tc.keyIsPointer {
+				statePath = "/bucket/versions/1"
+			}
+
+			var legalHold, versionID string
+			b := &Backend{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					switch {
+					case r.Method == http.MethodGet && r.URL.Path == "/bucket" && r.URL.Query().Has("object-lock"):
+						if !tc.objectLock {
+							writeS3Error(w, http.StatusNotFound, "ObjectLockConfigurationNotFoundError", "Object Lock configuration does not exist for this bucket")
+							return
+						}
+						w.Header().Set("Content-Type", "application/xml")
+						fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled></ObjectLockConfiguration>`)
+					case r.Method == http.MethodGet && r.URL.Path == "/bucket/env:/prod/state" && tc.keyIsPointer:
+						fmt.Fprint(w, "versions/1\n")
+					case r.Method == http.MethodHead && r.URL.Path == statePath:
+						w.Header().Set("X-Amz-Version-Id", "v2")
+					case r.Method == http.MethodPut && r.URL.Path == statePath && r.URL.Query().Has("legal-hold"):
+						body, _ := io.ReadAll(r.Body)
+						legalHold = string(body)
+						versionID = r.URL.Query().Get("versionId")
+					default:
+						t.Errorf("unexpected request %s %s", r.Method, r.URL)
+						w.WriteHeader(http.StatusBadRequest)
+					}
+				}),
+				bucketName:         "bucket",
+				keyName:            "state",
+				workspaceKeyPrefix: "env:",
+				keyIsPointer:       tc.keyIsPointer,
+			}
+
+			err := b.SetLegalHold(context.Background(), "prod", tc.on)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				if legalHold != "" {
+					t.Fatal("legal hold must not be set without object lock")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if versionID != "v2" {
+				t.Fatalf("expected legal hold on version %q, got %q", "v2", versionID)
+			}
+			if expected := fmt.Sprintf("<Status>%s</Status>", tc.expectedStatus); !strings.Contains(legalHold, expected) {
+				t.Fatalf("expected legal hold %s, got %s", expected, legalHold)
+			}
+		})
+	}
+}
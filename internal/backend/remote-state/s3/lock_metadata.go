@@ -0,0 +1,110 @@
+package s3
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+	"github.com/opentofu/opentofu/version"
+)
+
+// lockMetadataAttribute is the attribute of the DynamoDB lock item holding the
+// values of the environment variables listed in lock_metadata_env, such as
+// the URL of the CI build holding the lock.
+//
+// The values are kept apart from the Info attribute, so that the lock info
+// keeps the schema every client expects.
+const lockMetadataAttribute = "LockMetadata"
+
+// Attributes of the DynamoDB lock item recording the full OpenTofu version,
+// including any prerelease, and the run of the OpenTofu process holding the
+// lock, to tell apart the locks of a fleet running mixed versions. Like
+// lockMetadataAttribute, they are kept apart from the Info attribute, so that
+// older clients ignore them.
+const (
+	lockVersionAttribute = "TofuVersion"
+	lockRunIDAttribute   = "RunID"
+)
+
+var (
+	lockRunIDOnce sync.Once
+	lockRunIDVal  string
+)
+
+// lockRunID returns the identifier of the run of this OpenTofu process, which
+// is the same for all the locks it takes, or an empty string if it can't be
+// generated.
+func lockRunID() string {
+	lockRunIDOnce.Do(func() {
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			log.Printf("[WARN] Failed to generate the run ID recorded with locks: %s", err)
+			return
+		}
+		lockRunIDVal = id
+	})
+	return lockRunIDVal
+}
+
+// lockItem returns the DynamoDB item of a lock with the given info.
+func (c *RemoteClient) lockItem(info *statemgr.LockInfo) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		"LockID":             {S: aws.String(c.lockPath())},
+		"Info":               {S: aws.String(string(info.Marshal()))},
+		lockVersionAttribute: {S: aws.String(version.String())},
+	}
+	if runID := lockRunID(); runID != "" {
+		item[lockRunIDAttribute] = &dynamodb.AttributeValue{S: aws.String(runID)}
+	}
+	if metadata := lockMetadata(c.lockMetadataEnv); metadata != nil {
+		item[lockMetadataAttribute] = metadata
+	}
+	return item
+}
+
+// lockMetadata returns the values of the named environment variables as a
+// DynamoDB map, or nil if none of them are set.
+func lockMetadata(names []string) *dynamodb.AttributeValue {
+	values := make(map[string]*dynamodb.AttributeValue)
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			values[name] = &dynamodb.AttributeValue{S: aws.String(v)}
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return &dynamodb.AttributeValue{M: values}
+}
+
+// withLockMetadata returns the Info field of a lock held by another client,
+// extended with the lock metadata of its item so that it's shown along with
+// the rest of the lock info.
+func withLockMetadata(info string, metadata *dynamodb.AttributeValue) string {
+	if metadata == nil || len(metadata.M) == 0 {
+		return info
+	}
+
+	names := make([]string, 0, len(metadata.M))
+	for name := range metadata.M {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, aws.StringValue(metadata.M[name].S)))
+	}
+
+	if info == "" {
+		return strings.Join(pairs, ", ")
+	}
+	return info + " (" + strings.Join(pairs, ", ") + ")"
+}
@@ -0,0 +1,126 @@
+package s3
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+	"github.com/opentofu/opentofu/version"
+)
+
+func TestRemoteClient_lockMetadata(t *testing.T) {
+	oldEnv := stashEnv()
+	defer popEnv(oldEnv)
+	os.Setenv("CI_BUILD_URL", "https://ci.example.com/builds/42")
+	os.Setenv("CI_COMMIT_SHA", "0123456789abcdef")
+
+	// The items stored in the mock table, by lock ID.
+	items := make(map[string]map[string]any)
+	client := &RemoteClient{
+		bucketName: "bucket",
+		path:       "state",
+		ddbTable:   "table",
+		dynClient: mockDynamoDBClient(t, func(w http.ResponseWriter, r *http.Request) {
+			var input struct {
+				Item map[string]any
+			}
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+				t.Errorf("decoding request: %s", err)
+			}
+
+			switch dynamoDBOperation(r) {
+			case "PutItem":
+				if _, ok := items["bucket/state"]; ok {
+					writeDynamoDBError(w, dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed")
+					return
+				}
+				items["bucket/state"] = input.Item
+				writeDynamoDBResponse(w, map[string]any{})
+			case "GetItem":
+				writeDynamoDBResponse(w, map[string]any{"Item": items["bucket/state"]})
+			}
+		}),
+		lockMetadataEnv: []string{"CI_BUILD_URL", "CI_COMMIT_SHA", "CI_UNSET"},
+	}
+
+	info := statemgr.NewLockInfo()
+	info.Operation = "apply"
+	info.Info = "pipeline"
+	if _, err := client.Lock(info); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	item := items["bucket/state"]
+	metadata, _ := json.Marshal(item[lockMetadataAttribute])
+	if expected := `{"M":{"CI_BUILD_URL":{"S":"https://ci.example.com/builds/42"},"CI_COMMIT_SHA":{"S":"0123456789abcdef"}}}`; string(metadata) != expected {
+		t.Errorf("expected lock metadata %s, got %s", expected, metadata)
+	}
+
+	// The lock info itself must keep its schema, so that it can be read by
+	// clients which don't know about the metadata.
+	var stored statemgr.LockInfo
+	if err := json.Unmarshal([]byte(item["Info"].(map[string]any)["S"].(string)), &stored); err != nil {
+		t.Fatalf("decoding lock info: %s", err)
+	}
+	if stored.Info != "pipeline" {
+		t.Errorf("expected stored lock info %q, got %q", "pipeline", stored.Info)
+	}
+
+	_, err := client.Lock(statemgr.NewLockInfo())
+	var lockErr *statemgr.LockError
+	if !errors.As(err, &lockErr) || lockErr.Info == nil {
+		t.Fatalf("expected a lock error with the lock info, got: %v", err)
+	}
+	if expected := "pipeline (CI_BUILD_URL=https://ci.example.com/builds/42, CI_COMMIT_SHA=0123456789abcdef)"; lockErr.Info.Info != expected {
+		t.Errorf("expected lock info %q, got %q", expected, lockErr.Info.Info)
+	}
+}
+
+func TestRemoteClient_lockVersionAndRunID(t *testing.T) {
+	var items []map[string]any
+	client := &RemoteClient{
+		bucketName: "bucket",
+		path:       "state",
+		ddbTable:   "table",
+		dynClient: mockDynamoDBClient(t, func(w http.ResponseWriter, r *http.Request) {
+			var input struct {
+				Item map[string]any
+			}
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+				t.Errorf("decoding request: %s", err)
+			}
+			if dynamoDBOperation(r) == "PutItem" {
+				items = append(items, input.Item)
+			}
+			writeDynamoDBResponse(w, map[string]any{})
+		}),
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Lock(statemgr.NewLockInfo()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if len(items) != 2 {
+		t.Fatalf("expected 2 lock items, got %d", len(items))
+	}
+	for _, item := range items {
+		if got := item[lockVersionAttribute]; !reflect.DeepEqual(got, map[string]any{"S": version.String()}) {
+			t.Errorf("expected lock version %q, got %v", version.String(), got)
+		}
+	}
+	// All the locks of a run share its ID.
+	runID, ok := items[0][lockRunIDAttribute].(map[string]any)
+	if !ok || runID["S"] == "" {
+		t.Fatalf("expected a lock run ID, got %v", items[0][lockRunIDAttribute])
+	}
+	if !reflect.DeepEqual(items[1][lockRunIDAttribute], runID) {
+		t.Errorf("expected lock run ID %v, got %v", runID, items[1][lockRunIDAttribute])
+	}
+}
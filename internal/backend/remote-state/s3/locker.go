@@ -0,0 +1,43 @@
+package s3
+
+import (
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+// StateLocker locks the states of a backend with a lock service of the
+// embedding program, such as etcd or Redis, instead of the DynamoDB table.
+// It's set with WithStateLocker.
+//
+// Each state is locked under its lock path, which is the bucket name and the
+// key of the state joined with "/", like the LockID of the DynamoDB lock item.
+// A StateLocker is shared by all workspaces of the backend and must be safe
+// for concurrent use.
+type StateLocker interface {
+	// Lock takes the lock for the state at path and returns its ID.
+	//
+	// info.ID is the ID to lock with if it's set; otherwise Lock generates
+	// one. info must be kept with the lock, so that it can be reported to
+	// whoever else tries to take it. If the lock is already held, Lock must
+	// not wait for it but return a *statemgr.LockError with the info of the
+	// lock holder, so that OpenTofu can report it and retry according to
+	// -lock-timeout.
+	Lock(path string, info *statemgr.LockInfo) (string, error)
+
+	// Unlock releases the lock for the state at path if it's held with the
+	// given ID, and returns a *statemgr.LockError with the info of the lock
+	// holder if it's held with another ID.
+	//
+	// "tofu force-unlock" calls Unlock with the ID the user passes, from a
+	// process which didn't take the lock, so Unlock must not rely on state
+	// kept by the process which called Lock.
+	Unlock(path string, id string) error
+}
+
+// WithStateLocker makes the backend lock its states with the given
+// StateLocker instead of the DynamoDB table. The DynamoDB table is still used
+// for the state digests if dynamodb_table is set.
+func WithStateLocker(locker StateLocker) Option {
+	return func(b *Backend) {
+		b.locker = locker
+	}
+}
@@ -0,0 +1,112 @@
+package s3
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/opentofu/opentofu/internal/states/remote"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+// fakeLocker is a StateLocker keeping its locks in memory.
+type fakeLocker struct {
+	mu    sync.Mutex
+	locks map[string]*statemgr.LockInfo
+}
+
+func (l *fakeLocker) Lock(path string, info *statemgr.LockInfo) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if held, ok := l.locks[path]; ok {
+		return "", &statemgr.LockError{
+			Err:  fmt.Errorf("state %q is locked", path),
+			Info: held,
+		}
+	}
+	if info.ID == "" {
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			return "", err
+		}
+		info.ID = id
+	}
+	l.locks[path] = info
+	return info.ID, nil
+}
+
+func (l *fakeLocker) Unlock(path string, id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	held, ok := l.locks[path]
+	if !ok {
+		return nil
+	}
+	if held.ID != id {
+		return &statemgr.LockError{
+			Err:  fmt.Errorf("lock id %q does not match existing lock", id),
+			Info: held,
+		}
+	}
+	delete(l.locks, path)
+	return nil
+}
+
+func TestBackend_WithStateLocker(t *testing.T) {
+	locker := &fakeLocker{locks: make(map[string]*statemgr.LockInfo)}
+	b := New(WithStateLocker(locker)).(*Backend)
+	b.s3Client = mockS3Client(t, newMockS3Storage().ServeHTTP)
+	b.bucketName = "bucket"
+	b.keyName = "state"
+
+	a, err := b.remoteClient("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c, err := b.remoteClient("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// No DynamoDB table is configured, so the states can only be locked by
+	// the locker.
+	remote.TestRemoteLocks(t, a, c)
+
+	info := statemgr.NewLockInfo()
+	info.Operation = "test"
+	id, err := a.Lock(info)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if held := locker.locks["bucket/state"]; held == nil || held.Path != "bucket/state" {
+		t.Fatalf("expected the lock to be held under the lock path, got %v", locker.locks)
+	}
+
+	// Force-unlocking releases the lock from another client.
+	if err := c.Unlock(id); err != nil {
+		t.Fatalf("unexpected error force-unlocking: %s", err)
+	}
+	if len(locker.locks) != 0 {
+		t.Fatalf("expected the lock to be released, got %v", locker.locks)
+	}
+}
+
+func TestBackend_WithStateLocker_requireLocking(t *testing.T) {
+	config := cty.ObjectVal(map[string]cty.Value{
+		"bucket":          cty.StringVal("test"),
+		"key":             cty.StringVal("test"),
+		"region":          cty.StringVal("us-west-2"),
+		"require_locking": cty.True,
+	})
+
+	// The locker is a locking mechanism, so no DynamoDB table is required.
+	b := New(WithStateLocker(&fakeLocker{locks: make(map[string]*statemgr.LockInfo)}))
+	if _, diags := b.PrepareConfig(populateSchema(t, b.ConfigSchema(), config)); diags.HasErrors() {
+		t.Fatalf("unexpected error: %s", diags.Err())
+	}
+}
@@ -0,0 +1,168 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/states/remote"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// configureLocalMirror makes the backend use the state in a local directory
+// laid out like the S3 bucket, such as one downloaded with "aws s3 sync", for
+// local_mirror_path.
+func (b *Backend) configureLocalMirror(dir string, writable bool) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+
+	dir, err := homedir.Expand(dir)
+	if err == nil {
+		var info fs.FileInfo
+		if info, err = os.Stat(dir); err == nil && !info.IsDir() {
+			err = errors.New("not a directory")
+		}
+	}
+	if err != nil {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid local_mirror_path value",
+			fmt.Sprintf(`The "local_mirror_path" directory %q can't be used: %s.`, dir, err),
+			cty.Path{cty.GetAttrStep{Name: "local_mirror_path"}},
+		))
+		return diags
+	}
+
+	b.localMirrorPath = dir
+	b.localMirrorWrite = writable
+
+	detail := fmt.Sprintf(`The state is read from the local directory %q instead of the S3 bucket %q, and it is not locked.`, dir, b.bucketName)
+	if writable {
+		detail += ` Changes to the state are written to the local directory only.`
+	} else {
+		detail += ` The state can't be changed.`
+	}
+	diags = diags.Append(tfdiags.Sourceless(tfdiags.Warning, "Using a local state mirror", detail))
+	return diags
+}
+
+// mirrorClient returns a client for the state of the given workspace in the
+// local mirror.
+func (b *Backend) mirrorClient(name string) *mirrorClient {
+	return &mirrorClient{
+		path:     filepath.Join(b.localMirrorPath, filepath.FromSlash(b.path(name))),
+		writable: b.localMirrorWrite,
+	}
+}
+
+// requireBucket returns an error if the backend uses a local mirror, for the
+// operations which can only be done on the S3 bucket.
+func (b *Backend) requireBucket(operation string) error {
+	if b.localMirrorPath == "" {
+		return nil
+	}
+	return fmt.Errorf(errLocalMirrorUnsupported, operation)
+}
+
+// mirrorWorkspaces lists the workspaces whose state is found in the local
+// mirror, like Workspaces lists the bucket.
+func (b *Backend) mirrorWorkspaces() ([]string, error) {
+	wss := []string{backend.DefaultStateName}
+	err := filepath.WalkDir(b.localMirrorPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(b.localMirrorPath, path)
+		if err != nil {
+			return err
+		}
+		if ws := b.keyEnv(filepath.ToSlash(rel)); ws != "" {
+			wss = append(wss, ws)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the local state mirror: %w", err)
+	}
+
+	sort.Strings(wss[1:])
+	return wss, nil
+}
+
+// mirrorClient is a remote.Client for a state file in a local mirror, for
+// local_mirror_path. It can't lock the state, so remote.State doesn't lock it
+// either.
+type mirrorClient struct {
+	path     string
+	writable bool
+}
+
+var _ remote.Client = (*mirrorClient)(nil)
+
+func (c *mirrorClient) Get() (*remote.Payload, error) {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state from the local mirror: %w", err)
+	}
+	return statePayload(data), nil
+}
+
+func (c *mirrorClient) Put(data []byte) error {
+	if !c.writable {
+		return fmt.Errorf(errLocalMirrorReadOnly, c.path)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("failed to write state to the local mirror: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state to the local mirror: %w", err)
+	}
+	return nil
+}
+
+func (c *mirrorClient) Delete() error {
+	if !c.writable {
+		return fmt.Errorf(errLocalMirrorReadOnly, c.path)
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete state from the local mirror: %w", err)
+	}
+	return nil
+}
+
+// copyTo copies the state file to w, for CopyStateTo.
+func (c *mirrorClient) copyTo(w io.Writer) (int64, error) {
+	f, err := os.Open(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("state %q does not exist in the local mirror", c.path)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read state from the local mirror: %w", err)
+	}
+	defer f.Close()
+
+	n, err := io.Copy(w, f)
+	if err != nil {
+		return n, fmt.Errorf("failed to copy state %q: %w", c.path, err)
+	}
+	return n, nil
+}
+
+const errLocalMirrorUnsupported = `%s is not supported with "local_mirror_path".
+
+The local mirror only holds copies of the state objects. Run the operation
+against the S3 bucket rather than the local mirror.`
+
+const errLocalMirrorReadOnly = `The state %q is read from a local mirror, which is read-only.
+
+Run the operation against the S3 bucket rather than "local_mirror_path", or set
+"local_mirror_write" to change the local copy only.`
@@ -0,0 +1,206 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/states"
+	"github.com/opentofu/opentofu/internal/states/remote"
+	"github.com/opentofu/opentofu/internal/states/statefile"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+)
+
+func TestBackend_localMirror(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	dir := t.TempDir()
+	writeMirrorState(t, filepath.Join(dir, "network", "terraform.tfstate"), "default-lineage")
+	writeMirrorState(t, filepath.Join(dir, "env:", "dev", "network", "terraform.tfstate"), "dev-lineage")
+	writeMirrorState(t, filepath.Join(dir, "env:", "prod", "other", "terraform.tfstate"), "other-lineage")
+
+	// No credentials and no endpoint are needed, since S3 is never used.
+	b, diags := configureBackend(t, map[string]any{
+		"bucket":            "bucket",
+		"key":               "network/terraform.tfstate",
+		"region":            "us-west-2",
+		"local_mirror_path": dir,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diagnosticsString(diags))
+	}
+	if len(diags) != 1 || diags[0].Severity() != tfdiags.Warning || diags[0].Description().Summary != "Using a local state mirror" {
+		t.Fatalf("expected a local state mirror warning, got: %s", diagnosticsString(diags))
+	}
+	if b.s3Client != nil {
+		t.Fatal("expected no S3 client to be created")
+	}
+
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{"default", "dev"}; !reflect.DeepEqual(workspaces, expected) {
+		t.Fatalf("expected workspaces %v, got %v", expected, workspaces)
+	}
+
+	for workspace, lineage := range map[string]string{"default": "default-lineage", "dev": "dev-lineage"} {
+		stateMgr, err := b.StateMgr(workspace)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := stateMgr.RefreshState(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got := stateMgr.(*remote.State).StateSnapshotMeta().Lineage; got != lineage {
+			t.Fatalf("expected the state of workspace %q to have lineage %q, got %q", workspace, lineage, got)
+		}
+	}
+
+	stateMgr, err := b.StateMgr("dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := stateMgr.WriteState(states.NewState()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := stateMgr.PersistState(nil); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Fatalf("expected the mirror to be read-only, got %v", err)
+	}
+	if err := b.DeleteWorkspace("dev", true); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Fatalf("expected the mirror to be read-only, got %v", err)
+	}
+}
+
+func TestBackend_localMirrorWrite(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	dir := t.TempDir()
+	b, diags := configureBackend(t, map[string]any{
+		"bucket":             "bucket",
+		"key":                "terraform.tfstate",
+		"region":             "us-west-2",
+		"local_mirror_path":  dir,
+		"local_mirror_write": true,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diagnosticsString(diags))
+	}
+
+	stateMgr, err := b.StateMgr("dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := stateMgr.WriteState(states.NewState()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := stateMgr.PersistState(nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	path := filepath.Join(dir, "env:", "dev", "terraform.tfstate")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the state to be written to the mirror: %s", err)
+	}
+
+	if err := b.DeleteWorkspace("dev", true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the state to be deleted from the mirror, got %v", err)
+	}
+}
+
+func TestBackend_localMirrorHelpers(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	dir := t.TempDir()
+	defaultPath := filepath.Join(dir, "terraform.tfstate")
+	devPath := filepath.Join(dir, "env:", "dev", "terraform.tfstate")
+	writeMirrorState(t, defaultPath, "default-lineage")
+	writeMirrorState(t, devPath, "dev-lineage")
+
+	b, diags := configureBackend(t, map[string]any{
+		"bucket":             "bucket",
+		"key":                "terraform.tfstate",
+		"region":             "us-west-2",
+		"local_mirror_path":  dir,
+		"local_mirror_write": true,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected errors: %s", diagnosticsString(diags))
+	}
+	ctx := context.Background()
+
+	// The helpers which only read or delete state use the mirror.
+	cmp, err := b.CompareWorkspaces(ctx, "dev", "default")
+	if err != nil {
+		t.Fatalf("unexpected error comparing workspaces: %s", err)
+	}
+	if cmp.A.Lineage != "dev-lineage" || cmp.B.Lineage != "default-lineage" || cmp.SameLineage {
+		t.Fatalf("unexpected comparison %+v", cmp)
+	}
+
+	var buf bytes.Buffer
+	if _, err := b.CopyStateTo(ctx, &buf); err != nil {
+		t.Fatalf("unexpected error copying state: %s", err)
+	}
+	if expected, _ := os.ReadFile(defaultPath); !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("expected the state of the mirror to be copied, got %s", buf.Bytes())
+	}
+
+	if got := b.ResolvedConfig()["local_mirror_path"]; got != dir {
+		t.Fatalf("expected the resolved configuration to report the mirror, got %v", got)
+	}
+
+	if diags := b.DeleteWorkspaces(ctx, []string{"dev"}, 1); diags.HasErrors() {
+		t.Fatalf("unexpected error deleting workspaces: %s", diagnosticsString(diags))
+	}
+	if _, err := os.Stat(devPath); !os.IsNotExist(err) {
+		t.Fatalf("expected the state to be deleted from the mirror, got %v", err)
+	}
+
+	// The others need the bucket.
+	for name, fn := range map[string]func() error{
+		"PruneStateVersions": func() error {
+			_, err := b.PruneStateVersions(ctx, "default", 1)
+			return err
+		},
+		"SetLegalHold": func() error {
+			return b.SetLegalHold(ctx, "default", true)
+		},
+		"RecoverFromBackup": func() error {
+			return b.RecoverFromBackup(ctx, "default")
+		},
+		"RebuildWorkspaceIndex": b.RebuildWorkspaceIndex,
+		"VerifyReadWrite": func() error {
+			return b.VerifyReadWrite(ctx).Err()
+		},
+	} {
+		if err := fn(); err == nil || !strings.Contains(err.Error(), `not supported with "local_mirror_path"`) {
+			t.Errorf("expected %s to be unsupported with a local mirror, got %v", name, err)
+		}
+	}
+}
+
+func writeMirrorState(t *testing.T, path, lineage string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := statefile.Write(&statefile.File{State: states.NewState(), Lineage: lineage, Serial: 1}, f); err != nil {
+		t.Fatal(err)
+	}
+}
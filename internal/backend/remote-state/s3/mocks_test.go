@@ -1,15 +1,28 @@
 package s3
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/s3"
 	servicemocks "github.com/hashicorp/aws-sdk-go-base"
 )
 
@@ -127,3 +140,210 @@ func ec2metadata_instanceIdentityEndpoint(region string) *servicemocks.MetadataR
 }`, region),
 	}
 }
+
+// mockSession returns a session with static credentials and retries disabled
+// that sends all requests to the given endpoint.
+func mockSession(endpoint string) *session.Session {
+	return session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials(servicemocks.MockStaticAccessKey, servicemocks.MockStaticSecretKey, ""),
+		Endpoint:    aws.String(endpoint),
+		Region:      aws.String("us-west-2"),
+		MaxRetries:  aws.Int(0),
+	}))
+}
+
+// mockS3Client returns an S3 client whose requests are served by handler.
+// The server uses TLS, since the SDK refuses to send SSE-C keys over HTTP.
+func mockS3Client(t testing.TB, handler http.HandlerFunc) *s3.S3 {
+	ts := httptest.NewTLSServer(handler)
+	t.Cleanup(ts.Close)
+
+	return s3.New(mockSession(ts.URL), &aws.Config{
+		HTTPClient:       ts.Client(),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+}
+
+// mockDynamoDBClient returns a DynamoDB client whose requests are served by
+// handler. The operation name can be read from the X-Amz-Target header.
+func mockDynamoDBClient(t *testing.T, handler http.HandlerFunc) *dynamodb.DynamoDB {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	return dynamodb.New(mockSession(ts.URL))
+}
+
+// dynamoDBOperation returns the name of the DynamoDB operation of a request.
+func dynamoDBOperation(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+}
+
+func writeDynamoDBResponse(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeDynamoDBError(w http.ResponseWriter, code, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"__type":  "com.amazonaws.dynamodb.v20120810#" + code,
+		"message": message,
+	})
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>%s</Code><Message>%s</Message><RequestId>mock-request-id</RequestId></Error>`, code, message)
+}
+
+// sseCustomerKeyMD5Header is the canonical name of the header holding the
+// digest of a customer-provided encryption key.
+const sseCustomerKeyMD5Header = "X-Amz-Server-Side-Encryption-Customer-Key-Md5"
+
+// mockS3Object is an object held by a mockS3Storage.
+type mockS3Object struct {
+	body   []byte
+	header http.Header
+	// tags is the URL-encoded tag set of the object.
+	tags string
+}
+
+// mockS3Storage is a minimal in-memory implementation of the S3 object API,
+// sufficient to round-trip state through a RemoteClient. Objects are keyed by
+// "bucket/key".
+type mockS3Storage struct {
+	mu      sync.Mutex
+	objects map[string]*mockS3Object
+}
+
+func newMockS3Storage() *mockS3Storage {
+	return &mockS3Storage{
+		objects: make(map[string]*mockS3Object),
+	}
+}
+
+func (m *mockS3Storage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+
+	switch r.Method {
+	case http.MethodPut:
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			source, _ = url.PathUnescape(source)
+			obj, ok := m.objects[strings.TrimPrefix(source, "/")]
+			if !ok {
+				writeS3Error(w, http.StatusNotFound, s3.ErrCodeNoSuchKey, "The specified key does not exist.")
+				return
+			}
+			m.objects[name] = &mockS3Object{body: obj.body, header: obj.header.Clone(), tags: obj.tags}
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<CopyObjectResult><ETag>%s</ETag></CopyObjectResult>`, obj.header.Get("ETag"))
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeS3Error(w, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		header := make(http.Header)
+		for k, v := range r.Header {
+			if strings.HasPrefix(k, "X-Amz-Meta-") || k == "Content-Type" || k == "Content-Encoding" || k == sseCustomerKeyMD5Header {
+				header[k] = v
+			}
+		}
+		sum := md5.Sum(body)
+		header.Set("ETag", fmt.Sprintf(`"%x"`, sum))
+		m.objects[name] = &mockS3Object{body: body, header: header, tags: r.Header.Get("X-Amz-Tagging")}
+		w.Header().Set("ETag", header.Get("ETag"))
+	case http.MethodGet, http.MethodHead:
+		// Every bucket exists.
+		if r.Method == http.MethodHead && !strings.Contains(name, "/") {
+			return
+		}
+		obj, ok := m.objects[name]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, s3.ErrCodeNoSuchKey, "The specified key does not exist.")
+			return
+		}
+		if r.URL.Query().Has("tagging") {
+			tags, _ := url.ParseQuery(obj.tags)
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<Tagging><TagSet>`)
+			for k := range tags {
+				fmt.Fprintf(w, `<Tag><Key>%s</Key><Value>%s</Value></Tag>`, k, tags.Get(k))
+			}
+			fmt.Fprint(w, `</TagSet></Tagging>`)
+			return
+		}
+		// Like S3, objects encrypted with a customer-provided key can only
+		// be read, even just their metadata, with that key.
+		if v := obj.header.Get(sseCustomerKeyMD5Header); v != "" && r.Header.Get(sseCustomerKeyMD5Header) != v {
+			writeS3Error(w, http.StatusBadRequest, "InvalidRequest", "The object was stored using a form of Server Side Encryption.")
+			return
+		}
+		if etag := r.Header.Get("If-None-Match"); etag != "" && etag == obj.header.Get("ETag") {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		for k, v := range obj.header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(obj.body)))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(obj.body)
+		}
+	case http.MethodDelete:
+		delete(m.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented", r.Method)
+	}
+}
+
+// mockKMSClient returns a KMS client backed by a fake key service. Data keys
+// are "wrapped" by prefixing them with the key ID, which is enough to verify
+// that the right key is used to unwrap them again.
+func mockKMSClient(t *testing.T) *kms.KMS {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "TrentService.") {
+		case "GenerateDataKey":
+			keyID, _ := input["KeyId"].(string)
+			plaintext := bytes.Repeat([]byte{0x42}, 32)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"KeyId":          keyID,
+				"Plaintext":      plaintext,
+				"CiphertextBlob": append([]byte(keyID+":"), plaintext...),
+			})
+		case "Decrypt":
+			blob, _ := base64.StdEncoding.DecodeString(input["CiphertextBlob"].(string))
+			keyID, plaintext, ok := bytes.Cut(blob, []byte(":"))
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]string{"__type": kms.ErrCodeInvalidCiphertextException})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"KeyId":     string(keyID),
+				"Plaintext": plaintext,
+			})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	return kms.New(mockSession(ts.URL))
+}
@@ -0,0 +1,153 @@
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/opentofu/opentofu/internal/states/remote"
+)
+
+// maxPointerSize is the largest content of a pointer, which is the longest key
+// S3 allows.
+const maxPointerSize = 1024
+
+// readPointer returns the key of the state object the pointer at the state
+// path refers to, for key_is_pointer, or an empty string if the pointer
+// doesn't exist.
+func (c *RemoteClient) readPointer() (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: &c.bucketName,
+		Key:    &c.path,
+	}
+	if c.serverSideEncryption && c.customerEncryptionKey != nil {
+		input.SetSSECustomerKey(string(c.customerEncryptionKey))
+		input.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		input.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+	}
+
+	output, err := c.readClient().GetObject(input)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok {
+			switch awsErr.Code() {
+			case s3.ErrCodeNoSuchBucket:
+				return "", fmt.Errorf(errS3NoSuchBucket, c.bucketName, err)
+			case s3.ErrCodeNoSuchKey:
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("failed to read state pointer %q: %w", c.path, c.sseCustomerKeyError(err))
+	}
+	defer output.Body.Close()
+
+	buf := bytes.NewBuffer(nil)
+	if _, err := io.Copy(buf, io.LimitReader(output.Body, maxPointerSize+1)); err != nil {
+		return "", fmt.Errorf("failed to read state pointer %q: %w", c.path, err)
+	}
+
+	target := strings.TrimSpace(buf.String())
+	switch {
+	case target == "":
+		return "", fmt.Errorf("the state pointer %q in the S3 bucket %q is empty, so it doesn't refer to a state", c.path, c.bucketName)
+	case len(target) > maxPointerSize:
+		return "", fmt.Errorf("the state pointer %q in the S3 bucket %q is longer than %d bytes, so it isn't a key", c.path, c.bucketName, maxPointerSize)
+	case target == c.path:
+		return "", fmt.Errorf("the state pointer %q in the S3 bucket %q refers to itself", c.path, c.bucketName)
+	}
+	return target, nil
+}
+
+// resolveStateKey returns the key of the state object of the client, which is
+// the key the pointer refers to if key_is_pointer is set. It returns an empty
+// string if the pointer doesn't exist.
+func (c *RemoteClient) resolveStateKey() (string, error) {
+	if !c.keyIsPointer {
+		return c.path, nil
+	}
+	return c.readPointer()
+}
+
+// atKey returns a copy of the client which reads and writes the state object
+// with the given key directly, leaving the client itself unchanged, so that a
+// pointer can be followed by a client which is shared.
+func (c *RemoteClient) atKey(key string) *RemoteClient {
+	client := *c
+	client.path = key
+	client.keyIsPointer = false
+	return &client
+}
+
+// getThroughPointer reads the state the pointer refers to.
+func (c *RemoteClient) getThroughPointer() (*remote.Payload, error) {
+	key, err := c.resolveStateKey()
+	if err != nil || key == "" {
+		return nil, err
+	}
+
+	target := c.atKey(key)
+	payload, err := target.Get()
+	c.readSerial, c.shardManifest = target.readSerial, target.shardManifest
+	return payload, err
+}
+
+// putThroughPointer writes the state to pointer_target_key, or to the object
+// the pointer refers to if it isn't set, and then updates the pointer to refer
+// to the written object.
+func (c *RemoteClient) putThroughPointer(data []byte) error {
+	current, err := c.resolveStateKey()
+	if err != nil {
+		return err
+	}
+
+	target := c.pointerTargetKey
+	if target == "" {
+		target = current
+	}
+	if target == "" {
+		return fmt.Errorf(errStatePointerMissing, c.path, c.bucketName)
+	}
+	if target == c.path {
+		return fmt.Errorf("the state can't be written to the state pointer %q itself", c.path)
+	}
+
+	targetClient := c.atKey(target)
+	err = targetClient.put(data)
+	c.readSerial, c.shardManifest = targetClient.readSerial, targetClient.shardManifest
+	if err != nil {
+		return err
+	}
+
+	if target == current {
+		return nil
+	}
+	if err := c.putPointer(target); err != nil {
+		return fmt.Errorf("the state was written to %q, but the state pointer %q could not be updated to refer to it: %w", target, c.path, err)
+	}
+	return nil
+}
+
+// putPointer updates the pointer at the state path to refer to the given key.
+func (c *RemoteClient) putPointer(target string) error {
+	i := &s3.PutObjectInput{
+		ContentType: aws.String("text/plain"),
+		Body:        strings.NewReader(target),
+		Bucket:      &c.bucketName,
+		Key:         &c.path,
+	}
+	c.setPutObjectOptions(i)
+
+	_, err := c.s3Client.PutObject(i)
+	return err
+}
+
+const errStatePointerNotFound = "state pointer %q does not exist in the S3 bucket %q"
+
+const errStatePointerMissing = `The state pointer %q does not exist in the S3 bucket %q.
+
+With "key_is_pointer", the state is written to the object the pointer refers
+to. Create the pointer with the key of the state object as its content, or set
+"pointer_target_key" to the key the state should be written to.`
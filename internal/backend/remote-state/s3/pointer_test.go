@@ -0,0 +1,124 @@
+package s3
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestRemoteClient_keyIsPointer(t *testing.T) {
+	const (
+		oldState = `{"version": 4, "serial": 1}`
+		newState = `{"version": 4, "serial": 2}`
+	)
+
+	testCases := map[string]struct {
+		pointer          *string
+		pointerTargetKey string
+		expectedGet      string
+		expectedGetErr   string
+		expectedPutErr   string
+		expectedPointer  string
+		expectedTarget   string
+	}{
+		"follows the pointer": {
+			pointer:         aws.String("versions/1\n"),
+			expectedGet:     oldState,
+			expectedPointer: "versions/1\n",
+			expectedTarget:  "versions/1",
+		},
+		"updates the pointer to the target key": {
+			pointer:          aws.String("versions/1"),
+			pointerTargetKey: "versions/2",
+			expectedGet:      oldState,
+			expectedPointer:  "versions/2",
+			expectedTarget:   "versions/2",
+		},
+		"creates the pointer": {
+			pointerTargetKey: "versions/2",
+			expectedPointer:  "versions/2",
+			expectedTarget:   "versions/2",
+		},
+		"missing pointer": {
+			expectedPutErr: `The state pointer "state" does not exist`,
+		},
+		"empty pointer": {
+			pointer:        aws.String(" \n"),
+			expectedGetErr: `the state pointer "state" in the S3 bucket "bucket" is empty`,
+			expectedPutErr: `the state pointer "state" in the S3 bucket "bucket" is empty`,
+		},
+		"self-referencing pointer": {
+			pointer:        aws.String("state"),
+			expectedGetErr: `the state pointer "state" in the S3 bucket "bucket" refers to itself`,
+			expectedPutErr: `the state pointer "state" in the S3 bucket "bucket" refers to itself`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			if tc.pointer != nil {
+				storage.objects["bucket/state"] = &mockS3Object{body: []byte(*tc.pointer), header: http.Header{}}
+			}
+			storage.objects["bucket/versions/1"] = &mockS3Object{body: []byte(oldState), header: http.Header{}}
+
+			client := &RemoteClient{
+				s3Client:         mockS3Client(t, storage.ServeHTTP),
+				bucketName:       "bucket",
+				path:             "state",
+				keyIsPointer:     true,
+				pointerTargetKey: tc.pointerTargetKey,
+			}
+
+			payload, err := client.Get()
+			switch {
+			case tc.expectedGetErr != "":
+				if err == nil || !strings.Contains(err.Error(), tc.expectedGetErr) {
+					t.Fatalf("expected Get error containing %q, got %v", tc.expectedGetErr, err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected Get error: %s", err)
+			case tc.expectedGet == "" && payload != nil:
+				t.Fatalf("expected no state, got %q", payload.Data)
+			case tc.expectedGet != "" && (payload == nil || string(payload.Data) != tc.expectedGet):
+				t.Fatalf("expected state %q, got %v", tc.expectedGet, payload)
+			}
+
+			err = client.Put([]byte(newState))
+			if tc.expectedPutErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedPutErr) {
+					t.Fatalf("expected Put error containing %q, got %v", tc.expectedPutErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected Put error: %s", err)
+			}
+			if client.path != "state" {
+				t.Fatalf("expected the client to keep the pointer path, got %q", client.path)
+			}
+
+			storage.mu.Lock()
+			pointer := storage.objects["bucket/state"]
+			target := storage.objects["bucket/"+tc.expectedTarget]
+			storage.mu.Unlock()
+			if pointer == nil || string(pointer.body) != tc.expectedPointer {
+				t.Fatalf("expected pointer %q, got %v", tc.expectedPointer, pointer)
+			}
+			if target == nil || string(target.body) != newState {
+				t.Fatalf("expected the state to be written to %q", tc.expectedTarget)
+			}
+
+			payload, err = client.Get()
+			if err != nil {
+				t.Fatalf("unexpected Get error: %s", err)
+			}
+			if payload == nil || string(payload.Data) != newState {
+				t.Fatalf("expected to read back state %q, got %v", newState, payload)
+			}
+		})
+	}
+}
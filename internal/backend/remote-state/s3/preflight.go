@@ -0,0 +1,359 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Valid values of the dynamodb_table_missing_action attribute.
+const (
+	dynamoDBTableMissingError  = "error"
+	dynamoDBTableMissingWarn   = "warn"
+	dynamoDBTableMissingCreate = "create"
+)
+
+// checkDynamoDBTable verifies that the configured DynamoDB table exists, so
+// that a missing table is reported when the backend is configured rather than
+// in the middle of an operation. What happens when the table is missing is
+// controlled by action.
+//
+// The check is skipped if the caller is not allowed to describe the table,
+// since locking only requires item-level permissions.
+func (b *Backend) checkDynamoDBTable(action string) tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+
+	_, err := b.dynClient.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(b.ddbTable),
+	})
+	if err == nil {
+		return diags
+	}
+
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) || awsErr.Code() != dynamodb.ErrCodeResourceNotFoundException {
+		log.Printf("[WARN] Unable to verify that DynamoDB table %q exists: %s", b.ddbTable, err)
+		return diags
+	}
+
+	switch action {
+	case dynamoDBTableMissingWarn:
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Warning,
+			"DynamoDB table not found",
+			fmt.Sprintf(`The DynamoDB table %q does not exist. State locking is disabled.`, b.ddbTable),
+		))
+		b.ddbTable = ""
+
+	case dynamoDBTableMissingCreate:
+		log.Printf("[INFO] Creating DynamoDB table %q for state locking", b.ddbTable)
+		if err := b.createDynamoDBTable(); err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Failed to create DynamoDB table",
+				fmt.Sprintf(`The DynamoDB table %q does not exist and could not be created: %s`, b.ddbTable, err),
+			))
+		}
+
+	default:
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"DynamoDB table not found",
+			fmt.Sprintf(errDynamoDBTableNotFound, b.ddbTable),
+			cty.Path{cty.GetAttrStep{Name: "dynamodb_table"}},
+		))
+	}
+
+	return diags
+}
+
+// checkBucketVersioning verifies that versioning is enabled on every bucket
+// that holds state, so that the version history can be relied upon for
+// recovery.
+//
+// Buckets whose versioning status the caller is not allowed to read are
+// skipped with a warning, since reading and writing state doesn't require it.
+func (b *Backend) checkBucketVersioning() tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+
+	for _, bucket := range b.stateBuckets() {
+		out, err := b.bucketClient(bucket).GetBucketVersioning(&s3.GetBucketVersioningInput{
+			Bucket: aws.String(bucket),
+		})
+		if err != nil {
+			var awsErr awserr.Error
+			if errors.As(err, &awsErr) && awsErr.Code() == "AccessDenied" {
+				diags = diags.Append(tfdiags.Sourceless(
+					tfdiags.Warning,
+					"Unable to verify bucket versioning",
+					fmt.Sprintf(`Not allowed to read the versioning status of the S3 bucket %q, so "require_versioning" can't be enforced. Allow "s3:GetBucketVersioning" to verify it.`, bucket),
+				))
+				continue
+			}
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Failed to verify bucket versioning",
+				fmt.Sprintf(`Reading the versioning status of the S3 bucket %q failed: %s`, bucket, err),
+			))
+			continue
+		}
+
+		if status := aws.StringValue(out.Status); status != s3.BucketVersioningStatusEnabled {
+			if status == "" {
+				status = "not enabled"
+			}
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Bucket versioning not enabled",
+				fmt.Sprintf(`Versioning of the S3 bucket %q is %s, but "require_versioning" requires it to be enabled.`, bucket, strings.ToLower(status)),
+				cty.Path{cty.GetAttrStep{Name: "require_versioning"}},
+			))
+		}
+	}
+
+	return diags
+}
+
+// checkBucketEncryption verifies that default encryption is configured on
+// every bucket that holds state, so that the state is encrypted even by a
+// write which doesn't request it.
+//
+// Buckets whose encryption configuration the caller is not allowed to read are
+// skipped with a warning, like in checkBucketVersioning.
+func (b *Backend) checkBucketEncryption() tfdiags.Diagnostics {
+	var diags tfdiags.Diagnostics
+
+	for _, bucket := range b.stateBuckets() {
+		out, err := b.bucketClient(bucket).GetBucketEncryption(&s3.GetBucketEncryptionInput{
+			Bucket: aws.String(bucket),
+		})
+		var awsErr awserr.Error
+		switch {
+		case err == nil:
+		case errors.As(err, &awsErr) && awsErr.Code() == errCodeNoServerSideEncryptionConfiguration:
+			out = &s3.GetBucketEncryptionOutput{}
+		case errors.As(err, &awsErr) && awsErr.Code() == "AccessDenied":
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Warning,
+				"Unable to verify bucket encryption",
+				fmt.Sprintf(`Not allowed to read the encryption configuration of the S3 bucket %q, so "require_bucket_encryption" can't be enforced. Allow "s3:GetEncryptionConfiguration" to verify it.`, bucket),
+			))
+			continue
+		default:
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Failed to verify bucket encryption",
+				fmt.Sprintf(`Reading the encryption configuration of the S3 bucket %q failed: %s`, bucket, err),
+			))
+			continue
+		}
+
+		if !hasDefaultEncryption(out.ServerSideEncryptionConfiguration) {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Bucket encryption not configured",
+				fmt.Sprintf(`The S3 bucket %q has no default encryption configured, but "require_bucket_encryption" requires it.`, bucket),
+				cty.Path{cty.GetAttrStep{Name: "require_bucket_encryption"}},
+			))
+		}
+	}
+
+	return diags
+}
+
+// errCodeNoServerSideEncryptionConfiguration is the error code of
+// GetBucketEncryption for a bucket without default encryption.
+const errCodeNoServerSideEncryptionConfiguration = "ServerSideEncryptionConfigurationNotFoundError"
+
+// hasDefaultEncryption reports whether a bucket encryption configuration
+// applies an encryption algorithm to new objects.
+func hasDefaultEncryption(config *s3.ServerSideEncryptionConfiguration) bool {
+	if config == nil {
+		return false
+	}
+	for _, rule := range config.Rules {
+		if rule.ApplyServerSideEncryptionByDefault != nil && aws.StringValue(rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// stateBuckets returns the buckets that hold state, the configured bucket
+// first and then those of workspace_buckets in order.
+func (b *Backend) stateBuckets() []string {
+	buckets := []string{b.bucketName}
+	seen := map[string]bool{b.bucketName: true}
+	for _, bucket := range b.workspaceBuckets {
+		if !seen[bucket] {
+			seen[bucket] = true
+			buckets = append(buckets, bucket)
+		}
+	}
+	sort.Strings(buckets[1:])
+	return buckets
+}
+
+// preflightSuffix is the suffix of the throwaway object VerifyReadWrite writes
+// next to the state of the default workspace.
+const preflightSuffix = ".tofu-preflight"
+
+// VerifyReadWrite writes a throwaway object next to the state of the default
+// workspace with the configured encryption, ACL and grants, reads it back,
+// compares it and deletes it again, so that a misconfigured encryption key or
+// missing permission is caught before a real operation. Each step which fails
+// is reported with its own diagnostic.
+//
+// The object is deleted even if reading it back fails. Failing to delete it is
+// only a warning, since reading and writing state doesn't require it.
+func (b *Backend) VerifyReadWrite(ctx context.Context) (diags tfdiags.Diagnostics) {
+	if err := b.requireBucket("Verifying access to the S3 bucket"); err != nil {
+		return diags.Append(err)
+	}
+
+	client, err := b.remoteClient(backend.DefaultStateName)
+	if err != nil {
+		return diags.Append(err)
+	}
+	key := client.path + preflightSuffix
+
+	expected := make([]byte, 32)
+	if _, err := rand.Read(expected); err != nil {
+		return diags.Append(err)
+	}
+	body := []byte(hex.EncodeToString(expected))
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(client.bucketName),
+		Key:         aws.String(key),
+		ContentType: aws.String("text/plain"),
+	}
+	client.setPutObjectOptions(input)
+	upload := body
+	if client.clientSideEncryptionKMSKeyID != "" {
+		if upload, input.Metadata, err = client.encryptPayload(body); err != nil {
+			return diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Preflight write failed",
+				fmt.Sprintf(`Encrypting the preflight object %q client-side failed: %s`, key, err),
+			))
+		}
+	}
+	input.Body = bytes.NewReader(upload)
+
+	_, err = client.s3Client.PutObjectWithContext(ctx, input)
+	// The object should be deleted even if the write failed, since a write
+	// which timed out may still have succeeded. It's deleted without ctx so
+	// that it's deleted if ctx was canceled as well.
+	defer func() {
+		_, err := client.s3Client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(client.bucketName),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Warning,
+				"Preflight cleanup failed",
+				fmt.Sprintf(`Deleting the preflight object %q from the S3 bucket %q failed, so it must be deleted manually: %s`, key, client.bucketName, err),
+			))
+		}
+	}()
+	if err != nil {
+		return diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Preflight write failed",
+			fmt.Sprintf(`Writing the preflight object %q to the S3 bucket %q with the configured encryption and ACL failed: %s`, key, client.bucketName, client.sseCustomerKeyUnsupportedError(err)),
+		))
+	}
+
+	get := &s3.GetObjectInput{
+		Bucket: aws.String(client.bucketName),
+		Key:    aws.String(key),
+	}
+	if client.serverSideEncryption && client.customerEncryptionKey != nil {
+		get.SetSSECustomerKey(string(client.customerEncryptionKey))
+		get.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		get.SetSSECustomerKeyMD5(client.getSSECustomerKeyMD5())
+	}
+	output, err := client.readClient().GetObjectWithContext(ctx, get)
+	if err != nil {
+		return diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Preflight read failed",
+			fmt.Sprintf(`Reading back the preflight object %q from the S3 bucket %q failed: %s`, key, client.bucketName, client.sseCustomerKeyError(err)),
+		))
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err == nil {
+		data, err = client.decryptPayload(data, output.Metadata)
+	}
+	if err != nil {
+		return diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Preflight read failed",
+			fmt.Sprintf(`Reading back the preflight object %q from the S3 bucket %q failed: %s`, key, client.bucketName, err),
+		))
+	}
+
+	if !bytes.Equal(data, body) {
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Preflight read mismatch",
+			fmt.Sprintf(`The preflight object %q read back from the S3 bucket %q differs from the object written. Check that no proxy or S3-compatible store in between modifies objects.`, key, client.bucketName),
+		))
+	}
+
+	return diags
+}
+
+// createDynamoDBTable creates an on-demand lock table with the key schema
+// expected by the backend and waits until it is active.
+func (b *Backend) createDynamoDBTable() error {
+	_, err := b.dynClient.CreateTable(&dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String("LockID"),
+				AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String("LockID"),
+				KeyType:       aws.String(dynamodb.KeyTypeHash),
+			},
+		},
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+		TableName:   aws.String(b.ddbTable),
+	})
+	if err != nil {
+		return err
+	}
+
+	return b.dynClient.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+		TableName: aws.String(b.ddbTable),
+	})
+}
+
+const errDynamoDBTableNotFound = `The DynamoDB table %q does not exist.
+
+The table used for state locking must have been previously created, with a
+partition key named "LockID" of type "String". Set
+"dynamodb_table_missing_action" to "create" to have it created automatically,
+or to "warn" to continue without state locking.`
@@ -0,0 +1,388 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+)
+
+func TestBackendConfig_DynamoDBTableMissingAction(t *testing.T) {
+	testCases := map[string]struct {
+		action           string
+		tableExists      bool
+		expectedSeverity tfdiags.Severity
+		expectedSummary  string
+		expectedTable    string
+		expectCreate     bool
+	}{
+		"exists": {
+			tableExists:   true,
+			expectedTable: "table",
+		},
+		"default": {
+			expectedSeverity: tfdiags.Error,
+			expectedSummary:  "DynamoDB table not found",
+		},
+		"error": {
+			action:           dynamoDBTableMissingError,
+			expectedSeverity: tfdiags.Error,
+			expectedSummary:  "DynamoDB table not found",
+		},
+		"warn": {
+			action:           dynamoDBTableMissingWarn,
+			expectedSeverity: tfdiags.Warning,
+			expectedSummary:  "DynamoDB table not found",
+			expectedTable:    "",
+		},
+		"create": {
+			action:        dynamoDBTableMissingCreate,
+			expectedTable: "table",
+			expectCreate:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			tableExists := tc.tableExists
+			var created bool
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch dynamoDBOperation(r) {
+				case "DescribeTable":
+					if !tableExists {
+						writeDynamoDBError(w, dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found")
+						return
+					}
+					writeDynamoDBResponse(w, map[string]any{
+						"Table": map[string]any{
+							"TableName":   "table",
+							"TableStatus": dynamodb.TableStatusActive,
+						},
+					})
+				case "CreateTable":
+					created = true
+					tableExists = true
+					writeDynamoDBResponse(w, map[string]any{
+						"TableDescription": map[string]any{
+							"TableName":   "table",
+							"TableStatus": dynamodb.TableStatusCreating,
+						},
+					})
+				default:
+					t.Errorf("unexpected DynamoDB operation %q", dynamoDBOperation(r))
+				}
+			}))
+			defer ts.Close()
+
+			config := map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         "key",
+				"region":                      "us-west-2",
+				"dynamodb_table":              "table",
+				"dynamodb_endpoint":           ts.URL,
+				"skip_credentials_validation": true,
+			}
+			if tc.action != "" {
+				config["dynamodb_table_missing_action"] = tc.action
+			}
+
+			b, diags := configureBackend(t, config)
+
+			if tc.expectedSummary == "" {
+				if len(diags) != 0 {
+					t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+				}
+			} else {
+				if len(diags) != 1 {
+					t.Fatalf("expected 1 diagnostic, got %d: %s", len(diags), diagnosticsString(diags))
+				}
+				if diags[0].Severity() != tc.expectedSeverity || diags[0].Description().Summary != tc.expectedSummary {
+					t.Fatalf("unexpected diagnostic: %s", diagnosticString(diags[0]))
+				}
+				if !strings.Contains(diags[0].Description().Detail, `"table"`) {
+					t.Fatalf("expected diagnostic to name the table, got: %s", diagnosticString(diags[0]))
+				}
+			}
+
+			if created != tc.expectCreate {
+				t.Fatalf("expected table created to be %t, got %t", tc.expectCreate, created)
+			}
+
+			if diags.HasErrors() {
+				return
+			}
+			if b.ddbTable != tc.expectedTable {
+				t.Fatalf("expected DynamoDB table %q, got %q", tc.expectedTable, b.ddbTable)
+			}
+		})
+	}
+}
+
+func TestBackendConfig_RequireVersioning(t *testing.T) {
+	testCases := map[string]struct {
+		status           string
+		accessDenied     bool
+		expectedSeverity tfdiags.Severity
+		expectedSummary  string
+		expectedDetail   string
+	}{
+		"enabled": {
+			status: s3.BucketVersioningStatusEnabled,
+		},
+		"suspended": {
+			status:           s3.BucketVersioningStatusSuspended,
+			expectedSeverity: tfdiags.Error,
+			expectedSummary:  "Bucket versioning not enabled",
+			expectedDetail:   `Versioning of the S3 bucket "bucket" is suspended`,
+		},
+		"never enabled": {
+			expectedSeverity: tfdiags.Error,
+			expectedSummary:  "Bucket versioning not enabled",
+			expectedDetail:   `Versioning of the S3 bucket "bucket" is not enabled`,
+		},
+		"access denied": {
+			accessDenied:     true,
+			expectedSeverity: tfdiags.Warning,
+			expectedSummary:  "Unable to verify bucket versioning",
+			expectedDetail:   `"s3:GetBucketVersioning"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/bucket" || !r.URL.Query().Has("versioning") {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL)
+				}
+				if tc.accessDenied {
+					writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+					return
+				}
+				w.Header().Set("Content-Type", "application/xml")
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><VersioningConfiguration>`)
+				if tc.status != "" {
+					fmt.Fprintf(w, `<Status>%s</Status>`, tc.status)
+				}
+				fmt.Fprint(w, `</VersioningConfiguration>`)
+			}))
+			defer ts.Close()
+
+			_, diags := configureBackend(t, map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         "key",
+				"region":                      "us-west-2",
+				"endpoint":                    ts.URL,
+				"force_path_style":            true,
+				"require_versioning":          true,
+				"skip_credentials_validation": true,
+			})
+
+			if tc.expectedSummary == "" {
+				if len(diags) != 0 {
+					t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+				}
+				return
+			}
+			if len(diags) != 1 {
+				t.Fatalf("expected 1 diagnostic, got %d: %s", len(diags), diagnosticsString(diags))
+			}
+			desc := diags[0].Description()
+			if diags[0].Severity() != tc.expectedSeverity || desc.Summary != tc.expectedSummary || !strings.Contains(desc.Detail, tc.expectedDetail) {
+				t.Fatalf("unexpected diagnostic: %s", diagnosticString(diags[0]))
+			}
+		})
+	}
+}
+
+func TestBackendConfig_RequireBucketEncryption(t *testing.T) {
+	testCases := map[string]struct {
+		algorithm        string
+		notConfigured    bool
+		accessDenied     bool
+		expectedSeverity tfdiags.Severity
+		expectedSummary  string
+		expectedDetail   string
+	}{
+		"SSE-S3": {
+			algorithm: s3.ServerSideEncryptionAes256,
+		},
+		"SSE-KMS": {
+			algorithm: s3.ServerSideEncryptionAwsKms,
+		},
+		"no default encryption rule": {
+			expectedSeverity: tfdiags.Error,
+			expectedSummary:  "Bucket encryption not configured",
+			expectedDetail:   `The S3 bucket "bucket" has no default encryption configured`,
+		},
+		"not configured": {
+			notConfigured:    true,
+			expectedSeverity: tfdiags.Error,
+			expectedSummary:  "Bucket encryption not configured",
+			expectedDetail:   `The S3 bucket "bucket" has no default encryption configured`,
+		},
+		"access denied": {
+			accessDenied:     true,
+			expectedSeverity: tfdiags.Warning,
+			expectedSummary:  "Unable to verify bucket encryption",
+			expectedDetail:   `"s3:GetEncryptionConfiguration"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/bucket" || !r.URL.Query().Has("encryption") {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL)
+				}
+				switch {
+				case tc.accessDenied:
+					writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+					return
+				case tc.notConfigured:
+					writeS3Error(w, http.StatusNotFound, "ServerSideEncryptionConfigurationNotFoundError", "The server side encryption configuration was not found")
+					return
+				}
+				w.Header().Set("Content-Type", "application/xml")
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ServerSideEncryptionConfiguration><Rule>`)
+				if tc.algorithm != "" {
+					fmt.Fprintf(w, `<ApplyServerSideEncryptionByDefault><SSEAlgorithm>%s</SSEAlgorithm></ApplyServerSideEncryptionByDefault>`, tc.algorithm)
+				}
+				fmt.Fprint(w, `</Rule></ServerSideEncryptionConfiguration>`)
+			}))
+			defer ts.Close()
+
+			_, diags := configureBackend(t, map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         "key",
+				"region":                      "us-west-2",
+				"endpoint":                    ts.URL,
+				"force_path_style":            true,
+				"require_bucket_encryption":   true,
+				"skip_credentials_validation": true,
+			})
+
+			if tc.expectedSummary == "" {
+				if len(diags) != 0 {
+					t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+				}
+				return
+			}
+			if len(diags) != 1 {
+				t.Fatalf("expected 1 diagnostic, got %d: %s", len(diags), diagnosticsString(diags))
+			}
+			desc := diags[0].Description()
+			if diags[0].Severity() != tc.expectedSeverity || desc.Summary != tc.expectedSummary || !strings.Contains(desc.Detail, tc.expectedDetail) {
+				t.Fatalf("unexpected diagnostic: %s", diagnosticString(diags[0]))
+			}
+		})
+	}
+}
+
+func TestBackend_VerifyReadWrite(t *testing.T) {
+	testCases := map[string]struct {
+		failPut         bool
+		failGet         bool
+		failDelete      bool
+		corrupt         bool
+		expectedSummary string
+		expectedDetail  string
+	}{
+		"success": {},
+		"write fails": {
+			failPut:         true,
+			expectedSummary: "Preflight write failed",
+			expectedDetail:  "AccessDenied",
+		},
+		"read fails": {
+			failGet:         true,
+			expectedSummary: "Preflight read failed",
+			expectedDetail:  "AccessDenied",
+		},
+		"read mismatch": {
+			corrupt:         true,
+			expectedSummary: "Preflight read mismatch",
+			expectedDetail:  `"state.tofu-preflight"`,
+		},
+		"cleanup fails": {
+			failDelete:      true,
+			expectedSummary: "Preflight cleanup failed",
+			expectedDetail:  `"state.tofu-preflight"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			var deleted bool
+			b := &Backend{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path != "/bucket/state.tofu-preflight" {
+						t.Errorf("unexpected request %s %s", r.Method, r.URL)
+					}
+					switch {
+					case r.Method == http.MethodPut && tc.failPut,
+						r.Method == http.MethodGet && tc.failGet,
+						r.Method == http.MethodDelete && tc.failDelete:
+						writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+						return
+					case r.Method == http.MethodGet && tc.corrupt:
+						storage.objects["bucket/state.tofu-preflight"].body = []byte("corrupt")
+					case r.Method == http.MethodDelete:
+						deleted = true
+					}
+					storage.ServeHTTP(w, r)
+				}),
+				bucketName: "bucket",
+				keyName:    "state",
+				acl:        s3.ObjectCannedACLBucketOwnerFullControl,
+			}
+
+			diags := b.VerifyReadWrite(context.Background())
+
+			if tc.expectedSummary == "" {
+				if len(diags) != 0 {
+					t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+				}
+			} else {
+				if len(diags) != 1 {
+					t.Fatalf("expected 1 diagnostic, got %d: %s", len(diags), diagnosticsString(diags))
+				}
+				desc := diags[0].Description()
+				if desc.Summary != tc.expectedSummary || !strings.Contains(desc.Detail, tc.expectedDetail) {
+					t.Fatalf("unexpected diagnostic: %s", diagnosticString(diags[0]))
+				}
+			}
+
+			// The object is cleaned up whichever step failed.
+			if !tc.failDelete && (!deleted || len(storage.objects) != 0) {
+				t.Fatalf("expected the preflight object to be deleted, got %d objects", len(storage.objects))
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// stateCache holds the states read by clients with read_cache_ttl set, so
+// that reading a state again within read_cache_ttl only downloads it if its
+// ETag changed. The ETag is checked with a conditional GetObject each time,
+// so a state changed by another process is never served from the cache.
+var stateCache = struct {
+	sync.Mutex
+	entries map[string]cachedState
+}{entries: make(map[string]cachedState)}
+
+type cachedState struct {
+	etag string
+	data []byte
+	// manifest is the manifest of the state if it is sharded.
+	manifest *shardManifest
+	expires  time.Time
+}
+
+// cachedState returns the cached state of the client, if read_cache_ttl is
+// set and the state was cached less than read_cache_ttl ago.
+func (c *RemoteClient) cachedState() (cachedState, bool) {
+	if c.readCacheTTL <= 0 {
+		return cachedState{}, false
+	}
+
+	stateCache.Lock()
+	defer stateCache.Unlock()
+
+	key := c.stateCacheKey()
+	entry, ok := stateCache.entries[key]
+	if !ok {
+		return cachedState{}, false
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(stateCache.entries, key)
+		return cachedState{}, false
+	}
+	return entry, true
+}
+
+// cacheState caches a state read with the given ETag, if read_cache_ttl is
+// set.
+func (c *RemoteClient) cacheState(etag string, data []byte, manifest *shardManifest) {
+	if c.readCacheTTL <= 0 || etag == "" {
+		return
+	}
+
+	stateCache.Lock()
+	defer stateCache.Unlock()
+
+	stateCache.entries[c.stateCacheKey()] = cachedState{
+		etag:     etag,
+		data:     bytes.Clone(data),
+		manifest: manifest,
+		expires:  time.Now().Add(c.readCacheTTL),
+	}
+}
+
+// forgetCachedState removes the cached state of the client after it was
+// written or deleted.
+func (c *RemoteClient) forgetCachedState() {
+	if c.readCacheTTL <= 0 {
+		return
+	}
+
+	stateCache.Lock()
+	defer stateCache.Unlock()
+
+	delete(stateCache.entries, c.stateCacheKey())
+}
+
+// stateCacheKey identifies the state of the client. It includes the digest of
+// the customer-provided key and the KMS key used for client-side encryption,
+// so that a state can't be read from the cache without the key it is
+// encrypted with.
+func (c *RemoteClient) stateCacheKey() string {
+	return c.readClient().Endpoint + "\x00" + c.bucketName + "\x00" + c.path + "\x00" + c.getSSECustomerKeyMD5() + "\x00" + c.clientSideEncryptionKMSKeyID
+}
+
+// isNotModified reports whether err is the response to a conditional request
+// for an object which didn't change.
+func isNotModified(err error) bool {
+	var reqErr awserr.RequestFailure
+	return errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotModified
+}
@@ -0,0 +1,146 @@
+package s3
+
+import (
+	"bytes"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRemoteClient_readCache(t *testing.T) {
+	storage := newMockS3Storage()
+	var downloads, notModified atomic.Int64
+	s3Client := mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if r.Header.Get("If-None-Match") == storage.objects["bucket/state"].header.Get("ETag") {
+				notModified.Add(1)
+			} else {
+				downloads.Add(1)
+			}
+		}
+		storage.ServeHTTP(w, r)
+	})
+	t.Cleanup(func() {
+		stateCache.Lock()
+		defer stateCache.Unlock()
+		stateCache.entries = make(map[string]cachedState)
+	})
+
+	newClient := func() *RemoteClient {
+		return &RemoteClient{
+			s3Client:     s3Client,
+			bucketName:   "bucket",
+			path:         "state",
+			readCacheTTL: time.Minute,
+		}
+	}
+	reader := newClient()
+
+	state := []byte(`{"version": 4, "serial": 1, "lineage": "abc"}`)
+	if err := newClient().Put(state); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+
+	read := func(expected []byte) {
+		t.Helper()
+		payload, err := reader.Get()
+		if err != nil {
+			t.Fatalf("unexpected error reading state: %s", err)
+		}
+		if !bytes.Equal(payload.Data, expected) {
+			t.Fatalf("expected state %q, got %q", expected, payload.Data)
+		}
+	}
+
+	// The first read downloads the state, and the next ones only check that
+	// it is unchanged.
+	read(state)
+	read(state)
+	read(state)
+	if got := downloads.Load(); got != 1 {
+		t.Fatalf("expected 1 download, got %d", got)
+	}
+	if got := notModified.Load(); got != 2 {
+		t.Fatalf("expected 2 unchanged reads, got %d", got)
+	}
+
+	// A state written by another client has a new ETag, so it's downloaded
+	// again.
+	changed := []byte(`{"version": 4, "serial": 2, "lineage": "abc"}`)
+	if err := newClient().Put(changed); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+	read(changed)
+	if got := downloads.Load(); got != 2 {
+		t.Fatalf("expected 2 downloads, got %d", got)
+	}
+
+	// The state is downloaded again once the cached entry expires.
+	stateCache.Lock()
+	for key, entry := range stateCache.entries {
+		entry.expires = time.Now()
+		stateCache.entries[key] = entry
+	}
+	stateCache.Unlock()
+	read(changed)
+	if got := downloads.Load(); got != 3 {
+		t.Fatalf("expected 3 downloads, got %d", got)
+	}
+}
+
+func TestRemoteClient_readCacheDisabled(t *testing.T) {
+	storage := newMockS3Storage()
+	s3Client := mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			t.Errorf("unexpected conditional request with read_cache_ttl unset")
+		}
+		storage.ServeHTTP(w, r)
+	})
+
+	client := &RemoteClient{
+		s3Client:   s3Client,
+		bucketName: "bucket",
+		path:       "state",
+	}
+	if err := client.Put([]byte(`{"version": 4, "serial": 1, "lineage": "abc"}`)); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get(); err != nil {
+			t.Fatalf("unexpected error reading state: %s", err)
+		}
+	}
+}
+
+func TestRemoteClient_readCacheClientSideEncryption(t *testing.T) {
+	t.Cleanup(func() {
+		stateCache.Lock()
+		defer stateCache.Unlock()
+		stateCache.entries = make(map[string]cachedState)
+	})
+
+	s3Client := mockS3Client(t, newMockS3Storage().ServeHTTP)
+	newClient := func(kmsKeyID string) *RemoteClient {
+		return &RemoteClient{
+			s3Client:                     s3Client,
+			bucketName:                   "bucket",
+			path:                         "state",
+			readCacheTTL:                 time.Minute,
+			clientSideEncryptionKMSKeyID: kmsKeyID,
+		}
+	}
+
+	// A state decrypted with a KMS key isn't served from the cache to a
+	// client without that key.
+	newClient("alias/state").cacheState(`"etag"`, []byte(`{"version": 4}`), nil)
+	if _, ok := newClient("").cachedState(); ok {
+		t.Fatal("expected no cached state for a client without client-side encryption")
+	}
+	if _, ok := newClient("alias/other").cachedState(); ok {
+		t.Fatal("expected no cached state for a client with another KMS key")
+	}
+	if _, ok := newClient("alias/state").cachedState(); !ok {
+		t.Fatal("expected a cached state for a client with the same KMS key")
+	}
+}
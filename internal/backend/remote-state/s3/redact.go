@@ -0,0 +1,88 @@
+package s3
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+
+	"github.com/opentofu/opentofu/internal/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// sensitiveEnvVars are the environment variables holding secrets the backend
+// reads in place of sensitive attributes.
+var sensitiveEnvVars = []string{
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_SSE_CUSTOMER_KEY",
+	"AWS_ASSUME_ROLE_EXTERNAL_ID",
+}
+
+// sensitiveValues returns the secrets which must not appear in diagnostics:
+// the values of the attributes the schema marks as sensitive, the environment
+// variables read in their place, and the secrets resolved while configuring
+// the backend, such as a customer-provided key read from a file.
+func (b *Backend) sensitiveValues(obj cty.Value) []string {
+	var values []string
+	add := func(v string) {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+
+	if !obj.IsNull() && obj.IsKnown() {
+		for name, attr := range b.ConfigSchema().Attributes {
+			if !attr.Sensitive || !attr.Type.Equals(cty.String) {
+				continue
+			}
+			if val := obj.GetAttr(name); !val.IsNull() && val.IsKnown() {
+				add(val.AsString())
+			}
+		}
+	}
+	for _, name := range sensitiveEnvVars {
+		add(os.Getenv(name))
+	}
+	if b.customerEncryptionKey != nil {
+		add(base64.StdEncoding.EncodeToString(b.customerEncryptionKey))
+	}
+	if b.awsConfig != nil {
+		add(b.awsConfig.SecretKey)
+		add(b.awsConfig.Token)
+		add(b.awsConfig.AssumeRoleExternalID)
+	}
+	return values
+}
+
+// redactDiagnostics replaces the given secrets in the summaries and details of
+// diagnostics with redactedValue. Diagnostics without secrets are returned as
+// they are.
+func redactDiagnostics(diags tfdiags.Diagnostics, secrets []string) tfdiags.Diagnostics {
+	if len(secrets) == 0 {
+		return diags
+	}
+
+	var redacted tfdiags.Diagnostics
+	for _, diag := range diags {
+		desc := diag.Description()
+		summary, detail := redactSecrets(desc.Summary, secrets), redactSecrets(desc.Detail, secrets)
+		switch {
+		case summary == desc.Summary && detail == desc.Detail:
+			redacted = redacted.Append(diag)
+		case tfdiags.GetAttribute(diag) != nil:
+			redacted = redacted.Append(tfdiags.AttributeValue(diag.Severity(), summary, detail, tfdiags.GetAttribute(diag)))
+		default:
+			redacted = redacted.Append(tfdiags.Sourceless(diag.Severity(), summary, detail))
+		}
+	}
+	return redacted
+}
+
+// redactSecrets replaces every occurrence of the given secrets in s with
+// redactedValue.
+func redactSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redactedValue)
+	}
+	return s
+}
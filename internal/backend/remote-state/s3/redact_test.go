@@ -0,0 +1,77 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestBackendConfig_redactsSecrets(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	const (
+		secretKey   = "super-secret-access-key-value"
+		token       = "super-secret-session-token"
+		customerKey = "4Dm1n4Dm1n4Dm1n4Dm1n4Dm1n4Dm1n4Dm1n4Dm1n4A="
+	)
+
+	// Some S3-compatible stores echo the request in their errors.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `<ErrorResponse><Error><Type>Sender</Type><Code>InvalidClientTokenId</Code><Message>Invalid credentials %s/%s for key %s</Message></Error><RequestId>mock-request-id</RequestId></ErrorResponse>`, secretKey, token, customerKey)
+	}))
+	defer ts.Close()
+
+	_, diags := configureBackend(t, map[string]any{
+		"access_key":       awsbase.MockStaticAccessKey,
+		"secret_key":       secretKey,
+		"token":            token,
+		"bucket":           "bucket",
+		"key":              "key",
+		"region":           "us-west-2",
+		"sts_endpoint":     ts.URL,
+		"encrypt":          true,
+		"sse_customer_key": customerKey,
+	})
+	if !diags.HasErrors() {
+		t.Fatal("expected the credentials validation to fail")
+	}
+
+	got := diagnosticsString(diags)
+	if !strings.Contains(got, "InvalidClientTokenId") || !strings.Contains(got, redactedValue) {
+		t.Fatalf("expected the error to be reported with redacted secrets, got: %s", got)
+	}
+	for _, secret := range []string{secretKey, token, customerKey} {
+		if strings.Contains(got, secret) {
+			t.Fatalf("expected the diagnostics not to contain %q, got: %s", secret, got)
+		}
+	}
+}
+
+func TestRedactDiagnostics(t *testing.T) {
+	var diags tfdiags.Diagnostics
+	diags = diags.Append(tfdiags.AttributeValue(tfdiags.Error, "Invalid token", "The token s3cr3t is not valid.", cty.GetAttrPath("token")))
+	diags = diags.Append(tfdiags.Sourceless(tfdiags.Warning, "Unrelated", "Nothing to redact."))
+
+	redacted := redactDiagnostics(diags, []string{"s3cr3t"})
+	if len(redacted) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d", len(redacted))
+	}
+	if got := redacted[0].Description().Detail; got != "The token (redacted) is not valid." {
+		t.Fatalf("unexpected detail %q", got)
+	}
+	if got := tfdiags.GetAttribute(redacted[0]); !got.Equals(cty.GetAttrPath("token")) {
+		t.Fatalf("expected the attribute path to be kept, got %#v", got)
+	}
+	if redacted[1] != diags[1] {
+		t.Fatal("expected a diagnostic without secrets to be kept as is")
+	}
+}
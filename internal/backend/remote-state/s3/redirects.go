@@ -0,0 +1,89 @@
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// defaultMaxRedirects is the number of redirects followed when follow_redirects
+// is set without max_redirects.
+const defaultMaxRedirects = 5
+
+// maxMaxRedirects is the largest valid value of max_redirects, which is the
+// limit of the Go HTTP client as well.
+const maxMaxRedirects = 10
+
+// signedRedirectPolicy returns an http.Client CheckRedirect function following
+// up to max redirects, for follow_redirects.
+//
+// The signature of a request covers its host and path, so a redirected request
+// is signed again with the same credentials, service and region as the
+// original request. Signed requests are only redirected to the same host, so
+// that they aren't signed for a host which wasn't configured. Requests which
+// weren't signed are redirected as they are.
+func signedRedirectPolicy(creds *credentials.Credentials, max int) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > max {
+			return fmt.Errorf("stopped after %d redirects", max)
+		}
+
+		service, region, ok := signingScope(via[0].Header.Get("Authorization"))
+		if !ok {
+			return nil
+		}
+		if req.URL.Host != via[0].URL.Host {
+			return fmt.Errorf("refusing to follow the redirect of a signed request from %q to another host %q", via[0].URL.Host, req.URL.Host)
+		}
+
+		// The Go client only forwards the Authorization header to the same
+		// host, but the signature has to be replaced in any case.
+		req.Header.Del("Authorization")
+
+		// S3 requests carry the hash of their body, so it's only read for the
+		// other services, whose requests are small.
+		var body io.ReadSeeker
+		if req.Header.Get("X-Amz-Content-Sha256") == "" && req.GetBody != nil {
+			rc, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			body = bytes.NewReader(data)
+		}
+
+		signer := v4.NewSigner(creds, func(s *v4.Signer) {
+			s.DisableRequestBodyOverwrite = true
+		})
+		if _, err := signer.Sign(req, body, service, region, time.Now()); err != nil {
+			return fmt.Errorf("failed to sign redirected request: %w", err)
+		}
+		return nil
+	}
+}
+
+// signingScope returns the service and region of the credential scope of a
+// SigV4 Authorization header, such as
+// "AWS4-HMAC-SHA256 Credential=AKID/20060102/us-east-1/s3/aws4_request, ...".
+func signingScope(auth string) (service, region string, ok bool) {
+	_, rest, found := strings.Cut(auth, "Credential=")
+	if !found {
+		return "", "", false
+	}
+	scope, _, _ := strings.Cut(rest, ",")
+	parts := strings.Split(scope, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return "", "", false
+	}
+	return parts[3], parts[2], true
+}
@@ -0,0 +1,193 @@
+package s3
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+)
+
+func TestBackend_followRedirects(t *testing.T) {
+	testCases := map[string]struct {
+		followRedirects bool
+		crossHost       bool
+		expectedErr     string
+	}{
+		"follow": {
+			followRedirects: true,
+		},
+		"cross-host": {
+			followRedirects: true,
+			crossHost:       true,
+			expectedErr:     "to another host",
+		},
+		"default": {
+			expectedErr: "SignatureDoesNotMatch",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			// Signed requests must not be redirected to another host.
+			var otherRequests int
+			other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				otherRequests++
+				writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+			}))
+			defer other.Close()
+
+			// The gateway redirects the requests to the store behind it,
+			// which only accepts requests signed for their own path.
+			storage := newMockS3Storage()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if path, ok := strings.CutPrefix(r.URL.Path, "/gateway"); ok {
+					if tc.crossHost {
+						path = other.URL + path
+					}
+					http.Redirect(w, r, path, http.StatusTemporaryRedirect)
+					return
+				}
+				if !validSignature(t, r) {
+					writeS3Error(w, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature does not match.")
+					return
+				}
+				storage.ServeHTTP(w, r)
+			}))
+			defer ts.Close()
+
+			config := map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         "key",
+				"region":                      "us-west-2",
+				"endpoint":                    ts.URL + "/gateway",
+				"force_path_style":            true,
+				"max_retries":                 0,
+				"skip_credentials_validation": true,
+			}
+			if tc.followRedirects {
+				config["follow_redirects"] = true
+			}
+			b, diags := configureBackend(t, config)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+			}
+
+			client, err := b.remoteClient("default")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			err = client.Put([]byte(`{"version": 4}`))
+			if otherRequests != 0 {
+				t.Fatalf("expected no requests to the other host, got %d", otherRequests)
+			}
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if _, ok := storage.objects["bucket/key"]; !ok {
+				t.Fatal("expected the state to be written through the redirect")
+			}
+		})
+	}
+}
+
+func TestBackend_maxRedirects(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Redirect(w, r, r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer ts.Close()
+
+	b, diags := configureBackend(t, map[string]any{
+		"access_key":                  awsbase.MockStaticAccessKey,
+		"secret_key":                  awsbase.MockStaticSecretKey,
+		"bucket":                      "bucket",
+		"key":                         "key",
+		"region":                      "us-west-2",
+		"endpoint":                    ts.URL,
+		"force_path_style":            true,
+		"max_retries":                 0,
+		"follow_redirects":            true,
+		"max_redirects":               2,
+		"skip_credentials_validation": true,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+	}
+
+	client, err := b.remoteClient("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := client.Get(); err == nil || !strings.Contains(err.Error(), "stopped after 2 redirects") {
+		t.Fatalf("expected the redirects to be stopped, got %v", err)
+	}
+	if requests != 3 {
+		t.Fatalf("expected 3 requests, got %d", requests)
+	}
+}
+
+func TestSigningScope(t *testing.T) {
+	service, region, ok := signingScope("AWS4-HMAC-SHA256 Credential=AKID/20060102/eu-west-1/dynamodb/aws4_request, SignedHeaders=host;x-amz-date, Signature=abc")
+	if !ok || service != "dynamodb" || region != "eu-west-1" {
+		t.Fatalf("unexpected scope: %q %q %t", service, region, ok)
+	}
+	if _, _, ok := signingScope(""); ok {
+		t.Fatal("expected no scope for an unsigned request")
+	}
+}
+
+// validSignature reports whether the request received by a test server has a
+// valid SigV4 signature from the mock credentials.
+func validSignature(t *testing.T, r *http.Request) bool {
+	t.Helper()
+
+	auth := r.Header.Get("Authorization")
+	_, signed, ok := strings.Cut(auth, "SignedHeaders=")
+	if !ok {
+		return false
+	}
+	signed, _, _ = strings.Cut(signed, ",")
+
+	req, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range strings.Split(signed, ";") {
+		if name != "host" {
+			req.Header[http.CanonicalHeaderKey(name)] = r.Header.Values(name)
+		}
+	}
+	signTime, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	signer := v4.NewSigner(credentials.NewStaticCredentials(awsbase.MockStaticAccessKey, awsbase.MockStaticSecretKey, ""), func(s *v4.Signer) {
+		s.DisableRequestBodyOverwrite = true
+	})
+	if _, err := signer.Sign(req, nil, "s3", "us-west-2", signTime); err != nil {
+		t.Fatal(err)
+	}
+	return req.Header.Get("Authorization") == auth
+}
@@ -0,0 +1,155 @@
+package s3
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/mitchellh/go-homedir"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/ini.v1"
+)
+
+// resolveRegion determines the region of the backend from, in order of
+// precedence:
+//
+//  1. the "region" attribute
+//  2. the AWS_REGION environment variable
+//  3. the AWS_DEFAULT_REGION environment variable
+//  4. the region of the configured profile in the shared configuration or
+//     credentials file
+//  5. the EC2 instance metadata service, unless skip_metadata_api_check or
+//     forbid_imds is set, or s3_compatible is set and skip_metadata_api_check
+//     isn't
+//
+// It returns the region along with a description of its source, or an empty
+// region if none of the sources provides one.
+func resolveRegion(obj cty.Value) (region, source string) {
+	if region, source := staticRegion(obj); region != "" {
+		return region, source
+	}
+
+	if skipMetadataAPI(obj) {
+		return "", ""
+	}
+	region, err := imdsRegion()
+	if err != nil {
+		log.Printf("[DEBUG] Unable to read the region from the EC2 instance metadata service: %s", err)
+		return "", ""
+	}
+	return region, "the EC2 instance metadata service"
+}
+
+// staticRegion is like resolveRegion, but only considers the sources which
+// don't require a network request.
+func staticRegion(obj cty.Value) (region, source string) {
+	if v, ok := stringAttrOk(obj, "region"); ok {
+		return v, `the "region" attribute`
+	}
+	for _, envvar := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if v := os.Getenv(envvar); v != "" {
+			return v, fmt.Sprintf("the %q environment variable", envvar)
+		}
+	}
+
+	profile := configuredProfile(obj)
+	files := []struct {
+		filename string
+		sections []string
+	}{
+		{
+			filename: sharedConfigFilename(),
+			sections: configFileSections(profile),
+		},
+		{
+			filename: stringAttrDefaultEnvVar(obj, "shared_credentials_file", "AWS_SHARED_CREDENTIALS_FILE"),
+			sections: []string{profile},
+		},
+	}
+	if files[1].filename == "" {
+		files[1].filename = "~/.aws/credentials"
+	}
+	for _, file := range files {
+		if v := profileValue(file.filename, file.sections, "region"); v != "" {
+			return v, fmt.Sprintf("the profile %q in %q", profile, file.filename)
+		}
+	}
+
+	return "", ""
+}
+
+// configuredProfile returns the name of the profile used for the shared
+// configuration.
+func configuredProfile(obj cty.Value) string {
+	if profile := stringAttrDefaultEnvVar(obj, "profile", "AWS_PROFILE", "AWS_DEFAULT_PROFILE"); profile != "" {
+		return profile
+	}
+	return session.DefaultSharedConfigProfile
+}
+
+// sharedConfigFilename returns the name of the shared configuration file.
+func sharedConfigFilename() string {
+	if filename := os.Getenv("AWS_CONFIG_FILE"); filename != "" {
+		return filename
+	}
+	return "~/.aws/config"
+}
+
+// configFileSections returns the names of the sections a profile can be
+// defined in within the shared configuration file, in the order the SDK looks
+// them up.
+func configFileSections(profile string) []string {
+	return []string{profile, "profile " + profile}
+}
+
+// profileValue returns the value of key in the first of the given sections
+// which exists in a shared configuration or credentials file, like the SDK
+// reads the profile. It returns an empty string if the file can't be read,
+// none of the sections exists, or the section doesn't set the key.
+func profileValue(filename string, sections []string, key string) string {
+	filename, err := homedir.Expand(filename)
+	if err != nil {
+		return ""
+	}
+	f, err := ini.LoadSources(ini.LoadOptions{
+		// Indented lines continue the value above them, such as the
+		// settings nested under "s3 =", rather than setting keys of their
+		// own.
+		AllowPythonMultilineValues: true,
+		// Values like SSO start URLs can contain "#".
+		SpaceBeforeInlineComment: true,
+	}, filename)
+	if err != nil {
+		return ""
+	}
+
+	for _, name := range sections {
+		if section, err := f.GetSection(name); err == nil {
+			return section.Key(key).String()
+		}
+	}
+	return ""
+}
+
+// imdsRegion reads the region of the instance from the EC2 instance metadata
+// service.
+func imdsRegion() (string, error) {
+	cfg := &aws.Config{}
+	if endpoint := os.Getenv("AWS_METADATA_URL"); endpoint != "" {
+		cfg.Endpoint = aws.String(endpoint)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return "", err
+	}
+	return ec2metadata.New(sess).Region()
+}
+
+const errMissingRegion = `The "region" attribute or the "AWS_REGION" or "AWS_DEFAULT_REGION" environment variables must be set.
+
+The region is otherwise read from the configured profile in the shared
+configuration file, or from the EC2 instance metadata service unless
+"skip_metadata_api_check" or "forbid_imds" is set.`
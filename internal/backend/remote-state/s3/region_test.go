@@ -0,0 +1,79 @@
+package s3
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfileValue(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(filename, []byte(`[default]
+region = us-east-1 # the default region
+
+[profile nested]
+region = us-west-2
+s3 =
+  region = eu-west-1
+
+[profile sso]
+sso_start_url = https://example.awsapps.com/start#/
+sso_region=eu-central-1 ; inline comment
+
+[both]
+output = json
+
+[profile both]
+region = ap-south-1
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		profile  string
+		key      string
+		expected string
+	}{
+		"default": {
+			profile:  "default",
+			key:      "region",
+			expected: "us-east-1",
+		},
+		"nested setting": {
+			profile:  "nested",
+			key:      "region",
+			expected: "us-west-2",
+		},
+		"value containing a hash": {
+			profile:  "sso",
+			key:      "sso_start_url",
+			expected: "https://example.awsapps.com/start#/",
+		},
+		"inline comment": {
+			profile:  "sso",
+			key:      "sso_region",
+			expected: "eu-central-1",
+		},
+		"first existing section": {
+			profile: "both",
+			key:     "region",
+		},
+		"missing profile": {
+			profile: "missing",
+			key:     "region",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			if v := profileValue(filename, configFileSections(tc.profile), tc.key); v != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, v)
+			}
+		})
+	}
+
+	if v := profileValue(filepath.Join(t.TempDir(), "missing"), []string{"default"}, "region"); v != "" {
+		t.Fatalf("expected no value from a missing file, got %q", v)
+	}
+}
@@ -0,0 +1,132 @@
+package s3
+
+import (
+	"math/big"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// redactedValue replaces the values of sensitive attributes in the resolved
+// configuration.
+const redactedValue = "(redacted)"
+
+// redactedAttributes are the attributes redacted in the resolved configuration
+// in addition to those marked sensitive in the schema.
+var redactedAttributes = map[string]bool{
+	"access_key": true,
+}
+
+// ResolvedConfig returns the effective configuration of a configured backend,
+// after defaults and environment variables have been applied, keyed by
+// attribute name. Secrets are redacted, but whether they are set is still
+// visible. It returns nil if the backend has not been configured.
+//
+// Every attribute and block of the schema is included, with the value it was
+// configured with, or nil if it wasn't set, unless the backend resolved the
+// value from a default or the environment. Credentials are reported as they
+// were configured, not as they were resolved from other sources.
+func (b *Backend) ResolvedConfig() map[string]any {
+	if b.config.IsNull() {
+		return nil
+	}
+
+	schema := b.ConfigSchema()
+	cfg := make(map[string]any, len(schema.Attributes)+len(schema.BlockTypes))
+	for name, attr := range schema.Attributes {
+		v := b.config.GetAttr(name)
+		if attr.Sensitive || redactedAttributes[name] {
+			cfg[name] = ""
+			if !v.IsNull() {
+				cfg[name] = redactedValue
+			}
+			continue
+		}
+		cfg[name] = configValue(v)
+	}
+	for name := range schema.BlockTypes {
+		cfg[name] = configValue(b.config.GetAttr(name))
+	}
+
+	cfg["bucket"] = b.bucketName
+	cfg["key"] = b.keyName
+	cfg["workspace_key_prefix"] = b.workspaceKeyPrefix
+	cfg["unify_workspace_paths"] = b.unifyWorkspacePaths
+	if b.localMirrorPath != "" {
+		cfg["local_mirror_path"] = b.localMirrorPath
+		// None of the other attributes are used with the local mirror.
+		return cfg
+	}
+
+	cfg["region"] = aws.StringValue(b.s3Client.Config.Region)
+	cfg["endpoint"] = b.s3Client.Endpoint
+	cfg["force_path_style"] = aws.BoolValue(b.s3Client.Config.S3ForcePathStyle)
+	cfg["encrypt"] = b.serverSideEncryption
+	cfg["kms_key_id"] = b.kmsKeyID
+	cfg["client_side_encryption_kms_key_id"] = b.clientSideEncryptionKMSKeyID
+	cfg["acl"] = b.acl
+	cfg["compress"] = b.compress
+	cfg["key_case"] = b.keyCase
+	cfg["dynamodb_table"] = b.ddbTable
+	cfg["dynamodb_endpoint"] = b.dynClient.Endpoint
+	cfg["dynamodb_region"] = aws.StringValue(b.dynClient.Config.Region)
+	cfg["lock_retry_max_attempts"] = b.lockRetryMaxAttempts
+	cfg["lock_retry_wait_seconds"] = int(b.lockRetryWait.Seconds())
+	cfg["malformed_lock_action"] = b.malformedLockAction
+	cfg["new_state_read_retries"] = b.newStateReadRetries
+	cfg["profile"] = b.awsConfig.Profile
+	cfg["shared_credentials_file"] = b.awsConfig.CredsFilename
+	cfg["iam_endpoint"] = b.awsConfig.IamEndpoint
+	cfg["sts_endpoint"] = b.awsConfig.StsEndpoint
+	cfg["max_retries"] = b.awsConfig.MaxRetries
+	cfg["skip_credentials_validation"] = b.awsConfig.SkipCredsValidation
+	cfg["skip_metadata_api_check"] = b.awsConfig.SkipMetadataApiCheck
+	cfg["role_arn"] = b.awsConfig.AssumeRoleARN
+	cfg["session_name"] = b.awsConfig.AssumeRoleSessionName
+	if b.s3ReadClient != nil {
+		cfg["read_endpoint"] = b.s3ReadClient.Endpoint
+	}
+	if b.workspaceBuckets != nil {
+		cfg["workspace_buckets"] = b.workspaceBuckets
+	}
+
+	return cfg
+}
+
+// configValue returns the Go value of a configuration value for the resolved
+// configuration, or nil if it isn't set.
+func configValue(v cty.Value) any {
+	if v.IsNull() || !v.IsKnown() {
+		return nil
+	}
+
+	ty := v.Type()
+	switch {
+	case ty == cty.String:
+		return v.AsString()
+	case ty == cty.Bool:
+		return v.True()
+	case ty == cty.Number:
+		bf := v.AsBigFloat()
+		if i, acc := bf.Int64(); acc == big.Exact {
+			return int(i)
+		}
+		f, _ := bf.Float64()
+		return f
+	case ty.IsMapType() || ty.IsObjectType():
+		m := make(map[string]any)
+		for it := v.ElementIterator(); it.Next(); {
+			k, ev := it.Element()
+			m[k.AsString()] = configValue(ev)
+		}
+		return m
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		l := make([]any, 0, v.LengthInt())
+		for it := v.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			l = append(l, configValue(ev))
+		}
+		return l
+	}
+	return nil
+}
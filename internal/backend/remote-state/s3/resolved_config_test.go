@@ -0,0 +1,114 @@
+package s3
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+)
+
+func TestBackend_ResolvedConfig(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	if cfg := New().(*Backend).ResolvedConfig(); cfg != nil {
+		t.Fatalf("expected no configuration before Configure, got %v", cfg)
+	}
+
+	os.Setenv("AWS_REGION", "eu-central-1")
+	os.Setenv("AWS_S3_ENDPOINT", "https://s3.example.com")
+
+	const customerKey = "4Dm1n4rZv6iSPfGa5ZRSvOdwauCnWICiblK16Om18Eo="
+	b, diags := configureBackend(t, map[string]any{
+		"access_key":                  awsbase.MockStaticAccessKey,
+		"secret_key":                  awsbase.MockStaticSecretKey,
+		"bucket":                      "bucket",
+		"key":                         "state",
+		"encrypt":                     true,
+		"sse_customer_key":            customerKey,
+		"skip_credentials_validation": true,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+	}
+
+	cfg := b.ResolvedConfig()
+	expected := map[string]any{
+		"bucket":                  "bucket",
+		"region":                  "eu-central-1",
+		"endpoint":                "https://s3.example.com",
+		"dynamodb_endpoint":       "https://dynamodb.eu-central-1.amazonaws.com",
+		"workspace_key_prefix":    "env:",
+		"max_retries":             5,
+		"lock_retry_max_attempts": 3,
+		"access_key":              redactedValue,
+		"secret_key":              redactedValue,
+		"sse_customer_key":        redactedValue,
+		"token":                   "",
+	}
+	for k, v := range expected {
+		if cfg[k] != v {
+			t.Errorf("expected %q to be %v, got %v", k, v, cfg[k])
+		}
+	}
+
+	dump := fmt.Sprint(cfg)
+	for _, secret := range []string{awsbase.MockStaticSecretKey, awsbase.MockStaticAccessKey, string(b.customerEncryptionKey), customerKey} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("resolved configuration contains a secret: %s", dump)
+		}
+	}
+}
+
+func TestBackend_ResolvedConfigSchema(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	// The credentials are resolved from the environment rather than
+	// configured, so they're not reported as configured.
+	os.Setenv("AWS_ACCESS_KEY_ID", awsbase.MockEnvAccessKey)
+	os.Setenv("AWS_SECRET_ACCESS_KEY", awsbase.MockEnvSecretKey)
+
+	b, diags := configureBackend(t, map[string]any{
+		"bucket":                      "bucket",
+		"key":                         "state",
+		"region":                      "us-west-2",
+		"skip_credentials_validation": true,
+		"credentials_source_priority": []any{"env"},
+		"max_redirects":               3,
+		"follow_redirects":            true,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+	}
+
+	cfg := b.ResolvedConfig()
+	schema := b.ConfigSchema()
+	for name := range schema.Attributes {
+		if _, ok := cfg[name]; !ok {
+			t.Errorf("expected the attribute %q to be reported", name)
+		}
+	}
+	for name := range schema.BlockTypes {
+		if _, ok := cfg[name]; !ok {
+			t.Errorf("expected the block %q to be reported", name)
+		}
+	}
+
+	for k, v := range map[string]any{
+		"access_key":       "",
+		"secret_key":       "",
+		"max_redirects":    3,
+		"follow_redirects": true,
+		"compress":         false,
+	} {
+		if cfg[k] != v {
+			t.Errorf("expected %q to be %v, got %v", k, v, cfg[k])
+		}
+	}
+	if got := fmt.Sprint(cfg["credentials_source_priority"]); got != "[env]" {
+		t.Errorf("expected credentials_source_priority [env], got %s", got)
+	}
+}
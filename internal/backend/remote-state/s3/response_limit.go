@@ -0,0 +1,65 @@
+package s3
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// limitResponseBody returns the body of a state read, failing once more than
+// max_response_bytes are read from it, if set. The Content-Length of the
+// response isn't trusted, since the endpoint may not be either, but a response
+// announcing a larger body fails before any of it is read.
+func (c *RemoteClient) limitResponseBody(output *s3.GetObjectOutput) io.Reader {
+	if c.maxResponseBytes <= 0 {
+		return output.Body
+	}
+	if aws.Int64Value(output.ContentLength) > c.maxResponseBytes {
+		return &errReader{err: c.responseTooLargeError()}
+	}
+	return &limitedReader{r: output.Body, remaining: c.maxResponseBytes, err: c.responseTooLargeError}
+}
+
+func (c *RemoteClient) responseTooLargeError() error {
+	return fmt.Errorf(errResponseTooLarge, c.path, c.maxResponseBytes)
+}
+
+// limitedReader reads up to remaining bytes from r, and fails with err if r
+// has more to read.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	err       func() error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, l.err()
+	}
+	// One more byte than allowed is read, to tell a body of exactly the
+	// maximum size from a larger one.
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return 0, l.err()
+	}
+	return n, err
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+const errResponseTooLarge = `the response reading state %q is larger than "max_response_bytes" (%d bytes).
+
+Check that the endpoint serves the expected state file, or raise
+"max_response_bytes" if the state has legitimately grown.`
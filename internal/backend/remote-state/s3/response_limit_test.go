@@ -0,0 +1,65 @@
+package s3
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRemoteClient_maxResponseBytes(t *testing.T) {
+	const state = `{"version": 4, "serial": 1}`
+
+	testCases := map[string]struct {
+		maxResponseBytes int64
+		chunked          bool
+		expectedErr      bool
+	}{
+		"unlimited": {},
+		"exactly the limit": {
+			maxResponseBytes: int64(len(state)),
+		},
+		"over the limit": {
+			maxResponseBytes: 10,
+			expectedErr:      true,
+		},
+		"over the limit without content length": {
+			maxResponseBytes: 10,
+			chunked:          true,
+			expectedErr:      true,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					if tc.chunked {
+						// Flushing before writing the body makes the server
+						// send it without a Content-Length.
+						w.WriteHeader(http.StatusOK)
+						w.(http.Flusher).Flush()
+					}
+					_, _ = w.Write([]byte(state))
+				}),
+				bucketName:       "bucket",
+				path:             "state",
+				maxResponseBytes: tc.maxResponseBytes,
+			}
+
+			payload, err := client.Get()
+			if tc.expectedErr {
+				if err == nil || !strings.Contains(err.Error(), `larger than "max_response_bytes"`) {
+					t.Fatalf("expected the response to be too large, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if string(payload.Data) != state {
+				t.Fatalf("expected state %s, got %s", state, payload.Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package s3
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Valid values of the retry_on attribute, each naming a class of errors.
+const (
+	retryOnServerError = "5xx"
+	retryOnThrottling  = "throttling"
+	retryOnTimeout     = "timeout"
+)
+
+// newRetryer returns the SDK's default retryer for the session's maximum
+// number of retries, with the delay between two retries capped at maxDelay
+// rather than the SDK's default of five minutes. A zero maxDelay keeps the
+// default.
+//
+// If retryOn lists any error classes, only errors of those classes are
+// retried.
+func newRetryer(sess *session.Session, maxDelay time.Duration, retryOn []string) request.Retryer {
+	maxRetries := aws.IntValue(sess.Config.MaxRetries)
+	if maxRetries == aws.UseServiceDefaultRetries {
+		maxRetries = client.DefaultRetryerMaxNumRetries
+	}
+
+	retryer := client.DefaultRetryer{
+		NumMaxRetries:    maxRetries,
+		MaxRetryDelay:    maxDelay,
+		MaxThrottleDelay: maxDelay,
+	}
+	if len(retryOn) == 0 {
+		return retryer
+	}
+
+	classes := make(map[string]bool, len(retryOn))
+	for _, class := range retryOn {
+		classes[class] = true
+	}
+	return classRetryer{
+		DefaultRetryer: retryer,
+		classes:        classes,
+	}
+}
+
+// classRetryer only retries the errors the default retryer would retry if
+// they belong to one of the selected classes.
+type classRetryer struct {
+	client.DefaultRetryer
+	classes map[string]bool
+}
+
+func (r classRetryer) ShouldRetry(req *request.Request) bool {
+	if !r.DefaultRetryer.ShouldRetry(req) {
+		return false
+	}
+
+	// Requests which failed without a response, such as those that timed
+	// out, are given a response with a zero status code by the SDK.
+	var status int
+	if req.HTTPResponse != nil {
+		status = req.HTTPResponse.StatusCode
+	}
+
+	switch {
+	case r.classes[retryOnThrottling] && req.IsErrorThrottle():
+		return true
+	case r.classes[retryOnServerError] && status >= 500:
+		return true
+	case r.classes[retryOnTimeout] && (status == 0 || isRequestTimeout(req)):
+		return true
+	}
+	return false
+}
+
+// isRequestTimeout reports whether the service closed the connection because
+// the request wasn't sent in time.
+func isRequestTimeout(req *request.Request) bool {
+	var awsErr awserr.Error
+	if !errors.As(req.Error, &awsErr) {
+		return false
+	}
+	return awsErr.Code() == "RequestTimeout" || awsErr.Code() == "RequestTimeoutException"
+}
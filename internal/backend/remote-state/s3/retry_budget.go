@@ -0,0 +1,92 @@
+package s3
+
+import (
+	"log"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// retryBudget is a token bucket bounding the retries of AWS API requests, for
+// retry_budget. Each retry takes a token, and each request which succeeds
+// returns one, so that throttling which persists across many concurrent
+// requests exhausts the budget instead of multiplying the retries, while
+// occasional failures don't use it up over a long run.
+type retryBudget struct {
+	mu       sync.Mutex
+	capacity int
+	tokens   int
+}
+
+// take takes a token for a retry, and reports whether there was one left.
+func (b *retryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens == 0 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refund returns a token after a request succeeded.
+func (b *retryBudget) refund() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < b.capacity {
+		b.tokens++
+	}
+}
+
+// retryBudgets holds the retry budgets of the process by their size, so that
+// all backends configured with the same retry_budget share a budget, like
+// the state operations of a run which read the state of other workspaces.
+var retryBudgets = struct {
+	sync.Mutex
+	budgets map[int]*retryBudget
+}{budgets: make(map[int]*retryBudget)}
+
+// sharedRetryBudget returns the retry budget of the process with the given
+// size.
+func sharedRetryBudget(size int) *retryBudget {
+	retryBudgets.Lock()
+	defer retryBudgets.Unlock()
+
+	budget, ok := retryBudgets.budgets[size]
+	if !ok {
+		budget = &retryBudget{capacity: size, tokens: size}
+		retryBudgets.budgets[size] = budget
+	}
+	return budget
+}
+
+// retryBudgetHandlers returns the handlers which make the retries of requests
+// take from the budget. The retry handler must run after all other retry
+// handlers, once it's decided whether the request is retried.
+func retryBudgetHandlers(budget *retryBudget) (retry, complete request.NamedHandler) {
+	retry = request.NamedHandler{
+		Name: "tofu.s3.RetryBudget",
+		Fn: func(r *request.Request) {
+			if r.Retryable == nil {
+				r.Retryable = aws.Bool(r.ShouldRetry(r))
+			}
+			if !r.WillRetry() || budget.take() {
+				return
+			}
+			log.Printf("[WARN] Not retrying %s/%s request, since the retry budget of %d retries is used up: %s", r.ClientInfo.ServiceName, r.Operation.Name, budget.capacity, r.Error)
+			r.Retryable = aws.Bool(false)
+		},
+	}
+	complete = request.NamedHandler{
+		Name: "tofu.s3.RetryBudgetRefund",
+		Fn: func(r *request.Request) {
+			if r.Error == nil {
+				budget.refund()
+			}
+		},
+	}
+	return retry, complete
+}
@@ -0,0 +1,81 @@
+package s3
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+)
+
+func TestBackendConfig_RetryBudget(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	var requests atomic.Int64
+	var failing atomic.Bool
+	failing.Store(true)
+	storage := newMockS3Storage()
+	storage.objects["bucket/key"] = &mockS3Object{body: []byte(`{"version": 4}`), header: http.Header{}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			writeS3Error(w, http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again.")
+			return
+		}
+		storage.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	newBackend := func() *Backend {
+		b, diags := configureBackend(t, map[string]any{
+			"access_key":                  awsbase.MockStaticAccessKey,
+			"secret_key":                  awsbase.MockStaticSecretKey,
+			"bucket":                      "bucket",
+			"key":                         "key",
+			"region":                      "us-west-2",
+			"endpoint":                    ts.URL,
+			"force_path_style":            true,
+			"max_retries":                 5,
+			"retry_budget":                3,
+			"skip_credentials_validation": true,
+		})
+		if diags.HasErrors() {
+			t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+		}
+		return b
+	}
+
+	// Operations of separate backends with the same budget share it.
+	for _, b := range []*Backend{newBackend(), newBackend()} {
+		for _, name := range []string{"default", "other"} {
+			client, err := b.remoteClient(name)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if _, err := client.Get(); err == nil {
+				t.Fatal("expected an error reading the state")
+			}
+		}
+	}
+
+	// One request per operation, and only 3 retries in total instead of 5
+	// per operation.
+	if got := requests.Load(); got != 4+3 {
+		t.Fatalf("expected %d requests, got %d", 4+3, got)
+	}
+
+	// A request which succeeds returns a token for a retry.
+	failing.Store(false)
+	client, err := newBackend().remoteClient("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := client.Get(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if budget := sharedRetryBudget(3); budget.tokens != 1 {
+		t.Fatalf("expected 1 token in the retry budget, got %d", budget.tokens)
+	}
+}
@@ -0,0 +1,193 @@
+package s3
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+)
+
+func TestBackendConfig_MaxRetryDelay(t *testing.T) {
+	testCases := map[string]struct {
+		config             map[string]any
+		expectedMaxRetries int
+		expectedMaxDelay   time.Duration
+	}{
+		"default": {
+			config:             map[string]any{},
+			expectedMaxRetries: 5,
+			expectedMaxDelay:   client.DefaultRetryerMaxRetryDelay,
+		},
+		"configured": {
+			config: map[string]any{
+				"max_retries":     7,
+				"max_retry_delay": 10,
+			},
+			expectedMaxRetries: 7,
+			expectedMaxDelay:   10 * time.Second,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			config := map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         "state",
+				"region":                      "us-west-2",
+				"skip_credentials_validation": true,
+			}
+			for k, v := range tc.config {
+				config[k] = v
+			}
+
+			b, diags := configureBackend(t, config)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+			}
+
+			for name, c := range map[string]*client.Client{"S3": b.s3Client.Client, "DynamoDB": b.dynClient.Client} {
+				retryer, ok := c.Retryer.(client.DefaultRetryer)
+				if !ok {
+					t.Fatalf("unexpected %s retryer type %T", name, c.Retryer)
+				}
+				if retryer.NumMaxRetries != tc.expectedMaxRetries {
+					t.Errorf("expected %s max retries %d, got %d", name, tc.expectedMaxRetries, retryer.NumMaxRetries)
+				}
+				// An unset delay means the SDK's default cap.
+				maxDelay := retryer.MaxRetryDelay
+				if maxDelay == 0 {
+					maxDelay = client.DefaultRetryerMaxRetryDelay
+				}
+				if maxDelay != tc.expectedMaxDelay {
+					t.Errorf("expected %s max retry delay %s, got %s", name, tc.expectedMaxDelay, maxDelay)
+				}
+			}
+		})
+	}
+}
+
+func TestClassRetryer(t *testing.T) {
+	errs := map[string]*request.Request{
+		"server error": {
+			Error:        awserr.New("InternalError", "We encountered an internal error", nil),
+			HTTPResponse: &http.Response{StatusCode: http.StatusInternalServerError},
+		},
+		"throttling": {
+			Error:        awserr.New("ThrottlingException", "Rate exceeded", nil),
+			HTTPResponse: &http.Response{StatusCode: http.StatusBadRequest},
+		},
+		"connection timeout": {
+			Error:        awserr.New(request.ErrCodeRequestError, "send request failed", timeoutError{}),
+			HTTPResponse: &http.Response{},
+		},
+		"request timeout": {
+			Error:        awserr.New("RequestTimeout", "Your socket connection to the server was not read from or written to within the timeout period", nil),
+			HTTPResponse: &http.Response{StatusCode: http.StatusBadRequest},
+		},
+		"access denied": {
+			Error:        awserr.New("AccessDenied", "Access Denied", nil),
+			HTTPResponse: &http.Response{StatusCode: http.StatusForbidden},
+		},
+	}
+
+	testCases := map[string]struct {
+		retryOn  []string
+		expected map[string]bool
+	}{
+		"5xx": {
+			retryOn: []string{retryOnServerError},
+			expected: map[string]bool{
+				"server error": true,
+			},
+		},
+		"throttling": {
+			retryOn: []string{retryOnThrottling},
+			expected: map[string]bool{
+				"throttling": true,
+			},
+		},
+		"timeout": {
+			retryOn: []string{retryOnTimeout},
+			expected: map[string]bool{
+				"connection timeout": true,
+				"request timeout":    true,
+			},
+		},
+		"all": {
+			retryOn: []string{retryOnServerError, retryOnThrottling, retryOnTimeout},
+			expected: map[string]bool{
+				"server error":       true,
+				"throttling":         true,
+				"connection timeout": true,
+				"request timeout":    true,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			retryer := classRetryer{
+				DefaultRetryer: client.DefaultRetryer{NumMaxRetries: 3},
+				classes:        map[string]bool{},
+			}
+			for _, class := range tc.retryOn {
+				retryer.classes[class] = true
+			}
+
+			for errName, req := range errs {
+				if actual := retryer.ShouldRetry(req); actual != tc.expected[errName] {
+					t.Errorf("expected retry of %s to be %t, got %t", errName, tc.expected[errName], actual)
+				}
+			}
+		})
+	}
+}
+
+func TestBackendConfig_RetryOn(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	b, diags := configureBackend(t, map[string]any{
+		"access_key":                  awsbase.MockStaticAccessKey,
+		"secret_key":                  awsbase.MockStaticSecretKey,
+		"bucket":                      "bucket",
+		"key":                         "state",
+		"region":                      "us-west-2",
+		"skip_credentials_validation": true,
+		"retry_on":                    []any{retryOnServerError},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+	}
+
+	for name, c := range map[string]*client.Client{"S3": b.s3Client.Client, "DynamoDB": b.dynClient.Client} {
+		retryer, ok := c.Retryer.(classRetryer)
+		if !ok {
+			t.Fatalf("unexpected %s retryer type %T", name, c.Retryer)
+		}
+		if !retryer.classes[retryOnServerError] || len(retryer.classes) != 1 {
+			t.Errorf("unexpected %s retry classes %v", name, retryer.classes)
+		}
+		if retryer.NumMaxRetries != 5 {
+			t.Errorf("expected %s max retries %d, got %d", name, 5, retryer.NumMaxRetries)
+		}
+	}
+}
+
+// timeoutError is a network error which timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
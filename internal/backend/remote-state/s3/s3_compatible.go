@@ -0,0 +1,55 @@
+package s3
+
+import (
+	"github.com/opentofu/opentofu/internal/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// s3CompatibleAttr returns the value of a bool attribute which s3_compatible
+// turns on unless it's set explicitly. These are force_path_style and the
+// skip_* attributes, since S3-compatible stores such as MinIO address buckets
+// by path, and have neither the STS API, the instance metadata service nor
+// AWS region names.
+func s3CompatibleAttr(obj cty.Value, name string) bool {
+	if v, ok := boolAttrOk(obj, name); ok {
+		return v
+	}
+	return boolAttr(obj, "s3_compatible")
+}
+
+// validateS3Compatible checks that the settings overriding s3_compatible
+// can work with an S3-compatible store.
+func validateS3Compatible(obj cty.Value) (diags tfdiags.Diagnostics) {
+	if !boolAttr(obj, "s3_compatible") {
+		return diags
+	}
+
+	if stringAttrDefaultEnvVar(obj, "endpoint", "AWS_S3_ENDPOINT") == "" {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Missing endpoint value",
+			`The "s3_compatible" attribute requires the "endpoint" of the S3-compatible store to be set, either with the "endpoint" attribute or the environment variable "AWS_S3_ENDPOINT".`,
+			cty.Path{cty.GetAttrStep{Name: "endpoint"}},
+		))
+	}
+
+	if v, ok := boolAttrOk(obj, "skip_credentials_validation"); ok && !v && stringAttrDefaultEnvVar(obj, "sts_endpoint", "AWS_STS_ENDPOINT") == "" {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid skip_credentials_validation value",
+			`Credentials are validated with the STS API, which S3-compatible stores don't provide. Set "sts_endpoint" to an STS-compatible endpoint to validate credentials with "s3_compatible".`,
+			cty.Path{cty.GetAttrStep{Name: "skip_credentials_validation"}},
+		))
+	}
+
+	if stringAttr(obj, "dynamodb_table") != "" && stringAttrDefaultEnvVar(obj, "dynamodb_endpoint", "AWS_DYNAMODB_ENDPOINT") == "" {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Warning,
+			"DynamoDB table on AWS",
+			`The "s3_compatible" attribute is set, but "dynamodb_table" is locked with DynamoDB on AWS since "dynamodb_endpoint" is not set. Set "dynamodb_endpoint" if the stack provides a DynamoDB-compatible service.`,
+			cty.Path{cty.GetAttrStep{Name: "dynamodb_table"}},
+		))
+	}
+
+	return diags
+}
@@ -0,0 +1,95 @@
+package s3
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestBackendConfig_S3Compatible(t *testing.T) {
+	testCases := map[string]struct {
+		config                 map[string]any
+		expectedPathStyle      bool
+		expectedSkipValidation bool
+		expectedSkipMetadata   bool
+	}{
+		"preset": {
+			config: map[string]any{
+				"s3_compatible": true,
+			},
+			expectedPathStyle:      true,
+			expectedSkipValidation: true,
+			expectedSkipMetadata:   true,
+		},
+		"override": {
+			config: map[string]any{
+				"s3_compatible":    true,
+				"force_path_style": false,
+			},
+			expectedSkipValidation: true,
+			expectedSkipMetadata:   true,
+		},
+		"without preset": {
+			config: map[string]any{
+				"skip_credentials_validation": true,
+				"skip_region_validation":      true,
+			},
+			expectedSkipValidation: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			ts := httptest.NewServer(newMockS3Storage())
+			defer ts.Close()
+
+			config := map[string]any{
+				"access_key": awsbase.MockStaticAccessKey,
+				"secret_key": awsbase.MockStaticSecretKey,
+				"bucket":     "bucket",
+				"key":        "key",
+				// Not an AWS region, as is common with S3-compatible stores.
+				"region":   "minio",
+				"endpoint": ts.URL,
+			}
+			for k, v := range tc.config {
+				config[k] = v
+			}
+
+			b, diags := configureBackend(t, config)
+			if len(diags) != 0 {
+				t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+			}
+
+			if got := aws.BoolValue(b.s3Client.Config.S3ForcePathStyle); got != tc.expectedPathStyle {
+				t.Fatalf("expected force_path_style %t, got %t", tc.expectedPathStyle, got)
+			}
+			if b.awsConfig.SkipCredsValidation != tc.expectedSkipValidation || b.awsConfig.SkipMetadataApiCheck != tc.expectedSkipMetadata {
+				t.Fatalf("unexpected validation settings: skip_credentials_validation %t, skip_metadata_api_check %t", b.awsConfig.SkipCredsValidation, b.awsConfig.SkipMetadataApiCheck)
+			}
+		})
+	}
+}
+
+func TestBackendConfig_S3CompatibleDynamoDBTable(t *testing.T) {
+	b := New()
+	_, diags := b.PrepareConfig(populateSchema(t, b.ConfigSchema(), cty.ObjectVal(map[string]cty.Value{
+		"bucket":         cty.StringVal("bucket"),
+		"key":            cty.StringVal("key"),
+		"region":         cty.StringVal("minio"),
+		"endpoint":       cty.StringVal("https://minio.example.com"),
+		"s3_compatible":  cty.True,
+		"dynamodb_table": cty.StringVal("locks"),
+	})))
+	if len(diags) != 1 || diags[0].Severity() != tfdiags.Warning || diags[0].Description().Summary != "DynamoDB table on AWS" {
+		t.Fatalf("expected a warning about the DynamoDB table, got: %s", diagnosticsString(diags))
+	}
+}
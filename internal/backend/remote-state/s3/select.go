@@ -0,0 +1,342 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// QueryState returns the values at the paths selected by expression from the
+// state, in the order they are selected, with null for paths which don't
+// exist in the state.
+//
+// The values are extracted by S3 Select where possible, to avoid downloading
+// large states. The state is downloaded and queried locally instead if it's
+// compressed, sharded or encrypted client-side, or if the store doesn't
+// support S3 Select, so that the result is the same either way.
+//
+// Only a subset of the S3 Select SQL is supported, which is a projection of
+// paths from the state document:
+//
+//	SELECT s.serial, s.outputs."vpc-id".value, s.resources[0].type FROM S3Object s
+//
+// Each path starts with the alias of S3Object, followed by attribute names and
+// array indices. Attribute names are matched exactly, and must be quoted if
+// they aren't plain identifiers. Filtering with WHERE, functions and wildcards
+// aren't supported.
+func (c *RemoteClient) QueryState(ctx context.Context, expression string) ([]json.RawMessage, error) {
+	query, err := parseStateQuery(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.compress && !c.shardedState && c.clientSideEncryptionKMSKeyID == "" {
+		values, err := c.selectState(ctx, query)
+		if err == nil || !isSelectUnsupported(err) {
+			return values, err
+		}
+		log.Printf("[DEBUG] S3 Select isn't supported for state %q, querying it locally: %s", c.path, err)
+	}
+
+	payload, err := c.Get()
+	if err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		return nil, fmt.Errorf("state %q not found", c.path)
+	}
+	return query.evaluate(payload.Data)
+}
+
+// selectState runs the query on the state object with S3 Select, following
+// the pointer if key_is_pointer is set.
+func (c *RemoteClient) selectState(ctx context.Context, query *stateQuery) ([]json.RawMessage, error) {
+	key, err := c.resolveStateKey()
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, fmt.Errorf("state %q not found", c.path)
+	}
+
+	input := &s3.SelectObjectContentInput{
+		Bucket:         &c.bucketName,
+		Key:            &key,
+		Expression:     aws.String(query.sql()),
+		ExpressionType: aws.String(s3.ExpressionTypeSql),
+		InputSerialization: &s3.InputSerialization{
+			JSON: &s3.JSONInput{Type: aws.String(s3.JSONTypeDocument)},
+		},
+		OutputSerialization: &s3.OutputSerialization{
+			JSON: &s3.JSONOutput{},
+		},
+	}
+	if c.serverSideEncryption && c.customerEncryptionKey != nil {
+		input.SetSSECustomerKey(string(c.customerEncryptionKey))
+		input.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		input.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+	}
+
+	output, err := c.readClient().SelectObjectContentWithContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	defer output.EventStream.Close()
+
+	var records bytes.Buffer
+	for event := range output.EventStream.Events() {
+		if e, ok := event.(*s3.RecordsEvent); ok {
+			records.Write(e.Payload)
+		}
+	}
+	if err := output.EventStream.Err(); err != nil {
+		return nil, err
+	}
+
+	// The state is a single document, so there is a single record.
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(bytes.TrimSpace(records.Bytes()), &record); err != nil {
+		return nil, fmt.Errorf("failed to decode S3 Select result: %w", err)
+	}
+
+	values := make([]json.RawMessage, len(query.paths))
+	for i := range query.paths {
+		if v, ok := record[selectColumn(i)]; ok {
+			values[i] = v
+		} else {
+			values[i] = json.RawMessage("null")
+		}
+	}
+	return values, nil
+}
+
+// isSelectUnsupported reports whether err means the store doesn't support S3
+// Select, which S3-compatible stores report in various ways.
+func isSelectUnsupported(err error) bool {
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) {
+		return false
+	}
+	switch reqErr.StatusCode() {
+	case http.StatusNotImplemented, http.StatusMethodNotAllowed:
+		return true
+	}
+	switch reqErr.Code() {
+	case "NotImplemented", "MethodNotAllowed", "XNotImplemented":
+		return true
+	}
+	return false
+}
+
+// stateQuery is a query parsed from the subset of S3 Select SQL supported by
+// QueryState.
+type stateQuery struct {
+	paths [][]statePathStep
+}
+
+// statePathStep is either an attribute name or an array index of a path.
+type statePathStep struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+// parseStateQuery parses an expression of the form
+// "SELECT <path>, ... FROM S3Object <alias>".
+func parseStateQuery(expression string) (*stateQuery, error) {
+	expr := strings.TrimSpace(expression)
+	if len(expr) < len("SELECT ") || !strings.EqualFold(expr[:len("SELECT ")], "SELECT ") {
+		return nil, fmt.Errorf("invalid state query %q: must start with SELECT", expression)
+	}
+	expr = expr[len("SELECT "):]
+
+	from := strings.LastIndex(strings.ToUpper(expr), " FROM ")
+	if from < 0 {
+		return nil, fmt.Errorf("invalid state query %q: missing FROM clause", expression)
+	}
+	source := strings.Fields(expr[from+len(" FROM "):])
+	if len(source) == 3 && strings.EqualFold(source[1], "AS") {
+		source = []string{source[0], source[2]}
+	}
+	if len(source) != 2 || !strings.EqualFold(source[0], "S3Object") || !isPlainIdentifier(source[1]) {
+		return nil, fmt.Errorf(`invalid state query %q: the FROM clause must be "FROM S3Object <alias>"`, expression)
+	}
+	alias := source[1]
+
+	query := &stateQuery{}
+	for _, field := range splitSelectList(expr[:from]) {
+		path, err := parseStatePath(strings.TrimSpace(field), alias)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state query %q: %w", expression, err)
+		}
+		query.paths = append(query.paths, path)
+	}
+	return query, nil
+}
+
+// splitSelectList splits the selected paths at the commas outside of quoted
+// attribute names.
+func splitSelectList(s string) []string {
+	var fields []string
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			fields = append(fields, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, s[start:])
+}
+
+// parseStatePath parses a path starting with the alias of S3Object.
+func parseStatePath(s string, alias string) ([]statePathStep, error) {
+	name, rest, ok := strings.Cut(s, ".")
+	if !ok || !strings.EqualFold(name, alias) {
+		return nil, fmt.Errorf("the path %q must start with %q", s, alias+".")
+	}
+	rest = "." + rest
+
+	var path []statePathStep
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, `."`):
+			// Quotes within quoted names are escaped by doubling them.
+			var name strings.Builder
+			i := 2
+			for ; i < len(rest); i++ {
+				if rest[i] != '"' {
+					name.WriteByte(rest[i])
+					continue
+				}
+				if i+1 < len(rest) && rest[i+1] == '"' {
+					name.WriteByte('"')
+					i++
+					continue
+				}
+				break
+			}
+			if i >= len(rest) {
+				return nil, fmt.Errorf("unterminated quoted name in the path %q", s)
+			}
+			path = append(path, statePathStep{name: name.String()})
+			rest = rest[i+1:]
+
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if !isPlainIdentifier(name) {
+				return nil, fmt.Errorf("invalid name %q in the path %q; names which aren't plain identifiers must be quoted", name, s)
+			}
+			path = append(path, statePathStep{name: name})
+			rest = rest[end+1:]
+
+		case strings.HasPrefix(rest, "["):
+			digits, tail, ok := strings.Cut(rest[1:], "]")
+			index, err := strconv.Atoi(digits)
+			if !ok || err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid array index in the path %q", s)
+			}
+			path = append(path, statePathStep{index: index, isIndex: true})
+			rest = tail
+
+		default:
+			return nil, fmt.Errorf("unexpected %q in the path %q", rest, s)
+		}
+	}
+	return path, nil
+}
+
+func isPlainIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case '0' <= r && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// sql returns the S3 Select expression of the query. Names are always quoted,
+// so that they are matched exactly as when the query is evaluated locally, and
+// each path is selected as a numbered column, so that the results can be
+// told apart whatever their names.
+func (q *stateQuery) sql() string {
+	columns := make([]string, len(q.paths))
+	for i, path := range q.paths {
+		var b strings.Builder
+		b.WriteString("s")
+		for _, step := range path {
+			if step.isIndex {
+				fmt.Fprintf(&b, "[%d]", step.index)
+			} else {
+				fmt.Fprintf(&b, `."%s"`, strings.ReplaceAll(step.name, `"`, `""`))
+			}
+		}
+		columns[i] = b.String() + " AS " + selectColumn(i)
+	}
+	return "SELECT " + strings.Join(columns, ", ") + " FROM S3Object s"
+}
+
+func selectColumn(i int) string {
+	return "c" + strconv.Itoa(i)
+}
+
+// evaluate runs the query on the given state.
+func (q *stateQuery) evaluate(data []byte) ([]json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var state any
+	if err := decoder.Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to decode state: %w", err)
+	}
+
+	values := make([]json.RawMessage, len(q.paths))
+	for i, path := range q.paths {
+		v := state
+		for _, step := range path {
+			switch node := v.(type) {
+			case map[string]any:
+				v = nil
+				if !step.isIndex {
+					v = node[step.name]
+				}
+			case []any:
+				v = nil
+				if step.isIndex && step.index < len(node) {
+					v = node[step.index]
+				}
+			default:
+				v = nil
+			}
+		}
+
+		value, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,233 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/private/protocol/eventstream"
+)
+
+const testQueryState = `{
+  "version": 4,
+  "serial": 7,
+  "lineage": "5d2a4b8c-1f3e-4a6b-9c7d-8e9f0a1b2c3d",
+  "outputs": {"vpc-id": {"value": "vpc-123", "type": "string"}},
+  "resources": [{"type": "aws_vpc", "name": "main"}]
+}`
+
+const testQueryExpression = `SELECT s.serial, s.outputs."vpc-id".value, s.resources[0].type, s.missing FROM S3Object s`
+
+func TestRemoteClient_QueryState(t *testing.T) {
+	expected := []string{`7`, `"vpc-123"`, `"aws_vpc"`, `null`}
+
+	testCases := map[string]struct {
+		compress       bool
+		selectResponse func(w http.ResponseWriter)
+		expectSelect   bool
+	}{
+		"S3 Select": {
+			selectResponse: func(w http.ResponseWriter) {
+				writeSelectEvents(t, w, `{"c0":7,"c1":"vpc-123","c2":"aws_vpc"}`+"\n")
+			},
+			expectSelect: true,
+		},
+		"S3 Select not implemented": {
+			selectResponse: func(w http.ResponseWriter) {
+				writeS3Error(w, http.StatusNotImplemented, "NotImplemented", "A header you provided implies functionality that is not implemented")
+			},
+			expectSelect: true,
+		},
+		"compressed": {
+			compress: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			var selectExpression string
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					if _, ok := r.URL.Query()["select"]; ok && r.Method == http.MethodPost {
+						var input struct {
+							Expression string
+						}
+						if err := xml.NewDecoder(r.Body).Decode(&input); err != nil {
+							t.Errorf("decoding select request: %s", err)
+						}
+						selectExpression = input.Expression
+						tc.selectResponse(w)
+						return
+					}
+					storage.ServeHTTP(w, r)
+				}),
+				bucketName: "bucket",
+				path:       "state",
+				compress:   tc.compress,
+			}
+			if err := client.Put([]byte(testQueryState)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			values, err := client.QueryState(context.Background(), testQueryExpression)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if tc.expectSelect {
+				if e := `SELECT s."serial" AS c0, s."outputs"."vpc-id"."value" AS c1, s."resources"[0]."type" AS c2, s."missing" AS c3 FROM S3Object s`; selectExpression != e {
+					t.Errorf("expected S3 Select expression %q, got %q", e, selectExpression)
+				}
+			} else if selectExpression != "" {
+				t.Errorf("expected no S3 Select request, got %q", selectExpression)
+			}
+
+			if len(values) != len(expected) {
+				t.Fatalf("expected %d values, got %d", len(expected), len(values))
+			}
+			for i, v := range values {
+				if string(v) != expected[i] {
+					t.Errorf("expected value %d to be %s, got %s", i, expected[i], v)
+				}
+			}
+		})
+	}
+}
+
+func TestParseStateQuery(t *testing.T) {
+	testCases := map[string]struct {
+		expression  string
+		expectedSQL string
+		expectedErr string
+	}{
+		"paths": {
+			expression:  `select doc.a, doc."b.c"[2]."d""e" from s3object doc`,
+			expectedSQL: `SELECT s."a" AS c0, s."b.c"[2]."d""e" AS c1 FROM S3Object s`,
+		},
+		"AS alias": {
+			expression:  `SELECT s.a FROM S3Object AS s`,
+			expectedSQL: `SELECT s."a" AS c0 FROM S3Object s`,
+		},
+		"no SELECT": {
+			expression:  `s.a FROM S3Object s`,
+			expectedErr: "must start with SELECT",
+		},
+		"no FROM": {
+			expression:  `SELECT s.a`,
+			expectedErr: "missing FROM clause",
+		},
+		"other source": {
+			expression:  `SELECT s.a FROM S3Object[*] s`,
+			expectedErr: `the FROM clause must be "FROM S3Object <alias>"`,
+		},
+		"WHERE clause": {
+			expression:  `SELECT s.a FROM S3Object s WHERE s.b = 1`,
+			expectedErr: `the FROM clause must be "FROM S3Object <alias>"`,
+		},
+		"other alias": {
+			expression:  `SELECT t.a FROM S3Object s`,
+			expectedErr: `the path "t.a" must start with "s."`,
+		},
+		"wildcard": {
+			expression:  `SELECT s.* FROM S3Object s`,
+			expectedErr: `invalid name "*"`,
+		},
+		"unquoted name": {
+			expression:  `SELECT s.vpc-id FROM S3Object s`,
+			expectedErr: `names which aren't plain identifiers must be quoted`,
+		},
+		"unterminated quote": {
+			expression:  `SELECT s."a FROM S3Object s`,
+			expectedErr: "unterminated quoted name",
+		},
+		"invalid index": {
+			expression:  `SELECT s.a[x] FROM S3Object s`,
+			expectedErr: "invalid array index",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			query, err := parseStateQuery(tc.expression)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if sql := query.sql(); sql != tc.expectedSQL {
+				t.Errorf("expected SQL %q, got %q", tc.expectedSQL, sql)
+			}
+		})
+	}
+}
+
+// writeSelectEvents writes an S3 Select response holding the given records.
+func writeSelectEvents(t *testing.T, w http.ResponseWriter, records string) {
+	var body bytes.Buffer
+	encoder := eventstream.NewEncoder(&body)
+	for _, event := range []struct {
+		eventType string
+		payload   []byte
+	}{
+		{"Records", []byte(records)},
+		{"End", nil},
+	} {
+		var headers eventstream.Headers
+		headers.Set(":message-type", eventstream.StringValue("event"))
+		headers.Set(":event-type", eventstream.StringValue(event.eventType))
+		if event.payload != nil {
+			headers.Set(":content-type", eventstream.StringValue("application/octet-stream"))
+		}
+		if err := encoder.Encode(eventstream.Message{Headers: headers, Payload: event.payload}); err != nil {
+			t.Fatalf("encoding event: %s", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(body.Bytes())
+}
+
+func TestRemoteClient_QueryStateKeyIsPointer(t *testing.T) {
+	storage := newMockS3Storage()
+	storage.objects["bucket/state"] = &mockS3Object{body: []byte("versions/1\n"), header: http.Header{}}
+	storage.objects["bucket/versions/1"] = &mockS3Object{body: []byte(testQueryState), header: http.Header{}}
+
+	var selectPath string
+	client := &RemoteClient{
+		s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.URL.Query()["select"]; ok && r.Method == http.MethodPost {
+				selectPath = r.URL.Path
+				writeSelectEvents(t, w, `{"c0":7,"c1":"vpc-123","c2":"aws_vpc"}`+"\n")
+				return
+			}
+			storage.ServeHTTP(w, r)
+		}),
+		bucketName:   "bucket",
+		path:         "state",
+		keyIsPointer: true,
+	}
+
+	values, err := client.QueryState(context.Background(), testQueryExpression)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if selectPath != "/bucket/versions/1" {
+		t.Fatalf("expected S3 Select to query the state the pointer refers to, got %q", selectPath)
+	}
+	if len(values) == 0 || string(values[0]) != "7" {
+		t.Fatalf("unexpected values %s", values)
+	}
+	if client.path != "state" {
+		t.Fatalf("expected the client to keep the pointer path, got %q", client.path)
+	}
+}
@@ -0,0 +1,174 @@
+package s3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// stateSerialSuffix is the suffix of the DynamoDB item recording the serial of
+// the last state written when check_serial is set.
+const stateSerialSuffix = "-serial"
+
+// stateSerialAttribute is the attribute of the serial item holding the serial.
+const stateSerialAttribute = "StateSerial"
+
+// stateSerial returns the serial of the state in data, or nil if it has none.
+func stateSerial(data []byte) *uint64 {
+	var state struct {
+		Serial *uint64 `json:"serial"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil
+	}
+	return state.Serial
+}
+
+// advanceSerial records serial as the serial of the state, unless another
+// writer advanced the recorded serial since the state was read by this client.
+//
+// S3 uploads can't be part of a DynamoDB transaction, so the serial is
+// advanced before the state is uploaded, and reverted with revertSerial if the
+// upload fails. A writer which read the state before the serial was advanced
+// fails to advance it in turn, rather than overwriting the newer state.
+func (c *RemoteClient) advanceSerial(serial uint64) error {
+	input := &dynamodb.UpdateItemInput{
+		Key:              c.serialItemKey(),
+		TableName:        aws.String(c.ddbTable),
+		UpdateExpression: aws.String("SET " + stateSerialAttribute + " = :serial"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":serial": serialAttributeValue(serial),
+		},
+	}
+	if c.readSerial == nil {
+		input.ConditionExpression = aws.String("attribute_not_exists(LockID)")
+	} else {
+		// States written before check_serial was set have no serial item.
+		input.ConditionExpression = aws.String("attribute_not_exists(LockID) OR " + stateSerialAttribute + " = :expected")
+		input.ExpressionAttributeValues[":expected"] = serialAttributeValue(*c.readSerial)
+	}
+
+	_, err := c.dynClient.UpdateItem(input)
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) || awsErr.Code() != dynamodb.ErrCodeConditionalCheckFailedException {
+		return err
+	}
+
+	expected := "absent"
+	if c.readSerial != nil {
+		expected = strconv.FormatUint(*c.readSerial, 10)
+	}
+	current, getErr := c.recordedSerial()
+	if getErr != nil {
+		current = fmt.Sprintf("unknown (%s)", getErr)
+	}
+	return fmt.Errorf(errStateSerialConflict, c.path, expected, current)
+}
+
+// revertSerial reverts the recorded serial after a failed upload of the state
+// with the given serial, so that the write can be retried.
+func (c *RemoteClient) revertSerial(serial uint64) {
+	var err error
+	if c.readSerial == nil {
+		_, err = c.dynClient.DeleteItem(&dynamodb.DeleteItemInput{
+			Key:                 c.serialItemKey(),
+			TableName:           aws.String(c.ddbTable),
+			ConditionExpression: aws.String(stateSerialAttribute + " = :serial"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":serial": serialAttributeValue(serial),
+			},
+		})
+	} else {
+		_, err = c.dynClient.UpdateItem(&dynamodb.UpdateItemInput{
+			Key:                 c.serialItemKey(),
+			TableName:           aws.String(c.ddbTable),
+			UpdateExpression:    aws.String("SET " + stateSerialAttribute + " = :expected"),
+			ConditionExpression: aws.String(stateSerialAttribute + " = :serial"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":serial":   serialAttributeValue(serial),
+				":expected": serialAttributeValue(*c.readSerial),
+			},
+		})
+	}
+	if err != nil {
+		log.Printf("[WARN] Failed to revert the recorded serial of state %q after a failed upload: %s", c.path, err)
+	}
+}
+
+// recordedSerial returns the recorded serial of the state, for reporting.
+func (c *RemoteClient) recordedSerial() (string, error) {
+	v, err := c.getSerialAttribute()
+	if err != nil {
+		return "", err
+	}
+	if v == nil {
+		return "absent", nil
+	}
+	return *v.N, nil
+}
+
+// readRecordedSerial takes the recorded serial of the state as the serial last
+// read by the client, for a write which replaces the state without reading it,
+// such as recovering it from its backup. The state must be locked.
+func (c *RemoteClient) readRecordedSerial() error {
+	v, err := c.getSerialAttribute()
+	if err != nil {
+		return fmt.Errorf("failed to read the recorded serial of state %q: %w", c.path, err)
+	}
+	c.readSerial = nil
+	if v != nil {
+		serial, err := strconv.ParseUint(*v.N, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid recorded serial %q of state %q: %w", *v.N, c.path, err)
+		}
+		c.readSerial = &serial
+	}
+	return nil
+}
+
+// getSerialAttribute returns the attribute holding the recorded serial of the
+// state, or nil if no serial is recorded.
+func (c *RemoteClient) getSerialAttribute() (*dynamodb.AttributeValue, error) {
+	resp, err := c.dynClient.GetItem(&dynamodb.GetItemInput{
+		Key:            c.serialItemKey(),
+		TableName:      aws.String(c.ddbTable),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := resp.Item[stateSerialAttribute]; ok && v.N != nil {
+		return v, nil
+	}
+	return nil, nil
+}
+
+func (c *RemoteClient) deleteSerial() error {
+	_, err := c.dynClient.DeleteItem(&dynamodb.DeleteItemInput{
+		Key:       c.serialItemKey(),
+		TableName: aws.String(c.ddbTable),
+	})
+	return err
+}
+
+func (c *RemoteClient) serialItemKey() map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"LockID": {S: aws.String(c.lockPath() + stateSerialSuffix)},
+	}
+}
+
+func serialAttributeValue(serial uint64) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatUint(serial, 10))}
+}
+
+const errStateSerialConflict = `State %q was changed by another process since it was read.
+
+The serial of the state was expected to be %s, but is %s. The state was not
+written, so that the changes of the other process are not lost. Run the
+operation again to work from the latest state.`
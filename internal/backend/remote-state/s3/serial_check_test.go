@@ -0,0 +1,156 @@
+package s3
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// mockSerialTable is a DynamoDB table for the items written by check_serial,
+// evaluating only the conditions they are written with.
+type mockSerialTable struct {
+	items map[string]map[string]map[string]string
+}
+
+func (m *mockSerialTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Key                       map[string]map[string]string
+		Item                      map[string]map[string]string
+		ConditionExpression       string
+		UpdateExpression          string
+		ExpressionAttributeValues map[string]map[string]string
+	}
+	_ = json.NewDecoder(r.Body).Decode(&input)
+
+	id := input.Key["LockID"]["S"]
+	if input.Item != nil {
+		id = input.Item["LockID"]["S"]
+	}
+	item, exists := m.items[id]
+
+	// The serial item is only ever written on the conditions that it doesn't
+	// exist or has the expected serial.
+	if cond := input.ConditionExpression; cond != "" {
+		ok := strings.Contains(cond, "attribute_not_exists(LockID)") && !exists
+		for _, name := range []string{":expected", ":serial"} {
+			if strings.Contains(cond, "= "+name) && exists && item[stateSerialAttribute]["N"] == input.ExpressionAttributeValues[name]["N"] {
+				ok = true
+			}
+		}
+		if !ok {
+			writeDynamoDBError(w, dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed")
+			return
+		}
+	}
+
+	switch dynamoDBOperation(r) {
+	case "GetItem":
+		writeDynamoDBResponse(w, map[string]any{"Item": item})
+		return
+	case "PutItem":
+		m.items[id] = input.Item
+	case "UpdateItem":
+		_, name, _ := strings.Cut(input.UpdateExpression, " = ")
+		m.items[id] = map[string]map[string]string{
+			"LockID":             {"S": id},
+			stateSerialAttribute: input.ExpressionAttributeValues[name],
+		}
+	case "DeleteItem":
+		delete(m.items, id)
+	}
+	writeDynamoDBResponse(w, map[string]any{})
+}
+
+func TestRemoteClient_checkSerial(t *testing.T) {
+	storage := newMockS3Storage()
+	table := &mockSerialTable{items: make(map[string]map[string]map[string]string)}
+	newClient := func() *RemoteClient {
+		return &RemoteClient{
+			s3Client:    mockS3Client(t, storage.ServeHTTP),
+			dynClient:   mockDynamoDBClient(t, table.ServeHTTP),
+			bucketName:  "bucket",
+			path:        "state",
+			ddbTable:    "table",
+			checkSerial: true,
+		}
+	}
+	first, second := newClient(), newClient()
+
+	for _, c := range []*RemoteClient{first, second} {
+		if _, err := c.Get(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if err := first.Put([]byte(`{"version": 4, "serial": 1}`)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := first.Put([]byte(`{"version": 4, "serial": 2}`)); err != nil {
+		t.Fatalf("unexpected error writing after own write: %s", err)
+	}
+
+	// The second client read the state before the first one wrote it.
+	err := second.Put([]byte(`{"version": 4, "serial": 1}`))
+	if err == nil {
+		t.Fatal("expected a conflict, got none")
+	}
+	if expected := "The serial of the state was expected to be absent, but is 2."; !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected error containing %q, got: %s", expected, err)
+	}
+	payload, err := second.Get()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if serial := stateSerial(payload.Data); serial == nil || *serial != 2 {
+		t.Fatalf("expected the state of the first client to be kept, got: %s", payload.Data)
+	}
+
+	if err := second.Put([]byte(`{"version": 4, "serial": 3}`)); err != nil {
+		t.Fatalf("unexpected error writing after reading the latest state: %s", err)
+	}
+	err = first.Put([]byte(`{"version": 4, "serial": 3}`))
+	if err == nil {
+		t.Fatal("expected a conflict, got none")
+	}
+	if expected := "The serial of the state was expected to be 2, but is 3."; !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected error containing %q, got: %s", expected, err)
+	}
+}
+
+func TestRemoteClient_checkSerialFailedUpload(t *testing.T) {
+	storage := newMockS3Storage()
+	table := &mockSerialTable{items: make(map[string]map[string]map[string]string)}
+	failUpload := true
+	client := &RemoteClient{
+		s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut && failUpload {
+				writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+				return
+			}
+			storage.ServeHTTP(w, r)
+		}),
+		dynClient:   mockDynamoDBClient(t, table.ServeHTTP),
+		bucketName:  "bucket",
+		path:        "state",
+		ddbTable:    "table",
+		checkSerial: true,
+	}
+
+	if err := client.Put([]byte(`{"version": 4, "serial": 1}`)); err == nil {
+		t.Fatal("expected the upload to fail, got no error")
+	}
+	if _, ok := table.items["bucket/state"+stateSerialSuffix]; ok {
+		t.Fatal("expected the serial item to be removed after the failed upload")
+	}
+
+	failUpload = false
+	if err := client.Put([]byte(`{"version": 4, "serial": 1}`)); err != nil {
+		t.Fatalf("unexpected error retrying the write: %s", err)
+	}
+	if serial := table.items["bucket/state"+stateSerialSuffix][stateSerialAttribute]["N"]; serial != "1" {
+		t.Fatalf("expected recorded serial 1, got %q", serial)
+	}
+}
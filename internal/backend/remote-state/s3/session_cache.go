@@ -0,0 +1,188 @@
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+	"github.com/mitchellh/go-homedir"
+)
+
+// sessionCache holds the AWS sessions created by configured backends, so that
+// configuring the backend again within credential_cache_ttl reuses the
+// resolved credentials instead of resolving and validating them with STS
+// again. Each session's credentials are still refreshed by the SDK when they
+// expire.
+var sessionCache = struct {
+	sync.Mutex
+	entries map[string]cachedSession
+}{entries: make(map[string]cachedSession)}
+
+type cachedSession struct {
+	sess    *session.Session
+	expires time.Time
+}
+
+// getSession returns a session for cfg, reusing a cached one created from an
+// identical configuration less than ttl ago. A ttl of zero disables caching.
+// If creds is set, the session uses them rather than the credentials sources
+// of the AWS SDK base library.
+//
+// The returned session is always a copy, so that callers can add handlers
+// without affecting the cached session.
+func getSession(cfg *awsbase.Config, creds *credentials.Credentials, ttl time.Duration) (*session.Session, error) {
+	if ttl <= 0 {
+		return newSession(cfg, creds)
+	}
+
+	key, err := sessionCacheKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionCache.Lock()
+	defer sessionCache.Unlock()
+
+	now := time.Now()
+	if entry, ok := sessionCache.entries[key]; ok && now.Before(entry.expires) {
+		return entry.sess.Copy(), nil
+	}
+
+	sess, err := newSession(cfg, creds)
+	if err != nil {
+		return nil, err
+	}
+	sessionCache.entries[key] = cachedSession{
+		sess:    sess,
+		expires: now.Add(ttl),
+	}
+	return sess.Copy(), nil
+}
+
+// newSession creates a session for cfg, using creds if they're set.
+func newSession(cfg *awsbase.Config, creds *credentials.Credentials) (*session.Session, error) {
+	var files []string
+	if creds == nil {
+		var err error
+		files, creds, err = sourceProfileCredentials(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if creds == nil {
+		return awsbase.GetSession(cfg)
+	}
+
+	value, err := creds.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve credentials: %w", err)
+	}
+
+	// The session is created like the AWS SDK base library does, but without
+	// the role, which withCredentials assumes with creds, so that it's only
+	// assumed once. With source_profile, the profile is read from the same
+	// files the credentials were resolved from.
+	options, err := awsbase.GetSessionOptions(baseSessionConfig(cfg, value))
+	if err != nil {
+		return nil, err
+	}
+	if files != nil {
+		options.SharedConfigFiles = files
+	}
+	sess, err := session.NewSessionWithOptions(*options)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating AWS session: %w", err)
+	}
+	if cfg.MaxRetries > 0 {
+		sess = sess.Copy(&aws.Config{MaxRetries: aws.Int(cfg.MaxRetries)})
+	}
+	for i := len(cfg.UserAgentProducts) - 1; i >= 0; i-- {
+		product := cfg.UserAgentProducts[i]
+		sess.Handlers.Build.PushFront(request.MakeAddToUserAgentHandler(product.Name, product.Version, product.Extra...))
+	}
+	if v := os.Getenv(awsbase.AppendUserAgentEnvVar); v != "" {
+		sess.Handlers.Build.PushBack(request.MakeAddToUserAgentFreeFormHandler(v))
+	}
+
+	sess = withCredentials(sess, cfg, creds)
+	if !cfg.SkipCredsValidation {
+		if _, _, err := awsbase.GetAccountIDAndPartitionFromSTSGetCallerIdentity(sts.New(sess)); err != nil {
+			return nil, fmt.Errorf("error validating provider credentials: %w", err)
+		}
+	}
+	return sess, nil
+}
+
+// sourceProfileCredentials returns the credentials of a profile chained to
+// other profiles with source_profile, resolved from the configured shared
+// credentials file, along with the shared files they're resolved from, or nil
+// if the AWS SDK base library resolves them itself.
+//
+// The library resolves such chains with a session reading the default shared
+// credentials file, and would otherwise ignore shared_credentials_file for the
+// source profiles.
+func sourceProfileCredentials(cfg *awsbase.Config) ([]string, *credentials.Credentials, error) {
+	if cfg.CredsFilename == "" || cfg.AccessKey != "" || os.Getenv("AWS_ACCESS_KEY_ID") != "" || os.Getenv("AWS_ACCESS_KEY") != "" {
+		return nil, nil, nil
+	}
+
+	profile := cfg.Profile
+	for _, envvar := range []string{"AWS_PROFILE", "AWS_DEFAULT_PROFILE"} {
+		if profile == "" {
+			profile = os.Getenv(envvar)
+		}
+	}
+	if profile == "" {
+		profile = session.DefaultSharedConfigProfile
+	}
+	if profileValue(sharedConfigFilename(), configFileSections(profile), "source_profile") == "" {
+		return nil, nil, nil
+	}
+
+	credsFilename, err := homedir.Expand(cfg.CredsFilename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error expanding shared credentials filename: %w", err)
+	}
+	configFilename, err := homedir.Expand(sharedConfigFilename())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error expanding shared configuration filename: %w", err)
+	}
+
+	// Like the defaults of the SDK, the credentials file takes precedence
+	// over the configuration file.
+	files := []string{configFilename, credsFilename}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config: aws.Config{
+			EndpointResolver: cfg.EndpointResolver(),
+			Region:           aws.String(cfg.Region),
+		},
+		Profile:           profile,
+		SharedConfigState: session.SharedConfigEnable,
+		SharedConfigFiles: files,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load profile %q: %w", profile, err)
+	}
+	return files, sess.Config.Credentials, nil
+}
+
+// sessionCacheKey derives the cache key from the whole configuration, hashed
+// so that the key doesn't contain the credentials.
+func sessionCacheKey(cfg *awsbase.Config) (string, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
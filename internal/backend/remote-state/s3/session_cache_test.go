@@ -0,0 +1,145 @@
+package s3
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+)
+
+func TestBackendConfig_CredentialCacheTTL(t *testing.T) {
+	cases := map[string]struct {
+		ttl           int
+		expectedCalls int32
+	}{
+		"disabled": {
+			expectedCalls: 3,
+		},
+		"enabled": {
+			ttl:           60,
+			expectedCalls: 1,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			var calls int32
+			response := awsbase.MockStsGetCallerIdentityValidEndpoint.Response
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil || r.Form.Get("Action") != "GetCallerIdentity" {
+					t.Errorf("unexpected STS request: %s", r.Form.Encode())
+				}
+				atomic.AddInt32(&calls, 1)
+				w.Header().Set("Content-Type", response.ContentType)
+				w.WriteHeader(response.StatusCode)
+				w.Write([]byte(response.Body))
+			}))
+			defer ts.Close()
+
+			config := map[string]any{
+				"access_key":   awsbase.MockStaticAccessKey,
+				"secret_key":   awsbase.MockStaticSecretKey,
+				"bucket":       "bucket",
+				"key":          "state",
+				"region":       "us-west-2",
+				"sts_endpoint": ts.URL,
+			}
+			if tc.ttl != 0 {
+				config["credential_cache_ttl"] = tc.ttl
+			}
+
+			for i := 0; i < 3; i++ {
+				if _, diags := configureBackend(t, config); diags.HasErrors() {
+					t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+				}
+			}
+
+			if calls := atomic.LoadInt32(&calls); calls != tc.expectedCalls {
+				t.Fatalf("expected %d STS calls, got %d", tc.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestSessionCacheKey(t *testing.T) {
+	cfg := &awsbase.Config{
+		AccessKey: awsbase.MockStaticAccessKey,
+		SecretKey: awsbase.MockStaticSecretKey,
+		Region:    "us-west-2",
+	}
+	key, err := sessionCacheKey(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(key, awsbase.MockStaticSecretKey) {
+		t.Fatalf("cache key contains the secret key: %s", key)
+	}
+
+	other := *cfg
+	other.Region = "eu-west-1"
+	otherKey, err := sessionCacheKey(&other)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if key == otherKey {
+		t.Fatal("expected different configurations to have different cache keys")
+	}
+}
+
+func TestBackendConfig_AssumeRoleOnce(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	// The role is assumed with the credentials resolved by the backend, and
+	// never again with the role's own credentials.
+	var assumeRoleCalls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("invalid STS request: %s", err)
+		}
+		response := awsbase.MockStsGetCallerIdentityValidEndpoint.Response
+		if r.Form.Get("Action") == "AssumeRole" {
+			atomic.AddInt32(&assumeRoleCalls, 1)
+			if auth := r.Header.Get("Authorization"); !strings.Contains(auth, "Credential="+awsbase.MockStaticAccessKey+"/") {
+				t.Errorf("expected the role to be assumed with the static credentials, got %q", auth)
+			}
+			response = awsbase.MockStsAssumeRoleValidEndpoint.Response
+		}
+		w.Header().Set("Content-Type", response.ContentType)
+		w.WriteHeader(response.StatusCode)
+		w.Write([]byte(response.Body))
+	}))
+	defer ts.Close()
+
+	b, diags := configureBackend(t, map[string]any{
+		"access_key":                  awsbase.MockStaticAccessKey,
+		"secret_key":                  awsbase.MockStaticSecretKey,
+		"credentials_source_priority": []any{"static"},
+		"role_arn":                    awsbase.MockStsAssumeRoleArn,
+		"session_name":                awsbase.MockStsAssumeRoleSessionName,
+		"bucket":                      "bucket",
+		"key":                         "state",
+		"region":                      "us-west-2",
+		"sts_endpoint":                ts.URL,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected error: %s", diagnosticsString(diags))
+	}
+
+	creds, err := b.s3Client.Config.Credentials.Get()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if creds.AccessKeyID != awsbase.MockStsAssumeRoleAccessKey {
+		t.Fatalf("expected the credentials of the role, got %q", creds.AccessKeyID)
+	}
+	if calls := atomic.LoadInt32(&assumeRoleCalls); calls != 1 {
+		t.Fatalf("expected 1 AssumeRole call, got %d", calls)
+	}
+}
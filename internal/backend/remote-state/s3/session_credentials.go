@@ -0,0 +1,77 @@
+package s3
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+)
+
+// resolvedConfig returns a copy of cfg with the current value of creds as its
+// static credentials.
+//
+// The AWS SDK base library only creates and validates sessions from the
+// credentials sources it knows, so credentials resolved by the backend itself
+// are passed to it this way, and the session's credentials are replaced with
+// creds afterwards with withCredentials, so that they're still refreshed.
+func resolvedConfig(cfg *awsbase.Config, creds credentials.Value) *awsbase.Config {
+	resolved := *cfg
+	resolved.AccessKey = creds.AccessKeyID
+	resolved.SecretKey = creds.SecretAccessKey
+	resolved.Token = creds.SessionToken
+	return &resolved
+}
+
+// baseSessionConfig is like resolvedConfig, but without the role to assume, for
+// the session the role is then assumed from by withCredentials.
+func baseSessionConfig(cfg *awsbase.Config, creds credentials.Value) *awsbase.Config {
+	resolved := resolvedConfig(cfg, creds)
+	resolved.AssumeRoleARN = ""
+	return resolved
+}
+
+// withCredentials returns a copy of the session using creds, which are
+// refreshed by the SDK when they expire. If cfg assumes a role, the session
+// uses the credentials of the role assumed with creds instead.
+func withCredentials(sess *session.Session, cfg *awsbase.Config, creds *credentials.Credentials) *session.Session {
+	if cfg.AssumeRoleARN != "" {
+		creds = credentials.NewCredentials(assumeRoleProvider(sess.Copy(&aws.Config{Credentials: creds}), cfg))
+	}
+	return sess.Copy(&aws.Config{Credentials: creds})
+}
+
+// assumeRoleProvider returns the provider of the credentials of the role
+// configured in cfg, assumed with the credentials of sess, in the same way as
+// the AWS SDK base library.
+func assumeRoleProvider(sess *session.Session, cfg *awsbase.Config) *stscreds.AssumeRoleProvider {
+	provider := &stscreds.AssumeRoleProvider{
+		Client:  sts.New(sess),
+		RoleARN: cfg.AssumeRoleARN,
+	}
+	if cfg.AssumeRoleDurationSeconds > 0 {
+		provider.Duration = time.Duration(cfg.AssumeRoleDurationSeconds) * time.Second
+	}
+	if cfg.AssumeRoleExternalID != "" {
+		provider.ExternalID = aws.String(cfg.AssumeRoleExternalID)
+	}
+	if cfg.AssumeRolePolicy != "" {
+		provider.Policy = aws.String(cfg.AssumeRolePolicy)
+	}
+	for _, arn := range cfg.AssumeRolePolicyARNs {
+		provider.PolicyArns = append(provider.PolicyArns, &sts.PolicyDescriptorType{Arn: aws.String(arn)})
+	}
+	if cfg.AssumeRoleSessionName != "" {
+		provider.RoleSessionName = cfg.AssumeRoleSessionName
+	}
+	for k, v := range cfg.AssumeRoleTags {
+		provider.Tags = append(provider.Tags, &sts.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	if len(cfg.AssumeRoleTransitiveTagKeys) > 0 {
+		provider.TransitiveTagKeys = aws.StringSlice(cfg.AssumeRoleTransitiveTagKeys)
+	}
+	return provider
+}
@@ -0,0 +1,318 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// shardManifestFormat identifies the manifest written in place of the state
+// when sharded_state is set.
+const shardManifestFormat = "opentofu-sharded-state"
+
+// shardKeyInfix separates the state key from the names of its shards, which
+// are named by their MD5 digest, so that a shard which doesn't change between
+// two writes is only uploaded once.
+const shardKeyInfix = ".shards/"
+
+// shardTargetSize is the size beyond which the resources of a module are
+// split across several shards, at a change of resource type.
+const shardTargetSize = 1 << 20
+
+// shardParallelism is the number of shards uploaded or downloaded at the same
+// time.
+const shardParallelism = 8
+
+// shardManifest lists the shards of a sharded state, which is the
+// concatenation of their contents.
+type shardManifest struct {
+	Format string       `json:"format"`
+	Size   int          `json:"size"`
+	MD5    string       `json:"md5"`
+	Shards []stateShard `json:"shards"`
+}
+
+type stateShard struct {
+	Key  string `json:"key"`
+	Size int    `json:"size"`
+	MD5  string `json:"md5"`
+}
+
+// parseShardManifest returns the manifest in data, if data is a manifest
+// rather than a state. States are never mistaken for manifests, since they
+// have no "format" field.
+func parseShardManifest(data []byte) (*shardManifest, bool) {
+	if !bytes.Contains(data, []byte(shardManifestFormat)) {
+		return nil, false
+	}
+	var m shardManifest
+	if err := json.Unmarshal(data, &m); err != nil || m.Format != shardManifestFormat {
+		return nil, false
+	}
+	return &m, true
+}
+
+// splitState splits a state into contiguous pieces along the boundaries of
+// its resources, so that the pieces concatenate to exactly the same bytes.
+// Resources are cut into a new piece when their module changes, and within a
+// module when the piece grows beyond shardTargetSize and the resource type
+// changes, so that a change to a resource only changes the piece holding it.
+func splitState(data []byte) ([][]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("the state is not a JSON object")
+	}
+
+	var cuts []int
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok != "resources" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return nil, errors.New(`the "resources" field of the state is not an array`)
+		}
+		var module, resourceType string
+		pieceStart := -1
+		for dec.More() {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, err
+			}
+			start := int(dec.InputOffset()) - len(raw)
+
+			var resource struct {
+				Module string `json:"module"`
+				Type   string `json:"type"`
+			}
+			if err := json.Unmarshal(raw, &resource); err != nil {
+				return nil, err
+			}
+
+			switch {
+			case pieceStart < 0:
+				cuts = append(cuts, start)
+				pieceStart = start
+			case resource.Module != module,
+				resource.Type != resourceType && start-pieceStart > shardTargetSize:
+				cuts = append(cuts, start)
+				pieceStart = start
+			}
+			module, resourceType = resource.Module, resource.Type
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		// The rest of the state after the resources is a piece of its own.
+		cuts = append(cuts, int(dec.InputOffset()))
+	}
+
+	var pieces [][]byte
+	start := 0
+	for _, cut := range cuts {
+		if cut > start {
+			pieces = append(pieces, data[start:cut])
+			start = cut
+		}
+	}
+	return append(pieces, data[start:]), nil
+}
+
+// putShards uploads the shards of a state which aren't already stored, and
+// returns the manifest to store in place of the state.
+func (c *RemoteClient) putShards(data []byte) (*shardManifest, error) {
+	pieces, err := splitState(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split state into shards: %w", err)
+	}
+
+	stored := make(map[string]bool)
+	if c.shardManifest != nil {
+		for _, shard := range c.shardManifest.Shards {
+			stored[shard.Key] = true
+		}
+	}
+
+	sum := md5.Sum(data)
+	manifest := &shardManifest{
+		Format: shardManifestFormat,
+		Size:   len(data),
+		MD5:    hex.EncodeToString(sum[:]),
+	}
+	var uploads []int
+	for i, piece := range pieces {
+		sum := md5.Sum(piece)
+		digest := hex.EncodeToString(sum[:])
+		manifest.Shards = append(manifest.Shards, stateShard{
+			Key:  c.path + shardKeyInfix + digest,
+			Size: len(piece),
+			MD5:  digest,
+		})
+		if !stored[manifest.Shards[i].Key] {
+			uploads = append(uploads, i)
+		}
+	}
+
+	log.Printf("[DEBUG] Uploading %d of the %d shards of state %q", len(uploads), len(pieces), c.path)
+	err = forEachShard(len(uploads), func(i int) error {
+		shard := manifest.Shards[uploads[i]]
+		input := &s3.PutObjectInput{
+			Body:          bytes.NewReader(pieces[uploads[i]]),
+			Bucket:        &c.bucketName,
+			Key:           aws.String(shard.Key),
+			ContentLength: aws.Int64(int64(shard.Size)),
+			ContentType:   aws.String("application/octet-stream"),
+		}
+		c.setPutObjectOptions(input)
+		_, err := c.s3Client.PutObject(input)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload state shard: %w", c.sseCustomerKeyUnsupportedError(err))
+	}
+	return manifest, nil
+}
+
+// getShards downloads the shards of a manifest, and returns the state they
+// make up.
+func (c *RemoteClient) getShards(manifest *shardManifest) ([]byte, error) {
+	pieces := make([][]byte, len(manifest.Shards))
+	err := forEachShard(len(manifest.Shards), func(i int) error {
+		shard := manifest.Shards[i]
+		input := &s3.GetObjectInput{
+			Bucket: &c.bucketName,
+			Key:    aws.String(shard.Key),
+		}
+		if c.serverSideEncryption && c.customerEncryptionKey != nil {
+			input.SetSSECustomerKey(string(c.customerEncryptionKey))
+			input.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+			input.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+		}
+		output, err := c.readClient().GetObject(input)
+		if err != nil {
+			return fmt.Errorf("failed to read state shard %q: %w", shard.Key, c.sseCustomerKeyError(err))
+		}
+		defer output.Body.Close()
+
+		piece, err := io.ReadAll(output.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read state shard %q: %w", shard.Key, err)
+		}
+		if sum := md5.Sum(piece); hex.EncodeToString(sum[:]) != shard.MD5 {
+			return fmt.Errorf("state shard %q does not have the expected content", shard.Key)
+		}
+		pieces[i] = piece
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data := bytes.Join(pieces, nil)
+	if sum := md5.Sum(data); len(data) != manifest.Size || hex.EncodeToString(sum[:]) != manifest.MD5 {
+		return nil, fmt.Errorf("the shards of state %q do not make up the expected state", c.path)
+	}
+	return data, nil
+}
+
+// deleteShards deletes the shards of the previous manifest which the current
+// one no longer refers to. Failing to delete them only leaves unused objects
+// behind, so it doesn't fail the write.
+func (c *RemoteClient) deleteShards(previous, current *shardManifest) {
+	keep := make(map[string]bool)
+	if current != nil {
+		for _, shard := range current.Shards {
+			keep[shard.Key] = true
+		}
+	}
+
+	var stale []string
+	for _, shard := range previous.Shards {
+		if !keep[shard.Key] {
+			stale = append(stale, shard.Key)
+		}
+	}
+
+	err := forEachShard(len(stale), func(i int) error {
+		_, err := c.s3Client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: &c.bucketName,
+			Key:    aws.String(stale[i]),
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("[WARN] Failed to delete unused shards of state %q: %s", c.path, err)
+	}
+}
+
+// storedShardManifest returns the manifest stored in place of the state, or
+// nil if the state isn't sharded or can't be read, for cleaning up its shards.
+func (c *RemoteClient) storedShardManifest() *shardManifest {
+	input := &s3.GetObjectInput{
+		Bucket: &c.bucketName,
+		Key:    &c.path,
+	}
+	if c.serverSideEncryption && c.customerEncryptionKey != nil {
+		input.SetSSECustomerKey(string(c.customerEncryptionKey))
+		input.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		input.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+	}
+	output, err := c.readClient().GetObject(input)
+	if err != nil {
+		return nil
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil
+	}
+	manifest, _ := parseShardManifest(data)
+	return manifest
+}
+
+// forEachShard calls fn for each index below n, up to shardParallelism at the
+// same time, and returns the first error.
+func forEachShard(n int, fn func(i int) error) error {
+	var mu sync.Mutex
+	var firstErr error
+
+	sem := make(chan struct{}, shardParallelism)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := fn(i); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return firstErr
+}
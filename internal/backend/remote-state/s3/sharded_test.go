@@ -0,0 +1,276 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// shardedTestState returns a state with the given number of modules, each
+// holding the given number of resources with an attribute of the given size.
+// The serial is also written into the attributes of the first resource, so
+// that changing it changes a single resource.
+func shardedTestState(t testing.TB, modules, resources, attrSize, serial int) []byte {
+	t.Helper()
+
+	type resource struct {
+		Module    string           `json:"module,omitempty"`
+		Mode      string           `json:"mode"`
+		Type      string           `json:"type"`
+		Name      string           `json:"name"`
+		Instances []map[string]any `json:"instances"`
+	}
+	var all []resource
+	for m := 0; m < modules; m++ {
+		module := ""
+		if m > 0 {
+			module = fmt.Sprintf("module.m%d", m)
+		}
+		for r := 0; r < resources; r++ {
+			attrs := map[string]any{
+				"id":   fmt.Sprintf("%d-%d", m, r),
+				"data": strings.Repeat("x", attrSize),
+			}
+			if m == 0 && r == 0 {
+				attrs["revision"] = serial
+			}
+			all = append(all, resource{
+				Module:    module,
+				Mode:      "managed",
+				Type:      fmt.Sprintf("test_type%d", r%3),
+				Name:      fmt.Sprintf("r%d", r),
+				Instances: []map[string]any{{"attributes": attrs}},
+			})
+		}
+	}
+
+	data, err := json.MarshalIndent(map[string]any{
+		"version":   4,
+		"serial":    serial,
+		"lineage":   "abc",
+		"outputs":   map[string]any{},
+		"resources": all,
+	}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSplitState(t *testing.T) {
+	data := shardedTestState(t, 3, 4, 10, 1)
+
+	pieces, err := splitState(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := bytes.Join(pieces, nil); !bytes.Equal(got, data) {
+		t.Fatalf("pieces don't concatenate to the state:\n%s", got)
+	}
+	// The prefix, one piece per module and the suffix.
+	if len(pieces) != 5 {
+		t.Fatalf("expected 5 pieces, got %d", len(pieces))
+	}
+
+	for _, invalid := range []string{`[]`, `{"resources": {}}`, `{"resources": [1]}`} {
+		if _, err := splitState([]byte(invalid)); err == nil {
+			t.Errorf("expected error splitting %s", invalid)
+		}
+	}
+}
+
+func TestRemoteClient_shardedState(t *testing.T) {
+	storage := newMockS3Storage()
+	var puts atomic.Int64
+	s3Client := mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			puts.Add(1)
+		}
+		storage.ServeHTTP(w, r)
+	})
+
+	writer := &RemoteClient{
+		s3Client:     s3Client,
+		bucketName:   "bucket",
+		path:         "state",
+		shardedState: true,
+	}
+	state := shardedTestState(t, 4, 10, 100, 1)
+	if err := writer.Put(state); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+
+	manifest, ok := parseShardManifest(storage.objects["bucket/state"].body)
+	if !ok {
+		t.Fatalf("expected a manifest in place of the state, got %s", storage.objects["bucket/state"].body)
+	}
+	if len(manifest.Shards) < 2 {
+		t.Fatalf("expected the state to be split, got %d shards", len(manifest.Shards))
+	}
+	for _, shard := range manifest.Shards {
+		if storage.objects["bucket/"+shard.Key] == nil {
+			t.Fatalf("shard %q was not written", shard.Key)
+		}
+	}
+
+	// Readers without sharded_state set read the state as well.
+	reader := &RemoteClient{
+		s3Client:   s3Client,
+		bucketName: "bucket",
+		path:       "state",
+	}
+	payload, err := reader.Get()
+	if err != nil {
+		t.Fatalf("unexpected error reading state: %s", err)
+	}
+	if !bytes.Equal(payload.Data, state) {
+		t.Fatalf("expected state %q, got %q", state, payload.Data)
+	}
+
+	// Only the shard holding the changed resource is uploaded again, along
+	// with the end of the state holding the serial, and the manifest.
+	puts.Store(0)
+	changed := shardedTestState(t, 4, 10, 100, 2)
+	if err := writer.Put(changed); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+	if got := puts.Load(); got != 3 {
+		t.Fatalf("expected 3 uploads, got %d", got)
+	}
+	// The shards which were replaced are deleted.
+	if got, want := len(storage.objects), len(manifest.Shards)+1; got != want {
+		t.Fatalf("expected %d objects, got %d", want, got)
+	}
+
+	payload, err = reader.Get()
+	if err != nil {
+		t.Fatalf("unexpected error reading state: %s", err)
+	}
+	if !bytes.Equal(payload.Data, changed) {
+		t.Fatalf("expected state %q, got %q", changed, payload.Data)
+	}
+
+	// Writing the state without sharded_state replaces the manifest, and
+	// deletes the shards.
+	if err := reader.Put(state); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+	if len(storage.objects) != 1 || !bytes.Equal(storage.objects["bucket/state"].body, state) {
+		t.Fatalf("expected only the unsharded state, got %d objects", len(storage.objects))
+	}
+}
+
+func TestRemoteClient_shardedStateDelete(t *testing.T) {
+	storage := newMockS3Storage()
+	s3Client := mockS3Client(t, storage.ServeHTTP)
+
+	writer := &RemoteClient{
+		s3Client:     s3Client,
+		bucketName:   "bucket",
+		path:         "state",
+		shardedState: true,
+	}
+	if err := writer.Put(shardedTestState(t, 2, 2, 10, 1)); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+
+	// A client which didn't read the state deletes the shards as well.
+	deleter := &RemoteClient{
+		s3Client:     s3Client,
+		bucketName:   "bucket",
+		path:         "state",
+		shardedState: true,
+	}
+	if err := deleter.Delete(); err != nil {
+		t.Fatalf("unexpected error deleting state: %s", err)
+	}
+	if len(storage.objects) != 0 {
+		t.Fatalf("expected all objects to be deleted, got %d", len(storage.objects))
+	}
+}
+
+func TestRemoteClient_shardedStateCorrupt(t *testing.T) {
+	storage := newMockS3Storage()
+	client := &RemoteClient{
+		s3Client:     mockS3Client(t, storage.ServeHTTP),
+		bucketName:   "bucket",
+		path:         "state",
+		shardedState: true,
+	}
+	if err := client.Put(shardedTestState(t, 2, 2, 10, 1)); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+
+	manifest, _ := parseShardManifest(storage.objects["bucket/state"].body)
+	shard := storage.objects["bucket/"+manifest.Shards[1].Key]
+	shard.body = bytes.Replace(shard.body, []byte("managed"), []byte("MANAGED"), 1)
+
+	_, err := client.Get()
+	if err == nil || !strings.Contains(err.Error(), "does not have the expected content") {
+		t.Fatalf("expected an error about the corrupt shard, got %v", err)
+	}
+}
+
+func TestRemoteClient_shardedStateMissingShard(t *testing.T) {
+	storage := newMockS3Storage()
+	client := &RemoteClient{
+		s3Client:     mockS3Client(t, storage.ServeHTTP),
+		bucketName:   "bucket",
+		path:         "state",
+		shardedState: true,
+	}
+	if err := client.Put(shardedTestState(t, 2, 2, 10, 1)); err != nil {
+		t.Fatalf("unexpected error writing state: %s", err)
+	}
+
+	manifest, _ := parseShardManifest(storage.objects["bucket/state"].body)
+	delete(storage.objects, "bucket/"+manifest.Shards[0].Key)
+
+	_, err := client.Get()
+	if err == nil || !strings.Contains(err.Error(), "failed to read state shard") {
+		t.Fatalf("expected an error about the missing shard, got %v", err)
+	}
+}
+
+// benchmarkStatePut measures writing a large state of which a single
+// resource changes between writes, to a store where requests take time in
+// proportion to their size.
+func benchmarkStatePut(b *testing.B, sharded bool) {
+	storage := newMockS3Storage()
+	s3Client := mockS3Client(b, func(w http.ResponseWriter, r *http.Request) {
+		// About 100MB/s, plus a fixed delay per request.
+		time.Sleep(time.Millisecond + time.Duration(r.ContentLength)*10*time.Nanosecond)
+		storage.ServeHTTP(w, r)
+	})
+	client := &RemoteClient{
+		s3Client:     s3Client,
+		bucketName:   "bucket",
+		path:         "state",
+		shardedState: sharded,
+	}
+
+	states := [][]byte{
+		shardedTestState(b, 50, 20, 2000, 1),
+		shardedTestState(b, 50, 20, 2000, 2),
+	}
+	b.SetBytes(int64(len(states[0])))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := client.Put(states[i%2]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRemoteClient_putState(b *testing.B) {
+	benchmarkStatePut(b, false)
+}
+
+func BenchmarkRemoteClient_putShardedState(b *testing.B) {
+	benchmarkStatePut(b, true)
+}
@@ -0,0 +1,66 @@
+package s3
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sso"
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// setSSOCredentials resolves the credentials of an SSO profile through the
+// configured sso_endpoint, sets their current value as the static
+// credentials of cfg, and returns them so that the session can be created
+// with them by getSession, to be refreshed when the role session ends.
+// It returns nil if the credentials aren't resolved here.
+//
+// The AWS SDK resolves the credentials of SSO profiles itself, but always
+// requests them from the SSO portal endpoint of the profile's sso_region,
+// which isn't reachable from isolated partitions. The credentials are only
+// resolved here if none with a higher precedence than the profile are set.
+func setSSOCredentials(cfg *awsbase.Config, obj cty.Value) (*credentials.Credentials, error) {
+	endpoint := stringAttrDefaultEnvVar(obj, "sso_endpoint", "AWS_SSO_ENDPOINT")
+	if endpoint == "" || cfg.AccessKey != "" || os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+		return nil, nil
+	}
+
+	profile := configuredProfile(obj)
+	filename, sections := sharedConfigFilename(), configFileSections(profile)
+	startURL := profileValue(filename, sections, "sso_start_url")
+	if startURL == "" {
+		return nil, nil
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config: aws.Config{
+			Credentials: credentials.AnonymousCredentials,
+			Endpoint:    aws.String(endpoint),
+			Region:      aws.String(profileValue(filename, sections, "sso_region")),
+		},
+		SharedConfigState: session.SharedConfigDisable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] Resolving SSO credentials of profile %q through %q", profile, endpoint)
+	creds := ssocreds.NewCredentialsWithClient(
+		sso.New(sess),
+		profileValue(filename, sections, "sso_account_id"),
+		profileValue(filename, sections, "sso_role_name"),
+		startURL,
+	)
+	value, err := creds.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve SSO credentials of profile %q: %w", profile, err)
+	}
+
+	*cfg = *resolvedConfig(cfg, value)
+	return creds, nil
+}
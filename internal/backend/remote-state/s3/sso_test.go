@@ -0,0 +1,97 @@
+package s3
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestBackendConfig_SSOEndpoint(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	const startURL = "https://example.awsapps.com/start"
+
+	home := t.TempDir()
+	os.Setenv("HOME", home)
+
+	sum := sha1.Sum([]byte(startURL))
+	cacheDir := filepath.Join(home, ".aws", "sso", "cache")
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	token := fmt.Sprintf(`{"accessToken": "SSOAccessToken", "expiresAt": %q}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	if err := os.WriteFile(filepath.Join(cacheDir, hex.EncodeToString(sum[:])+".json"), []byte(token), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	configFile := filepath.Join(home, "config")
+	if err := os.WriteFile(configFile, []byte(fmt.Sprintf(`
+[profile sso]
+sso_start_url = %s
+sso_region = us-gov-west-1
+sso_account_id = 123456789012
+sso_role_name = StateAccess
+`, startURL)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("AWS_CONFIG_FILE", configFile)
+
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		q := r.URL.Query()
+		if r.URL.Path != "/federation/credentials" || q.Get("account_id") != "123456789012" || q.Get("role_name") != "StateAccess" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		if v := r.Header.Get("X-Amz-Sso_bearer_token"); v != "SSOAccessToken" {
+			t.Errorf("unexpected bearer token %q", v)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"roleCredentials": {"accessKeyId": "SSOAccessKey", "secretAccessKey": "SSOSecretKey", "sessionToken": "SSOSessionToken", "expiration": %d}}`, time.Now().Add(time.Hour).UnixMilli())
+	}))
+	defer ts.Close()
+
+	b, diags := configureBackend(t, map[string]any{
+		"bucket":                      "bucket",
+		"key":                         "key",
+		"region":                      "us-gov-west-1",
+		"profile":                     "sso",
+		"sso_endpoint":                ts.URL,
+		"skip_credentials_validation": true,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+	}
+	if requests != 1 {
+		t.Fatalf("expected the SSO endpoint to be requested once, got %d", requests)
+	}
+
+	creds, err := b.s3Client.Config.Credentials.Get()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if creds.AccessKeyID != "SSOAccessKey" || creds.SecretAccessKey != "SSOSecretKey" || creds.SessionToken != "SSOSessionToken" {
+		t.Fatalf("unexpected credentials: %#v", creds)
+	}
+	if region := aws.StringValue(b.s3Client.Config.Region); region != "us-gov-west-1" {
+		t.Fatalf("expected region %q, got %q", "us-gov-west-1", region)
+	}
+
+	// The credentials are requested again once the role session ends.
+	b.s3Client.Config.Credentials.Expire()
+	if _, err := b.s3Client.Config.Credentials.Get(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if requests != 2 {
+		t.Fatalf("expected the SSO endpoint to be requested again, got %d requests", requests)
+	}
+}
@@ -0,0 +1,29 @@
+package s3
+
+import (
+	"log"
+	"time"
+
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+// isStaleLock reports whether a lock held by another client was created more
+// than lock_max_age ago, such as the lock of a CI job which crashed without
+// releasing it.
+func (c *RemoteClient) isStaleLock(held *statemgr.LockInfo) bool {
+	if c.lockMaxAge <= 0 || held == nil || held.Created.IsZero() {
+		return false
+	}
+	return time.Since(held.Created) > c.lockMaxAge
+}
+
+// takeOverStaleLock replaces a stale lock with our own. The lock is only
+// replaced if it still holds the lock info that was read, so that a lock
+// taken in the meantime is not overwritten.
+func (c *RemoteClient) takeOverStaleLock(info, held *statemgr.LockInfo, raw string) error {
+	log.Printf(
+		"[WARN] Overriding stale lock %q in DynamoDB table %q: it was created %s ago, more than lock_max_age of %s. The lock was held by %q for the %q operation, with ID %q.",
+		c.lockPath(), c.ddbTable, time.Since(held.Created).Round(time.Second), c.lockMaxAge, held.Who, held.Operation, held.ID,
+	)
+	return c.replaceLockItem(info, raw)
+}
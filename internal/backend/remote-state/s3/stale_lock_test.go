@@ -0,0 +1,129 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+func TestRemoteClient_staleLock(t *testing.T) {
+	testCases := map[string]struct {
+		age        time.Duration
+		lockMaxAge time.Duration
+		// changed replaces the lock after it was read, as if another
+		// operation had taken it over in the meantime.
+		changed      bool
+		expectLocked bool
+	}{
+		"fresh lock": {
+			age:        time.Minute,
+			lockMaxAge: time.Hour,
+		},
+		"aged lock": {
+			age:          2 * time.Hour,
+			lockMaxAge:   time.Hour,
+			expectLocked: true,
+		},
+		"aged lock changed": {
+			age:        2 * time.Hour,
+			lockMaxAge: time.Hour,
+			changed:    true,
+		},
+		"disabled": {
+			age: 2 * time.Hour,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			held := statemgr.NewLockInfo()
+			held.ID = "held"
+			held.Operation = "apply"
+			held.Who = "ci@runner"
+			held.Created = time.Now().Add(-tc.age).UTC()
+			info := string(held.Marshal())
+
+			client := &RemoteClient{
+				dynClient: mockDynamoDBClient(t, func(w http.ResponseWriter, r *http.Request) {
+					var input struct {
+						Item                      map[string]map[string]string
+						ConditionExpression       string
+						ExpressionAttributeValues map[string]map[string]string
+					}
+					if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+						t.Errorf("invalid DynamoDB request: %s", err)
+					}
+
+					switch dynamoDBOperation(r) {
+					case "PutItem":
+						if input.ConditionExpression != "Info = :info" || input.ExpressionAttributeValues[":info"]["S"] != info {
+							writeDynamoDBError(w, dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed")
+							return
+						}
+						info = input.Item["Info"]["S"]
+						writeDynamoDBResponse(w, map[string]any{})
+					case "GetItem":
+						writeDynamoDBResponse(w, map[string]any{
+							"Item": map[string]any{
+								"LockID": map[string]string{"S": "bucket/state"},
+								"Info":   map[string]string{"S": info},
+							},
+						})
+						if tc.changed {
+							other := statemgr.NewLockInfo()
+							other.ID = "other"
+							info = string(other.Marshal())
+						}
+					default:
+						t.Errorf("unexpected DynamoDB operation %q", dynamoDBOperation(r))
+					}
+				}),
+				bucketName: "bucket",
+				path:       "state",
+				ddbTable:   "table",
+				lockMaxAge: tc.lockMaxAge,
+			}
+
+			lockInfo := statemgr.NewLockInfo()
+			lockInfo.Operation = "test"
+			id, err := client.Lock(lockInfo)
+			if !tc.expectLocked {
+				var lockErr *statemgr.LockError
+				if !errors.As(err, &lockErr) {
+					t.Fatalf("expected a lock error, got: %v", err)
+				}
+				if !tc.changed && (lockErr.Info == nil || lockErr.Info.ID != "held") {
+					t.Fatalf("expected the error to report the held lock, got: %s", err)
+				}
+				if tc.changed != strings.Contains(logs.String(), "Overriding stale lock") {
+					t.Fatalf("unexpected logs: %s", logs.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if id != lockInfo.ID || !strings.Contains(info, lockInfo.ID) {
+				t.Fatalf("expected lock to be taken over, lock info is %s", info)
+			}
+			if !strings.Contains(logs.String(), `[WARN] Overriding stale lock "bucket/state" in DynamoDB table "table"`) || !strings.Contains(logs.String(), `"ci@runner"`) {
+				t.Fatalf("expected a warning about the overridden lock, got: %s", logs.String())
+			}
+		})
+	}
+}
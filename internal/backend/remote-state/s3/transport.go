@@ -0,0 +1,89 @@
+package s3
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// tlsVersions are the valid values of the min_tls_version attribute.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// defaultMinTLSVersion is the minimum TLS version when min_tls_version isn't
+// set.
+const defaultMinTLSVersion = "1.2"
+
+// dialKeepAlive is the keep-alive period of connections dialed with
+// connect_timeout, which is the same as that of the default transport.
+const dialKeepAlive = 30 * time.Second
+
+// withHTTPClientOptions returns a copy of the session using an HTTP client
+// with the transport options of the configuration applied. The HTTP client of
+// the given session is never modified, since it may be shared with a cached
+// session.
+//
+// If custom is set, it's used instead of the session's HTTP client, with only
+// the timeout and redirect policy applied, and its transport left as it is, so
+// connect_timeout and min_tls_version don't apply to it.
+func withHTTPClientOptions(sess *session.Session, obj cty.Value, custom *http.Client) *session.Session {
+	client := &http.Client{}
+	switch {
+	case custom != nil:
+		*client = *custom
+	case sess.Config.HTTPClient != nil:
+		*client = *sess.Config.HTTPClient
+	}
+
+	if timeout, ok := intAttrOk(obj, "http_request_timeout"); ok {
+		// The timeout covers each attempt separately, so that a stuck request
+		// is retried rather than holding up the operation.
+		client.Timeout = time.Duration(timeout) * time.Second
+	}
+
+	if boolAttr(obj, "follow_redirects") {
+		client.CheckRedirect = signedRedirectPolicy(sess.Config.Credentials, intAttrDefault(obj, "max_redirects", defaultMaxRedirects))
+	}
+
+	if custom != nil {
+		return sess.Copy(&aws.Config{HTTPClient: client})
+	}
+
+	// The transport is cloned along with its TLS configuration, since the
+	// client's transport is shared as well.
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		log.Printf("[WARN] Not setting the minimum TLS version of unsupported HTTP transport %T", t)
+	}
+	if transport != nil {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.MinVersion = tlsVersions[stringAttrDefault(obj, "min_tls_version", defaultMinTLSVersion)]
+		if timeout, ok := intAttrOk(obj, "connect_timeout"); ok {
+			// Unlike http_request_timeout, this only limits establishing the
+			// connection, so that an unreachable endpoint fails fast while
+			// slow responses are still waited for.
+			transport.DialContext = (&net.Dialer{
+				Timeout:   time.Duration(timeout) * time.Second,
+				KeepAlive: dialKeepAlive,
+			}).DialContext
+		}
+		client.Transport = transport
+	}
+
+	return sess.Copy(&aws.Config{HTTPClient: client})
+}
@@ -0,0 +1,258 @@
+package s3
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	awsbase "github.com/hashicorp/aws-sdk-go-base"
+	"github.com/opentofu/opentofu/internal/configs/hcl2shim"
+)
+
+func TestBackendConfig_HTTPRequestTimeout(t *testing.T) {
+	testCases := map[string]struct {
+		timeout  any
+		expected time.Duration
+	}{
+		"default": {},
+		"configured": {
+			timeout:  30,
+			expected: 30 * time.Second,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			config := map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         "key",
+				"region":                      "us-west-2",
+				"skip_credentials_validation": true,
+			}
+			if tc.timeout != nil {
+				config["http_request_timeout"] = tc.timeout
+			}
+
+			b, diags := configureBackend(t, config)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+			}
+
+			for name, timeout := range map[string]time.Duration{
+				"S3":       b.s3Client.Config.HTTPClient.Timeout,
+				"DynamoDB": b.dynClient.Config.HTTPClient.Timeout,
+			} {
+				if timeout != tc.expected {
+					t.Errorf("expected %s client timeout %s, got %s", name, tc.expected, timeout)
+				}
+			}
+		})
+	}
+}
+
+func TestBackendConfig_MinTLSVersion(t *testing.T) {
+	testCases := map[string]struct {
+		version  any
+		expected uint16
+	}{
+		"default": {
+			expected: tls.VersionTLS12,
+		},
+		"1.3": {
+			version:  "1.3",
+			expected: tls.VersionTLS13,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			oldEnv := initSessionTestEnv()
+			defer popEnv(oldEnv)
+
+			config := map[string]any{
+				"access_key":                  awsbase.MockStaticAccessKey,
+				"secret_key":                  awsbase.MockStaticSecretKey,
+				"bucket":                      "bucket",
+				"key":                         "key",
+				"region":                      "us-west-2",
+				"skip_credentials_validation": true,
+			}
+			if tc.version != nil {
+				config["min_tls_version"] = tc.version
+			}
+
+			b, diags := configureBackend(t, config)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+			}
+
+			for name, client := range map[string]*http.Client{
+				"S3":       b.s3Client.Config.HTTPClient,
+				"DynamoDB": b.dynClient.Config.HTTPClient,
+			} {
+				transport, ok := client.Transport.(*http.Transport)
+				if !ok {
+					t.Fatalf("expected %s client transport to be *http.Transport, got %T", name, client.Transport)
+				}
+				if v := transport.TLSClientConfig.MinVersion; v != tc.expected {
+					t.Errorf("expected %s client minimum TLS version %x, got %x", name, tc.expected, v)
+				}
+			}
+		})
+	}
+}
+
+func TestBackend_connectTimeout(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	storage := newMockS3Storage()
+	ts := httptest.NewServer(storage)
+	defer ts.Close()
+
+	configure := func(endpoint string) *Backend {
+		b, diags := configureBackend(t, map[string]any{
+			"access_key":                  awsbase.MockStaticAccessKey,
+			"secret_key":                  awsbase.MockStaticSecretKey,
+			"bucket":                      "bucket",
+			"key":                         "key",
+			"region":                      "us-west-2",
+			"endpoint":                    endpoint,
+			"force_path_style":            true,
+			"max_retries":                 0,
+			"connect_timeout":             1,
+			"skip_credentials_validation": true,
+		})
+		if diags.HasErrors() {
+			t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+		}
+		return b
+	}
+
+	// Connections to a reachable endpoint are dialed as usual.
+	client, err := configure(ts.URL).remoteClient("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The address is reserved for documentation, so connections to it are
+	// never established, and only the connect timeout ends the request.
+	client, err = configure("http://192.0.2.1").remoteClient("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	start := time.Now()
+	if _, err := client.Get(); err == nil {
+		t.Fatal("expected an error, got none")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected the connection to time out after 1 second, took %s", elapsed)
+	}
+}
+
+func TestBackend_minTLSVersionRejected(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+	}))
+	ts.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	ts.StartTLS()
+	defer ts.Close()
+
+	b, diags := configureBackend(t, map[string]any{
+		"access_key":                  awsbase.MockStaticAccessKey,
+		"secret_key":                  awsbase.MockStaticSecretKey,
+		"bucket":                      "bucket",
+		"key":                         "key",
+		"region":                      "us-west-2",
+		"endpoint":                    ts.URL,
+		"force_path_style":            true,
+		"max_retries":                 0,
+		"min_tls_version":             "1.3",
+		"skip_credentials_validation": true,
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+	}
+
+	client, err := b.remoteClient("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err = client.Get()
+	if err == nil {
+		t.Fatal("expected an error, got none")
+	}
+	if !strings.Contains(err.Error(), "protocol version") {
+		t.Fatalf("expected a TLS protocol version error, got: %s", err)
+	}
+}
+
+func TestBackendConfig_WithHTTPClient(t *testing.T) {
+	oldEnv := initSessionTestEnv()
+	defer popEnv(oldEnv)
+
+	// The TLS server is only trusted by its own client, so the requests only
+	// succeed if they are sent with it.
+	storage := newMockS3Storage()
+	var requests int
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		storage.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	b := New(WithHTTPClient(ts.Client())).(*Backend)
+	config := map[string]any{
+		"access_key":                  awsbase.MockStaticAccessKey,
+		"secret_key":                  awsbase.MockStaticSecretKey,
+		"bucket":                      "bucket",
+		"key":                         "key",
+		"region":                      "us-west-2",
+		"endpoint":                    ts.URL,
+		"force_path_style":            true,
+		"http_request_timeout":        30,
+		"skip_credentials_validation": true,
+	}
+	obj, diags := b.PrepareConfig(populateSchema(t, b.ConfigSchema(), hcl2shim.HCL2ValueFromConfigValue(config)))
+	if !diags.HasErrors() {
+		diags = diags.Append(b.Configure(obj))
+	}
+	if diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+	}
+
+	client, err := b.remoteClient("default")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if requests == 0 {
+		t.Fatal("expected requests to be sent to the server")
+	}
+
+	httpClient := b.s3Client.Config.HTTPClient
+	if httpClient.Transport != ts.Client().Transport {
+		t.Error("expected the transport of the custom client to be used as it is")
+	}
+	if httpClient.Timeout != 30*time.Second {
+		t.Errorf("expected client timeout %s, got %s", 30*time.Second, httpClient.Timeout)
+	}
+}
@@ -0,0 +1,61 @@
+package s3
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// incompleteUploadMaxAge is the age after which cleanup_incomplete_uploads
+// aborts an incomplete multipart upload. Uploading a state takes seconds, so
+// an upload this old has been abandoned.
+const incompleteUploadMaxAge = 24 * time.Hour
+
+// cleanupIncompleteUploads aborts the incomplete multipart uploads of the
+// objects of the state which are older than incompleteUploadMaxAge, so that
+// the parts of abandoned uploads don't incur storage charges indefinitely.
+// The objects of the state are the state itself and the objects kept
+// alongside it, such as its shards and backups. The cleanup is best effort,
+// so failures are only logged.
+func (c *RemoteClient) cleanupIncompleteUploads() {
+	cutoff := time.Now().Add(-incompleteUploadMaxAge)
+
+	var stale []*s3.MultipartUpload
+	err := c.s3Client.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(c.bucketName),
+		Prefix: aws.String(c.path),
+	}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, upload := range page.Uploads {
+			key := aws.StringValue(upload.Key)
+			// The prefix also matches the objects of states whose key
+			// merely starts with ours.
+			if key != c.path && !strings.HasPrefix(key, c.path+".") {
+				continue
+			}
+			if aws.TimeValue(upload.Initiated).Before(cutoff) {
+				stale = append(stale, upload)
+			}
+		}
+		return !lastPage
+	})
+	if err != nil {
+		log.Printf("[WARN] Failed to list incomplete multipart uploads of state %q: %s", c.path, err)
+		return
+	}
+
+	for _, upload := range stale {
+		_, err := c.s3Client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(c.bucketName),
+			Key:      upload.Key,
+			UploadId: upload.UploadId,
+		})
+		if err != nil {
+			log.Printf("[WARN] Failed to abort incomplete multipart upload %q of %q: %s", aws.StringValue(upload.UploadId), aws.StringValue(upload.Key), err)
+			continue
+		}
+		log.Printf("[INFO] Aborted incomplete multipart upload %q of %q, initiated %s", aws.StringValue(upload.UploadId), aws.StringValue(upload.Key), aws.TimeValue(upload.Initiated).Format(time.RFC3339))
+	}
+}
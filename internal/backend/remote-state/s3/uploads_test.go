@@ -0,0 +1,82 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRemoteClient_cleanupIncompleteUploads(t *testing.T) {
+	stale := time.Now().Add(-2 * incompleteUploadMaxAge).UTC().Format(time.RFC3339)
+	recent := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	uploads := []struct{ key, id, initiated string }{
+		{"state", "stale-state", stale},
+		{"state.shards/0123", "stale-shard", stale},
+		{"state", "recent-state", recent},
+		{"statefoo", "other-state", stale},
+	}
+
+	testCases := map[string]struct {
+		cleanupUploads bool
+		failList       bool
+		expectedAborts []string
+	}{
+		"disabled": {},
+		"enabled": {
+			cleanupUploads: true,
+			expectedAborts: []string{"state.shards/0123:stale-shard", "state:stale-state"},
+		},
+		"list fails": {
+			cleanupUploads: true,
+			failList:       true,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			var aborts []string
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					switch {
+					case r.Method == http.MethodGet && r.URL.Path == "/bucket" && r.URL.Query().Has("uploads"):
+						if tc.failList {
+							writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+							return
+						}
+						if prefix := r.URL.Query().Get("prefix"); prefix != "state" {
+							t.Errorf("expected uploads to be listed with the prefix %q, got %q", "state", prefix)
+						}
+						w.Header().Set("Content-Type", "application/xml")
+						fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ListMultipartUploadsResult><Bucket>bucket</Bucket>`)
+						for _, upload := range uploads {
+							fmt.Fprintf(w, `<Upload><Key>%s</Key><UploadId>%s</UploadId><Initiated>%s</Initiated></Upload>`, upload.key, upload.id, upload.initiated)
+						}
+						fmt.Fprint(w, `<IsTruncated>false</IsTruncated></ListMultipartUploadsResult>`)
+					case r.Method == http.MethodDelete && r.URL.Query().Has("uploadId"):
+						aborts = append(aborts, r.URL.Path[len("/bucket/"):]+":"+r.URL.Query().Get("uploadId"))
+						w.WriteHeader(http.StatusNoContent)
+					default:
+						storage.ServeHTTP(w, r)
+					}
+				}),
+				bucketName:     "bucket",
+				path:           "state",
+				cleanupUploads: tc.cleanupUploads,
+			}
+
+			// The cleanup never fails the write.
+			if err := client.Put([]byte(`{"version": 4}`)); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			sort.Strings(aborts)
+			if !reflect.DeepEqual(aborts, tc.expectedAborts) {
+				t.Fatalf("expected aborted uploads %v, got %v", tc.expectedAborts, aborts)
+			}
+		})
+	}
+}
@@ -2,11 +2,19 @@ package s3
 
 import (
 	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
 	"regexp"
+	"strings"
+	"unicode"
 
 	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/opentofu/opentofu/internal/tfdiags"
 	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/slices"
 )
 
 const (
@@ -85,3 +93,347 @@ func aliasIdFromARNResource(s string) string {
 
 	return matches[1]
 }
+
+// validateDualStackRegion checks that S3 has a dual-stack endpoint in the
+// region. Regions which can't be resolved at all are left to the region
+// validation.
+func validateDualStackRegion(path cty.Path, region string) (diags tfdiags.Diagnostics) {
+	resolver := endpoints.DefaultResolver()
+	if _, err := resolver.EndpointFor(s3.EndpointsID, region, endpoints.StrictMatchingOption); err != nil {
+		return diags
+	}
+
+	_, err := resolver.EndpointFor(s3.EndpointsID, region, endpoints.StrictMatchingOption, func(o *endpoints.Options) {
+		o.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+	})
+	if err != nil {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid use_dualstack_endpoint value",
+			fmt.Sprintf("The region %q has no dual-stack S3 endpoint.", region),
+			path,
+		))
+	}
+	return diags
+}
+
+// signingOptionRegexp matches the service names and regions used in SigV4
+// credential scopes.
+var signingOptionRegexp = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+func validateSigningOption(path cty.Path, s string) (diags tfdiags.Diagnostics) {
+	if !signingOptionRegexp.MatchString(s) {
+		name := path[len(path)-1].(cty.GetAttrStep).Name
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			fmt.Sprintf("Invalid %s value", name),
+			fmt.Sprintf("The value %q must only contain lowercase letters, digits, and dashes.", s),
+			path,
+		))
+	}
+	return diags
+}
+
+// headerNameRegexp matches a valid HTTP header field name, which is an RFC 7230
+// token.
+var headerNameRegexp = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// validateCustomHeaderName checks that name is a valid header name which does
+// not conflict with the headers the AWS SDK sets to authenticate requests.
+func validateCustomHeaderName(path cty.Path, name string) (diags tfdiags.Diagnostics) {
+	if !headerNameRegexp.MatchString(name) {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid custom_headers value",
+			fmt.Sprintf("The header name %q is not a valid HTTP header name.", name),
+			path,
+		))
+		return diags
+	}
+
+	canonical := http.CanonicalHeaderKey(name)
+	switch {
+	case canonical == "Authorization", canonical == "Host", canonical == "Content-Length", strings.HasPrefix(canonical, "X-Amz-"):
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid custom_headers value",
+			fmt.Sprintf("The header %q is set by the AWS SDK and cannot be overridden.", name),
+			path,
+		))
+	}
+	return diags
+}
+
+// validateContentDisposition checks that the value is a valid
+// Content-Disposition header value, such as `attachment; filename="x.tfstate"`.
+func validateContentDisposition(path cty.Path, v string) (diags tfdiags.Diagnostics) {
+	var err error
+	if strings.IndexFunc(v, unicode.IsControl) >= 0 {
+		err = fmt.Errorf("it must not contain control characters")
+	} else {
+		_, _, err = mime.ParseMediaType(v)
+	}
+	if err != nil {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid content_disposition value",
+			fmt.Sprintf("The value %q is not a valid Content-Disposition header value: %s.", v, err),
+			path,
+		))
+	}
+	return diags
+}
+
+// validateCannedACL checks that the value is one of the canned ACLs S3 accepts
+// for objects.
+func validateCannedACL(path cty.Path, v string) (diags tfdiags.Diagnostics) {
+	if slices.Contains(s3.ObjectCannedACL_Values(), v) {
+		return diags
+	}
+	name := path[0].(cty.GetAttrStep).Name
+	diags = diags.Append(tfdiags.AttributeValue(
+		tfdiags.Error,
+		fmt.Sprintf("Invalid %s value", name),
+		fmt.Sprintf("The value %q is not a canned ACL. Expected one of: %s.", v, strings.Join(s3.ObjectCannedACL_Values(), ", ")),
+		path,
+	))
+	return diags
+}
+
+// bucketNameRegexp matches the characters S3 bucket names may consist of,
+// starting and ending with a letter or digit.
+var bucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*[a-z0-9]$`)
+
+// ipAddressRegexp matches names formatted like an IPv4 address.
+var ipAddressRegexp = regexp.MustCompile(`^\d+\.\d+\.\d+\.\d+$`)
+
+// validateBucketName checks that the bucket name follows the S3 bucket naming
+// rules, so that typos are caught before requests fail with opaque errors.
+// See https://docs.aws.amazon.com/AmazonS3/latest/userguide/bucketnamingrules.html.
+func validateBucketName(path cty.Path, attr, name string) (diags tfdiags.Diagnostics) {
+	var problem string
+	switch {
+	case len(name) < 3 || len(name) > 63:
+		problem = "must be between 3 and 63 characters long"
+	case !bucketNameRegexp.MatchString(name):
+		problem = "must consist only of lowercase letters, digits, dots and hyphens, and begin and end with a letter or digit"
+	case strings.Contains(name, ".."):
+		problem = "must not contain two adjacent dots"
+	case ipAddressRegexp.MatchString(name):
+		problem = "must not be formatted as an IP address"
+	case strings.HasPrefix(name, "xn--"), strings.HasPrefix(name, "sthree-"):
+		problem = `must not start with the reserved prefixes "xn--" and "sthree-"`
+	case strings.HasSuffix(name, "-s3alias"), strings.HasSuffix(name, "--ol-s3"):
+		problem = `must not end with the reserved suffixes "-s3alias" and "--ol-s3"`
+	default:
+		return diags
+	}
+
+	diags = diags.Append(tfdiags.AttributeValue(
+		tfdiags.Error,
+		fmt.Sprintf("Invalid %s value", attr),
+		fmt.Sprintf(`The bucket name %q is not valid: S3 bucket names %s. Set "skip_bucket_name_validation" if the S3-compatible store has laxer rules.`, name, problem),
+		path,
+	))
+	return diags
+}
+
+// validateAllowedBucket checks that the bucket is one of the allowed buckets,
+// if a list of allowed buckets is set.
+func validateAllowedBucket(path cty.Path, s string, allowed cty.Value) (diags tfdiags.Diagnostics) {
+	if allowed.IsNull() || allowed.HasElement(cty.StringVal(s)).True() {
+		return diags
+	}
+
+	var names []string
+	for _, v := range allowed.AsValueSlice() {
+		names = append(names, fmt.Sprintf("%q", v.AsString()))
+	}
+	diags = diags.Append(tfdiags.AttributeValue(
+		tfdiags.Error,
+		"Invalid bucket value",
+		fmt.Sprintf(`The bucket %q is not in the list of allowed buckets: %s.`, s, strings.Join(names, ", ")),
+		path,
+	))
+	return diags
+}
+
+// validateGrant checks that a grant block names its grantee by the attribute
+// matching its type, and only grants permissions which apply to objects.
+func validateGrant(path cty.Path, grant cty.Value) (diags tfdiags.Diagnostics) {
+	grantType := stringValue(grant.GetAttr("type"))
+	var required, conflicting string
+	switch grantType {
+	case s3.TypeCanonicalUser:
+		required, conflicting = "id", "uri"
+	case s3.TypeGroup:
+		required, conflicting = "uri", "id"
+	default:
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid grant type",
+			fmt.Sprintf(`The grant type must be %q or %q, got %q.`, s3.TypeCanonicalUser, s3.TypeGroup, grantType),
+			path.GetAttr("type"),
+		))
+		return diags
+	}
+
+	if v, ok := stringValueOk(grant.GetAttr(required)); !ok || v == "" {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Missing grantee",
+			fmt.Sprintf(`A grant of type %q must set %q.`, grantType, required),
+			path.GetAttr(required),
+		))
+	}
+	if v := grant.GetAttr(conflicting); !v.IsNull() {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid grantee",
+			fmt.Sprintf(`A grant of type %q cannot set %q.`, grantType, conflicting),
+			path.GetAttr(conflicting),
+		))
+	}
+
+	permissions := grant.GetAttr("permissions")
+	if permissions.IsNull() || permissions.LengthInt() == 0 {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid permissions value",
+			"At least one permission must be granted.",
+			path.GetAttr("permissions"),
+		))
+		return diags
+	}
+	for _, v := range permissions.AsValueSlice() {
+		permission := v.AsString()
+		valid := false
+		for _, p := range grantPermissions {
+			if permission == p {
+				valid = true
+			}
+		}
+		if !valid {
+			diags = diags.Append(tfdiags.AttributeValue(
+				tfdiags.Error,
+				"Invalid permissions value",
+				fmt.Sprintf(`The permission %q cannot be granted on the state file. Valid values are %q, %q, %q and %q.`, permission, s3.PermissionRead, s3.PermissionReadAcp, s3.PermissionWriteAcp, s3.PermissionFullControl),
+				path.GetAttr("permissions"),
+			))
+		}
+	}
+
+	return diags
+}
+
+// validateEndpointURL checks that an endpoint is a URL with a host. As with
+// the other endpoints, the scheme defaults to HTTPS.
+func validateEndpointURL(path cty.Path, s string) (diags tfdiags.Diagnostics) {
+	endpoint := s
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid endpoint value",
+			fmt.Sprintf(`The endpoint %q must be an HTTPS or HTTP URL with a host.`, s),
+			path,
+		))
+	}
+	return diags
+}
+
+func validateHTTPSEndpoint(path cty.Path, s string) (diags tfdiags.Diagnostics) {
+	if isPlaintextEndpoint(s) {
+		diags = diags.Append(tfdiags.AttributeValue(
+			tfdiags.Error,
+			"Invalid endpoint value",
+			fmt.Sprintf(`The endpoint %q uses plaintext HTTP, which is not allowed when "require_https" is set.`, s),
+			path,
+		))
+	}
+	return diags
+}
+
+// isPlaintextEndpoint reports whether the endpoint explicitly uses the http
+// scheme. Endpoints without a scheme default to HTTPS.
+func isPlaintextEndpoint(s string) bool {
+	return strings.HasPrefix(strings.ToLower(s), "http://")
+}
+
+// validateEndpointRegion warns if an AWS endpoint names a region other than
+// the configured region, which usually results in signature errors or
+// requests being redirected. Custom endpoints whose host name doesn't follow
+// the AWS naming scheme are not checked.
+func validateEndpointRegion(path cty.Path, endpoint, region string) (diags tfdiags.Diagnostics) {
+	endpointRegion, ok := regionFromEndpoint(endpoint)
+	if !ok || endpointRegion == region {
+		return diags
+	}
+
+	diags = diags.Append(tfdiags.AttributeValue(
+		tfdiags.Warning,
+		"Endpoint region mismatch",
+		fmt.Sprintf(`The endpoint %q is in the region %q, but the configured region is %q.`, endpoint, endpointRegion, region),
+		path,
+	))
+	return diags
+}
+
+// regionFromEndpoint returns the region implied by the host name of an AWS
+// endpoint such as "s3.us-west-2.amazonaws.com" or
+// "bucket.s3-eu-west-1.amazonaws.com". It reports false for global and
+// custom endpoints.
+func regionFromEndpoint(endpoint string) (string, bool) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	var ok bool
+	for _, suffix := range []string{".amazonaws.com", ".amazonaws.com.cn"} {
+		var trimmed string
+		if trimmed, ok = strings.CutSuffix(host, suffix); ok {
+			host = trimmed
+			break
+		}
+	}
+	if !ok {
+		return "", false
+	}
+
+	regions := knownRegions()
+	labels := strings.Split(host, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		label := labels[i]
+		if _, ok := regions[label]; ok {
+			return label, true
+		}
+		// Legacy S3 endpoints separate the region with a dash, as in
+		// "s3-us-west-2.amazonaws.com".
+		if _, r, found := strings.Cut(label, "-"); found && strings.HasPrefix(label, "s3") {
+			if _, ok := regions[r]; ok {
+				return r, true
+			}
+		}
+	}
+	return "", false
+}
+
+// knownRegions returns the set of regions in all partitions known to the AWS
+// SDK.
+func knownRegions() map[string]endpoints.Region {
+	regions := make(map[string]endpoints.Region)
+	for _, p := range endpoints.DefaultPartitions() {
+		for id, r := range p.Regions() {
+			regions[id] = r
+		}
+	}
+	return regions
+}
@@ -1,6 +1,7 @@
 package s3
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -136,3 +137,90 @@ func TestValidateKeyARN(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateBucketName(t *testing.T) {
+	t.Parallel()
+
+	path := cty.Path{cty.GetAttrStep{Name: "bucket"}}
+
+	testcases := map[string]struct {
+		in          string
+		expectedErr string
+	}{
+		"valid": {
+			in: "my-state-bucket",
+		},
+		"valid with dots": {
+			in: "state.example.com",
+		},
+		"valid shortest": {
+			in: "abc",
+		},
+		"valid longest": {
+			in: strings.Repeat("a", 63),
+		},
+		"too short": {
+			in:          "ab",
+			expectedErr: "must be between 3 and 63 characters long",
+		},
+		"too long": {
+			in:          strings.Repeat("a", 64),
+			expectedErr: "must be between 3 and 63 characters long",
+		},
+		"uppercase": {
+			in:          "My-Bucket",
+			expectedErr: "must consist only of lowercase letters, digits, dots and hyphens",
+		},
+		"underscore": {
+			in:          "my_bucket",
+			expectedErr: "must consist only of lowercase letters, digits, dots and hyphens",
+		},
+		"leading hyphen": {
+			in:          "-bucket",
+			expectedErr: "begin and end with a letter or digit",
+		},
+		"trailing dot": {
+			in:          "bucket.",
+			expectedErr: "begin and end with a letter or digit",
+		},
+		"adjacent dots": {
+			in:          "my..bucket",
+			expectedErr: "must not contain two adjacent dots",
+		},
+		"ip address": {
+			in:          "192.168.5.4",
+			expectedErr: "must not be formatted as an IP address",
+		},
+		"reserved prefix": {
+			in:          "xn--bucket",
+			expectedErr: `must not start with the reserved prefixes`,
+		},
+		"reserved suffix": {
+			in:          "bucket-s3alias",
+			expectedErr: `must not end with the reserved suffixes`,
+		},
+	}
+
+	for name, testcase := range testcases {
+		testcase := testcase
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			diags := validateBucketName(path, "bucket", testcase.in)
+
+			if testcase.expectedErr == "" {
+				if len(diags) != 0 {
+					t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+				}
+				return
+			}
+			if len(diags) != 1 {
+				t.Fatalf("expected 1 diagnostic, got %d: %s", len(diags), diagnosticsString(diags))
+			}
+			desc := diags[0].Description()
+			if desc.Summary != "Invalid bucket value" || !strings.Contains(desc.Detail, testcase.expectedErr) {
+				t.Fatalf("unexpected diagnostic: %s", diagnosticString(diags[0]))
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+// maxDeleteObjects is the largest number of objects a single DeleteObjects
+// request accepts.
+const maxDeleteObjects = 1000
+
+// PruneStateVersions deletes all but the most recent keep versions of the
+// state object of the given workspace, which accumulate as noncurrent versions
+// in buckets with versioning enabled. The current version is never deleted.
+// The state is locked while versions are pruned, and the number of deleted
+// versions is returned.
+func (b *Backend) PruneStateVersions(ctx context.Context, workspace string, keep int) (int, error) {
+	if keep < 1 {
+		return 0, fmt.Errorf("at least one state version must be kept, got %d", keep)
+	}
+	if err := b.requireBucket("Pruning state versions"); err != nil {
+		return 0, err
+	}
+
+	client, err := b.remoteClient(workspace)
+	if err != nil {
+		return 0, err
+	}
+
+	lockInfo := statemgr.NewLockInfo()
+	lockInfo.Operation = "prune"
+	lockID, err := client.Lock(lockInfo)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock state: %w", err)
+	}
+	defer func() {
+		if err := client.Unlock(lockID); err != nil {
+			log.Printf("[ERROR] Failed to unlock state after pruning versions: %s", err)
+		}
+	}()
+
+	key, err := client.resolveStateKey()
+	if err != nil {
+		return 0, err
+	}
+	if key == "" {
+		return 0, fmt.Errorf(errStatePointerNotFound, client.path, client.bucketName)
+	}
+
+	var versions []*s3.ObjectVersion
+	err = client.s3Client.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(client.bucketName),
+		Prefix: aws.String(key),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		for _, v := range page.Versions {
+			// The prefix also matches the states of other workspaces whose
+			// keys start with this one.
+			if aws.StringValue(v.Key) == key {
+				versions = append(versions, v)
+			}
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list state versions: %w", err)
+	}
+
+	// Order the versions newest first, making sure the current version is
+	// always among those kept.
+	sort.SliceStable(versions, func(i, j int) bool {
+		if latestI, latestJ := aws.BoolValue(versions[i].IsLatest), aws.BoolValue(versions[j].IsLatest); latestI != latestJ {
+			return latestI
+		}
+		return aws.TimeValue(versions[i].LastModified).After(aws.TimeValue(versions[j].LastModified))
+	})
+	if len(versions) <= keep {
+		return 0, nil
+	}
+
+	var objects []*s3.ObjectIdentifier
+	for _, v := range versions[keep:] {
+		objects = append(objects, &s3.ObjectIdentifier{
+			Key:       v.Key,
+			VersionId: v.VersionId,
+		})
+	}
+
+	deleted := 0
+	for len(objects) > 0 {
+		n := len(objects)
+		if n > maxDeleteObjects {
+			n = maxDeleteObjects
+		}
+
+		out, err := client.s3Client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(client.bucketName),
+			Delete: &s3.Delete{
+				Objects: objects[:n],
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete state versions: %w", err)
+		}
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return deleted + n - len(out.Errors), fmt.Errorf("failed to delete state version %q: %s", aws.StringValue(e.VersionId), aws.StringValue(e.Message))
+		}
+
+		deleted += n
+		objects = objects[n:]
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,166 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+func TestBackend_PruneStateVersions(t *testing.T) {
+	// Versions of the state object, newest first, as S3 lists them, plus a
+	// version of another workspace's state sharing the prefix.
+	const listVersions = `<?xml version="1.0" encoding="UTF-8"?>
+<ListVersionsResult>
+  <Name>bucket</Name>
+  <Prefix>state</Prefix>
+  <IsTruncated>false</IsTruncated>
+  <Version><Key>state</Key><VersionId>v4</VersionId><IsLatest>true</IsLatest><LastModified>2023-01-04T00:00:00.000Z</LastModified></Version>
+  <Version><Key>state</Key><VersionId>v3</VersionId><IsLatest>false</IsLatest><LastModified>2023-01-03T00:00:00.000Z</LastModified></Version>
+  <Version><Key>state</Key><VersionId>v2</VersionId><IsLatest>false</IsLatest><LastModified>2023-01-02T00:00:00.000Z</LastModified></Version>
+  <Version><Key>state</Key><VersionId>v1</VersionId><IsLatest>false</IsLatest><LastModified>2023-01-01T00:00:00.000Z</LastModified></Version>
+  <Version><Key>state-other</Key><VersionId>o1</VersionId><IsLatest>false</IsLatest><LastModified>2022-01-01T00:00:00.000Z</LastModified></Version>
+</ListVersionsResult>`
+
+	testCases := map[string]struct {
+		keep            int
+		expectedDeleted []string
+		expectedErr     string
+	}{
+		"keep two": {
+			keep:            2,
+			expectedDeleted: []string{"v1", "v2"},
+		},
+		"keep one": {
+			keep:            1,
+			expectedDeleted: []string{"v1", "v2", "v3"},
+		},
+		"keep all": {
+			keep: 10,
+		},
+		"keep none": {
+			keep:        0,
+			expectedErr: "at least one state version must be kept",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var deleted []string
+			b := &Backend{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					query := r.URL.Query()
+					switch {
+					case r.Method == http.MethodGet && query.Has("versions"):
+						w.Header().Set("Content-Type", "application/xml")
+						fmt.Fprint(w, listVersions)
+					case r.Method == http.MethodPost && query.Has("delete"):
+						var req struct {
+							Objects []struct {
+								Key       string
+								VersionId string
+							} `xml:"Object"`
+						}
+						if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+							t.Errorf("invalid DeleteObjects request: %s", err)
+						}
+						for _, o := range req.Objects {
+							if o.Key != "state" {
+								t.Errorf("unexpected object %q deleted", o.Key)
+							}
+							deleted = append(deleted, o.VersionId)
+						}
+						w.Header().Set("Content-Type", "application/xml")
+						fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><DeleteResult></DeleteResult>`)
+					default:
+						t.Errorf("unexpected request %s %s", r.Method, r.URL)
+					}
+				}),
+				bucketName: "bucket",
+				keyName:    "state",
+			}
+
+			n, err := b.PruneStateVersions(context.Background(), backend.DefaultStateName, tc.keep)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			sort.Strings(deleted)
+			if strings.Join(deleted, ",") != strings.Join(tc.expectedDeleted, ",") {
+				t.Fatalf("expected versions %q to be deleted, got %q", tc.expectedDeleted, deleted)
+			}
+			if n != len(tc.expectedDeleted) {
+				t.Fatalf("expected %d deleted versions to be reported, got %d", len(tc.expectedDeleted), n)
+			}
+		})
+	}
+}
+
+func TestBackend_PruneStateVersionsKeyIsPointer(t *testing.T) {
+	// Only the versions of the state the pointer refers to are pruned, not
+	// those of the pointer itself.
+	const listVersions = `<?xml version="1.0" encoding="UTF-8"?>
+<ListVersionsResult>
+  <Name>bucket</Name>
+  <Prefix>versions/1</Prefix>
+  <IsTruncated>false</IsTruncated>
+  <Version><Key>versions/1</Key><VersionId>v2</VersionId><IsLatest>true</IsLatest><LastModified>2023-01-02T00:00:00.000Z</LastModified></Version>
+  <Version><Key>versions/1</Key><VersionId>v1</VersionId><IsLatest>false</IsLatest><LastModified>2023-01-01T00:00:00.000Z</LastModified></Version>
+</ListVersionsResult>`
+
+	var deleted []string
+	b := &Backend{
+		s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			switch {
+			case r.Method == http.MethodGet && query.Has("versions"):
+				if prefix := query.Get("prefix"); prefix != "versions/1" {
+					t.Errorf("expected the versions of %q to be listed, got %q", "versions/1", prefix)
+				}
+				w.Header().Set("Content-Type", "application/xml")
+				fmt.Fprint(w, listVersions)
+			case r.Method == http.MethodGet && r.URL.Path == "/bucket/state":
+				fmt.Fprint(w, "versions/1\n")
+			case r.Method == http.MethodPost && query.Has("delete"):
+				var req struct {
+					Objects []struct {
+						Key       string
+						VersionId string
+					} `xml:"Object"`
+				}
+				if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("invalid DeleteObjects request: %s", err)
+				}
+				for _, o := range req.Objects {
+					deleted = append(deleted, o.Key+"@"+o.VersionId)
+				}
+				w.Header().Set("Content-Type", "application/xml")
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><DeleteResult></DeleteResult>`)
+			default:
+				t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			}
+		}),
+		bucketName:   "bucket",
+		keyName:      "state",
+		keyIsPointer: true,
+	}
+
+	if _, err := b.PruneStateVersions(context.Background(), backend.DefaultStateName, 1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Join(deleted, ",") != "versions/1@v1" {
+		t.Fatalf("expected version v1 of the target state to be deleted, got %q", deleted)
+	}
+}
@@ -0,0 +1,205 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+// workspaceIndexClient returns a client for the workspace index object set by
+// workspace_index_key. It's only used to lock, read and write the index, which
+// is encrypted and locked like the state of the default workspace.
+func (b *Backend) workspaceIndexClient() *RemoteClient {
+	return &RemoteClient{
+		s3Client:              b.s3Client,
+		dynClient:             b.dynClient,
+		bucketName:            b.bucketName,
+		path:                  b.workspaceIndexKey,
+		serverSideEncryption:  b.serverSideEncryption,
+		customerEncryptionKey: b.customerEncryptionKey,
+		kmsKeyID:              b.kmsKeyID,
+		acl:                   b.acl,
+		grants:                b.grants,
+		ddbTable:              b.ddbTable,
+		lockRetryMaxAttempts:  b.lockRetryMaxAttempts,
+		lockRetryWait:         b.lockRetryWait,
+		lockInitialJitter:     b.lockInitialJitter,
+		lockMaxAge:            b.lockMaxAge,
+		malformedLockAction:   b.malformedLockAction,
+		lockMetadataEnv:       b.lockMetadataEnv,
+		locker:                b.locker,
+	}
+}
+
+// indexedWorkspaces returns the workspaces in the workspace index. Until the
+// index is written, only the default workspace exists.
+func (b *Backend) indexedWorkspaces() ([]string, error) {
+	names, err := b.workspaceIndexClient().getWorkspaceIndex()
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{backend.DefaultStateName}, names...), nil
+}
+
+// addIndexedWorkspace adds the named workspace to the workspace index, if it
+// isn't in it already.
+func (b *Backend) addIndexedWorkspace(name string) error {
+	return b.updateWorkspaceIndex(func(names []string) ([]string, error) {
+		return append(names, name), nil
+	})
+}
+
+// removeIndexedWorkspace removes the named workspaces from the workspace
+// index.
+func (b *Backend) removeIndexedWorkspace(removed ...string) error {
+	remove := make(map[string]bool, len(removed))
+	for _, name := range removed {
+		remove[normalizeKey(b.keyCase, name)] = true
+	}
+	return b.updateWorkspaceIndex(func(names []string) ([]string, error) {
+		kept := names[:0]
+		for _, n := range names {
+			if !remove[normalizeKey(b.keyCase, n)] {
+				kept = append(kept, n)
+			}
+		}
+		return kept, nil
+	})
+}
+
+// RebuildWorkspaceIndex replaces the workspace index with the workspaces found
+// by listing the bucket, for when the index is out of date, such as after
+// workspaces were created by configurations without workspace_index_key.
+func (b *Backend) RebuildWorkspaceIndex() error {
+	if err := b.requireBucket("Rebuilding the workspace index"); err != nil {
+		return err
+	}
+	if b.workspaceIndexKey == "" {
+		return errors.New("workspace_index_key is not set")
+	}
+	return b.updateWorkspaceIndex(func([]string) ([]string, error) {
+		wss, err := b.listWorkspaces()
+		if err != nil {
+			return nil, err
+		}
+		return wss[1:], nil
+	})
+}
+
+// updateWorkspaceIndex replaces the workspace index with the result of update,
+// holding the lock of the index in between, so that concurrent updates aren't
+// lost.
+func (b *Backend) updateWorkspaceIndex(update func([]string) ([]string, error)) error {
+	client := b.workspaceIndexClient()
+
+	lockInfo := statemgr.NewLockInfo()
+	lockInfo.Operation = "workspace index"
+	lockID, err := client.Lock(lockInfo)
+	if err != nil {
+		return fmt.Errorf("failed to lock workspace index: %w", err)
+	}
+	defer func() {
+		if err := client.Unlock(lockID); err != nil {
+			log.Printf("[WARN] Failed to unlock workspace index %q: %s", client.path, err)
+		}
+	}()
+
+	names, err := client.getWorkspaceIndex()
+	if err != nil {
+		return err
+	}
+	names, err = update(names)
+	if err != nil {
+		return err
+	}
+	return client.putWorkspaceIndex(names)
+}
+
+// getWorkspaceIndex returns the workspace names in the index object, other
+// than the default workspace, sorted by name. A missing index is empty.
+func (c *RemoteClient) getWorkspaceIndex() ([]string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: &c.bucketName,
+		Key:    &c.path,
+	}
+	if c.serverSideEncryption && c.customerEncryptionKey != nil {
+		input.SetSSECustomerKey(string(c.customerEncryptionKey))
+		input.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		input.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+	}
+
+	output, err := c.s3Client.GetObject(input)
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil
+		}
+		if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchBucket {
+			return nil, fmt.Errorf(errS3NoSuchBucket, c.bucketName, err)
+		}
+		return nil, fmt.Errorf("failed to read workspace index %q: %w", c.path, err)
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace index %q: %w", c.path, err)
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("workspace index %q is not a JSON list of workspace names: %w", c.path, err)
+	}
+	return sortedWorkspaceNames(names), nil
+}
+
+// putWorkspaceIndex writes the workspace index object, listing the given
+// workspace names.
+func (c *RemoteClient) putWorkspaceIndex(names []string) error {
+	data, err := json.Marshal(sortedWorkspaceNames(names))
+	if err != nil {
+		return err
+	}
+
+	i := &s3.PutObjectInput{
+		ContentType:   aws.String("application/json"),
+		ContentLength: aws.Int64(int64(len(data))),
+		Body:          bytes.NewReader(data),
+		Bucket:        &c.bucketName,
+		Key:           &c.path,
+	}
+	c.setPutObjectOptions(i)
+
+	if _, err := c.s3Client.PutObject(i); err != nil {
+		return fmt.Errorf("failed to write workspace index %q: %w", c.path, err)
+	}
+	return nil
+}
+
+// sortedWorkspaceNames returns the workspace names sorted and without
+// duplicates, empty names or the default workspace, which always exists.
+func sortedWorkspaceNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	sorted := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || name == backend.DefaultStateName || seen[name] {
+			continue
+		}
+		seen[name] = true
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
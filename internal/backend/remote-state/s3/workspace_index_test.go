@@ -0,0 +1,109 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+func TestBackend_workspaceIndex(t *testing.T) {
+	storage := newMockS3Storage()
+	b := &Backend{
+		s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			// Listing requests are for the bucket itself rather than a key.
+			if r.Method == http.MethodGet && !strings.Contains(strings.Trim(r.URL.Path, "/"), "/") {
+				t.Errorf("unexpected listing request: %s", r.URL)
+				writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+				return
+			}
+			storage.ServeHTTP(w, r)
+		}),
+		bucketName:         "bucket",
+		keyName:            "state",
+		workspaceKeyPrefix: "env:",
+		workspaceIndexKey:  "workspaces.json",
+	}
+
+	checkWorkspaces := func(expected ...string) {
+		t.Helper()
+		workspaces, err := b.Workspaces()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if expected := append([]string{backend.DefaultStateName}, expected...); !reflect.DeepEqual(workspaces, expected) {
+			t.Fatalf("expected workspaces %q, got %q", expected, workspaces)
+		}
+	}
+
+	checkWorkspaces()
+
+	for _, name := range []string{"prod", "dev", "dev"} {
+		if _, err := b.StateMgr(name); err != nil {
+			t.Fatalf("unexpected error creating workspace %q: %s", name, err)
+		}
+	}
+	checkWorkspaces("dev", "prod")
+	if got, expected := string(storage.objects["bucket/workspaces.json"].body), `["dev","prod"]`; got != expected {
+		t.Fatalf("expected the index %s, got %s", expected, got)
+	}
+
+	if err := b.DeleteWorkspace("dev", false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkWorkspaces("prod")
+	if _, ok := storage.objects["bucket/env:/dev/state"]; ok {
+		t.Fatal("expected the state of the deleted workspace to be removed")
+	}
+}
+
+func TestBackend_RebuildWorkspaceIndex(t *testing.T) {
+	storage := newMockS3Storage()
+	storage.objects["bucket/env:/dev/state"] = &mockS3Object{body: []byte(`{"version": 4}`), header: http.Header{}}
+	storage.objects["bucket/env:/prod/state"] = &mockS3Object{body: []byte(`{"version": 4}`), header: http.Header{}}
+	storage.objects["bucket/workspaces.json"] = &mockS3Object{body: []byte(`["dev","deleted"]`), header: http.Header{}}
+
+	b := &Backend{
+		s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || strings.Contains(strings.Trim(r.URL.Path, "/"), "/") {
+				storage.ServeHTTP(w, r)
+				return
+			}
+
+			var keys []string
+			for name := range storage.objects {
+				if key, ok := strings.CutPrefix(name, "bucket/"); ok && strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><IsTruncated>false</IsTruncated>`)
+			for _, key := range keys {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size></Contents>`, key, len(storage.objects["bucket/"+key].body))
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+		}),
+		bucketName:         "bucket",
+		keyName:            "state",
+		workspaceKeyPrefix: "env:",
+		workspaceIndexKey:  "workspaces.json",
+	}
+
+	if err := b.RebuildWorkspaceIndex(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{backend.DefaultStateName, "dev", "prod"}; !reflect.DeepEqual(workspaces, expected) {
+		t.Fatalf("expected workspaces %q, got %q", expected, workspaces)
+	}
+}
@@ -0,0 +1,92 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+// knownWorkspaces returns the workspaces which can be found without listing
+// the bucket, when skip_workspace_listing is set: the default workspace and
+// the workspaces in workspace_buckets whose state exists.
+func (b *Backend) knownWorkspaces() ([]string, error) {
+	wss := []string{backend.DefaultStateName}
+	for ws, bucket := range b.workspaceBuckets {
+		if ws == backend.DefaultStateName {
+			continue
+		}
+		exists, err := b.headStateExists(bucket, b.path(ws))
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			wss = append(wss, ws)
+		}
+	}
+
+	sort.Strings(wss[1:])
+	return wss, nil
+}
+
+// workspaceExists reports whether the state of the named workspace exists.
+// The default workspace always exists.
+func (b *Backend) workspaceExists(name string) (bool, error) {
+	if b.skipWorkspaceListing {
+		if name == backend.DefaultStateName {
+			return true, nil
+		}
+		return b.headStateExists(b.workspaceBucket(name), b.path(name))
+	}
+
+	existing, err := b.Workspaces()
+	if err != nil {
+		return false, err
+	}
+	for _, s := range existing {
+		if normalizeKey(b.keyCase, s) == normalizeKey(b.keyCase, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// headStateExists reports whether the state object with the given key exists
+// in the bucket, by requesting its metadata rather than listing the bucket,
+// which only requires permission to read the object.
+func (b *Backend) headStateExists(bucket, key string) (bool, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}
+	if b.serverSideEncryption && b.customerEncryptionKey != nil {
+		sum := md5.Sum(b.customerEncryptionKey)
+		input.SetSSECustomerKey(string(b.customerEncryptionKey))
+		input.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		input.SetSSECustomerKeyMD5(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+
+	client := b.bucketClient(bucket)
+	_, err := client.HeadObject(input)
+	var reqErr awserr.RequestFailure
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound:
+		// Responses to HEAD requests have no body, so a missing bucket is
+		// reported just like a missing object, and must be ruled out before
+		// the state is taken to be missing.
+		if _, err := client.HeadBucket(&s3.HeadBucketInput{Bucket: &bucket}); errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+			return false, fmt.Errorf(errS3NoSuchBucket, bucket, err)
+		}
+		return false, nil
+	default:
+		return false, err
+	}
+}
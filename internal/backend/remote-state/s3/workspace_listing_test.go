@@ -0,0 +1,114 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/opentofu/opentofu/internal/backend"
+)
+
+func TestBackend_skipWorkspaceListing(t *testing.T) {
+	storage := newMockS3Storage()
+	storage.objects["bucket/state"] = &mockS3Object{body: []byte(`{"version": 4}`), header: http.Header{}}
+	storage.objects["staging-bucket/env:/staging/state"] = &mockS3Object{body: []byte(`{"version": 4}`), header: http.Header{}}
+
+	b := &Backend{
+		s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			// Listing requests are for the bucket itself rather than a key.
+			if r.Method == http.MethodGet && !strings.Contains(strings.Trim(r.URL.Path, "/"), "/") {
+				t.Errorf("unexpected listing request: %s", r.URL)
+				writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+				return
+			}
+			storage.ServeHTTP(w, r)
+		}),
+		bucketName:         "bucket",
+		keyName:            "state",
+		workspaceKeyPrefix: "env:",
+		workspaceBuckets: map[string]string{
+			"staging":    "staging-bucket",
+			"production": "production-bucket",
+		},
+		skipWorkspaceListing: true,
+	}
+
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{backend.DefaultStateName, "staging"}; !reflect.DeepEqual(workspaces, expected) {
+		t.Fatalf("expected workspaces %q, got %q", expected, workspaces)
+	}
+
+	for _, name := range []string{backend.DefaultStateName, "staging"} {
+		stateMgr, err := b.StateMgr(name)
+		if err != nil {
+			t.Fatalf("unexpected error for workspace %q: %s", name, err)
+		}
+		if err := stateMgr.RefreshState(); err != nil {
+			t.Fatalf("unexpected error refreshing workspace %q: %s", name, err)
+		}
+	}
+}
+
+func TestBackend_workspaceBucketRegion(t *testing.T) {
+	storage := newMockS3Storage()
+	storage.objects["bucket/state"] = &mockS3Object{body: []byte(`{"version": 4}`), header: http.Header{}}
+	storage.objects["eu-bucket/env:/eu/state"] = &mockS3Object{body: []byte(`{"version": 4}`), header: http.Header{}}
+
+	client := mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+		// Like S3, redirect requests for the bucket in eu-west-1 unless they
+		// are signed for its region. The region is looked up anonymously.
+		if strings.HasPrefix(r.URL.Path, "/eu-bucket") && !strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/") {
+			w.Header().Set("X-Amz-Bucket-Region", "eu-west-1")
+			writeS3Error(w, http.StatusMovedPermanently, "PermanentRedirect", "The bucket you are attempting to access must be addressed using the specified endpoint.")
+			return
+		}
+		if bucket := strings.Trim(r.URL.Path, "/"); r.Method == http.MethodGet && !strings.Contains(bucket, "/") {
+			prefix := r.URL.Query().Get("prefix")
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<ListBucketResult>`)
+			for name := range storage.objects {
+				if key, ok := strings.CutPrefix(name, bucket+"/"); ok && strings.HasPrefix(key, prefix) {
+					fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>14</Size></Contents>`, key)
+				}
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+			return
+		}
+		storage.ServeHTTP(w, r)
+	})
+	b := &Backend{
+		s3Client:           client,
+		s3Session:          mockSession(aws.StringValue(client.Config.Endpoint)),
+		bucketName:         "bucket",
+		keyName:            "state",
+		workspaceKeyPrefix: "env:",
+		workspaceBuckets: map[string]string{
+			"eu": "eu-bucket",
+		},
+	}
+
+	for _, skipListing := range []bool{false, true} {
+		b.skipWorkspaceListing = skipListing
+		workspaces, err := b.Workspaces()
+		if err != nil {
+			t.Fatalf("unexpected error with skip_workspace_listing %t: %s", skipListing, err)
+		}
+		if expected := []string{backend.DefaultStateName, "eu"}; !reflect.DeepEqual(workspaces, expected) {
+			t.Fatalf("expected workspaces %q with skip_workspace_listing %t, got %q", expected, skipListing, workspaces)
+		}
+	}
+
+	stateMgr, err := b.StateMgr("eu")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := stateMgr.RefreshState(); err != nil {
+		t.Fatalf("unexpected error refreshing state: %s", err)
+	}
+}
@@ -0,0 +1,128 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+	"github.com/opentofu/opentofu/internal/tfdiags"
+)
+
+// defaultDeleteWorkspacesParallelism is the number of workspaces
+// DeleteWorkspaces deletes at the same time unless told otherwise.
+const defaultDeleteWorkspacesParallelism = 10
+
+// DeleteWorkspaces deletes the state of each of the named workspaces,
+// deleting up to parallelism workspaces at the same time, or a default number
+// of them if parallelism is not positive. The default workspace and
+// workspaces which are currently locked are not deleted; each workspace which
+// is not deleted is reported with an error diagnostic. The deleted workspaces
+// are removed from the workspace index once all of them are deleted, if
+// workspace_index_key is set.
+func (b *Backend) DeleteWorkspaces(ctx context.Context, names []string, parallelism int) tfdiags.Diagnostics {
+	if parallelism <= 0 {
+		parallelism = defaultDeleteWorkspacesParallelism
+	}
+
+	var mu sync.Mutex
+	var diags tfdiags.Diagnostics
+	var deleted []string
+	appendErr := func(name string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		diags = diags.Append(tfdiags.Sourceless(
+			tfdiags.Error,
+			"Failed to delete workspace",
+			fmt.Sprintf("The workspace %q was not deleted: %s", name, err),
+		))
+	}
+
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if name == backend.DefaultStateName || name == "" {
+			appendErr(name, fmt.Errorf("can't delete default state"))
+			continue
+		}
+
+		// NewLockInfo is not safe for concurrent use.
+		lockInfo := statemgr.NewLockInfo()
+		lockInfo.Operation = "delete"
+
+		wg.Add(1)
+		go func(name string, lockInfo *statemgr.LockInfo) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				appendErr(name, ctx.Err())
+				return
+			}
+
+			if err := b.deleteUnlockedWorkspace(name, lockInfo); err != nil {
+				appendErr(name, err)
+				return
+			}
+			mu.Lock()
+			deleted = append(deleted, name)
+			mu.Unlock()
+		}(name, lockInfo)
+	}
+	wg.Wait()
+
+	// The index is updated once, rather than for each workspace, since each
+	// update locks the index.
+	if b.workspaceIndexKey != "" && b.localMirrorPath == "" && len(deleted) > 0 {
+		if err := b.removeIndexedWorkspace(deleted...); err != nil {
+			diags = diags.Append(tfdiags.Sourceless(
+				tfdiags.Error,
+				"Failed to update workspace index",
+				fmt.Sprintf("The workspaces were deleted, but could not be removed from the workspace index %q: %s", b.workspaceIndexKey, err),
+			))
+		}
+	}
+
+	return diags
+}
+
+// deleteUnlockedWorkspace deletes the state of a workspace, and its lock and
+// digest items in DynamoDB. The workspace is locked while it is deleted, so
+// that a workspace which is in use is never deleted. The state in the local
+// mirror can't be locked, so it is deleted as it is, like DeleteWorkspace
+// does.
+func (b *Backend) deleteUnlockedWorkspace(name string, lockInfo *statemgr.LockInfo) error {
+	if b.localMirrorPath != "" {
+		return b.mirrorClient(name).Delete()
+	}
+
+	client, err := b.remoteClient(name)
+	if err != nil {
+		return err
+	}
+
+	lockID, err := client.Lock(lockInfo)
+	if err != nil {
+		return fmt.Errorf("the state is locked: %w", err)
+	}
+
+	if err := client.Delete(); err != nil {
+		if unlockErr := client.Unlock(lockID); unlockErr != nil {
+			log.Printf("[ERROR] Failed to unlock workspace %q: %s", name, unlockErr)
+		}
+		return err
+	}
+
+	// Releasing the lock removes the workspace's lock item.
+	return client.Unlock(lockID)
+}
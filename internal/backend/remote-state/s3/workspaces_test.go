@@ -0,0 +1,139 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/opentofu/opentofu/internal/backend"
+	"github.com/opentofu/opentofu/internal/states/statemgr"
+)
+
+func TestBackend_DeleteWorkspaces(t *testing.T) {
+	storage := newMockS3Storage()
+	for _, name := range []string{"a", "b", "locked", "broken"} {
+		storage.objects["bucket/env:/"+name+"/state"] = &mockS3Object{body: []byte(`{}`), header: http.Header{}}
+	}
+
+	// A minimal DynamoDB table holding items by their LockID.
+	var mu sync.Mutex
+	items := map[string]map[string]any{}
+	lockedInfo := statemgr.NewLockInfo()
+	items["bucket/env:/locked/state"] = map[string]any{
+		"LockID": map[string]string{"S": "bucket/env:/locked/state"},
+		"Info":   map[string]string{"S": string(lockedInfo.Marshal())},
+	}
+
+	dynClient := mockDynamoDBClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var input struct {
+			Item map[string]any
+			Key  struct {
+				LockID struct{ S string }
+			}
+			ConditionExpression string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Errorf("invalid DynamoDB request: %s", err)
+		}
+
+		switch dynamoDBOperation(r) {
+		case "PutItem":
+			id := input.Item["LockID"].(map[string]any)["S"].(string)
+			if _, ok := items[id]; ok && input.ConditionExpression != "" {
+				writeDynamoDBError(w, dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed")
+				return
+			}
+			items[id] = input.Item
+			writeDynamoDBResponse(w, map[string]any{})
+		case "GetItem":
+			resp := map[string]any{}
+			if item, ok := items[input.Key.LockID.S]; ok {
+				resp["Item"] = item
+			}
+			writeDynamoDBResponse(w, resp)
+		case "DeleteItem":
+			delete(items, input.Key.LockID.S)
+			writeDynamoDBResponse(w, map[string]any{})
+		default:
+			t.Errorf("unexpected DynamoDB operation %q", dynamoDBOperation(r))
+		}
+	})
+
+	b := &Backend{
+		s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodDelete && strings.Contains(r.URL.Path, "/broken/") {
+				writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+				return
+			}
+			storage.ServeHTTP(w, r)
+		}),
+		dynClient:          dynClient,
+		bucketName:         "bucket",
+		keyName:            "state",
+		workspaceKeyPrefix: "env:",
+		ddbTable:           "table",
+	}
+
+	diags := b.DeleteWorkspaces(context.Background(), []string{"a", backend.DefaultStateName, "b", "locked", "broken", "a"}, 2)
+
+	var failed []string
+	for _, diag := range diags {
+		detail := diag.Description().Detail
+		for _, name := range []string{backend.DefaultStateName, "a", "b", "locked", "broken"} {
+			if strings.HasPrefix(detail, `The workspace "`+name+`"`) {
+				failed = append(failed, name)
+			}
+		}
+	}
+	sort.Strings(failed)
+	if strings.Join(failed, ",") != "broken,default,locked" {
+		t.Fatalf("expected deleting broken, default and locked to fail, got %v: %s", failed, diagnosticsString(diags))
+	}
+
+	for name, expected := range map[string]bool{"a": false, "b": false, "locked": true, "broken": true} {
+		if _, ok := storage.objects["bucket/env:/"+name+"/state"]; ok != expected {
+			t.Errorf("expected state of workspace %q to exist to be %t", name, expected)
+		}
+	}
+
+	// Only the lock of the workspace that was locked before remains.
+	if len(items) != 1 || items["bucket/env:/locked/state"] == nil {
+		t.Errorf("unexpected DynamoDB items left: %v", items)
+	}
+}
+
+func TestBackend_DeleteWorkspacesIndex(t *testing.T) {
+	storage := newMockS3Storage()
+	b := &Backend{
+		s3Client:           mockS3Client(t, storage.ServeHTTP),
+		bucketName:         "bucket",
+		keyName:            "state",
+		workspaceKeyPrefix: "env:",
+		workspaceIndexKey:  "workspaces.json",
+	}
+	for _, name := range []string{"dev", "prod", "test"} {
+		if _, err := b.StateMgr(name); err != nil {
+			t.Fatalf("unexpected error creating workspace %q: %s", name, err)
+		}
+	}
+
+	if diags := b.DeleteWorkspaces(context.Background(), []string{"dev", "test"}, 2); diags.HasErrors() {
+		t.Fatalf("unexpected diagnostics: %s", diagnosticsString(diags))
+	}
+
+	workspaces, err := b.Workspaces()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, expected := strings.Join(workspaces, ","), "default,prod"; got != expected {
+		t.Fatalf("expected workspaces %q after deleting, got %q", expected, got)
+	}
+}
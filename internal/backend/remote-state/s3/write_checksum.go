@@ -0,0 +1,83 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// writeChecksum returns the base64-encoded SHA-256 checksum of an uploaded
+// body, in the form S3 reports object checksums in.
+func writeChecksum(body []byte) string {
+	sum := sha256.Sum256(body)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// checkWrittenChecksum verifies that the state object in the bucket has the
+// given SHA-256 checksum of the uploaded body, for verify_write_checksum.
+//
+// The checksum is requested from the store along with the object metadata.
+// Stores which don't keep checksums return none, in which case the object is
+// read back and its checksum computed locally instead.
+func (c *RemoteClient) checkWrittenChecksum(expected string) error {
+	head := &s3.HeadObjectInput{
+		Bucket:       &c.bucketName,
+		Key:          &c.path,
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	}
+	get := &s3.GetObjectInput{
+		Bucket: &c.bucketName,
+		Key:    &c.path,
+	}
+	if c.serverSideEncryption && c.customerEncryptionKey != nil {
+		head.SetSSECustomerKey(string(c.customerEncryptionKey))
+		head.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		head.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+		get.SetSSECustomerKey(string(c.customerEncryptionKey))
+		get.SetSSECustomerAlgorithm(s3EncryptionAlgorithm)
+		get.SetSSECustomerKeyMD5(c.getSSECustomerKeyMD5())
+	}
+
+	output, err := c.s3Client.HeadObject(head)
+	if err != nil {
+		return fmt.Errorf("failed to verify the checksum of state %q: %w", c.path, err)
+	}
+	if actual := aws.StringValue(output.ChecksumSHA256); actual != "" {
+		if actual != expected {
+			return fmt.Errorf(errWriteChecksumMismatch, c.path, expected, actual)
+		}
+		return nil
+	}
+
+	log.Printf("[DEBUG] No checksum returned for state %q, reading it back to verify it", c.path)
+	// The body must be compared as it's stored, so it must not be
+	// decompressed on the way.
+	body, err := c.s3Client.GetObjectWithContext(context.Background(), get, request.WithSetRequestHeaders(map[string]string{"Accept-Encoding": "identity"}))
+	if err != nil {
+		return fmt.Errorf("failed to verify the checksum of state %q: %w", c.path, err)
+	}
+	defer body.Body.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, body.Body); err != nil {
+		return fmt.Errorf("failed to verify the checksum of state %q: %w", c.path, err)
+	}
+	if actual := base64.StdEncoding.EncodeToString(h.Sum(nil)); actual != expected {
+		return fmt.Errorf(errWriteChecksumMismatch, c.path, expected, actual)
+	}
+	return nil
+}
+
+const errWriteChecksumMismatch = `state %q was corrupted while it was written.
+
+The SHA-256 checksum of the state uploaded is %q, but the checksum of the
+object stored is %q. Something between OpenTofu and the store, such as a proxy
+or gateway, changed the state in transit, so the stored state must not be
+trusted. Write the state again once the cause is fixed.`
@@ -0,0 +1,101 @@
+package s3
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRemoteClient_verifyWriteChecksum(t *testing.T) {
+	state := []byte(`{"version": 4, "serial": 1, "lineage": "checksum"}`)
+
+	testCases := map[string]struct {
+		corrupt        bool
+		storeChecksum  string
+		expectReadBack bool
+		expectedErr    string
+	}{
+		"intact": {
+			expectReadBack: true,
+		},
+		"corrupted in transit": {
+			corrupt:        true,
+			expectReadBack: true,
+			expectedErr:    "was corrupted while it was written",
+		},
+		"store checksum": {
+			storeChecksum: writeChecksum(state),
+		},
+		"store checksum mismatch": {
+			storeChecksum: writeChecksum([]byte("something else")),
+			expectedErr:   "was corrupted while it was written",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			storage := newMockS3Storage()
+			table := &mockSerialTable{items: make(map[string]map[string]map[string]string)}
+			var readBack bool
+			client := &RemoteClient{
+				s3Client: mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+					switch r.Method {
+					case http.MethodPut:
+						if r.Header.Get("X-Amz-Checksum-Sha256") != writeChecksum(state) {
+							t.Errorf("expected the checksum of the state to be uploaded, got %q", r.Header.Get("X-Amz-Checksum-Sha256"))
+						}
+						if tc.corrupt {
+							body, _ := io.ReadAll(r.Body)
+							r.Body = io.NopCloser(bytes.NewReader(bytes.Replace(body, []byte("1"), []byte("2"), 1)))
+						}
+					case http.MethodHead:
+						if r.Header.Get("X-Amz-Checksum-Mode") != "ENABLED" {
+							t.Error("expected the checksum to be requested")
+						}
+						if tc.storeChecksum != "" {
+							w.Header().Set("X-Amz-Checksum-Sha256", tc.storeChecksum)
+						}
+					case http.MethodGet:
+						readBack = true
+					}
+					storage.ServeHTTP(w, r)
+				}),
+				dynClient:           mockDynamoDBClient(t, table.ServeHTTP),
+				bucketName:          "bucket",
+				path:                "state",
+				ddbTable:            "table",
+				checkSerial:         true,
+				verifyWriteChecksum: true,
+			}
+
+			err := client.Put(state)
+			if readBack != tc.expectReadBack {
+				t.Errorf("expected the state to be read back: %t, got %t", tc.expectReadBack, readBack)
+			}
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if client.readSerial == nil || *client.readSerial != 1 {
+					t.Fatalf("expected the serial to advance to 1, got %v", client.readSerial)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Fatalf("expected error containing %q, got: %v", tc.expectedErr, err)
+			}
+			if client.readSerial != nil {
+				t.Fatalf("expected the serial not to advance, got %d", *client.readSerial)
+			}
+			for id, item := range table.items {
+				if _, ok := item[stateSerialAttribute]; ok {
+					t.Fatalf("expected the serial to be reverted, got %v in %q", item[stateSerialAttribute], id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package s3
+
+// StateWrite describes a state written by the backend, as passed to the hook
+// set with WithPostWriteHook.
+type StateWrite struct {
+	// Workspace is the name of the workspace whose state was written.
+	Workspace string
+
+	// Bucket and Key locate the state object. With key_is_pointer, they're
+	// those of the object the pointer refers to.
+	Bucket string
+	Key    string
+
+	// Serial is the serial of the state, or zero if it has none.
+	Serial uint64
+
+	// ETag is the ETag of the state object S3 returned for the write.
+	ETag string
+}
+
+// PostWriteHook is called after each successful write of a state, such as to
+// notify other systems of the change.
+type PostWriteHook func(StateWrite)
+
+// WithPostWriteHook makes the backend call hook after each successful write of
+// a state. The hook isn't called for writes which fail.
+//
+// The hook runs synchronously, after the state has been written and before
+// the write returns, so a slow hook holds up the operation, and the state is
+// still locked while it runs. Hooks which take time should hand the write off
+// to run in the background.
+func WithPostWriteHook(hook PostWriteHook) Option {
+	return func(b *Backend) {
+		b.postWriteHook = hook
+	}
+}
@@ -0,0 +1,52 @@
+package s3
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBackend_WithPostWriteHook(t *testing.T) {
+	storage := newMockS3Storage()
+	var writes []StateWrite
+	b := New(WithPostWriteHook(func(w StateWrite) {
+		writes = append(writes, w)
+	})).(*Backend)
+	b.s3Client = mockS3Client(t, storage.ServeHTTP)
+	b.bucketName = "bucket"
+	b.keyName = "state"
+	b.workspaceKeyPrefix = "env:"
+
+	client, err := b.remoteClient("dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := client.Put([]byte(`{"version": 4, "serial": 3, "lineage": "hook"}`)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(writes) != 1 {
+		t.Fatalf("expected the hook to be called once, got %d calls", len(writes))
+	}
+	w := writes[0]
+	if w.Workspace != "dev" || w.Bucket != "bucket" || w.Key != "env:/dev/state" || w.Serial != 3 {
+		t.Fatalf("unexpected write: %#v", w)
+	}
+	if etag := storage.objects["bucket/env:/dev/state"].header.Get("ETag"); w.ETag == "" || w.ETag != etag {
+		t.Fatalf("expected the ETag %s, got %q", etag, w.ETag)
+	}
+
+	// A failed write isn't reported.
+	b.s3Client = mockS3Client(t, func(w http.ResponseWriter, r *http.Request) {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+	})
+	client, err = b.remoteClient("dev")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := client.Put([]byte(`{"version": 4, "serial": 4, "lineage": "hook"}`)); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(writes) != 1 {
+		t.Fatalf("expected the hook not to be called for a failed write, got %d calls", len(writes))
+	}
+}